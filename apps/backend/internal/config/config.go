@@ -18,11 +18,19 @@ type Config struct {
 	Auth          AuthConfig           `koanf:"auth" validate:"required"`
 	Redis         RedisConfig          `koanf:"redis" validate:"required"`
 	Integration   IntegrationConfig    `koanf:"integration" validate:"required"`
+	Storage       StorageConfig        `koanf:"storage"`
 	Observability *ObservabilityConfig `koanf:"observability"`
 }
 
 type Primary struct {
 	Env string `koanf:"env" validate:"required"`
+	// AppURL is the public base URL of the frontend, used to build links in
+	// emails (e.g. https://app.example.com).
+	AppURL string `koanf:"app_url"`
+	// APIURL is the public base URL of this API, used for links in emails
+	// that point at the API itself, such as data export downloads. Defaults
+	// to AppURL, for deployments that serve the API under the same origin.
+	APIURL string `koanf:"api_url"`
 }
 
 type ServerConfig struct {
@@ -59,6 +67,24 @@ type AuthConfig struct {
 	PasswordResetTTL int `koanf:"password_reset_ttl"`
 	// DeletionDefaultTTL is the default TTL (in seconds) for scheduled deletions
 	DeletionDefaultTTL int `koanf:"deletion_default_ttl"`
+	// DeletionSweepSchedule is the cron spec on which users whose scheduled
+	// deletion is overdue are deleted, in case their deletion task was lost.
+	// Default: "@every 15m".
+	DeletionSweepSchedule string `koanf:"deletion_sweep_schedule"`
+	// RestoreWindow is how long (in seconds) after deletion an account can be
+	// restored from its escrow. Default: 1209600 (14 days); a negative value
+	// disables the escrow. Deleted users are not purged before it ends.
+	RestoreWindow int `koanf:"restore_window"`
+	// EscrowEncryptionKey encrypts the escrow of deleted accounts. Like
+	// MFAEncryptionKey it may hold several keys; falls back to Auth.SecretKey.
+	EscrowEncryptionKey string `koanf:"escrow_encryption_key"`
+	// PurgeRetention is how long (in seconds) a deleted user's row is kept
+	// before it is purged for good. Default: 2592000 (30 days). It is raised
+	// to RestoreWindow when shorter.
+	PurgeRetention int `koanf:"purge_retention"`
+	// PurgeSchedule is the cron spec on which deleted users past
+	// PurgeRetention are purged. Default: "@hourly".
+	PurgeSchedule string `koanf:"purge_schedule"`
 	// WebhookSigningSecret is the Svix/Clerk signing secret used to verify incoming webhooks
 	WebhookSigningSecret string `koanf:"webhook_signing_secret"`
 	// WebhookToleranceSec is the allowed clock skew in seconds for webhook timestamps
@@ -70,6 +96,161 @@ type AuthConfig struct {
 	// (used only for internal tooling/tests). For production, use a stronger auth
 	// mechanism or centralized secret management.
 	AdminToken string `koanf:"admin_token"`
+	// AccessTokenSecret signs the access tokens issued on local login. It may hold
+	// several secrets separated by ',' or '|': the first signs new tokens and all
+	// of them are accepted during verification. Falls back to Auth.SecretKey.
+	AccessTokenSecret string `koanf:"access_token_secret"`
+	// AccessTokenTTL is the lifetime (in seconds) of access tokens. Default: 900.
+	AccessTokenTTL int `koanf:"access_token_ttl"`
+	// RefreshTokenTTL is the lifetime (in seconds) of a login session and its
+	// refresh token. Default: 2592000 (30 days).
+	RefreshTokenTTL int `koanf:"refresh_token_ttl"`
+	// RequireEmailVerification rejects logins of local accounts whose email
+	// address has not been verified yet.
+	RequireEmailVerification bool `koanf:"require_email_verification"`
+	// EmailVerificationTTL is the lifetime (in seconds) of email verification
+	// tokens. Default: 86400 (24 hours).
+	EmailVerificationTTL int `koanf:"email_verification_ttl"`
+	// MagicLinkTTL is the lifetime (in seconds) of passwordless login links.
+	// Default: 900 (15 minutes).
+	MagicLinkTTL int `koanf:"magic_link_ttl"`
+	// MFAEncryptionKey encrypts TOTP secrets at rest. Like AccessTokenSecret it
+	// may hold several keys separated by ',' or '|'; the first encrypts and all
+	// are tried when decrypting. Falls back to Auth.SecretKey.
+	MFAEncryptionKey string `koanf:"mfa_encryption_key"`
+	// MFAIssuer is the issuer name shown in authenticator apps. Default: "Boilerplate".
+	MFAIssuer string `koanf:"mfa_issuer"`
+	// WebAuthnRPID is the relying party ID for passkeys, normally the site's
+	// registrable domain (e.g. example.com). Passkeys are disabled when empty.
+	WebAuthnRPID string `koanf:"webauthn_rp_id"`
+	// WebAuthnRPDisplayName is the name shown by the browser during passkey
+	// prompts. Defaults to Auth.MFAIssuer.
+	WebAuthnRPDisplayName string `koanf:"webauthn_rp_display_name"`
+	// WebAuthnRPOrigins lists the fully qualified origins allowed to use
+	// passkeys (e.g. https://app.example.com).
+	WebAuthnRPOrigins []string `koanf:"webauthn_rp_origins"`
+	// Lockout throttles repeated failed logins per email address and per IP.
+	Lockout LockoutConfig `koanf:"lockout"`
+	// PasswordPolicy is enforced whenever a local password is set.
+	PasswordPolicy PasswordPolicy `koanf:"password_policy"`
+	// PasswordHash selects how new passwords are hashed. Existing hashes are
+	// upgraded on the next successful login.
+	PasswordHash PasswordHashConfig `koanf:"password_hash"`
+	// OIDCProviders configures OpenID Connect identity providers for social
+	// login, keyed by the name used in the /auth/oidc/:provider routes.
+	OIDCProviders map[string]OIDCProvider `koanf:"oidc_providers"`
+	// DataExportTTL is how long (in seconds) a data export can be downloaded
+	// once ready. Default: 604800 (7 days).
+	DataExportTTL int `koanf:"data_export_ttl"`
+	// ImpersonationTTL is the lifetime (in seconds) of the sessions admins open
+	// as other users. Default: 900 (15 minutes).
+	ImpersonationTTL int `koanf:"impersonation_ttl"`
+	// RegistrationMode controls POST /auth/register: "open" (default),
+	// "invite_only" (an invitation code is required) or "closed".
+	RegistrationMode string `koanf:"registration_mode" validate:"omitempty,oneof=open invite_only closed"`
+	// Providers lists the authenticators RequireAuth tries, in order: "local"
+	// (access tokens issued on login and personal access tokens) and "clerk"
+	// (Clerk session tokens). Default: local,clerk.
+	Providers []string `koanf:"providers" validate:"omitempty,dive,oneof=local clerk"`
+}
+
+// Registration modes accepted by AuthConfig.RegistrationMode.
+const (
+	RegistrationOpen       = "open"
+	RegistrationInviteOnly = "invite_only"
+	RegistrationClosed     = "closed"
+)
+
+// StorageConfig selects where generated files, such as data exports, are
+// kept.
+type StorageConfig struct {
+	// Backend is "local" (default).
+	Backend string `koanf:"backend" validate:"omitempty,oneof=local"`
+	// LocalDir is the directory used by the local backend. Default: "data".
+	LocalDir string `koanf:"local_dir"`
+}
+
+// Storage backends accepted by StorageConfig.Backend.
+const StorageBackendLocal = "local"
+
+// Authentication providers accepted in AuthConfig.Providers.
+const (
+	AuthProviderLocal = "local"
+	AuthProviderClerk = "clerk"
+)
+
+// OIDCProvider describes a client registration with an OpenID Connect
+// identity provider.
+type OIDCProvider struct {
+	// Issuer is the provider's issuer URL; its metadata is discovered from
+	// <issuer>/.well-known/openid-configuration.
+	Issuer       string `koanf:"issuer"`
+	ClientID     string `koanf:"client_id"`
+	ClientSecret string `koanf:"client_secret"`
+	// RedirectURL is the frontend page the provider sends the user back to.
+	// It passes code and state on to POST /auth/oidc/:provider/callback.
+	RedirectURL string `koanf:"redirect_url"`
+	// Scopes defaults to openid, email and profile.
+	Scopes []string `koanf:"scopes"`
+}
+
+// PasswordHashConfig configures the password hasher. Zero values fall back to
+// the defaults in the auth service.
+type PasswordHashConfig struct {
+	// Algorithm is "argon2id" (default) or "bcrypt".
+	Algorithm string `koanf:"algorithm" validate:"omitempty,oneof=argon2id bcrypt"`
+	// Argon2Memory is the argon2id memory cost in KiB. Default: 19456.
+	Argon2Memory int `koanf:"argon2_memory"`
+	// Argon2Time is the number of argon2id passes. Default: 2.
+	Argon2Time int `koanf:"argon2_time"`
+	// Argon2Threads is the argon2id degree of parallelism. Default: 1.
+	Argon2Threads int `koanf:"argon2_threads"`
+	// BcryptCost is the bcrypt cost factor. Default: 10.
+	BcryptCost int `koanf:"bcrypt_cost"`
+}
+
+// PasswordPolicy configures which passwords are accepted on registration and
+// password reset. Zero values fall back to the defaults in the auth service.
+type PasswordPolicy struct {
+	// MinLength is the minimum length in characters. Default: 8.
+	MinLength int `koanf:"min_length"`
+	// MaxLength is the maximum length in characters. Default: 128.
+	MaxLength int `koanf:"max_length"`
+	// RequiredClasses lists the character classes a password must contain:
+	// upper, lower, digit and symbol. Default: upper, lower, digit. Use
+	// "none" to require none.
+	RequiredClasses []string `koanf:"required_classes" validate:"omitempty,dive,oneof=upper lower digit symbol none"`
+	// BannedWords may not appear anywhere in a password, ignoring case, e.g.
+	// the product name.
+	BannedWords []string `koanf:"banned_words"`
+	// DenylistFile is a local file of breached passwords, one per line.
+	DenylistFile string `koanf:"denylist_file" validate:"omitempty,file"`
+}
+
+// LockoutConfig configures login throttling. Failures are counted in Redis
+// over a sliding window; all durations are in seconds and zero values fall
+// back to the defaults in the auth service.
+type LockoutConfig struct {
+	// Window is the sliding window failures are counted in. Default: 900.
+	Window int `koanf:"window"`
+	// BackoffAfter is the number of failures after which further attempts for
+	// the same email must wait BackoffBase, doubling up to BackoffMax.
+	// Default: 3.
+	BackoffAfter int `koanf:"backoff_after"`
+	// BackoffBase is the first backoff delay. Default: 1.
+	BackoffBase int `koanf:"backoff_base"`
+	// BackoffMax caps the backoff delay. Default: 30.
+	BackoffMax int `koanf:"backoff_max"`
+	// MaxFailuresPerEmail locks an account for Duration once reached.
+	// Default: 10.
+	MaxFailuresPerEmail int `koanf:"max_failures_per_email"`
+	// MaxFailuresPerIP blocks a client IP for Duration once reached.
+	// Default: 100.
+	MaxFailuresPerIP int `koanf:"max_failures_per_ip"`
+	// Duration is how long a lockout lasts. Default: 900.
+	Duration int `koanf:"duration"`
+	// Disabled turns login throttling off entirely.
+	Disabled bool `koanf:"disabled"`
 }
 
 func LoadConfig() (*Config, error) {
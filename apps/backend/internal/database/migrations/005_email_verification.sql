@@ -0,0 +1,10 @@
+-- 005_email_verification.sql
+-- Single-use email verification tokens. Like password reset tokens they are
+-- stored only as HMAC digests.
+
+ALTER TABLE users
+  ADD COLUMN IF NOT EXISTS email_verification_token TEXT,
+  ADD COLUMN IF NOT EXISTS email_verification_expires TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS users_email_verification_token_idx ON users (email_verification_token)
+  WHERE email_verification_token IS NOT NULL;
@@ -0,0 +1,33 @@
+-- 006_mfa.sql
+-- TOTP multi-factor authentication for local password accounts. The TOTP
+-- secret is stored encrypted; recovery codes and login challenges are stored
+-- only as HMAC digests.
+
+ALTER TABLE users
+  ADD COLUMN IF NOT EXISTS mfa_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+  ADD COLUMN IF NOT EXISTS mfa_secret TEXT,
+  ADD COLUMN IF NOT EXISTS mfa_last_used_step BIGINT,
+  ADD COLUMN IF NOT EXISTS mfa_enabled_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  code_hash TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  used_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS mfa_recovery_codes_user_code_idx ON mfa_recovery_codes (user_id, code_hash);
+
+CREATE TABLE IF NOT EXISTS mfa_challenges (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  token_hash TEXT NOT NULL,
+  attempts INT NOT NULL DEFAULT 0,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  expires_at TIMESTAMPTZ NOT NULL,
+  consumed_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS mfa_challenges_token_hash_idx ON mfa_challenges (token_hash);
+CREATE INDEX IF NOT EXISTS mfa_challenges_user_id_idx ON mfa_challenges (user_id);
@@ -0,0 +1,15 @@
+-- 008_oidc_login.sql
+-- State of OpenID Connect logins in progress. Only the HMAC digest of the
+-- state parameter is stored; the PKCE verifier and nonce are needed once to
+-- redeem the authorization code and the row is deleted when the user returns.
+
+CREATE TABLE IF NOT EXISTS oidc_login_states (
+  state_hash TEXT PRIMARY KEY,
+  provider TEXT NOT NULL,
+  code_verifier TEXT NOT NULL,
+  nonce TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS oidc_login_states_expires_at_idx ON oidc_login_states (expires_at);
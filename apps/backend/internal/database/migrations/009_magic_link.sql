@@ -0,0 +1,9 @@
+-- 009_magic_link.sql
+-- Single-use passwordless login links. As with the other emailed tokens only
+-- the HMAC digest is stored; requesting a new link replaces the previous one.
+
+ALTER TABLE users
+  ADD COLUMN IF NOT EXISTS magic_link_token TEXT,
+  ADD COLUMN IF NOT EXISTS magic_link_expires TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS users_magic_link_token_idx ON users (magic_link_token) WHERE magic_link_token IS NOT NULL;
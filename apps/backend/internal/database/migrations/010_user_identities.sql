@@ -0,0 +1,35 @@
+-- 010_user_identities.sql
+-- External identities (Clerk, OpenID Connect providers) attached to a user.
+-- A row with linked_at NULL is a pending link: the identity's email matched
+-- an existing account but the provider did not verify it, so the owner has to
+-- confirm the link before it is used.
+
+CREATE TABLE IF NOT EXISTS user_identities (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  provider TEXT NOT NULL,
+  provider_user_id TEXT NOT NULL,
+  email TEXT,
+  email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+  linked_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  last_used_at TIMESTAMPTZ,
+  UNIQUE (provider, provider_user_id)
+);
+
+CREATE INDEX IF NOT EXISTS user_identities_user_id_idx ON user_identities (user_id);
+
+-- Empty identifiers were stored by earlier webhook syncs and collide on the
+-- unique indexes; treat them as missing.
+UPDATE users SET clerk_id = NULL WHERE clerk_id = '';
+UPDATE users SET external_id = NULL WHERE external_id = '';
+
+INSERT INTO user_identities (user_id, provider, provider_user_id, email, email_verified, linked_at)
+SELECT id, 'clerk', clerk_id, email, COALESCE(email_verified, FALSE), now()
+FROM users WHERE clerk_id IS NOT NULL
+ON CONFLICT (provider, provider_user_id) DO NOTHING;
+
+INSERT INTO user_identities (user_id, provider, provider_user_id, email, email_verified, linked_at)
+SELECT id, oauth_provider, oauth_provider_id, email, COALESCE(email_verified, FALSE), now()
+FROM users WHERE oauth_provider IS NOT NULL AND oauth_provider_id IS NOT NULL
+ON CONFLICT (provider, provider_user_id) DO NOTHING;
@@ -0,0 +1,28 @@
+-- 011_service_accounts.sql
+-- Non-human principals for machine-to-machine calls and the API keys issued
+-- to them. Keys are stored as HMAC digests; key_hint keeps the prefix and
+-- first characters so a key can be recognised in listings.
+
+CREATE TABLE IF NOT EXISTS service_accounts (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  name TEXT NOT NULL UNIQUE,
+  description TEXT,
+  created_by TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  disabled_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  service_account_id UUID NOT NULL REFERENCES service_accounts(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  key_hash TEXT NOT NULL UNIQUE,
+  key_hint TEXT NOT NULL,
+  scopes TEXT[] NOT NULL DEFAULT '{}',
+  expires_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  last_used_at TIMESTAMPTZ,
+  revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_service_account_id_idx ON api_keys (service_account_id);
@@ -0,0 +1,19 @@
+-- 012_personal_access_tokens.sql
+-- Long-lived tokens users mint for CLIs and scripts. Like API keys they are
+-- stored as HMAC digests; last_used_at/last_used_ip show where a token is in
+-- use so a leaked one can be spotted and revoked.
+
+CREATE TABLE IF NOT EXISTS personal_access_tokens (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  token_hash TEXT NOT NULL UNIQUE,
+  token_hint TEXT NOT NULL,
+  expires_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  last_used_at TIMESTAMPTZ,
+  last_used_ip TEXT,
+  revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS personal_access_tokens_user_id_idx ON personal_access_tokens (user_id);
@@ -0,0 +1,61 @@
+-- 013_rbac.sql
+-- Roles grant permissions ("<resource>:<action>", "<resource>:*" or "*") and
+-- are assigned to users. users.role is still honoured as one more role so
+-- roles synced from Clerk metadata keep working.
+
+CREATE TABLE IF NOT EXISTS roles (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  name TEXT NOT NULL UNIQUE,
+  description TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  name TEXT NOT NULL UNIQUE,
+  description TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+  role_id UUID NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+  permission_id UUID NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+  PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  role_id UUID NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+  assigned_by TEXT,
+  assigned_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (user_id, role_id)
+);
+
+CREATE INDEX IF NOT EXISTS user_roles_role_id_idx ON user_roles (role_id);
+
+INSERT INTO roles (name, description) VALUES
+  ('admin', 'Full access'),
+  ('support', 'Read users and lift lockouts'),
+  ('user', 'Regular user')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO permissions (name, description) VALUES
+  ('*', 'Every permission'),
+  ('admin:access', 'Use the admin API'),
+  ('users:read', 'View users and their roles'),
+  ('users:unlock', 'Lift login lockouts'),
+  ('users:delete', 'Delete users'),
+  ('roles:read', 'View roles and permissions'),
+  ('roles:assign', 'Assign and remove user roles'),
+  ('service_accounts:manage', 'Manage service accounts and their API keys')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r JOIN permissions p ON
+  (r.name = 'admin' AND p.name = '*') OR
+  (r.name = 'support' AND p.name IN ('admin:access', 'users:read', 'users:unlock', 'roles:read'))
+ON CONFLICT DO NOTHING;
+
+INSERT INTO user_roles (user_id, role_id, assigned_by)
+SELECT u.id, r.id, 'migration' FROM users u JOIN roles r ON r.name = u.role
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,30 @@
+-- 015_invitations.sql
+-- Invitation codes for invite-only registration. A code may be used
+-- max_uses times, may be bound to one email address and may grant a role to
+-- the users who register with it.
+
+CREATE TABLE IF NOT EXISTS invitations (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  code_hash TEXT NOT NULL UNIQUE,
+  code_hint TEXT NOT NULL,
+  email TEXT,
+  role_id UUID REFERENCES roles(id) ON DELETE SET NULL,
+  max_uses INTEGER NOT NULL DEFAULT 1 CHECK (max_uses > 0),
+  uses INTEGER NOT NULL DEFAULT 0,
+  expires_at TIMESTAMPTZ,
+  created_by TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  revoked_at TIMESTAMPTZ,
+  CHECK (uses <= max_uses)
+);
+
+CREATE TABLE IF NOT EXISTS invitation_redemptions (
+  invitation_id UUID NOT NULL REFERENCES invitations(id) ON DELETE CASCADE,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  redeemed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (invitation_id, user_id)
+);
+
+INSERT INTO permissions (name, description) VALUES
+  ('invitations:manage', 'Create and revoke registration invitations')
+ON CONFLICT (name) DO NOTHING;
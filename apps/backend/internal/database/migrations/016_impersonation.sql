@@ -0,0 +1,27 @@
+-- 016_impersonation.sql
+-- Admins with users:impersonate may open a short-lived session as another
+-- user. Such sessions record the admin in sessions.impersonator_id, and every
+-- start and stop is written to impersonation_events.
+
+ALTER TABLE sessions
+  ADD COLUMN IF NOT EXISTS impersonator_id TEXT;
+
+CREATE TABLE IF NOT EXISTS impersonation_events (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  session_id UUID NOT NULL,
+  actor_id TEXT NOT NULL,
+  target_user_id UUID NOT NULL,
+  action TEXT NOT NULL CHECK (action IN ('start', 'stop')),
+  reason TEXT,
+  stopped_by TEXT,
+  ip_address TEXT,
+  user_agent TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS impersonation_events_target_user_id_idx ON impersonation_events (target_user_id);
+CREATE INDEX IF NOT EXISTS impersonation_events_actor_id_idx ON impersonation_events (actor_id);
+
+INSERT INTO permissions (name, description) VALUES
+  ('users:impersonate', 'Open a session as another user')
+ON CONFLICT (name) DO NOTHING;
@@ -0,0 +1,22 @@
+-- 017_login_events.sql
+-- Login history: one row per successful or failed sign-in attempt. user_id is
+-- NULL for attempts against unknown addresses. device_id is a fingerprint of
+-- the user agent used to spot sign-ins from new devices.
+
+CREATE TABLE IF NOT EXISTS login_events (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+  email TEXT,
+  success BOOLEAN NOT NULL,
+  method TEXT NOT NULL,
+  failure_reason TEXT,
+  ip_address TEXT,
+  user_agent TEXT,
+  device_id TEXT,
+  request_id TEXT,
+  new_device BOOLEAN NOT NULL DEFAULT false,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS login_events_user_id_created_at_idx ON login_events (user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS login_events_created_at_idx ON login_events (created_at DESC);
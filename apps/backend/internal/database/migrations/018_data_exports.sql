@@ -0,0 +1,20 @@
+-- 018_data_exports.sql
+-- "Download my data" requests. The archive is built by the user:export task,
+-- kept in file storage under storage_key and downloadable through a signed
+-- link until expires_at. Only the latest archive of a user is kept.
+
+CREATE TABLE IF NOT EXISTS data_exports (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'ready', 'failed', 'expired')),
+  storage_key TEXT,
+  size_bytes BIGINT,
+  error TEXT,
+  requested_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  completed_at TIMESTAMPTZ,
+  expires_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS data_exports_user_id_idx ON data_exports (user_id, requested_at DESC);
+-- At most one export per user is in progress.
+CREATE UNIQUE INDEX IF NOT EXISTS data_exports_pending_idx ON data_exports (user_id) WHERE status = 'pending';
@@ -0,0 +1,11 @@
+-- 019_user_tombstones.sql
+-- Users soft-deleted longer than the purge retention are removed for good.
+-- A tombstone records only that the account existed and when it went away.
+
+CREATE TABLE IF NOT EXISTS user_tombstones (
+  user_id UUID PRIMARY KEY,
+  deleted_at TIMESTAMPTZ NOT NULL,
+  purged_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS users_deleted_at_idx ON users (deleted_at) WHERE deleted_at IS NOT NULL;
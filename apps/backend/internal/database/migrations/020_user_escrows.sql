@@ -0,0 +1,24 @@
+-- 020_user_escrows.sql
+-- When an account is deleted its email, credentials and profile are sealed
+-- into an escrow row before they are cleared from users, so the account can
+-- be restored within the recovery window. email_digest (an HMAC of the
+-- address) lets the owner ask for a restore link without the address being
+-- stored in clear; restore_token holds the digest of that link's token.
+
+CREATE TABLE IF NOT EXISTS user_escrows (
+  user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+  sealed TEXT NOT NULL,
+  email_digest TEXT,
+  restore_token TEXT,
+  restore_token_expires TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS user_escrows_email_digest_idx ON user_escrows (email_digest) WHERE email_digest IS NOT NULL;
+CREATE INDEX IF NOT EXISTS user_escrows_restore_token_idx ON user_escrows (restore_token) WHERE restore_token IS NOT NULL;
+CREATE INDEX IF NOT EXISTS user_escrows_expires_at_idx ON user_escrows (expires_at);
+
+INSERT INTO permissions (name, description) VALUES
+  ('users:restore', 'Restore deleted accounts')
+ON CONFLICT (name) DO NOTHING;
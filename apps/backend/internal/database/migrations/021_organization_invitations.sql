@@ -0,0 +1,22 @@
+-- 021_organization_invitations.sql
+-- Invitation codes can also invite an existing user into an organization.
+-- Organization admins create them and the invitee joins by redeeming the
+-- code, so nobody is added to an organization without consenting. Such
+-- invitations carry an organization role instead of a global role and cannot
+-- be used to register.
+
+ALTER TABLE invitations
+  ADD COLUMN IF NOT EXISTS organization_id UUID REFERENCES organizations(id) ON DELETE CASCADE,
+  ADD COLUMN IF NOT EXISTS organization_role TEXT;
+
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'invitations_organization_check') THEN
+    ALTER TABLE invitations ADD CONSTRAINT invitations_organization_check CHECK (
+      (organization_id IS NULL AND organization_role IS NULL) OR
+      (organization_id IS NOT NULL AND organization_role IS NOT NULL AND role_id IS NULL)
+    );
+  END IF;
+END$$;
+
+CREATE INDEX IF NOT EXISTS invitations_organization_id_idx ON invitations (organization_id) WHERE organization_id IS NOT NULL;
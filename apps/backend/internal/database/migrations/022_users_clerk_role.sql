@@ -0,0 +1,8 @@
+-- 022_users_clerk_role.sql
+-- clerk_role is the role Clerk last reported in public_metadata.role. Syncs
+-- only copy it into users.role when it changes, so a role removed through
+-- the API is not restored by the next webhook for the same metadata.
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS clerk_role TEXT;
+
+UPDATE users SET clerk_role = role WHERE clerk_id IS NOT NULL AND clerk_role IS NULL;
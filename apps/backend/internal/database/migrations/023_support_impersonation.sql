@@ -0,0 +1,9 @@
+-- 023_support_impersonation.sql
+-- Support staff reproduce user issues through impersonation, so the support
+-- role gets users:impersonate. StartImpersonation still refuses targets
+-- holding permissions the actor lacks, such as admins.
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r JOIN permissions p ON
+  r.name = 'support' AND p.name = 'users:impersonate'
+ON CONFLICT DO NOTHING;
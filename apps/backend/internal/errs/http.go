@@ -13,6 +13,9 @@ type ActionType string
 
 const (
 	ActionTypeRedirect ActionType = "redirect"
+	// ActionTypeReauthenticate asks the client to re-confirm the user's identity
+	// (password, MFA or Clerk reverification) and retry the request.
+	ActionTypeReauthenticate ActionType = "reauthenticate"
 )
 
 type Action struct {
@@ -30,6 +33,9 @@ type HTTPError struct {
 	Errors []FieldError `json:"errors"`
 	// action to be taken
 	Action *Action `json:"action"`
+	// RetryAfter is the number of seconds the client should wait before
+	// retrying; it is also sent as the Retry-After header.
+	RetryAfter int `json:"retry_after,omitempty"`
 }
 
 func (e *HTTPError) Error() string {
@@ -44,12 +50,13 @@ func (e *HTTPError) Is(target error) bool {
 
 func (e *HTTPError) WithMessage(message string) *HTTPError {
 	return &HTTPError{
-		Code:     e.Code,
-		Message:  message,
-		Status:   e.Status,
-		Override: e.Override,
-		Errors:   e.Errors,
-		Action:   e.Action,
+		Code:       e.Code,
+		Message:    message,
+		Status:     e.Status,
+		Override:   e.Override,
+		Errors:     e.Errors,
+		Action:     e.Action,
+		RetryAfter: e.RetryAfter,
 	}
 }
 
@@ -2,6 +2,8 @@ package errs
 
 import (
 	"net/http"
+	"strconv"
+	"time"
 )
 
 func NewUnauthorizedError(message string, override bool) *HTTPError {
@@ -22,6 +24,41 @@ func NewForbiddenError(message string, override bool) *HTTPError {
 	}
 }
 
+// NewReauthenticationRequiredError is returned when an operation needs a login
+// or re-confirmation more recent than maxAge. Action.Value carries maxAge in
+// seconds so the client can tell the user how fresh the confirmation must be.
+func NewReauthenticationRequiredError(message string, maxAge time.Duration) *HTTPError {
+	return &HTTPError{
+		Code:     "REAUTHENTICATION_REQUIRED",
+		Message:  message,
+		Status:   http.StatusForbidden,
+		Override: false,
+		Action: &Action{
+			Type:    ActionTypeReauthenticate,
+			Message: "Please confirm your identity to continue",
+			Value:   strconv.FormatInt(int64(maxAge.Seconds()), 10),
+		},
+	}
+}
+
+// NewTooManyRequestsError is returned when a client is being throttled. The
+// wait is rounded up to whole seconds so a client honouring it is never early.
+func NewTooManyRequestsError(message string, override bool, code *string, retryAfter time.Duration) *HTTPError {
+	formattedCode := MakeUpperCaseWithUnderscores(http.StatusText(http.StatusTooManyRequests))
+
+	if code != nil {
+		formattedCode = *code
+	}
+
+	return &HTTPError{
+		Code:       formattedCode,
+		Message:    message,
+		Status:     http.StatusTooManyRequests,
+		Override:   override,
+		RetryAfter: int((retryAfter + time.Second - 1) / time.Second),
+	}
+}
+
 func NewBadRequestError(message string, override bool, code *string, errors []FieldError, action *Action) *HTTPError {
 	formattedCode := MakeUpperCaseWithUnderscores(http.StatusText(http.StatusBadRequest))
 
@@ -2,6 +2,8 @@ package handler
 
 import (
 	"crypto/subtle"
+	"database/sql"
+	"errors"
 	"net/http"
 	"strings"
 
@@ -56,3 +58,18 @@ func (h *AdminHandler) RotateSecrets(c echo.Context) error {
 	logger.Info().Str("actor", "admin_api").Msg("admin rotated token HMAC secrets and persisted to config (masked preview logged by service)")
 	return c.NoContent(http.StatusOK)
 }
+
+// UnlockUser lifts a login lockout or backoff on the user's account.
+func (h *AdminHandler) UnlockUser(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "admin_unlock_user").Logger()
+	userID := c.Param("id")
+	if err := h.services.Auth.UnlockAccount(c.Request().Context(), userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "user not found")
+		}
+		logger.Error().Err(err).Str("user_id", userID).Msg("failed to unlock user")
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to unlock user")
+	}
+	logger.Info().Str("user_id", userID).Str("actor", middleware.GetUserID(c)).Msg("admin unlocked user")
+	return c.NoContent(http.StatusNoContent)
+}
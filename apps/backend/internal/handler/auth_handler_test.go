@@ -48,7 +48,7 @@ func TestRequestPasswordReset_ProdDoesNotReturnToken(t *testing.T) {
 	require.NoError(t, err)
 	authSvc := services.Auth
 	email := "prod@example.com"
-	userID, err := authSvc.RegisterUser(context.Background(), email, "password123")
+	userID, err := authSvc.RegisterUser(context.Background(), email, "Password123", "")
 	require.NoError(t, err)
 	require.NotEmpty(t, userID)
 
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/petonlabs/go-boilerplate/internal/errs"
 	"github.com/petonlabs/go-boilerplate/internal/lib/job"
 	"github.com/petonlabs/go-boilerplate/internal/middleware"
 	"github.com/petonlabs/go-boilerplate/internal/server"
@@ -22,8 +23,9 @@ func NewAuthHandler(s *server.Server, services *service.Services) *AuthHandler {
 }
 
 type registerReq struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email          string `json:"email"`
+	Password       string `json:"password"`
+	InvitationCode string `json:"invitation_code"`
 }
 
 func (h *AuthHandler) Register(c echo.Context) error {
@@ -33,8 +35,21 @@ func (h *AuthHandler) Register(c echo.Context) error {
 		logger.Error().Err(err).Msg("invalid register payload")
 		return c.NoContent(http.StatusBadRequest)
 	}
-	id, err := h.services.Auth.RegisterUser(c.Request().Context(), req.Email, req.Password)
+	id, err := h.services.Auth.RegisterUser(c.Request().Context(), req.Email, req.Password, req.InvitationCode)
 	if err != nil {
+		var weak *service.PasswordPolicyError
+		if errors.As(err, &weak) {
+			return errs.NewBadRequestError("Password does not meet the requirements", true, nil, weak.FieldErrors("password"), nil)
+		}
+		switch {
+		case errors.Is(err, service.ErrRegistrationClosed):
+			return errs.NewForbiddenError("Registration is closed", true)
+		case errors.Is(err, service.ErrInvitationRequired):
+			return errs.NewForbiddenError("An invitation code is required", true)
+		case errors.Is(err, service.ErrInvalidInvitation):
+			logger.Info().Msg("registration with invalid invitation code")
+			return errs.NewForbiddenError("Invalid invitation code", true)
+		}
 		logger.Error().Err(err).Msg("failed to register user")
 		return c.NoContent(http.StatusInternalServerError)
 	}
@@ -53,12 +68,176 @@ func (h *AuthHandler) Login(c echo.Context) error {
 		logger.Error().Err(err).Msg("invalid login payload")
 		return c.NoContent(http.StatusBadRequest)
 	}
-	id, err := h.services.Auth.Login(c.Request().Context(), req.Email, req.Password)
+	session, err := h.services.Auth.Login(c.Request().Context(), req.Email, req.Password, sessionMeta(c))
+	if err != nil {
+		var mfaErr *service.MFARequiredError
+		if errors.As(err, &mfaErr) {
+			return c.JSON(http.StatusOK, mfaErr.Challenge)
+		}
+		if errors.Is(err, service.ErrInvalidCredentials) {
+			logger.Info().Err(err).Msg("authentication failed")
+			return c.NoContent(http.StatusUnauthorized)
+		}
+		var throttled *service.LoginThrottledError
+		if errors.As(err, &throttled) {
+			logger.Warn().Dur("retry_after", throttled.RetryAfter).Msg("login throttled")
+			return errs.NewTooManyRequestsError("Too many failed login attempts, please try again later", true, nil, throttled.RetryAfter)
+		}
+		if errors.Is(err, service.ErrEmailNotVerified) {
+			logger.Info().Err(err).Msg("login blocked until email is verified")
+			return errs.NewForbiddenError("Please verify your email address before logging in", true)
+		}
+		logger.Error().Err(err).Msg("failed to issue session")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return c.JSON(http.StatusOK, session)
+}
+
+type refreshReq struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RefreshSession exchanges a refresh token for a fresh access token and a rotated refresh token
+func (h *AuthHandler) RefreshSession(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "refresh_session").Logger()
+	var req refreshReq
+	if err := c.Bind(&req); err != nil {
+		logger.Error().Err(err).Msg("invalid refresh payload")
+		return c.NoContent(http.StatusBadRequest)
+	}
+	session, err := h.services.Auth.RefreshSession(c.Request().Context(), req.RefreshToken, sessionMeta(c))
 	if err != nil {
-		logger.Info().Err(err).Msg("authentication failed")
-		return c.NoContent(http.StatusUnauthorized)
+		if errors.Is(err, service.ErrInvalidRefreshToken) {
+			logger.Info().Err(err).Msg("refresh rejected")
+			return c.NoContent(http.StatusUnauthorized)
+		}
+		logger.Error().Err(err).Msg("failed to refresh session")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return c.JSON(http.StatusOK, session)
+}
+
+// Logout revokes the session bound to the given refresh token
+func (h *AuthHandler) Logout(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "logout").Logger()
+	var req refreshReq
+	if err := c.Bind(&req); err != nil {
+		logger.Error().Err(err).Msg("invalid logout payload")
+		return c.NoContent(http.StatusBadRequest)
 	}
-	return c.JSON(http.StatusOK, map[string]string{"id": id})
+	if err := h.services.Auth.RevokeSession(c.Request().Context(), req.RefreshToken); err != nil {
+		logger.Error().Err(err).Msg("failed to revoke session")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+type reauthReq struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// Reauthenticate re-confirms the caller's password, or an MFA code when one is
+// given, so that endpoints guarded by RequireRecentAuth accept the current
+// session again.
+func (h *AuthHandler) Reauthenticate(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "reauthenticate").Logger()
+	var req reauthReq
+	if err := c.Bind(&req); err != nil {
+		logger.Error().Err(err).Msg("invalid reauth payload")
+		return c.NoContent(http.StatusBadRequest)
+	}
+	sessionID, _ := c.Get(middleware.SessionIDKey).(string)
+	var err error
+	if req.Code != "" {
+		err = h.services.Auth.ConfirmMFA(c.Request().Context(), middleware.GetUserID(c), sessionID, req.Code, sessionMeta(c))
+	} else {
+		err = h.services.Auth.ConfirmPassword(c.Request().Context(), middleware.GetUserID(c), sessionID, req.Password, sessionMeta(c))
+	}
+	if err != nil {
+		var throttled *service.LoginThrottledError
+		if errors.As(err, &throttled) {
+			logger.Warn().Dur("retry_after", throttled.RetryAfter).Msg("re-authentication throttled")
+			return errs.NewTooManyRequestsError("Too many failed attempts, please try again later", true, nil, throttled.RetryAfter)
+		}
+		if errors.Is(err, service.ErrInvalidCredentials) || errors.Is(err, service.ErrInvalidMFACode) || errors.Is(err, service.ErrMFANotEnabled) {
+			logger.Info().Err(err).Msg("re-authentication failed")
+			return c.NoContent(http.StatusUnauthorized)
+		}
+		if errors.Is(err, service.ErrUserNotFound) {
+			return c.NoContent(http.StatusNotFound)
+		}
+		if errors.Is(err, service.ErrNoLocalPassword) {
+			logger.Info().Err(err).Msg("re-authentication rejected")
+			return c.NoContent(http.StatusConflict)
+		}
+		logger.Error().Err(err).Msg("failed to record re-authentication")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// sessionMeta captures the client details recorded on sessions and in the
+// login history.
+func sessionMeta(c echo.Context) service.SessionMeta {
+	return service.SessionMeta{
+		UserAgent: c.Request().UserAgent(),
+		IPAddress: c.RealIP(),
+		RequestID: middleware.GetRequestID(c),
+	}
+}
+
+type verifyEmailReq struct {
+	Token string `json:"token"`
+}
+
+// VerifyEmail consumes an email verification token and marks the address as verified
+func (h *AuthHandler) VerifyEmail(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "verify_email").Logger()
+	var req verifyEmailReq
+	if err := c.Bind(&req); err != nil {
+		logger.Error().Err(err).Msg("invalid payload")
+		return c.NoContent(http.StatusBadRequest)
+	}
+	if err := h.services.Auth.VerifyEmail(c.Request().Context(), req.Token); err != nil {
+		if errors.Is(err, service.ErrInvalidEmailVerificationToken) || errors.Is(err, service.ErrExpiredEmailVerificationToken) {
+			logger.Info().Err(err).Msg("email verification rejected")
+			return c.NoContent(http.StatusBadRequest)
+		}
+		logger.Error().Err(err).Msg("failed to verify email")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+type resendVerificationReq struct {
+	Email string `json:"email"`
+}
+
+// ResendVerification sends a fresh verification email to an unverified account
+func (h *AuthHandler) ResendVerification(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "resend_verification").Logger()
+	var req resendVerificationReq
+	if err := c.Bind(&req); err != nil {
+		logger.Error().Err(err).Msg("invalid payload")
+		return c.NoContent(http.StatusBadRequest)
+	}
+	token, err := h.services.Auth.RequestEmailVerification(c.Request().Context(), req.Email)
+	if err != nil {
+		// Unknown and already verified addresses look the same as success to avoid user enumeration.
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.NoContent(http.StatusNoContent)
+		}
+		logger.Error().Err(err).Msg("failed to create email verification token")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	// As with password reset, the token is only echoed back outside production.
+	if h.server != nil {
+		if cfg := h.server.GetConfig(); cfg != nil && (cfg.Primary.Env == "development" || cfg.Primary.Env == "test") {
+			return c.JSON(http.StatusOK, map[string]string{"token": token})
+		}
+	}
+	return c.NoContent(http.StatusNoContent)
 }
 
 type pwResetReq struct {
@@ -123,64 +302,11 @@ func (h *AuthHandler) ResetPassword(c echo.Context) error {
 		return c.NoContent(http.StatusBadRequest)
 	}
 	if err := h.services.Auth.ResetPassword(c.Request().Context(), req.Token, req.NewPassword); err != nil {
-		logger.Error().Err(err).Msg("failed to reset password")
-		return c.NoContent(http.StatusInternalServerError)
-	}
-	return c.NoContent(http.StatusOK)
-}
-
-type deletionReq struct {
-	UserID  string `json:"user_id"`
-	Seconds int64  `json:"seconds"` // optional override in seconds
-}
-
-func (h *AuthHandler) ScheduleDeletion(c echo.Context) error {
-	logger := middleware.GetLogger(c).With().Str("operation", "schedule_deletion").Logger()
-	var req deletionReq
-	if err := c.Bind(&req); err != nil {
-		logger.Error().Err(err).Msg("invalid payload")
-		return c.NoContent(http.StatusBadRequest)
-	}
-	// Default TTL from config (in seconds)
-	ttl := 0
-	if h.server != nil {
-		if cfg := h.server.GetConfig(); cfg != nil {
-			ttl = cfg.Auth.DeletionDefaultTTL
-		}
-	}
-	// If user provided seconds override, use it
-	if req.Seconds > 0 {
-		// Safely convert int64 -> int taking platform bounds into account.
-		// On 32-bit platforms int may be 32 bits so an unchecked cast can overflow.
-		maxInt := int(^uint(0) >> 1)
-		if req.Seconds > int64(maxInt) {
-			logger.Warn().Int64("seconds", req.Seconds).Msg("seconds value too large; clamping to max int")
-			ttl = maxInt
-		} else {
-			ttl = int(req.Seconds)
+		var weak *service.PasswordPolicyError
+		if errors.As(err, &weak) {
+			return errs.NewBadRequestError("Password does not meet the requirements", true, nil, weak.FieldErrors("new_password"), nil)
 		}
-	}
-	if err := h.services.Auth.ScheduleDeletion(c.Request().Context(), req.UserID, time.Duration(ttl)*time.Second); err != nil {
-		logger.Error().Err(err).Msg("failed to schedule deletion")
-		return c.NoContent(http.StatusInternalServerError)
-	}
-	return c.NoContent(http.StatusOK)
-}
-
-type cancelReq struct {
-	UserID string `json:"user_id"`
-}
-
-// CancelDeletion clears deletion_scheduled_at to interrupt a scheduled deletion
-func (h *AuthHandler) CancelDeletion(c echo.Context) error {
-	logger := middleware.GetLogger(c).With().Str("operation", "cancel_deletion").Logger()
-	var req cancelReq
-	if err := c.Bind(&req); err != nil {
-		logger.Error().Err(err).Msg("invalid payload")
-		return c.NoContent(http.StatusBadRequest)
-	}
-	if err := h.services.Auth.CancelDeletion(c.Request().Context(), req.UserID); err != nil {
-		logger.Error().Err(err).Msg("failed to cancel deletion")
+		logger.Error().Err(err).Msg("failed to reset password")
 		return c.NoContent(http.StatusInternalServerError)
 	}
 	return c.NoContent(http.StatusOK)
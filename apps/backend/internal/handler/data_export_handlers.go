@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/petonlabs/go-boilerplate/internal/middleware"
+	"github.com/petonlabs/go-boilerplate/internal/service"
+)
+
+// RequestDataExport queues an export of the caller's data; a download link is
+// emailed when it is ready
+func (h *AuthHandler) RequestDataExport(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "request_data_export").Logger()
+	userID := middleware.GetUserID(c)
+	export, err := h.services.Auth.RequestDataExport(c.Request().Context(), userID)
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			return c.NoContent(http.StatusNotFound)
+		}
+		logger.Error().Err(err).Msg("failed to request data export")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	logger.Info().Str("user_id", userID).Str("export_id", export.ID).Msg("data export requested")
+	return c.JSON(http.StatusAccepted, export)
+}
+
+// ListDataExports returns the caller's data export requests
+func (h *AuthHandler) ListDataExports(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "list_data_exports").Logger()
+	exports, err := h.services.Auth.ListDataExports(c.Request().Context(), middleware.GetUserID(c))
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to list data exports")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return c.JSON(http.StatusOK, exports)
+}
+
+// DownloadDataExport serves an export archive from a signed download link
+func (h *AuthHandler) DownloadDataExport(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "download_data_export").Logger()
+	expires, err := strconv.ParseInt(c.QueryParam("expires"), 10, 64)
+	if err != nil || c.QueryParam("signature") == "" {
+		return c.NoContent(http.StatusBadRequest)
+	}
+	archive, err := h.services.Auth.DownloadDataExport(c.Request().Context(), c.Param("id"), expires, c.QueryParam("signature"))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidDownloadLink) {
+			return c.NoContent(http.StatusNotFound)
+		}
+		logger.Error().Err(err).Msg("failed to download data export")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	c.Response().Header().Set("Content-Disposition", "attachment; filename=data-export.zip")
+	c.Response().Header().Set("Cache-Control", "no-store")
+	defer func() { _ = archive.Close() }()
+	return c.Stream(http.StatusOK, "application/zip", archive)
+}
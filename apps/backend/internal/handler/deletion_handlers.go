@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/petonlabs/go-boilerplate/internal/middleware"
+	"github.com/petonlabs/go-boilerplate/internal/service"
+)
+
+// GetDeletion returns when the caller's account is due to be deleted
+func (h *AuthHandler) GetDeletion(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "get_deletion").Logger()
+	status, err := h.services.Auth.DeletionStatus(c.Request().Context(), middleware.GetUserID(c))
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			return c.NoContent(http.StatusNotFound)
+		}
+		logger.Error().Err(err).Msg("failed to load deletion status")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return c.JSON(http.StatusOK, status)
+}
+
+// ScheduleDeletion schedules deletion of the caller's account after the grace period
+func (h *AuthHandler) ScheduleDeletion(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "schedule_deletion").Logger()
+	userID := middleware.GetUserID(c)
+	when, err := h.services.Auth.ScheduleDeletion(c.Request().Context(), userID, 0)
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			return c.NoContent(http.StatusNotFound)
+		}
+		logger.Error().Err(err).Msg("failed to schedule deletion")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	logger.Info().Str("user_id", userID).Time("scheduled_at", when).Msg("account deletion scheduled")
+	return c.JSON(http.StatusAccepted, service.DeletionStatus{ScheduledAt: &when})
+}
+
+// CancelDeletion cancels the scheduled deletion of the caller's account
+func (h *AuthHandler) CancelDeletion(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "cancel_deletion").Logger()
+	userID := middleware.GetUserID(c)
+	if err := h.services.Auth.CancelDeletion(c.Request().Context(), userID); err != nil {
+		switch {
+		case errors.Is(err, service.ErrUserNotFound):
+			return c.NoContent(http.StatusNotFound)
+		case errors.Is(err, service.ErrDeletionNotScheduled):
+			return c.NoContent(http.StatusConflict)
+		}
+		logger.Error().Err(err).Msg("failed to cancel deletion")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	logger.Info().Str("user_id", userID).Msg("account deletion cancelled")
+	return c.NoContent(http.StatusNoContent)
+}
+
+type userDeletionReq struct {
+	// Seconds overrides the grace period.
+	Seconds int64 `json:"seconds"`
+}
+
+// ScheduleUserDeletion schedules deletion of a user's account
+func (h *AdminHandler) ScheduleUserDeletion(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "admin_schedule_user_deletion").Logger()
+	var req userDeletionReq
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid payload")
+	}
+	if req.Seconds < 0 || req.Seconds > int64(100*365*24*time.Hour/time.Second) {
+		return echo.NewHTTPError(http.StatusBadRequest, "seconds is out of range")
+	}
+	userID := c.Param("id")
+	when, err := h.services.Auth.ScheduleDeletion(c.Request().Context(), userID, time.Duration(req.Seconds)*time.Second)
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "user not found")
+		}
+		logger.Error().Err(err).Str("user_id", userID).Msg("failed to schedule user deletion")
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to schedule user deletion")
+	}
+	logger.Info().Str("user_id", userID).Time("scheduled_at", when).Str("actor", middleware.GetUserID(c)).Msg("admin scheduled user deletion")
+	return c.JSON(http.StatusAccepted, service.DeletionStatus{ScheduledAt: &when})
+}
+
+// CancelUserDeletion cancels the scheduled deletion of a user's account
+func (h *AdminHandler) CancelUserDeletion(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "admin_cancel_user_deletion").Logger()
+	userID := c.Param("id")
+	if err := h.services.Auth.CancelDeletion(c.Request().Context(), userID); err != nil {
+		switch {
+		case errors.Is(err, service.ErrUserNotFound):
+			return echo.NewHTTPError(http.StatusNotFound, "user not found")
+		case errors.Is(err, service.ErrDeletionNotScheduled):
+			return echo.NewHTTPError(http.StatusConflict, "deletion is not scheduled")
+		}
+		logger.Error().Err(err).Str("user_id", userID).Msg("failed to cancel user deletion")
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to cancel user deletion")
+	}
+	logger.Info().Str("user_id", userID).Str("actor", middleware.GetUserID(c)).Msg("admin cancelled user deletion")
+	return c.NoContent(http.StatusNoContent)
+}
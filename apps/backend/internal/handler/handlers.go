@@ -6,21 +6,23 @@ import (
 )
 
 type Handlers struct {
-	Health  *HealthHandler
-	OpenAPI *OpenAPIHandler
-	Dspy    *DspyHandler
-	Webhook *WebhookHandler
-	Auth    *AuthHandler
-	Admin   *AdminHandler
+	Health        *HealthHandler
+	OpenAPI       *OpenAPIHandler
+	Dspy          *DspyHandler
+	Webhook       *WebhookHandler
+	Auth          *AuthHandler
+	Admin         *AdminHandler
+	Organizations *OrganizationHandler
 }
 
 func NewHandlers(s *server.Server, services *service.Services) *Handlers {
 	return &Handlers{
-		Health:  NewHealthHandler(s, services),
-		OpenAPI: NewOpenAPIHandler(s, services),
-		Dspy:    NewDspyHandler(s, services),
-		Webhook: NewWebhookHandler(s, services),
-		Auth:    NewAuthHandler(s, services),
-		Admin:   NewAdminHandler(s, services),
+		Health:        NewHealthHandler(s, services),
+		OpenAPI:       NewOpenAPIHandler(s, services),
+		Dspy:          NewDspyHandler(s, services),
+		Webhook:       NewWebhookHandler(s, services),
+		Auth:          NewAuthHandler(s, services),
+		Admin:         NewAdminHandler(s, services),
+		Organizations: NewOrganizationHandler(s, services),
 	}
 }
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/petonlabs/go-boilerplate/internal/middleware"
+	"github.com/petonlabs/go-boilerplate/internal/service"
+)
+
+// ListIdentities returns the external identities linked to the caller,
+// including links waiting for confirmation
+func (h *AuthHandler) ListIdentities(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "list_identities").Logger()
+	identities, err := h.services.Auth.ListIdentities(c.Request().Context(), middleware.GetUserID(c))
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to list identities")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return c.JSON(http.StatusOK, identities)
+}
+
+// ConfirmIdentity links a pending identity to the caller
+func (h *AuthHandler) ConfirmIdentity(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "confirm_identity").Logger()
+	if err := h.services.Auth.ConfirmIdentity(c.Request().Context(), middleware.GetUserID(c), c.Param("id")); err != nil {
+		if errors.Is(err, service.ErrIdentityNotFound) {
+			return c.NoContent(http.StatusNotFound)
+		}
+		logger.Error().Err(err).Msg("failed to confirm identity")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// UnlinkIdentity removes a linked identity or rejects a pending one
+func (h *AuthHandler) UnlinkIdentity(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "unlink_identity").Logger()
+	if err := h.services.Auth.UnlinkIdentity(c.Request().Context(), middleware.GetUserID(c), c.Param("id")); err != nil {
+		switch {
+		case errors.Is(err, service.ErrIdentityNotFound):
+			return c.NoContent(http.StatusNotFound)
+		case errors.Is(err, service.ErrLastLoginMethod):
+			return c.NoContent(http.StatusConflict)
+		}
+		logger.Error().Err(err).Msg("failed to unlink identity")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/petonlabs/go-boilerplate/internal/middleware"
+	"github.com/petonlabs/go-boilerplate/internal/service"
+)
+
+type impersonateReq struct {
+	Reason string `json:"reason"`
+}
+
+// ImpersonateUser opens a short-lived session as another user. The reason is
+// kept in the impersonation audit trail.
+func (h *AdminHandler) ImpersonateUser(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "admin_impersonate_user").Logger()
+	targetID := c.Param("id")
+	var req impersonateReq
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid impersonation payload")
+	}
+	session, err := h.services.Auth.StartImpersonation(c.Request().Context(), middleware.GetUserID(c), targetID, req.Reason, sessionMeta(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrImpersonationReasonRequired):
+			return echo.NewHTTPError(http.StatusBadRequest, "reason is required")
+		case errors.Is(err, service.ErrUserNotFound):
+			return echo.NewHTTPError(http.StatusNotFound, "user not found")
+		case errors.Is(err, service.ErrCannotImpersonate):
+			return echo.NewHTTPError(http.StatusBadRequest, "cannot impersonate this user")
+		case errors.Is(err, service.ErrImpersonationNotAllowed):
+			return echo.NewHTTPError(http.StatusForbidden, "cannot impersonate a user with permissions you lack")
+		}
+		logger.Error().Err(err).Str("target_user_id", targetID).Msg("failed to start impersonation")
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to start impersonation")
+	}
+	logger.Warn().
+		Str("actor", middleware.GetUserID(c)).
+		Str("target_user_id", session.UserID).
+		Str("impersonation_session_id", session.ID).
+		Msg("admin started impersonation")
+	return c.JSON(http.StatusCreated, session)
+}
+
+// ListImpersonationEvents returns the impersonation audit trail, optionally
+// filtered by ?user_id=.
+func (h *AdminHandler) ListImpersonationEvents(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "admin_list_impersonation_events").Logger()
+	events, err := h.services.Auth.ListImpersonationEvents(c.Request().Context(), c.QueryParam("user_id"))
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to list impersonation events")
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to list impersonation events")
+	}
+	return c.JSON(http.StatusOK, events)
+}
+
+// EndImpersonation ends another admin's impersonation session.
+func (h *AdminHandler) EndImpersonation(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "admin_end_impersonation").Logger()
+	sessionID := c.Param("session_id")
+	if err := h.services.Auth.StopImpersonation(c.Request().Context(), sessionID, middleware.GetUserID(c), sessionMeta(c)); err != nil {
+		if errors.Is(err, service.ErrImpersonationSessionNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "impersonation session not found")
+		}
+		logger.Error().Err(err).Str("impersonation_session_id", sessionID).Msg("failed to end impersonation")
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to end impersonation")
+	}
+	logger.Info().Str("impersonation_session_id", sessionID).Str("actor", middleware.GetUserID(c)).Msg("admin ended impersonation")
+	return c.NoContent(http.StatusNoContent)
+}
+
+// StopImpersonation ends the impersonation session the request was made
+// with
+func (h *AuthHandler) StopImpersonation(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "stop_impersonation").Logger()
+	actorID := middleware.GetActorID(c)
+	sessionID, _ := c.Get(middleware.SessionIDKey).(string)
+	if actorID == "" || sessionID == "" {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if err := h.services.Auth.StopImpersonation(c.Request().Context(), sessionID, actorID, sessionMeta(c)); err != nil {
+		if errors.Is(err, service.ErrImpersonationSessionNotFound) {
+			return c.NoContent(http.StatusNotFound)
+		}
+		logger.Error().Err(err).Msg("failed to stop impersonation")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	logger.Info().Msg("impersonation stopped")
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/petonlabs/go-boilerplate/internal/middleware"
+	"github.com/petonlabs/go-boilerplate/internal/service"
+)
+
+type createInvitationReq struct {
+	Email     string     `json:"email"`
+	Role      string     `json:"role"`
+	MaxUses   int        `json:"max_uses"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreateInvitation mints a registration invitation. The code is only
+// returned in this response.
+func (h *AdminHandler) CreateInvitation(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "admin_create_invitation").Logger()
+	var req createInvitationReq
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid invitation payload")
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return echo.NewHTTPError(http.StatusBadRequest, "expires_at must be in the future")
+	}
+	inv, err := h.services.Auth.CreateInvitation(c.Request().Context(), service.InvitationParams{
+		Email:     req.Email,
+		Role:      req.Role,
+		MaxUses:   req.MaxUses,
+		ExpiresAt: req.ExpiresAt,
+		CreatedBy: middleware.GetUserID(c),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrRoleNotFound):
+			return echo.NewHTTPError(http.StatusBadRequest, "unknown role")
+		case errors.Is(err, service.ErrInvalidInvitationUses):
+			return echo.NewHTTPError(http.StatusBadRequest, "max_uses must be positive")
+		}
+		logger.Error().Err(err).Msg("failed to create invitation")
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to create invitation")
+	}
+	logger.Info().Str("invitation_id", inv.ID).Str("role", inv.Role).Int("max_uses", inv.MaxUses).Str("actor", middleware.GetUserID(c)).Msg("admin created invitation")
+	return c.JSON(http.StatusCreated, inv)
+}
+
+// ListInvitations returns all invitations.
+func (h *AdminHandler) ListInvitations(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "admin_list_invitations").Logger()
+	invitations, err := h.services.Auth.ListInvitations(c.Request().Context())
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to list invitations")
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to list invitations")
+	}
+	return c.JSON(http.StatusOK, invitations)
+}
+
+// RevokeInvitation stops an invitation from being redeemed.
+func (h *AdminHandler) RevokeInvitation(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "admin_revoke_invitation").Logger()
+	invitationID := c.Param("id")
+	if err := h.services.Auth.RevokeInvitation(c.Request().Context(), invitationID); err != nil {
+		if errors.Is(err, service.ErrInvitationNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "invitation not found")
+		}
+		logger.Error().Err(err).Str("invitation_id", invitationID).Msg("failed to revoke invitation")
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to revoke invitation")
+	}
+	logger.Info().Str("invitation_id", invitationID).Str("actor", middleware.GetUserID(c)).Msg("admin revoked invitation")
+	return c.NoContent(http.StatusNoContent)
+}
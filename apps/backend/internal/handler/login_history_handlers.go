@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/petonlabs/go-boilerplate/internal/middleware"
+	"github.com/petonlabs/go-boilerplate/internal/service"
+)
+
+// ListLogins returns the caller's recent successful and failed logins
+func (h *AuthHandler) ListLogins(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "list_logins").Logger()
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	events, err := h.services.Auth.ListLoginEvents(c.Request().Context(), service.LoginEventFilter{
+		UserID: middleware.GetUserID(c),
+		Limit:  limit,
+	})
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to list logins")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return c.JSON(http.StatusOK, events)
+}
+
+// ListLoginEvents queries the login history of all users. Supports the
+// user_id, email, ip, success and limit query parameters.
+func (h *AdminHandler) ListLoginEvents(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "admin_list_login_events").Logger()
+	filter := service.LoginEventFilter{
+		UserID:    c.QueryParam("user_id"),
+		Email:     c.QueryParam("email"),
+		IPAddress: c.QueryParam("ip"),
+	}
+	if raw := c.QueryParam("success"); raw != "" {
+		success, err := strconv.ParseBool(raw)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "success must be true or false")
+		}
+		filter.Success = &success
+	}
+	if raw := c.QueryParam("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "limit must be a positive number")
+		}
+		filter.Limit = limit
+	}
+	events, err := h.services.Auth.ListLoginEvents(c.Request().Context(), filter)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to list login events")
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to list login events")
+	}
+	return c.JSON(http.StatusOK, events)
+}
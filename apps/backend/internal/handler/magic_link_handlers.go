@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/petonlabs/go-boilerplate/internal/middleware"
+	"github.com/petonlabs/go-boilerplate/internal/service"
+)
+
+type magicLinkRequestReq struct {
+	Email string `json:"email"`
+}
+
+type magicLinkConsumeReq struct {
+	Token string `json:"token"`
+}
+
+// RequestMagicLink emails a passwordless login link
+func (h *AuthHandler) RequestMagicLink(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "request_magic_link").Logger()
+	var req magicLinkRequestReq
+	if err := c.Bind(&req); err != nil {
+		logger.Error().Err(err).Msg("invalid magic link payload")
+		return c.NoContent(http.StatusBadRequest)
+	}
+	token, err := h.services.Auth.RequestMagicLink(c.Request().Context(), req.Email)
+	if err != nil {
+		// Unknown addresses look the same as success to avoid user enumeration.
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.NoContent(http.StatusNoContent)
+		}
+		logger.Error().Err(err).Msg("failed to create magic link")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	// As with password reset, the token is only echoed back outside production.
+	if h.server != nil {
+		if cfg := h.server.GetConfig(); cfg != nil && (cfg.Primary.Env == "development" || cfg.Primary.Env == "test") {
+			return c.JSON(http.StatusOK, map[string]string{"token": token})
+		}
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ConsumeMagicLink redeems a login link and issues a session
+func (h *AuthHandler) ConsumeMagicLink(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "consume_magic_link").Logger()
+	var req magicLinkConsumeReq
+	if err := c.Bind(&req); err != nil {
+		logger.Error().Err(err).Msg("invalid magic link payload")
+		return c.NoContent(http.StatusBadRequest)
+	}
+	session, err := h.services.Auth.ConsumeMagicLink(c.Request().Context(), req.Token, sessionMeta(c))
+	if err != nil {
+		var mfaErr *service.MFARequiredError
+		if errors.As(err, &mfaErr) {
+			return c.JSON(http.StatusOK, mfaErr.Challenge)
+		}
+		if errors.Is(err, service.ErrInvalidMagicLink) {
+			logger.Info().Err(err).Msg("magic link rejected")
+			return c.NoContent(http.StatusUnauthorized)
+		}
+		logger.Error().Err(err).Msg("failed to consume magic link")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return c.JSON(http.StatusOK, session)
+}
@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/petonlabs/go-boilerplate/internal/errs"
+	"github.com/petonlabs/go-boilerplate/internal/middleware"
+	"github.com/petonlabs/go-boilerplate/internal/service"
+)
+
+type mfaLoginReq struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+// CompleteMFALogin exchanges the challenge returned by Login and a TOTP or recovery code for a session
+func (h *AuthHandler) CompleteMFALogin(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "complete_mfa_login").Logger()
+	var req mfaLoginReq
+	if err := c.Bind(&req); err != nil {
+		logger.Error().Err(err).Msg("invalid mfa login payload")
+		return c.NoContent(http.StatusBadRequest)
+	}
+	session, err := h.services.Auth.CompleteMFALogin(c.Request().Context(), req.MFAToken, req.Code, sessionMeta(c))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidMFAChallenge) || errors.Is(err, service.ErrInvalidMFACode) {
+			logger.Info().Err(err).Msg("mfa login rejected")
+			return c.NoContent(http.StatusUnauthorized)
+		}
+		var throttled *service.LoginThrottledError
+		if errors.As(err, &throttled) {
+			logger.Warn().Dur("retry_after", throttled.RetryAfter).Msg("mfa login throttled")
+			return errs.NewTooManyRequestsError("Too many failed login attempts, please try again later", true, nil, throttled.RetryAfter)
+		}
+		logger.Error().Err(err).Msg("failed to complete mfa login")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return c.JSON(http.StatusOK, session)
+}
+
+// EnrollTOTP starts TOTP enrollment and returns the secret to load into an authenticator app
+func (h *AuthHandler) EnrollTOTP(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "enroll_totp").Logger()
+	enrollment, err := h.services.Auth.BeginTOTPEnrollment(c.Request().Context(), middleware.GetUserID(c))
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			return c.NoContent(http.StatusNotFound)
+		}
+		if errors.Is(err, service.ErrMFAAlreadyEnabled) || errors.Is(err, service.ErrMFALocalOnly) {
+			logger.Info().Err(err).Msg("totp enrollment rejected")
+			return c.NoContent(http.StatusConflict)
+		}
+		logger.Error().Err(err).Msg("failed to start totp enrollment")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return c.JSON(http.StatusOK, enrollment)
+}
+
+type mfaCodeReq struct {
+	Code string `json:"code"`
+}
+
+// ConfirmTOTP enables MFA once the caller proves their authenticator works and returns recovery codes
+func (h *AuthHandler) ConfirmTOTP(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "confirm_totp").Logger()
+	var req mfaCodeReq
+	if err := c.Bind(&req); err != nil {
+		logger.Error().Err(err).Msg("invalid payload")
+		return c.NoContent(http.StatusBadRequest)
+	}
+	codes, err := h.services.Auth.ConfirmTOTPEnrollment(c.Request().Context(), middleware.GetUserID(c), req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidMFACode):
+			logger.Info().Err(err).Msg("totp confirmation rejected")
+			return c.NoContent(http.StatusUnauthorized)
+		case errors.Is(err, service.ErrMFAAlreadyEnabled), errors.Is(err, service.ErrMFAEnrollmentNotStarted):
+			logger.Info().Err(err).Msg("totp confirmation rejected")
+			return c.NoContent(http.StatusConflict)
+		case errors.Is(err, service.ErrUserNotFound):
+			return c.NoContent(http.StatusNotFound)
+		}
+		logger.Error().Err(err).Msg("failed to confirm totp enrollment")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return c.JSON(http.StatusOK, map[string][]string{"recovery_codes": codes})
+}
+
+// DisableTOTP turns MFA off after checking a current TOTP or recovery code
+func (h *AuthHandler) DisableTOTP(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "disable_totp").Logger()
+	var req mfaCodeReq
+	if err := c.Bind(&req); err != nil {
+		logger.Error().Err(err).Msg("invalid payload")
+		return c.NoContent(http.StatusBadRequest)
+	}
+	if err := h.services.Auth.DisableTOTP(c.Request().Context(), middleware.GetUserID(c), req.Code); err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidMFACode):
+			logger.Info().Err(err).Msg("totp disable rejected")
+			return c.NoContent(http.StatusUnauthorized)
+		case errors.Is(err, service.ErrMFANotEnabled):
+			return c.NoContent(http.StatusConflict)
+		case errors.Is(err, service.ErrUserNotFound):
+			return c.NoContent(http.StatusNotFound)
+		}
+		logger.Error().Err(err).Msg("failed to disable totp")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes replaces the caller's recovery codes with a new set
+func (h *AuthHandler) RegenerateRecoveryCodes(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "regenerate_recovery_codes").Logger()
+	codes, err := h.services.Auth.RegenerateRecoveryCodes(c.Request().Context(), middleware.GetUserID(c))
+	if err != nil {
+		if errors.Is(err, service.ErrMFANotEnabled) {
+			return c.NoContent(http.StatusConflict)
+		}
+		if errors.Is(err, service.ErrUserNotFound) {
+			return c.NoContent(http.StatusNotFound)
+		}
+		logger.Error().Err(err).Msg("failed to regenerate recovery codes")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return c.JSON(http.StatusOK, map[string][]string{"recovery_codes": codes})
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/petonlabs/go-boilerplate/internal/errs"
+	"github.com/petonlabs/go-boilerplate/internal/lib/oidc"
+	"github.com/petonlabs/go-boilerplate/internal/middleware"
+	"github.com/petonlabs/go-boilerplate/internal/service"
+)
+
+type oidcCallbackReq struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+}
+
+// ListOIDCProviders returns the names of the configured identity providers
+func (h *AuthHandler) ListOIDCProviders(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string][]string{"providers": h.services.Auth.OIDCProviders()})
+}
+
+// BeginOIDCLogin returns the identity provider URL to send the user to
+func (h *AuthHandler) BeginOIDCLogin(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "begin_oidc_login").Str("provider", c.Param("provider")).Logger()
+	auth, err := h.services.Auth.BeginOIDCLogin(c.Request().Context(), c.Param("provider"))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrOIDCProviderNotFound):
+			return c.NoContent(http.StatusNotFound)
+		case errors.Is(err, oidc.ErrDiscovery):
+			logger.Error().Err(err).Msg("identity provider unavailable")
+			return c.NoContent(http.StatusBadGateway)
+		}
+		logger.Error().Err(err).Msg("failed to begin oidc login")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return c.JSON(http.StatusOK, auth)
+}
+
+// FinishOIDCLogin redeems the code the identity provider returned and issues a session
+func (h *AuthHandler) FinishOIDCLogin(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "finish_oidc_login").Str("provider", c.Param("provider")).Logger()
+	var req oidcCallbackReq
+	if err := c.Bind(&req); err != nil {
+		logger.Error().Err(err).Msg("invalid oidc callback payload")
+		return c.NoContent(http.StatusBadRequest)
+	}
+	session, err := h.services.Auth.FinishOIDCLogin(c.Request().Context(), c.Param("provider"), req.State, req.Code, sessionMeta(c))
+	if err != nil {
+		var mfaErr *service.MFARequiredError
+		switch {
+		case errors.As(err, &mfaErr):
+			return c.JSON(http.StatusOK, mfaErr.Challenge)
+		case errors.Is(err, service.ErrOIDCProviderNotFound):
+			return c.NoContent(http.StatusNotFound)
+		case errors.Is(err, oidc.ErrDiscovery):
+			logger.Error().Err(err).Msg("identity provider unavailable")
+			return c.NoContent(http.StatusBadGateway)
+		case errors.Is(err, service.ErrInvalidOIDCState):
+			logger.Info().Err(err).Msg("oidc login state rejected")
+			return c.NoContent(http.StatusBadRequest)
+		case errors.Is(err, service.ErrOIDCRejected):
+			logger.Info().Err(err).Msg("oidc login rejected")
+			return c.NoContent(http.StatusUnauthorized)
+		case errors.Is(err, service.ErrRegistrationClosed):
+			return errs.NewForbiddenError("Registration is closed", true)
+		case errors.Is(err, service.ErrInvitationRequired):
+			return errs.NewForbiddenError("An invitation code is required", true)
+		case errors.Is(err, service.ErrOIDCAccountConflict):
+			logger.Info().Err(err).Msg("oidc identity conflicts with existing account")
+			return c.NoContent(http.StatusConflict)
+		}
+		logger.Error().Err(err).Msg("failed to finish oidc login")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return c.JSON(http.StatusOK, session)
+}
@@ -0,0 +1,245 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/petonlabs/go-boilerplate/internal/middleware"
+	"github.com/petonlabs/go-boilerplate/internal/model"
+	"github.com/petonlabs/go-boilerplate/internal/repository"
+	"github.com/petonlabs/go-boilerplate/internal/server"
+	"github.com/petonlabs/go-boilerplate/internal/service"
+)
+
+type OrganizationHandler struct{ Handler }
+
+func NewOrganizationHandler(s *server.Server, services *service.Services) *OrganizationHandler {
+	return &OrganizationHandler{Handler: NewHandler(s, services)}
+}
+
+type createOrganizationReq struct {
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+type setOrganizationMemberReq struct {
+	Role string `json:"role"`
+}
+
+type createOrganizationInvitationReq struct {
+	Email     string     `json:"email"`
+	Role      string     `json:"role"`
+	MaxUses   int        `json:"max_uses"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type joinOrganizationReq struct {
+	Code string `json:"code"`
+}
+
+// ListOrganizations returns the organizations the caller belongs to
+func (h *OrganizationHandler) ListOrganizations(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "list_organizations").Logger()
+	orgs, err := h.services.Organizations.ListForUser(c.Request().Context(), middleware.GetUserID(c))
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to list organizations")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return c.JSON(http.StatusOK, orgs)
+}
+
+// CreateOrganization creates an organization with the caller as its admin
+func (h *OrganizationHandler) CreateOrganization(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "create_organization").Logger()
+	var req createOrganizationReq
+	if err := c.Bind(&req); err != nil {
+		return c.NoContent(http.StatusBadRequest)
+	}
+	org, err := h.services.Organizations.Create(c.Request().Context(), middleware.GetUserID(c), req.Name, req.Slug)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidOrganization):
+			return c.NoContent(http.StatusBadRequest)
+		case errors.Is(err, repository.ErrSlugTaken):
+			return c.NoContent(http.StatusConflict)
+		case errors.Is(err, repository.ErrUserNotFound):
+			return c.NoContent(http.StatusNotFound)
+		}
+		logger.Error().Err(err).Msg("failed to create organization")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	logger.Info().Str("organization_id", org.ID.String()).Msg("organization created")
+	return c.JSON(http.StatusCreated, org)
+}
+
+// CurrentOrganization returns the active organization with the caller's role
+func (h *OrganizationHandler) CurrentOrganization(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "current_organization").Logger()
+	org, err := h.services.Organizations.Current(c.Request().Context())
+	if err != nil {
+		if errors.Is(err, repository.ErrOrganizationNotFound) {
+			return c.NoContent(http.StatusNotFound)
+		}
+		logger.Error().Err(err).Msg("failed to load organization")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	org.Role, _ = c.Get(middleware.OrganizationRoleKey).(string)
+	return c.JSON(http.StatusOK, org)
+}
+
+// ListOrganizationMembers returns the members of the active organization
+func (h *OrganizationHandler) ListOrganizationMembers(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "list_organization_members").Logger()
+	members, err := h.services.Organizations.Members(c.Request().Context())
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to list organization members")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return c.JSON(http.StatusOK, members)
+}
+
+// SetOrganizationMember changes the role of a member of the active
+// organization
+func (h *OrganizationHandler) SetOrganizationMember(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "set_organization_member").Logger()
+	var req setOrganizationMemberReq
+	if err := c.Bind(&req); err != nil {
+		return c.NoContent(http.StatusBadRequest)
+	}
+	if err := h.services.Organizations.SetMember(c.Request().Context(), c.Param("user_id"), req.Role); err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidOrganizationRole):
+			return c.NoContent(http.StatusBadRequest)
+		case errors.Is(err, repository.ErrMemberNotFound):
+			return c.NoContent(http.StatusNotFound)
+		case errors.Is(err, service.ErrLastOrganizationAdmin):
+			return c.NoContent(http.StatusConflict)
+		}
+		logger.Error().Err(err).Msg("failed to set organization member")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	logger.Info().
+		Str("organization_id", middleware.GetOrganizationID(c)).
+		Str("user_id", c.Param("user_id")).
+		Str("role", req.Role).
+		Str("actor", middleware.GetUserID(c)).
+		Msg("organization member updated")
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RemoveOrganizationMember removes a user from the active organization
+func (h *OrganizationHandler) RemoveOrganizationMember(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "remove_organization_member").Logger()
+	if err := h.services.Organizations.RemoveMember(c.Request().Context(), c.Param("user_id")); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrMemberNotFound):
+			return c.NoContent(http.StatusNotFound)
+		case errors.Is(err, service.ErrLastOrganizationAdmin):
+			return c.NoContent(http.StatusConflict)
+		}
+		logger.Error().Err(err).Msg("failed to remove organization member")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	logger.Info().
+		Str("organization_id", middleware.GetOrganizationID(c)).
+		Str("user_id", c.Param("user_id")).
+		Str("actor", middleware.GetUserID(c)).
+		Msg("organization member removed")
+	return c.NoContent(http.StatusNoContent)
+}
+
+// CreateOrganizationInvitation mints an invitation to the active
+// organization. The code is only returned in this response.
+func (h *OrganizationHandler) CreateOrganizationInvitation(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "create_organization_invitation").Logger()
+	var req createOrganizationInvitationReq
+	if err := c.Bind(&req); err != nil {
+		return c.NoContent(http.StatusBadRequest)
+	}
+	if req.Role == "" {
+		req.Role = model.OrganizationRoleMember
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return c.NoContent(http.StatusBadRequest)
+	}
+	inv, err := h.services.Auth.CreateOrganizationInvitation(c.Request().Context(), service.OrganizationInvitationParams{
+		Email:     req.Email,
+		Role:      req.Role,
+		MaxUses:   req.MaxUses,
+		ExpiresAt: req.ExpiresAt,
+		CreatedBy: middleware.GetUserID(c),
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidOrganizationRole) || errors.Is(err, service.ErrInvalidInvitationUses) {
+			return c.NoContent(http.StatusBadRequest)
+		}
+		logger.Error().Err(err).Msg("failed to create organization invitation")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	logger.Info().
+		Str("organization_id", middleware.GetOrganizationID(c)).
+		Str("invitation_id", inv.ID).
+		Str("role", inv.Role).
+		Str("actor", middleware.GetUserID(c)).
+		Msg("organization invitation created")
+	return c.JSON(http.StatusCreated, inv)
+}
+
+// ListOrganizationInvitations returns the invitations to the active
+// organization
+func (h *OrganizationHandler) ListOrganizationInvitations(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "list_organization_invitations").Logger()
+	invitations, err := h.services.Auth.ListOrganizationInvitations(c.Request().Context())
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to list organization invitations")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return c.JSON(http.StatusOK, invitations)
+}
+
+// RevokeOrganizationInvitation stops an invitation to the active
+// organization from being redeemed
+func (h *OrganizationHandler) RevokeOrganizationInvitation(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "revoke_organization_invitation").Logger()
+	if err := h.services.Auth.RevokeOrganizationInvitation(c.Request().Context(), c.Param("id")); err != nil {
+		if errors.Is(err, service.ErrInvitationNotFound) {
+			return c.NoContent(http.StatusNotFound)
+		}
+		logger.Error().Err(err).Msg("failed to revoke organization invitation")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	logger.Info().
+		Str("organization_id", middleware.GetOrganizationID(c)).
+		Str("invitation_id", c.Param("id")).
+		Str("actor", middleware.GetUserID(c)).
+		Msg("organization invitation revoked")
+	return c.NoContent(http.StatusNoContent)
+}
+
+// JoinOrganization adds the caller to an organization by redeeming an
+// invitation code
+func (h *OrganizationHandler) JoinOrganization(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "join_organization").Logger()
+	var req joinOrganizationReq
+	if err := c.Bind(&req); err != nil {
+		return c.NoContent(http.StatusBadRequest)
+	}
+	orgID, err := h.services.Auth.AcceptOrganizationInvitation(c.Request().Context(), middleware.GetUserID(c), req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidInvitation):
+			logger.Info().Msg("organization invitation rejected")
+			return c.NoContent(http.StatusForbidden)
+		case errors.Is(err, service.ErrAlreadyOrganizationMember):
+			return c.NoContent(http.StatusConflict)
+		case errors.Is(err, service.ErrUserNotFound):
+			return c.NoContent(http.StatusNotFound)
+		}
+		logger.Error().Err(err).Msg("failed to join organization")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	logger.Info().Str("organization_id", orgID).Str("user_id", middleware.GetUserID(c)).Msg("organization joined")
+	return c.JSON(http.StatusOK, map[string]string{"organization_id": orgID})
+}
@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/petonlabs/go-boilerplate/internal/middleware"
+	"github.com/petonlabs/go-boilerplate/internal/service"
+)
+
+type passkeyFinishReq struct {
+	CeremonyID string          `json:"ceremony_id"`
+	Name       string          `json:"name"`
+	Credential json.RawMessage `json:"credential"`
+}
+
+// BeginPasskeyLogin returns the options for navigator.credentials.get
+func (h *AuthHandler) BeginPasskeyLogin(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "begin_passkey_login").Logger()
+	ceremony, err := h.services.Auth.BeginPasskeyLogin(c.Request().Context())
+	if err != nil {
+		if errors.Is(err, service.ErrPasskeysDisabled) {
+			return c.NoContent(http.StatusNotFound)
+		}
+		logger.Error().Err(err).Msg("failed to begin passkey login")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return c.JSON(http.StatusOK, ceremony)
+}
+
+// FinishPasskeyLogin verifies the authenticator's assertion and issues a session
+func (h *AuthHandler) FinishPasskeyLogin(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "finish_passkey_login").Logger()
+	var req passkeyFinishReq
+	if err := c.Bind(&req); err != nil {
+		logger.Error().Err(err).Msg("invalid passkey login payload")
+		return c.NoContent(http.StatusBadRequest)
+	}
+	session, err := h.services.Auth.FinishPasskeyLogin(c.Request().Context(), req.CeremonyID, req.Credential, sessionMeta(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrPasskeysDisabled):
+			return c.NoContent(http.StatusNotFound)
+		case errors.Is(err, service.ErrInvalidPasskeyCeremony), errors.Is(err, service.ErrPasskeyRejected):
+			logger.Info().Err(err).Msg("passkey login rejected")
+			return c.NoContent(http.StatusUnauthorized)
+		}
+		logger.Error().Err(err).Msg("failed to finish passkey login")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return c.JSON(http.StatusOK, session)
+}
+
+// BeginPasskeyRegistration returns the options for navigator.credentials.create
+func (h *AuthHandler) BeginPasskeyRegistration(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "begin_passkey_registration").Logger()
+	ceremony, err := h.services.Auth.BeginPasskeyRegistration(c.Request().Context(), middleware.GetUserID(c))
+	if err != nil {
+		if errors.Is(err, service.ErrPasskeysDisabled) || errors.Is(err, service.ErrUserNotFound) {
+			return c.NoContent(http.StatusNotFound)
+		}
+		logger.Error().Err(err).Msg("failed to begin passkey registration")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return c.JSON(http.StatusOK, ceremony)
+}
+
+// FinishPasskeyRegistration verifies the authenticator's attestation and stores the passkey
+func (h *AuthHandler) FinishPasskeyRegistration(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "finish_passkey_registration").Logger()
+	var req passkeyFinishReq
+	if err := c.Bind(&req); err != nil {
+		logger.Error().Err(err).Msg("invalid passkey registration payload")
+		return c.NoContent(http.StatusBadRequest)
+	}
+	pk, err := h.services.Auth.FinishPasskeyRegistration(c.Request().Context(), middleware.GetUserID(c), req.CeremonyID, req.Name, req.Credential)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrPasskeysDisabled), errors.Is(err, service.ErrUserNotFound):
+			return c.NoContent(http.StatusNotFound)
+		case errors.Is(err, service.ErrInvalidPasskeyCeremony), errors.Is(err, service.ErrPasskeyRejected):
+			logger.Info().Err(err).Msg("passkey registration rejected")
+			return c.NoContent(http.StatusBadRequest)
+		}
+		logger.Error().Err(err).Msg("failed to finish passkey registration")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return c.JSON(http.StatusCreated, pk)
+}
+
+// ListPasskeys returns the caller's registered passkeys
+func (h *AuthHandler) ListPasskeys(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "list_passkeys").Logger()
+	passkeys, err := h.services.Auth.ListPasskeys(c.Request().Context(), middleware.GetUserID(c))
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to list passkeys")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return c.JSON(http.StatusOK, passkeys)
+}
+
+// DeletePasskey removes one of the caller's passkeys
+func (h *AuthHandler) DeletePasskey(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "delete_passkey").Logger()
+	if err := h.services.Auth.DeletePasskey(c.Request().Context(), middleware.GetUserID(c), c.Param("id")); err != nil {
+		switch {
+		case errors.Is(err, service.ErrPasskeyNotFound):
+			return c.NoContent(http.StatusNotFound)
+		case errors.Is(err, service.ErrLastLoginMethod):
+			return c.NoContent(http.StatusConflict)
+		}
+		logger.Error().Err(err).Msg("failed to delete passkey")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/petonlabs/go-boilerplate/internal/middleware"
+	"github.com/petonlabs/go-boilerplate/internal/service"
+)
+
+type createPersonalAccessTokenReq struct {
+	Name      string     `json:"name"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreatePersonalAccessToken mints a token for the caller. The token is only
+// returned in this response.
+func (h *AuthHandler) CreatePersonalAccessToken(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "create_personal_access_token").Logger()
+	var req createPersonalAccessTokenReq
+	if err := c.Bind(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		return c.NoContent(http.StatusBadRequest)
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return c.NoContent(http.StatusBadRequest)
+	}
+	pat, err := h.services.Auth.CreatePersonalAccessToken(c.Request().Context(), middleware.GetUserID(c), strings.TrimSpace(req.Name), req.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.NoContent(http.StatusNotFound)
+		}
+		logger.Error().Err(err).Msg("failed to create personal access token")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	logger.Info().Str("token_id", pat.ID).Msg("personal access token created")
+	return c.JSON(http.StatusCreated, pat)
+}
+
+// ListPersonalAccessTokens returns the caller's active tokens
+func (h *AuthHandler) ListPersonalAccessTokens(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "list_personal_access_tokens").Logger()
+	tokens, err := h.services.Auth.ListPersonalAccessTokens(c.Request().Context(), middleware.GetUserID(c))
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to list personal access tokens")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return c.JSON(http.StatusOK, tokens)
+}
+
+// RevokePersonalAccessToken revokes one of the caller's tokens
+func (h *AuthHandler) RevokePersonalAccessToken(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "revoke_personal_access_token").Logger()
+	if err := h.services.Auth.RevokePersonalAccessToken(c.Request().Context(), middleware.GetUserID(c), c.Param("id")); err != nil {
+		if errors.Is(err, service.ErrPersonalAccessTokenNotFound) {
+			return c.NoContent(http.StatusNotFound)
+		}
+		logger.Error().Err(err).Msg("failed to revoke personal access token")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/petonlabs/go-boilerplate/internal/middleware"
+	"github.com/petonlabs/go-boilerplate/internal/service"
+)
+
+type restoreRequestReq struct {
+	Email string `json:"email"`
+}
+
+type restoreConfirmReq struct {
+	Token string `json:"token"`
+}
+
+// RequestAccountRestore emails a restore link for a recently deleted account
+func (h *AuthHandler) RequestAccountRestore(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "request_account_restore").Logger()
+	var req restoreRequestReq
+	if err := c.Bind(&req); err != nil || req.Email == "" {
+		return c.NoContent(http.StatusBadRequest)
+	}
+	token, err := h.services.Auth.RequestAccountRestore(c.Request().Context(), req.Email)
+	if err != nil {
+		// Addresses without a restorable account look the same as success to
+		// avoid revealing deleted accounts.
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.NoContent(http.StatusNoContent)
+		}
+		logger.Error().Err(err).Msg("failed to create account restore link")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	// As with magic links, the token is only echoed back outside production.
+	if h.server != nil {
+		if cfg := h.server.GetConfig(); cfg != nil && (cfg.Primary.Env == "development" || cfg.Primary.Env == "test") {
+			return c.JSON(http.StatusOK, map[string]string{"token": token})
+		}
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ConfirmAccountRestore restores the account an emailed restore link was issued for
+func (h *AuthHandler) ConfirmAccountRestore(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "confirm_account_restore").Logger()
+	var req restoreConfirmReq
+	if err := c.Bind(&req); err != nil {
+		return c.NoContent(http.StatusBadRequest)
+	}
+	userID, err := h.services.Auth.ConsumeAccountRestore(c.Request().Context(), req.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidRestoreToken):
+			logger.Info().Err(err).Msg("account restore link rejected")
+			return c.NoContent(http.StatusBadRequest)
+		case errors.Is(err, service.ErrRestoreConflict):
+			return c.NoContent(http.StatusConflict)
+		}
+		logger.Error().Err(err).Msg("failed to restore account")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	logger.Info().Str("user_id", userID).Msg("account restored by its owner")
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RestoreUser restores a deleted account within the recovery window
+func (h *AdminHandler) RestoreUser(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "admin_restore_user").Logger()
+	userID := c.Param("id")
+	if err := h.services.Auth.RestoreAccount(c.Request().Context(), userID); err != nil {
+		switch {
+		case errors.Is(err, service.ErrAccountNotRestorable):
+			return echo.NewHTTPError(http.StatusNotFound, "no restorable account")
+		case errors.Is(err, service.ErrRestoreConflict):
+			return echo.NewHTTPError(http.StatusConflict, "account email or identity is now used by another account")
+		}
+		logger.Error().Err(err).Str("user_id", userID).Msg("failed to restore user")
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to restore user")
+	}
+	logger.Info().Str("user_id", userID).Str("actor", middleware.GetUserID(c)).Msg("admin restored user")
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/petonlabs/go-boilerplate/internal/middleware"
+	"github.com/petonlabs/go-boilerplate/internal/service"
+)
+
+// ListRoles returns every role with its permissions.
+func (h *AdminHandler) ListRoles(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "admin_list_roles").Logger()
+	roles, err := h.services.Auth.ListRoles(c.Request().Context())
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to list roles")
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to list roles")
+	}
+	return c.JSON(http.StatusOK, roles)
+}
+
+// ListUserRoles returns the roles assigned to a user.
+func (h *AdminHandler) ListUserRoles(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "admin_list_user_roles").Logger()
+	userID := c.Param("id")
+	roles, err := h.services.Auth.UserRoles(c.Request().Context(), userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "user not found")
+		}
+		logger.Error().Err(err).Str("user_id", userID).Msg("failed to list user roles")
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to list user roles")
+	}
+	return c.JSON(http.StatusOK, roles)
+}
+
+// AssignUserRole grants a role to a user.
+func (h *AdminHandler) AssignUserRole(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "admin_assign_user_role").Logger()
+	userID, role := c.Param("id"), c.Param("role")
+	if err := h.services.Auth.AssignRole(c.Request().Context(), userID, role, middleware.GetUserID(c)); err != nil {
+		switch {
+		case errors.Is(err, service.ErrRoleNotFound):
+			return echo.NewHTTPError(http.StatusNotFound, "role not found")
+		case errors.Is(err, sql.ErrNoRows):
+			return echo.NewHTTPError(http.StatusNotFound, "user not found")
+		}
+		logger.Error().Err(err).Str("user_id", userID).Msg("failed to assign role")
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to assign role")
+	}
+	logger.Info().Str("user_id", userID).Str("role", role).Str("actor", middleware.GetUserID(c)).Msg("admin assigned role")
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RemoveUserRole takes a role away from a user.
+func (h *AdminHandler) RemoveUserRole(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "admin_remove_user_role").Logger()
+	userID, role := c.Param("id"), c.Param("role")
+	if err := h.services.Auth.RemoveRole(c.Request().Context(), userID, role); err != nil {
+		switch {
+		case errors.Is(err, service.ErrRoleNotFound):
+			return echo.NewHTTPError(http.StatusNotFound, "role not assigned")
+		case errors.Is(err, sql.ErrNoRows):
+			return echo.NewHTTPError(http.StatusNotFound, "user not found")
+		}
+		logger.Error().Err(err).Str("user_id", userID).Msg("failed to remove role")
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to remove role")
+	}
+	logger.Info().Str("user_id", userID).Str("role", role).Str("actor", middleware.GetUserID(c)).Msg("admin removed role")
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/petonlabs/go-boilerplate/internal/middleware"
+	"github.com/petonlabs/go-boilerplate/internal/service"
+)
+
+type createServiceAccountReq struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type createAPIKeyReq struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreateServiceAccount registers a service account.
+func (h *AdminHandler) CreateServiceAccount(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "admin_create_service_account").Logger()
+	var req createServiceAccountReq
+	if err := c.Bind(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "name is required")
+	}
+	sa, err := h.services.Auth.CreateServiceAccount(c.Request().Context(), req.Name, req.Description, middleware.GetUserID(c))
+	if err != nil {
+		if errors.Is(err, service.ErrServiceAccountExists) {
+			return echo.NewHTTPError(http.StatusConflict, "service account already exists")
+		}
+		logger.Error().Err(err).Msg("failed to create service account")
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to create service account")
+	}
+	logger.Info().Str("service_account_id", sa.ID).Str("actor", middleware.GetUserID(c)).Msg("admin created service account")
+	return c.JSON(http.StatusCreated, sa)
+}
+
+// ListServiceAccounts returns all service accounts.
+func (h *AdminHandler) ListServiceAccounts(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "admin_list_service_accounts").Logger()
+	accounts, err := h.services.Auth.ListServiceAccounts(c.Request().Context())
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to list service accounts")
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to list service accounts")
+	}
+	return c.JSON(http.StatusOK, accounts)
+}
+
+// DisableServiceAccount stops all of a service account's keys from working.
+func (h *AdminHandler) DisableServiceAccount(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "admin_disable_service_account").Logger()
+	accountID := c.Param("id")
+	if err := h.services.Auth.DisableServiceAccount(c.Request().Context(), accountID); err != nil {
+		if errors.Is(err, service.ErrServiceAccountNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "service account not found")
+		}
+		logger.Error().Err(err).Str("service_account_id", accountID).Msg("failed to disable service account")
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to disable service account")
+	}
+	logger.Info().Str("service_account_id", accountID).Str("actor", middleware.GetUserID(c)).Msg("admin disabled service account")
+	return c.NoContent(http.StatusNoContent)
+}
+
+// CreateAPIKey issues a key for a service account. The key is only returned
+// in this response.
+func (h *AdminHandler) CreateAPIKey(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "admin_create_api_key").Logger()
+	accountID := c.Param("id")
+	var req createAPIKeyReq
+	if err := c.Bind(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "name is required")
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return echo.NewHTTPError(http.StatusBadRequest, "expires_at must be in the future")
+	}
+	key, err := h.services.Auth.CreateAPIKey(c.Request().Context(), accountID, req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidScope):
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		case errors.Is(err, service.ErrServiceAccountNotFound):
+			return echo.NewHTTPError(http.StatusNotFound, "service account not found")
+		}
+		logger.Error().Err(err).Str("service_account_id", accountID).Msg("failed to create api key")
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to create api key")
+	}
+	logger.Info().Str("service_account_id", accountID).Str("api_key_id", key.ID).Str("actor", middleware.GetUserID(c)).Msg("admin created api key")
+	return c.JSON(http.StatusCreated, key)
+}
+
+// ListAPIKeys returns a service account's keys without their secret values.
+func (h *AdminHandler) ListAPIKeys(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "admin_list_api_keys").Logger()
+	keys, err := h.services.Auth.ListAPIKeys(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to list api keys")
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to list api keys")
+	}
+	return c.JSON(http.StatusOK, keys)
+}
+
+// RevokeAPIKey revokes one of a service account's keys.
+func (h *AdminHandler) RevokeAPIKey(c echo.Context) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "admin_revoke_api_key").Logger()
+	accountID, keyID := c.Param("id"), c.Param("key_id")
+	if err := h.services.Auth.RevokeAPIKey(c.Request().Context(), accountID, keyID); err != nil {
+		if errors.Is(err, service.ErrAPIKeyNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "api key not found")
+		}
+		logger.Error().Err(err).Str("api_key_id", keyID).Msg("failed to revoke api key")
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to revoke api key")
+	}
+	logger.Info().Str("service_account_id", accountID).Str("api_key_id", keyID).Str("actor", middleware.GetUserID(c)).Msg("admin revoked api key")
+	return c.NoContent(http.StatusNoContent)
+}
+
+// CurrentServiceAccount describes the service account and key used to call
+// it, so integrations can check their credentials.
+func (h *AuthHandler) CurrentServiceAccount(c echo.Context) error {
+	apiKeyID, _ := c.Get(middleware.APIKeyIDKey).(string)
+	return c.JSON(http.StatusOK, map[string]any{
+		"service_account_id": middleware.GetUserID(c),
+		"api_key_id":         apiKeyID,
+		"scopes":             middleware.GetScopes(c),
+	})
+}
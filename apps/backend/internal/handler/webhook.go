@@ -157,11 +157,15 @@ func (h *WebhookHandler) HandleClerkWebhook(c echo.Context) error {
 		return c.NoContent(http.StatusBadRequest)
 	}
 
+	if strings.HasPrefix(payload.Type, "organization") {
+		return h.handleOrganizationEvent(c, payload)
+	}
+
 	// Extract a few known fields safely
 	data := payload.Data
 	externalID, _ := data["external_id"].(string)
 	clerkID, _ := data["id"].(string)
-	email, _ := data["email"].(string)
+	email, emailVerified := clerkPrimaryEmail(data)
 	firstName, _ := data["first_name"].(string)
 	lastName, _ := data["last_name"].(string)
 	imageURL, _ := data["image_url"].(string)
@@ -183,10 +187,99 @@ func (h *WebhookHandler) HandleClerkWebhook(c echo.Context) error {
 		return c.NoContent(http.StatusInternalServerError)
 	}
 
-	if err := h.services.Auth.SyncUser(c.Request().Context(), clerkID, externalID, email, firstName, lastName, imageURL, role, rawJSON); err != nil {
+	user := service.ClerkUser{
+		ID:            clerkID,
+		ExternalID:    externalID,
+		Email:         email,
+		EmailVerified: emailVerified,
+		FirstName:     firstName,
+		LastName:      lastName,
+		ImageURL:      imageURL,
+		Role:          role,
+		RawPayload:    rawJSON,
+	}
+	if err := h.services.Auth.SyncClerkUser(c.Request().Context(), user); err != nil {
 		logger.Error().Err(err).Msg("failed to sync user from webhook")
 		return c.NoContent(http.StatusInternalServerError)
 	}
 
 	return c.NoContent(http.StatusOK)
 }
+
+// handleOrganizationEvent mirrors Clerk organization and
+// organizationMembership events. A membership for a user or organization that
+// has not been synced yet fails so that Clerk retries the delivery.
+func (h *WebhookHandler) handleOrganizationEvent(c echo.Context, payload ClerkWebhookPayload) error {
+	logger := middleware.GetLogger(c).With().Str("operation", "clerk_webhook").Str("event", payload.Type).Logger()
+	if h.services == nil || h.services.Organizations == nil {
+		logger.Error().Msg("organization service not available")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	ctx := c.Request().Context()
+	data := payload.Data
+
+	var err error
+	switch payload.Type {
+	case "organization.created", "organization.updated":
+		org := service.ClerkOrganization{}
+		org.ID, _ = data["id"].(string)
+		org.Name, _ = data["name"].(string)
+		org.Slug, _ = data["slug"].(string)
+		org.ImageURL, _ = data["image_url"].(string)
+		org.RawPayload, _ = json.Marshal(data)
+		err = h.services.Organizations.SyncClerkOrganization(ctx, org)
+	case "organization.deleted":
+		clerkID, _ := data["id"].(string)
+		err = h.services.Organizations.DeleteClerkOrganization(ctx, clerkID)
+	case "organizationMembership.created", "organizationMembership.updated", "organizationMembership.deleted":
+		m := service.ClerkMembership{}
+		m.ID, _ = data["id"].(string)
+		m.Role, _ = data["role"].(string)
+		if org, ok := data["organization"].(map[string]interface{}); ok {
+			m.OrganizationID, _ = org["id"].(string)
+		}
+		if user, ok := data["public_user_data"].(map[string]interface{}); ok {
+			m.UserID, _ = user["user_id"].(string)
+		}
+		if payload.Type == "organizationMembership.deleted" {
+			err = h.services.Organizations.DeleteClerkMembership(ctx, m)
+		} else {
+			err = h.services.Organizations.SyncClerkMembership(ctx, m)
+		}
+	default:
+		logger.Debug().Msg("ignoring organization event")
+	}
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to sync organization from webhook")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// clerkPrimaryEmail returns the user's primary email address and whether
+// Clerk has verified it. Clerk user objects list addresses under
+// email_addresses; a flat email field is accepted for simpler payloads.
+func clerkPrimaryEmail(data map[string]interface{}) (string, bool) {
+	primaryID, _ := data["primary_email_address_id"].(string)
+	if addresses, ok := data["email_addresses"].([]interface{}); ok {
+		for _, entry := range addresses {
+			addr, ok := entry.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if id, _ := addr["id"].(string); primaryID != "" && id != primaryID {
+				continue
+			}
+			email, _ := addr["email_address"].(string)
+			var verified bool
+			if v, ok := addr["verification"].(map[string]interface{}); ok {
+				status, _ := v["status"].(string)
+				verified = status == "verified"
+			}
+			return email, verified
+		}
+	}
+	email, _ := data["email"].(string)
+	verified, _ := data["email_verified"].(bool)
+	return email, verified
+}
@@ -0,0 +1,39 @@
+package apikey
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	a, err := Generate(ServiceAccountPrefix)
+	require.NoError(t, err)
+	b, err := Generate(ServiceAccountPrefix)
+	require.NoError(t, err)
+	require.NotEqual(t, a, b)
+	require.True(t, strings.HasPrefix(a, ServiceAccountPrefix))
+	require.Len(t, a, len(ServiceAccountPrefix)+64)
+
+	require.Equal(t, a[:len(ServiceAccountPrefix)+6], Hint(ServiceAccountPrefix, a))
+	require.Equal(t, ServiceAccountPrefix, Hint(ServiceAccountPrefix, "gbsk_1"))
+}
+
+func TestValidateScopes(t *testing.T) {
+	require.NoError(t, ValidateScopes([]string{"*", "users:read", "users:*", "billing.invoices:export"}))
+	require.NoError(t, ValidateScopes(nil))
+
+	for _, scope := range []string{"", "users", ":read", "users:", "Users:read", "users:read write", "*:read"} {
+		require.ErrorIs(t, ValidateScopes([]string{scope}), ErrInvalidScope, scope)
+	}
+}
+
+func TestAllows(t *testing.T) {
+	require.True(t, Allows([]string{"users:read"}, "users:read"))
+	require.True(t, Allows([]string{"users:*"}, "users:delete"))
+	require.True(t, Allows([]string{"*"}, "billing:export"))
+	require.False(t, Allows([]string{"users:read"}, "users:delete"))
+	require.False(t, Allows([]string{"users:*"}, "billing:read"))
+	require.False(t, Allows(nil, "users:read"))
+}
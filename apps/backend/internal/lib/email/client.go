@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"html/template"
+	"strings"
 
 	"github.com/petonlabs/go-boilerplate/internal/config"
 	"github.com/pkg/errors"
@@ -14,12 +15,15 @@ import (
 type Client struct {
 	client *resend.Client
 	logger *zerolog.Logger
+	// appURL is the frontend base URL that links in emails point to.
+	appURL string
 }
 
 func NewClient(cfg *config.Config, logger *zerolog.Logger) *Client {
 	return &Client{
 		client: resend.NewClient(cfg.Integration.ResendAPIKey),
 		logger: logger,
+		appURL: strings.TrimRight(cfg.Primary.AppURL, "/"),
 	}
 }
 
@@ -1,5 +1,11 @@
 package email
 
+import (
+	"net/url"
+	"strconv"
+	"time"
+)
+
 func (c *Client) SendWelcomeEmail(to, firstName string) error {
 	data := map[string]string{
 		"UserFirstName": firstName,
@@ -12,3 +18,122 @@ func (c *Client) SendWelcomeEmail(to, firstName string) error {
 		data,
 	)
 }
+
+func (c *Client) SendVerificationEmail(to, token string, expiresAt time.Time) error {
+	data := map[string]string{
+		"VerifyURL": c.appURL + "/verify-email?token=" + url.QueryEscape(token),
+		"ExpiresIn": humanizeDuration(time.Until(expiresAt)),
+	}
+
+	return c.SendEmail(
+		to,
+		"Confirm your email address",
+		TemplateVerifyEmail,
+		data,
+	)
+}
+
+func (c *Client) SendMagicLinkEmail(to, token string, expiresAt time.Time) error {
+	data := map[string]string{
+		"LoginURL":  c.appURL + "/magic-link?token=" + url.QueryEscape(token),
+		"ExpiresIn": humanizeDuration(time.Until(expiresAt)),
+	}
+
+	return c.SendEmail(
+		to,
+		"Your sign-in link",
+		TemplateMagicLink,
+		data,
+	)
+}
+
+func (c *Client) SendNewSignInEmail(to, ipAddress, userAgent string, signedInAt time.Time) error {
+	if userAgent == "" {
+		userAgent = "Unknown device"
+	}
+	if ipAddress == "" {
+		ipAddress = "Unknown"
+	}
+	data := map[string]string{
+		"SignedInAt": signedInAt.UTC().Format("January 2, 2006 at 15:04 UTC"),
+		"IPAddress":  ipAddress,
+		"UserAgent":  userAgent,
+	}
+
+	return c.SendEmail(
+		to,
+		"New sign-in to your account",
+		TemplateNewSignIn,
+		data,
+	)
+}
+
+func (c *Client) SendDeletionScheduledEmail(to string, deleteAt time.Time) error {
+	data := map[string]string{
+		"DeleteAt": deleteAt.UTC().Format("January 2, 2006 at 15:04 UTC"),
+	}
+
+	return c.SendEmail(
+		to,
+		"Your account is scheduled for deletion",
+		TemplateDeletionScheduled,
+		data,
+	)
+}
+
+func (c *Client) SendDeletionCancelledEmail(to string) error {
+	return c.SendEmail(
+		to,
+		"Your account deletion was cancelled",
+		TemplateDeletionCancelled,
+		map[string]string{},
+	)
+}
+
+func (c *Client) SendAccountRestoreEmail(to, token string, expiresAt time.Time) error {
+	data := map[string]string{
+		"RestoreURL": c.appURL + "/restore-account?token=" + url.QueryEscape(token),
+		"ExpiresIn":  humanizeDuration(time.Until(expiresAt)),
+	}
+
+	return c.SendEmail(
+		to,
+		"Restore your account",
+		TemplateAccountRestore,
+		data,
+	)
+}
+
+func (c *Client) SendDataExportEmail(to, downloadURL string, expiresAt time.Time) error {
+	data := map[string]string{
+		"DownloadURL": downloadURL,
+		"ExpiresIn":   humanizeDuration(time.Until(expiresAt)),
+	}
+
+	return c.SendEmail(
+		to,
+		"Your data export is ready",
+		TemplateDataExport,
+		data,
+	)
+}
+
+// humanizeDuration renders d rounded to whole days from two days up, whole
+// hours from an hour up, or minutes below an hour.
+func humanizeDuration(d time.Duration) string {
+	if d >= 48*time.Hour {
+		return strconv.Itoa(int(d.Round(24*time.Hour)/(24*time.Hour))) + " days"
+	}
+	if d >= time.Hour {
+		h := int(d.Round(time.Hour) / time.Hour)
+		if h == 1 {
+			return "1 hour"
+		}
+		return strconv.Itoa(h) + " hours"
+	}
+	m := int(d.Round(time.Minute) / time.Minute)
+	if m <= 1 {
+		return "1 minute"
+	}
+	return strconv.Itoa(m) + " minutes"
+}
@@ -4,4 +4,29 @@ var PreviewData = map[string]map[string]string{
 	"welcome": {
 		"UserFirstName": "John",
 	},
+	"verify-email": {
+		"VerifyURL": "https://example.com/verify-email?token=abc123",
+		"ExpiresIn": "24 hours",
+	},
+	"magic-link": {
+		"LoginURL":  "https://example.com/magic-link?token=abc123",
+		"ExpiresIn": "15 minutes",
+	},
+	"new-sign-in": {
+		"SignedInAt": "January 2, 2025 at 15:04 UTC",
+		"IPAddress":  "203.0.113.7",
+		"UserAgent":  "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_0) Safari/605.1.15",
+	},
+	"deletion-scheduled": {
+		"DeleteAt": "February 1, 2025 at 15:04 UTC",
+	},
+	"deletion-cancelled": {},
+	"account-restore": {
+		"RestoreURL": "https://example.com/restore-account?token=abc123",
+		"ExpiresIn":  "1 hour",
+	},
+	"data-export": {
+		"DownloadURL": "https://api.example.com/api/v1/exports/0b6f0d5e/download?expires=1735830240&signature=abc123",
+		"ExpiresIn":   "7 days",
+	},
 }
@@ -3,5 +3,13 @@ package email
 type Template string
 
 const (
-	TemplateWelcome Template = "welcome"
+	TemplateWelcome     Template = "welcome"
+	TemplateVerifyEmail Template = "verify-email"
+	TemplateMagicLink   Template = "magic-link"
+	TemplateNewSignIn   Template = "new-sign-in"
+
+	TemplateDeletionScheduled Template = "deletion-scheduled"
+	TemplateDeletionCancelled Template = "deletion-cancelled"
+	TemplateAccountRestore    Template = "account-restore"
+	TemplateDataExport        Template = "data-export"
 )
@@ -0,0 +1,79 @@
+// Package encrypt seals small secrets (such as TOTP seeds) for storage at
+// rest using AES-256-GCM. Keys are supplied as a key ring in the same form as
+// the other secrets in AuthConfig: the first key seals, every key is tried
+// when opening, so keys can be rotated without re-encrypting existing rows.
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+const version = "v1:"
+
+var (
+	ErrNoKey      = errors.New("encrypt: no key configured")
+	ErrMalformed  = errors.New("encrypt: malformed ciphertext")
+	ErrDecryption = errors.New("encrypt: unable to decrypt with any configured key")
+)
+
+// Seal encrypts plaintext with the first key of keys. The result is a
+// printable string suitable for a TEXT column.
+func Seal(keys []string, plaintext []byte) (string, error) {
+	if len(keys) == 0 {
+		return "", ErrNoKey
+	}
+	aead, err := newAEAD(keys[0])
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, nil)
+	return version + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a value produced by Seal, trying every key in keys.
+func Open(keys []string, sealed string) ([]byte, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKey
+	}
+	if !strings.HasPrefix(sealed, version) {
+		return nil, ErrMalformed
+	}
+	raw, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(sealed, version))
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	for _, key := range keys {
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		if len(raw) < aead.NonceSize() {
+			return nil, ErrMalformed
+		}
+		nonce, ciphertext := raw[:aead.NonceSize()], raw[aead.NonceSize():]
+		if plaintext, err := aead.Open(nil, nonce, ciphertext, nil); err == nil {
+			return plaintext, nil
+		}
+	}
+	return nil, ErrDecryption
+}
+
+// newAEAD derives a 256-bit AES key from an arbitrary length secret.
+func newAEAD(secret string) (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,40 @@
+package encrypt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSealOpen(t *testing.T) {
+	sealed, err := Seal([]string{"k1"}, []byte("JBSWY3DPEHPK3PXP"))
+	require.NoError(t, err)
+	require.NotContains(t, sealed, "JBSWY3DPEHPK3PXP")
+
+	plain, err := Open([]string{"k1"}, sealed)
+	require.NoError(t, err)
+	require.Equal(t, "JBSWY3DPEHPK3PXP", string(plain))
+
+	// sealing twice yields different ciphertexts
+	again, err := Seal([]string{"k1"}, []byte("JBSWY3DPEHPK3PXP"))
+	require.NoError(t, err)
+	require.NotEqual(t, sealed, again)
+}
+
+func TestOpenAfterRotation(t *testing.T) {
+	sealed, err := Seal([]string{"old"}, []byte("secret"))
+	require.NoError(t, err)
+
+	plain, err := Open([]string{"new", "old"}, sealed)
+	require.NoError(t, err)
+	require.Equal(t, "secret", string(plain))
+
+	_, err = Open([]string{"new"}, sealed)
+	require.ErrorIs(t, err, ErrDecryption)
+
+	_, err = Open([]string{"new"}, "not-sealed")
+	require.ErrorIs(t, err, ErrMalformed)
+
+	_, err = Seal(nil, []byte("secret"))
+	require.ErrorIs(t, err, ErrNoKey)
+}
@@ -0,0 +1,151 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/petonlabs/go-boilerplate/internal/lib/token"
+	"github.com/petonlabs/go-boilerplate/internal/lib/userdata"
+)
+
+// DefaultDataExportTTL is how long an export can be downloaded when
+// config.Auth.DataExportTTL is unset.
+const DefaultDataExportTTL = 7 * 24 * time.Hour
+
+// DataExportKey is the storage key of an export archive.
+func DataExportKey(exportID string) string {
+	return "exports/" + exportID + ".zip"
+}
+
+func (j *JobService) handleUserExportTask(ctx context.Context, t *asynq.Task) error {
+	var p UserExportPayload
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		return fmt.Errorf("failed to unmarshal user export payload: %w", err)
+	}
+
+	logger := j.logger.With().Str("export_id", p.ExportID).Str("user_id", p.UserID).Logger()
+	logger.Info().Msg("Processing user export task")
+
+	if j.db == nil || j.db.Pool == nil || j.storage == nil || j.config == nil {
+		return fmt.Errorf("export worker is not initialized")
+	}
+
+	var email *string
+	var status string
+	err := j.db.Pool.QueryRow(ctx, `SELECT e.status, u.email FROM data_exports e JOIN users u ON u.id = e.user_id
+WHERE e.id::text = $1 AND u.id::text = $2`, p.ExportID, p.UserID).Scan(&status, &email)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to load data export")
+		return err
+	}
+	if status != "pending" {
+		logger.Info().Str("status", status).Msg("data export already processed, skipping")
+		return nil
+	}
+
+	size, err := j.writeExport(ctx, p)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to build data export")
+		j.failExport(ctx, p.ExportID, err)
+		return err
+	}
+
+	ttl := DefaultDataExportTTL
+	if j.config.Auth.DataExportTTL > 0 {
+		ttl = time.Duration(j.config.Auth.DataExportTTL) * time.Second
+	}
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+	if _, err := j.db.Pool.Exec(ctx, `UPDATE data_exports SET status = 'ready', storage_key = $2, size_bytes = $3,
+	completed_at = now(), expires_at = $4, error = NULL
+WHERE id::text = $1`, p.ExportID, DataExportKey(p.ExportID), size, expiresAt); err != nil {
+		logger.Error().Err(err).Msg("failed to mark data export ready")
+		return err
+	}
+	j.expireOlderExports(ctx, p)
+
+	if email == nil || *email == "" {
+		logger.Warn().Msg("user has no email address, data export link not sent")
+		return nil
+	}
+	secrets := token.KeyRing(j.config.Auth.TokenHMACSecret, j.config.Auth.SecretKey)
+	if len(secrets) == 0 {
+		return fmt.Errorf("no secret configured to sign download links")
+	}
+	baseURL := j.config.Primary.APIURL
+	if baseURL == "" {
+		baseURL = j.config.Primary.AppURL
+	}
+	link := userdata.DownloadURL(strings.TrimRight(baseURL, "/"), secrets[0], p.ExportID, expiresAt)
+	if err := j.email.SendDataExportEmail(*email, link, expiresAt); err != nil {
+		logger.Error().Err(err).Msg("Failed to send data export email")
+		return err
+	}
+
+	logger.Info().Int64("size_bytes", size).Msg("User export completed")
+	return nil
+}
+
+// writeExport streams the archive of p.UserID into storage and returns its
+// size.
+func (j *JobService) writeExport(ctx context.Context, p UserExportPayload) (int64, error) {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(userdata.Default.WriteExport(ctx, j.db.Pool, p.UserID, pw))
+	}()
+	counter := &countingReader{r: pr}
+	err := j.storage.Put(ctx, DataExportKey(p.ExportID), counter)
+	_ = pr.CloseWithError(err)
+	return counter.n, err
+}
+
+// failExport marks the export failed once asynq has run out of retries.
+func (j *JobService) failExport(ctx context.Context, exportID string, cause error) {
+	retried, _ := asynq.GetRetryCount(ctx)
+	maxRetry, _ := asynq.GetMaxRetry(ctx)
+	if retried < maxRetry {
+		return
+	}
+	if _, err := j.db.Pool.Exec(ctx, `UPDATE data_exports SET status = 'failed', error = $2, completed_at = now()
+WHERE id::text = $1 AND status = 'pending'`, exportID, cause.Error()); err != nil {
+		j.logger.Error().Err(err).Str("export_id", exportID).Msg("failed to mark data export failed")
+	}
+}
+
+// expireOlderExports deletes the user's previous archives so that only the
+// latest one is kept.
+func (j *JobService) expireOlderExports(ctx context.Context, p UserExportPayload) {
+	rows, err := j.db.Pool.Query(ctx, `UPDATE data_exports e SET status = 'expired', storage_key = NULL
+FROM data_exports old
+WHERE old.id = e.id AND e.user_id::text = $1 AND e.id::text <> $2 AND e.status = 'ready'
+RETURNING old.storage_key`, p.UserID, p.ExportID)
+	if err != nil {
+		j.logger.Error().Err(err).Str("user_id", p.UserID).Msg("failed to expire older data exports")
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key *string
+		if err := rows.Scan(&key); err != nil || key == nil {
+			continue
+		}
+		if err := j.storage.Delete(ctx, *key); err != nil {
+			j.logger.Warn().Err(err).Str("key", *key).Msg("failed to delete expired data export")
+		}
+	}
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,166 @@
+package job
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/jackc/pgx/v5"
+	"github.com/petonlabs/go-boilerplate/internal/lib/rbac"
+	"github.com/petonlabs/go-boilerplate/internal/lib/userdata"
+)
+
+// DefaultDeletionSweepSchedule is used when config.Auth.DeletionSweepSchedule
+// is unset.
+const DefaultDeletionSweepSchedule = "@every 15m"
+
+// userDeleteQueue is the queue of NewUserDeleteTask.
+const userDeleteQueue = "critical"
+
+// TaskDeleter removes tasks that have not run yet. It is satisfied by
+// *asynq.Inspector.
+type TaskDeleter interface {
+	GetTaskInfo(queue, id string) (*asynq.TaskInfo, error)
+	DeleteTask(queue, id string) error
+}
+
+// UserDeleteTaskID is the asynq task ID of userID's deletion, so that each
+// user has at most one pending deletion task.
+func UserDeleteTaskID(userID string) string {
+	return TaskUserDelete + ":" + userID
+}
+
+// ScheduleUserDeletion enqueues the deletion of userID to run at when,
+// replacing the pending deletion task if there is one. The task only wakes
+// the worker up; deletion_scheduled_at decides whether it deletes anything. So
+// if a task with the same ID is left over, because it is already running or a
+// concurrent call enqueued its own, it is kept, and a deletion that it misses
+// is picked up by the sweeper.
+func (j *JobService) ScheduleUserDeletion(userID string, when time.Time) error {
+	if j.Client == nil {
+		return fmt.Errorf("job client not initialized")
+	}
+	if err := j.CancelUserDeletion(userID); err != nil {
+		return err
+	}
+	task, err := NewUserDeleteTask(userID)
+	if err != nil {
+		return err
+	}
+	_, err = j.Client.Enqueue(task, asynq.TaskID(UserDeleteTaskID(userID)), asynq.ProcessAt(when))
+	if errors.Is(err, asynq.ErrTaskIDConflict) {
+		j.logger.Info().Str("user_id", userID).Msg("deletion task already queued or running, keeping it")
+		return nil
+	}
+	return err
+}
+
+// CancelUserDeletion deletes userID's pending deletion task. It is not an
+// error if there is none. A task that is already running cannot be deleted;
+// it re-checks the schedule before deleting anything, so that is not an error
+// either.
+func (j *JobService) CancelUserDeletion(userID string) error {
+	if j.Inspector == nil {
+		return fmt.Errorf("job inspector not initialized")
+	}
+	id := UserDeleteTaskID(userID)
+	running, err := j.userDeletionRunning(id)
+	if err != nil || running {
+		return err
+	}
+	err = j.Inspector.DeleteTask(userDeleteQueue, id)
+	if err == nil || isMissingTaskError(err) {
+		return nil
+	}
+	// The task may have started between the two calls.
+	if running, infoErr := j.userDeletionRunning(id); infoErr == nil && running {
+		return nil
+	}
+	return err
+}
+
+// userDeletionRunning reports whether the deletion task with the given ID is
+// active. A missing task is not running.
+func (j *JobService) userDeletionRunning(id string) (bool, error) {
+	info, err := j.Inspector.GetTaskInfo(userDeleteQueue, id)
+	if isMissingTaskError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return info.State == asynq.TaskStateActive, nil
+}
+
+func isMissingTaskError(err error) bool {
+	return errors.Is(err, asynq.ErrTaskNotFound) || errors.Is(err, asynq.ErrQueueNotFound)
+}
+
+// handleUserDeleteSweepTask deletes users whose scheduled deletion is overdue,
+// in case their deletion task was lost or could not be enqueued.
+func (j *JobService) handleUserDeleteSweepTask(ctx context.Context, t *asynq.Task) error {
+	if j.db == nil || j.db.Pool == nil {
+		j.logger.Error().Msg("database not available to deletion sweeper")
+		return fmt.Errorf("db not available")
+	}
+
+	// Leave a minute for deletion tasks that are due right now.
+	rows, err := j.db.Pool.Query(ctx, `SELECT id::text FROM users
+WHERE deleted_at IS NULL AND deletion_scheduled_at <= now() - interval '1 minute'
+ORDER BY deletion_scheduled_at LIMIT 500`)
+	if err != nil {
+		return fmt.Errorf("select overdue deletions: %w", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return fmt.Errorf("select overdue deletions: %w", err)
+	}
+
+	deleted := 0
+	escrow := j.deletionEscrow()
+	for _, id := range ids {
+		ok, err := j.deleteDueUser(ctx, id, escrow)
+		if err != nil {
+			j.logger.Error().Err(err).Str("user_id", id).Msg("failed to delete overdue user")
+			continue
+		}
+		if ok {
+			deleted++
+		}
+	}
+	if len(ids) > 0 {
+		j.logger.Warn().Int("overdue", len(ids)).Int("deleted", deleted).Msg("Deleted users whose deletion task did not run")
+	}
+	return nil
+}
+
+// deleteDueUser deletes userID through userdata.Default, which revokes its
+// sessions and tokens in the same transaction, and then drops its cached
+// permissions under both our ID and its Clerk ID. The cache is cleared after
+// the commit so that a concurrent request cannot refill it from the rows the
+// deletion is about to remove.
+func (j *JobService) deleteDueUser(ctx context.Context, userID string, escrow *userdata.Escrow) (bool, error) {
+	var clerkID *string
+	err := j.db.Pool.QueryRow(ctx, `SELECT clerk_id FROM users WHERE id::text = $1`, userID).Scan(&clerkID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	deleted, err := userdata.Default.DeleteDueUser(ctx, j.db.Pool, userID, escrow, j.logger)
+	if err != nil || !deleted {
+		return deleted, err
+	}
+	ids := []string{userID}
+	if clerkID != nil {
+		ids = append(ids, *clerkID)
+	}
+	if err := rbac.Invalidate(ctx, j.redis, ids...); err != nil {
+		j.logger.Warn().Err(err).Str("user_id", userID).Msg("failed to clear cached permissions of deleted user")
+	}
+	return true, nil
+}
@@ -0,0 +1,31 @@
+package job
+
+import (
+	"testing"
+	"time"
+
+	"github.com/petonlabs/go-boilerplate/internal/testhelpers/mocks"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserDeletionKeepsRunningTask(t *testing.T) {
+	m := mocks.NewMockEnqueuer()
+	logger := zerolog.Nop()
+	j := &JobService{Client: m, Inspector: m, logger: &logger}
+
+	// Cancelling without a task is not an error.
+	require.NoError(t, j.CancelUserDeletion("user-1"))
+
+	require.NoError(t, j.ScheduleUserDeletion("user-1", time.Now().Add(time.Hour)))
+	require.Len(t, m.GetTasks(), 1)
+	require.NoError(t, j.CancelUserDeletion("user-1"))
+	require.Empty(t, m.GetTasks())
+
+	// A running task cannot be deleted; it is kept and neither call fails.
+	require.NoError(t, j.ScheduleUserDeletion("user-1", time.Now().Add(time.Hour)))
+	m.SetActive(UserDeleteTaskID("user-1"))
+	require.NoError(t, j.CancelUserDeletion("user-1"))
+	require.NoError(t, j.ScheduleUserDeletion("user-1", time.Now().Add(2*time.Hour)))
+	require.Len(t, m.GetTasks(), 1)
+}
@@ -10,6 +10,13 @@ import (
 const (
 	TaskWelcome       = "email:welcome"
 	TaskPasswordReset = "email:password_reset"
+	TaskVerifyEmail   = "email:verify_email"
+	TaskMagicLink     = "email:magic_link"
+	TaskNewSignIn     = "email:new_sign_in"
+
+	TaskDeletionScheduled = "email:deletion_scheduled"
+	TaskDeletionCancelled = "email:deletion_cancelled"
+	TaskAccountRestore    = "email:account_restore"
 )
 
 type WelcomeEmailPayload struct {
@@ -38,6 +45,128 @@ func NewPasswordResetTask(to, token string, expiresAt int64) (*asynq.Task, error
 		asynq.Timeout(30*time.Second)), nil
 }
 
+type EmailVerificationPayload struct {
+	To        string `json:"to"`
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+func NewEmailVerificationTask(to, token string, expiresAt int64) (*asynq.Task, error) {
+	payload, err := json.Marshal(EmailVerificationPayload{
+		To:        to,
+		Token:     token,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asynq.NewTask(TaskVerifyEmail, payload,
+		asynq.MaxRetry(3),
+		asynq.Queue("critical"),
+		asynq.Timeout(30*time.Second)), nil
+}
+
+type MagicLinkPayload struct {
+	To        string `json:"to"`
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+func NewMagicLinkTask(to, token string, expiresAt int64) (*asynq.Task, error) {
+	payload, err := json.Marshal(MagicLinkPayload{
+		To:        to,
+		Token:     token,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// The link is only valid for minutes, so a delivery that keeps failing
+	// is not worth retrying for long.
+	return asynq.NewTask(TaskMagicLink, payload,
+		asynq.MaxRetry(2),
+		asynq.Queue("critical"),
+		asynq.Timeout(30*time.Second)), nil
+}
+
+type NewSignInPayload struct {
+	To         string `json:"to"`
+	IPAddress  string `json:"ip_address"`
+	UserAgent  string `json:"user_agent"`
+	SignedInAt int64  `json:"signed_in_at"`
+}
+
+func NewSignInAlertTask(to, ipAddress, userAgent string, signedInAt int64) (*asynq.Task, error) {
+	payload, err := json.Marshal(NewSignInPayload{
+		To:         to,
+		IPAddress:  ipAddress,
+		UserAgent:  userAgent,
+		SignedInAt: signedInAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asynq.NewTask(TaskNewSignIn, payload,
+		asynq.MaxRetry(3),
+		asynq.Queue("default"),
+		asynq.Timeout(30*time.Second)), nil
+}
+
+type DeletionScheduledPayload struct {
+	To       string `json:"to"`
+	DeleteAt int64  `json:"delete_at"`
+}
+
+func NewDeletionScheduledTask(to string, deleteAt int64) (*asynq.Task, error) {
+	payload, err := json.Marshal(DeletionScheduledPayload{
+		To:       to,
+		DeleteAt: deleteAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asynq.NewTask(TaskDeletionScheduled, payload,
+		asynq.MaxRetry(3),
+		asynq.Queue("critical"),
+		asynq.Timeout(30*time.Second)), nil
+}
+
+type DeletionCancelledPayload struct {
+	To string `json:"to"`
+}
+
+func NewDeletionCancelledTask(to string) (*asynq.Task, error) {
+	payload, err := json.Marshal(DeletionCancelledPayload{To: to})
+	if err != nil {
+		return nil, err
+	}
+	return asynq.NewTask(TaskDeletionCancelled, payload,
+		asynq.MaxRetry(3),
+		asynq.Queue("default"),
+		asynq.Timeout(30*time.Second)), nil
+}
+
+type AccountRestorePayload struct {
+	To        string `json:"to"`
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+func NewAccountRestoreTask(to, token string, expiresAt int64) (*asynq.Task, error) {
+	payload, err := json.Marshal(AccountRestorePayload{
+		To:        to,
+		Token:     token,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asynq.NewTask(TaskAccountRestore, payload,
+		asynq.MaxRetry(2),
+		asynq.Queue("critical"),
+		asynq.Timeout(30*time.Second)), nil
+}
+
 func NewWelcomeEmailTask(to, firstName string) (*asynq.Task, error) {
 	payload, err := json.Marshal(WelcomeEmailPayload{
 		To:        to,
@@ -2,18 +2,27 @@ package job
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/hibiken/asynq"
+	"github.com/newrelic/go-agent/v3/newrelic"
 	"github.com/petonlabs/go-boilerplate/internal/config"
 	"github.com/petonlabs/go-boilerplate/internal/lib/email"
+	"github.com/petonlabs/go-boilerplate/internal/lib/storage"
+	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog"
 )
 
-func (j *JobService) InitHandlers(config *config.Config, logger *zerolog.Logger) {
+func (j *JobService) InitHandlers(config *config.Config, logger *zerolog.Logger, store storage.Storage, rdb *redis.Client, nrApp *newrelic.Application) {
 	j.email = email.NewClient(config, logger)
+	j.config = config
+	j.storage = store
+	j.redis = rdb
+	j.nrApp = nrApp
 }
 
 func (j *JobService) handleUserDeleteTask(ctx context.Context, t *asynq.Task) error {
@@ -32,6 +41,10 @@ func (j *JobService) handleUserDeleteTask(ctx context.Context, t *asynq.Task) er
 	// Ensure the deletion is still scheduled (check deletion_scheduled_at)
 	var scheduledAt *time.Time
 	err := j.db.Pool.QueryRow(ctx, `SELECT deletion_scheduled_at FROM users WHERE id::text=$1`, p.UserID).Scan(&scheduledAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		j.logger.Info().Str("user_id", p.UserID).Msg("user already purged, skipping deletion")
+		return nil
+	}
 	if err != nil {
 		j.logger.Error().Err(err).Str("user_id", p.UserID).Msg("failed to query user for deletion")
 		return err
@@ -45,19 +58,15 @@ func (j *JobService) handleUserDeleteTask(ctx context.Context, t *asynq.Task) er
 		return nil
 	}
 
-	// Perform deletion atomically: soft-delete only if still scheduled and time has arrived
-	result, err := j.db.Pool.Exec(ctx, `
-		UPDATE users
-		SET deleted_at = now(), email = NULL, password_hash = NULL
-		WHERE id::text = $1
-		  AND deletion_scheduled_at IS NOT NULL
-		  AND deletion_scheduled_at <= now()
-	`, p.UserID)
+	// Perform deletion atomically: soft-delete only if still scheduled and
+	// time has arrived, escrowing what a restore needs and removing the
+	// user's data through the registered deletion hooks.
+	deleted, err := j.deleteDueUser(ctx, p.UserID, j.deletionEscrow())
 	if err != nil {
 		j.logger.Error().Err(err).Str("user_id", p.UserID).Msg("failed to delete user")
 		return err
 	}
-	if result.RowsAffected() == 0 {
+	if !deleted {
 		j.logger.Info().Str("user_id", p.UserID).Msg("deletion no longer scheduled or not yet time, skipping")
 		return nil
 	}
@@ -96,3 +105,165 @@ func (j *JobService) handleWelcomeEmailTask(ctx context.Context, t *asynq.Task)
 		Msg("Successfully sent welcome email")
 	return nil
 }
+
+func (j *JobService) handleEmailVerificationTask(ctx context.Context, t *asynq.Task) error {
+	var p EmailVerificationPayload
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		return fmt.Errorf("failed to unmarshal email verification payload: %w", err)
+	}
+
+	j.logger.Info().
+		Str("type", "verify_email").
+		Str("to", p.To).
+		Msg("Processing email verification task")
+
+	if err := j.email.SendVerificationEmail(p.To, p.Token, time.Unix(p.ExpiresAt, 0)); err != nil {
+		j.logger.Error().
+			Str("type", "verify_email").
+			Str("to", p.To).
+			Err(err).
+			Msg("Failed to send verification email")
+		return err
+	}
+
+	j.logger.Info().
+		Str("type", "verify_email").
+		Str("to", p.To).
+		Msg("Successfully sent verification email")
+	return nil
+}
+
+func (j *JobService) handleMagicLinkTask(ctx context.Context, t *asynq.Task) error {
+	var p MagicLinkPayload
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		return fmt.Errorf("failed to unmarshal magic link payload: %w", err)
+	}
+
+	j.logger.Info().
+		Str("type", "magic_link").
+		Str("to", p.To).
+		Msg("Processing magic link task")
+
+	if err := j.email.SendMagicLinkEmail(p.To, p.Token, time.Unix(p.ExpiresAt, 0)); err != nil {
+		j.logger.Error().
+			Str("type", "magic_link").
+			Str("to", p.To).
+			Err(err).
+			Msg("Failed to send magic link email")
+		return err
+	}
+
+	j.logger.Info().
+		Str("type", "magic_link").
+		Str("to", p.To).
+		Msg("Successfully sent magic link email")
+	return nil
+}
+
+func (j *JobService) handleAccountRestoreTask(ctx context.Context, t *asynq.Task) error {
+	var p AccountRestorePayload
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		return fmt.Errorf("failed to unmarshal account restore payload: %w", err)
+	}
+
+	j.logger.Info().
+		Str("type", "account_restore").
+		Str("to", p.To).
+		Msg("Processing account restore email task")
+
+	if err := j.email.SendAccountRestoreEmail(p.To, p.Token, time.Unix(p.ExpiresAt, 0)); err != nil {
+		j.logger.Error().
+			Str("type", "account_restore").
+			Str("to", p.To).
+			Err(err).
+			Msg("Failed to send account restore email")
+		return err
+	}
+
+	j.logger.Info().
+		Str("type", "account_restore").
+		Str("to", p.To).
+		Msg("Successfully sent account restore email")
+	return nil
+}
+
+func (j *JobService) handleNewSignInTask(ctx context.Context, t *asynq.Task) error {
+	var p NewSignInPayload
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		return fmt.Errorf("failed to unmarshal new sign-in payload: %w", err)
+	}
+
+	j.logger.Info().
+		Str("type", "new_sign_in").
+		Str("to", p.To).
+		Msg("Processing new sign-in email task")
+
+	if err := j.email.SendNewSignInEmail(p.To, p.IPAddress, p.UserAgent, time.Unix(p.SignedInAt, 0)); err != nil {
+		j.logger.Error().
+			Str("type", "new_sign_in").
+			Str("to", p.To).
+			Err(err).
+			Msg("Failed to send new sign-in email")
+		return err
+	}
+
+	j.logger.Info().
+		Str("type", "new_sign_in").
+		Str("to", p.To).
+		Msg("Successfully sent new sign-in email")
+	return nil
+}
+
+func (j *JobService) handleDeletionScheduledTask(ctx context.Context, t *asynq.Task) error {
+	var p DeletionScheduledPayload
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		return fmt.Errorf("failed to unmarshal deletion scheduled payload: %w", err)
+	}
+
+	j.logger.Info().
+		Str("type", "deletion_scheduled").
+		Str("to", p.To).
+		Msg("Processing deletion scheduled email task")
+
+	if err := j.email.SendDeletionScheduledEmail(p.To, time.Unix(p.DeleteAt, 0)); err != nil {
+		j.logger.Error().
+			Str("type", "deletion_scheduled").
+			Str("to", p.To).
+			Err(err).
+			Msg("Failed to send deletion scheduled email")
+		return err
+	}
+
+	j.logger.Info().
+		Str("type", "deletion_scheduled").
+		Str("to", p.To).
+		Msg("Successfully sent deletion scheduled email")
+	return nil
+}
+
+func (j *JobService) handleDeletionCancelledTask(ctx context.Context, t *asynq.Task) error {
+	var p DeletionCancelledPayload
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		return fmt.Errorf("failed to unmarshal deletion cancelled payload: %w", err)
+	}
+
+	j.logger.Info().
+		Str("type", "deletion_cancelled").
+		Str("to", p.To).
+		Msg("Processing deletion cancelled email task")
+
+	if err := j.email.SendDeletionCancelledEmail(p.To); err != nil {
+		j.logger.Error().
+			Str("type", "deletion_cancelled").
+			Str("to", p.To).
+			Err(err).
+			Msg("Failed to send deletion cancelled email")
+		return err
+	}
+
+	j.logger.Info().
+		Str("type", "deletion_cancelled").
+		Str("to", p.To).
+		Msg("Successfully sent deletion cancelled email")
+	return nil
+}
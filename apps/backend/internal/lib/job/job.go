@@ -2,22 +2,38 @@ package job
 
 import (
 	"errors"
+	"fmt"
 
 	"github.com/hibiken/asynq"
+	"github.com/newrelic/go-agent/v3/newrelic"
 	"github.com/petonlabs/go-boilerplate/internal/config"
 	"github.com/petonlabs/go-boilerplate/internal/database"
 	"github.com/petonlabs/go-boilerplate/internal/lib/email"
+	"github.com/petonlabs/go-boilerplate/internal/lib/storage"
+	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog"
 )
 
 type JobService struct {
 	// Client is an abstraction over asynq.Client so tests can inject a mock.
 	Client Enqueuer
-	server *asynq.Server
-	logger *zerolog.Logger
-	db     *database.Database
+	// Inspector removes pending tasks, such as cancelled deletions.
+	Inspector TaskDeleter
+	server    *asynq.Server
+	// scheduler enqueues the periodic tasks registered in Start.
+	scheduler *asynq.Scheduler
+	logger    *zerolog.Logger
+	db        *database.Database
 	// email client will be initialized by InitHandlers
 	email *email.Client
+	// config and storage are set by InitHandlers for the data export task.
+	config  *config.Config
+	storage storage.Storage
+	// redis holds the permission cache that is cleared when a user is
+	// deleted; nil disables it.
+	redis *redis.Client
+	// nrApp records job metrics; nil when New Relic is not configured.
+	nrApp *newrelic.Application
 }
 
 // Enqueuer abstracts the subset of asynq.Client used by our app so tests
@@ -52,30 +68,78 @@ func NewJobService(logger *zerolog.Logger, cfg *config.Config, db *database.Data
 		},
 	)
 
+	scheduler := asynq.NewScheduler(asynq.RedisClientOpt{Addr: redisAddr}, nil)
+	inspector := asynq.NewInspector(asynq.RedisClientOpt{Addr: redisAddr})
+
 	return &JobService{
-		Client: client,
-		server: server,
-		logger: logger,
-		db:     db,
+		Client:    client,
+		Inspector: inspector,
+		server:    server,
+		scheduler: scheduler,
+		logger:    logger,
+		db:        db,
 	}, nil
 }
 
 func (j *JobService) Start() error {
 	mux := asynq.NewServeMux()
 	mux.HandleFunc(TaskWelcome, j.handleWelcomeEmailTask)
+	mux.HandleFunc(TaskVerifyEmail, j.handleEmailVerificationTask)
+	mux.HandleFunc(TaskMagicLink, j.handleMagicLinkTask)
+	mux.HandleFunc(TaskNewSignIn, j.handleNewSignInTask)
+	mux.HandleFunc(TaskDeletionScheduled, j.handleDeletionScheduledTask)
+	mux.HandleFunc(TaskDeletionCancelled, j.handleDeletionCancelledTask)
+	mux.HandleFunc(TaskAccountRestore, j.handleAccountRestoreTask)
 	mux.HandleFunc(TaskUserDelete, j.handleUserDeleteTask)
+	mux.HandleFunc(TaskUserExport, j.handleUserExportTask)
+	mux.HandleFunc(TaskUserPurge, j.handleUserPurgeTask)
+	mux.HandleFunc(TaskUserDeleteSweep, j.handleUserDeleteSweepTask)
 
 	j.logger.Info().Msg("Starting background job server")
 	if err := j.server.Start(mux); err != nil {
 		return err
 	}
 
+	if err := j.registerPeriodicTasks(); err != nil {
+		return err
+	}
+	return j.scheduler.Start()
+}
+
+// registerPeriodicTasks adds the tasks enqueued on a schedule.
+func (j *JobService) registerPeriodicTasks() error {
+	purgeSchedule, sweepSchedule := DefaultPurgeSchedule, DefaultDeletionSweepSchedule
+	if j.config != nil && j.config.Auth.PurgeSchedule != "" {
+		purgeSchedule = j.config.Auth.PurgeSchedule
+	}
+	if j.config != nil && j.config.Auth.DeletionSweepSchedule != "" {
+		sweepSchedule = j.config.Auth.DeletionSweepSchedule
+	}
+	periodic := []struct {
+		spec    string
+		newTask func() (*asynq.Task, error)
+	}{
+		{purgeSchedule, NewUserPurgeTask},
+		{sweepSchedule, NewUserDeleteSweepTask},
+	}
+	for _, p := range periodic {
+		task, err := p.newTask()
+		if err != nil {
+			return err
+		}
+		if _, err := j.scheduler.Register(p.spec, task); err != nil {
+			return fmt.Errorf("failed to schedule %s: %w", task.Type(), err)
+		}
+	}
 	return nil
 }
 
 func (j *JobService) Stop() {
 	j.logger.Info().Msg("Stopping background job server")
 	// server may be nil in tests where we only inject a client mock
+	if j.scheduler != nil {
+		j.scheduler.Shutdown()
+	}
 	if j.server != nil {
 		j.server.Shutdown()
 	}
@@ -84,4 +148,9 @@ func (j *JobService) Stop() {
 			j.logger.Warn().Err(err).Msg("Error closing job client")
 		}
 	}
+	if inspector, ok := j.Inspector.(*asynq.Inspector); ok {
+		if err := inspector.Close(); err != nil {
+			j.logger.Warn().Err(err).Msg("Error closing job inspector")
+		}
+	}
 }
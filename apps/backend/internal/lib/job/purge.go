@@ -0,0 +1,86 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/petonlabs/go-boilerplate/internal/lib/userdata"
+)
+
+const (
+	// DefaultPurgeRetention is how long deleted users are kept when
+	// config.Auth.PurgeRetention is unset.
+	DefaultPurgeRetention = 30 * 24 * time.Hour
+	// DefaultPurgeSchedule is used when config.Auth.PurgeSchedule is unset.
+	DefaultPurgeSchedule = "@hourly"
+
+	purgeBatchSize = 500
+)
+
+func (j *JobService) handleUserPurgeTask(ctx context.Context, t *asynq.Task) error {
+	if j.db == nil || j.db.Pool == nil {
+		j.logger.Error().Msg("database not available to purge worker")
+		return fmt.Errorf("db not available")
+	}
+
+	retention := DefaultPurgeRetention
+	if j.config != nil && j.config.Auth.PurgeRetention > 0 {
+		retention = time.Duration(j.config.Auth.PurgeRetention) * time.Second
+	}
+	// Users are kept at least as long as they can be restored, or the purge
+	// would delete their escrow within the recovery window.
+	if window := j.restoreWindow(); window > retention {
+		j.logger.Warn().Dur("retention", retention).Dur("restore_window", window).
+			Msg("purge retention is shorter than the restore window, keeping deleted users for the restore window")
+		retention = window
+	}
+	cutoff := time.Now().Add(-retention)
+
+	purged := 0
+	defer func() { j.recordPurge(purged, retention) }()
+	for {
+		res, err := userdata.PurgeDeletedUsers(ctx, j.db.Pool, cutoff, purgeBatchSize)
+		if err != nil {
+			j.logger.Error().Err(err).Int("purged", purged).Msg("failed to purge deleted users")
+			return err
+		}
+		purged += len(res.UserIDs)
+		for _, key := range res.FileKeys {
+			if j.storage == nil {
+				break
+			}
+			if err := j.storage.Delete(ctx, key); err != nil {
+				j.logger.Warn().Err(err).Str("key", key).Msg("failed to delete purged user's file")
+			}
+		}
+		if len(res.UserIDs) < purgeBatchSize {
+			break
+		}
+	}
+
+	// Escrows outlive their recovery window when it is shorter than the
+	// retention period.
+	escrows, err := userdata.DeleteExpiredEscrows(ctx, j.db.Pool)
+	if err != nil {
+		j.logger.Error().Err(err).Msg("failed to delete expired escrows")
+		return err
+	}
+
+	j.logger.Info().Int("purged", purged).Int64("expired_escrows", escrows).Time("cutoff", cutoff).
+		Msg("Deleted user purge completed")
+	return nil
+}
+
+// recordPurge reports the number of users purged to New Relic.
+func (j *JobService) recordPurge(purged int, retention time.Duration) {
+	if j.nrApp == nil {
+		return
+	}
+	j.nrApp.RecordCustomMetric("Custom/Users/Purged", float64(purged))
+	j.nrApp.RecordCustomEvent("UsersPurged", map[string]interface{}{
+		"count":             purged,
+		"retention_seconds": int64(retention / time.Second),
+	})
+}
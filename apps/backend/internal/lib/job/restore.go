@@ -0,0 +1,43 @@
+package job
+
+import (
+	"time"
+
+	"github.com/petonlabs/go-boilerplate/internal/lib/token"
+	"github.com/petonlabs/go-boilerplate/internal/lib/userdata"
+)
+
+// DefaultRestoreWindow is how long a deleted account can be restored when
+// config.Auth.RestoreWindow is unset.
+const DefaultRestoreWindow = 14 * 24 * time.Hour
+
+// restoreWindow returns how long deleted accounts can be restored, or 0 when
+// the escrow is disabled.
+func (j *JobService) restoreWindow() time.Duration {
+	if j.config == nil || j.config.Auth.RestoreWindow < 0 {
+		return 0
+	}
+	if j.config.Auth.RestoreWindow > 0 {
+		return time.Duration(j.config.Auth.RestoreWindow) * time.Second
+	}
+	return DefaultRestoreWindow
+}
+
+// deletionEscrow returns how the profile of a user being deleted is escrowed,
+// or nil when the escrow is disabled or no key is configured.
+func (j *JobService) deletionEscrow() *userdata.Escrow {
+	window := j.restoreWindow()
+	if window == 0 {
+		return nil
+	}
+	keys := token.KeyRing(j.config.Auth.EscrowEncryptionKey, j.config.Auth.SecretKey)
+	if len(keys) == 0 {
+		j.logger.Warn().Msg("no escrow encryption key configured, deleted accounts cannot be restored")
+		return nil
+	}
+	e := &userdata.Escrow{Keys: keys, ExpiresAt: time.Now().Add(window)}
+	if secrets := token.KeyRing(j.config.Auth.TokenHMACSecret, j.config.Auth.SecretKey); len(secrets) > 0 {
+		e.DigestSecret = secrets[0]
+	}
+	return e
+}
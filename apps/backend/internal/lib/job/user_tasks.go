@@ -9,12 +9,19 @@ import (
 
 const (
 	TaskUserDelete = "user:delete"
+	TaskUserExport = "user:export"
+	TaskUserPurge  = "user:purge"
+
+	TaskUserDeleteSweep = "user:delete_sweep"
 )
 
 type UserDeletePayload struct {
 	UserID string `json:"user_id"`
 }
 
+// NewUserDeleteTask deletes userID once its deletion is due. Enqueue it
+// through JobService.ScheduleUserDeletion, which sets the task ID and the
+// time to process it.
 func NewUserDeleteTask(userID string) (*asynq.Task, error) {
 	payload, err := json.Marshal(UserDeletePayload{UserID: userID})
 	if err != nil {
@@ -23,6 +30,42 @@ func NewUserDeleteTask(userID string) (*asynq.Task, error) {
 
 	return asynq.NewTask(TaskUserDelete, payload,
 		asynq.MaxRetry(5),
-		asynq.Queue("critical"),
+		asynq.Queue(userDeleteQueue),
 		asynq.Timeout(60*time.Second)), nil
 }
+
+type UserExportPayload struct {
+	ExportID string `json:"export_id"`
+	UserID   string `json:"user_id"`
+}
+
+func NewUserExportTask(exportID, userID string) (*asynq.Task, error) {
+	payload, err := json.Marshal(UserExportPayload{ExportID: exportID, UserID: userID})
+	if err != nil {
+		return nil, err
+	}
+
+	return asynq.NewTask(TaskUserExport, payload,
+		asynq.MaxRetry(3),
+		asynq.Queue("low"),
+		asynq.Timeout(10*time.Minute)), nil
+}
+
+// NewUserPurgeTask purges users deleted longer ago than the retention period.
+// It is unique so that schedulers on several instances do not pile up runs.
+func NewUserPurgeTask() (*asynq.Task, error) {
+	return asynq.NewTask(TaskUserPurge, nil,
+		asynq.MaxRetry(3),
+		asynq.Queue("low"),
+		asynq.Timeout(10*time.Minute),
+		asynq.Unique(30*time.Minute)), nil
+}
+
+// NewUserDeleteSweepTask deletes users whose deletion is overdue.
+func NewUserDeleteSweepTask() (*asynq.Task, error) {
+	return asynq.NewTask(TaskUserDeleteSweep, nil,
+		asynq.MaxRetry(1),
+		asynq.Queue("default"),
+		asynq.Timeout(10*time.Minute),
+		asynq.Unique(10*time.Minute)), nil
+}
@@ -0,0 +1,47 @@
+package lockout
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyDelay(t *testing.T) {
+	p := Policy{
+		Window:          15 * time.Minute,
+		BackoffAfter:    3,
+		BackoffBase:     time.Second,
+		BackoffMax:      10 * time.Second,
+		LockoutAfter:    8,
+		LockoutDuration: 15 * time.Minute,
+	}
+
+	require.Equal(t, time.Duration(0), p.Delay(0))
+	require.Equal(t, time.Duration(0), p.Delay(2))
+	require.Equal(t, time.Second, p.Delay(3))
+	require.Equal(t, 2*time.Second, p.Delay(4))
+	require.Equal(t, 8*time.Second, p.Delay(6))
+	require.Equal(t, 10*time.Second, p.Delay(7))
+	require.Equal(t, 15*time.Minute, p.Delay(8))
+	require.Equal(t, 15*time.Minute, p.Delay(20))
+}
+
+func TestPolicyDelayDisabled(t *testing.T) {
+	require.Equal(t, time.Duration(0), Policy{}.Delay(100))
+	require.Equal(t, time.Minute, Policy{LockoutAfter: 5, LockoutDuration: time.Minute}.Delay(5))
+}
+
+func TestGuardWithoutRedisNeverBlocks(t *testing.T) {
+	g := New(nil, "login:email", Policy{LockoutAfter: 1, LockoutDuration: time.Minute})
+	ctx := context.Background()
+
+	d, err := g.Fail(ctx, "bob@example.com")
+	require.NoError(t, err)
+	require.Zero(t, d)
+
+	d, err = g.Check(ctx, "bob@example.com")
+	require.NoError(t, err)
+	require.Zero(t, d)
+}
@@ -0,0 +1,261 @@
+// Package oidc implements the OpenID Connect authorization code flow with
+// PKCE against any compliant identity provider: discovery, building the
+// authorization URL, exchanging the code and verifying the ID token.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+)
+
+var (
+	// ErrDiscovery is returned when the provider metadata cannot be loaded.
+	ErrDiscovery = errors.New("oidc: provider discovery failed")
+	// ErrExchange is returned when the token endpoint rejects the code.
+	ErrExchange = errors.New("oidc: code exchange failed")
+	// ErrIDToken is returned when the ID token is missing or invalid.
+	ErrIDToken = errors.New("oidc: invalid id token")
+)
+
+// DefaultScopes are requested when Config.Scopes is empty.
+var DefaultScopes = []string{"openid", "email", "profile"}
+
+// allowedAlgorithms are the ID token signature algorithms we accept. HMAC
+// algorithms are excluded because the client secret would become a
+// verification key.
+var allowedAlgorithms = map[string]bool{
+	string(jose.RS256): true, string(jose.RS384): true, string(jose.RS512): true,
+	string(jose.PS256): true, string(jose.PS384): true, string(jose.PS512): true,
+	string(jose.ES256): true, string(jose.ES384): true, string(jose.ES512): true,
+	string(jose.EdDSA): true,
+}
+
+// Config describes a client registered with an identity provider.
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Claims are the identity claims read from a verified ID token.
+type Claims struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+	Picture       string `json:"picture"`
+	Nonce         string `json:"nonce"`
+}
+
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is a discovered identity provider.
+type Provider struct {
+	cfg    Config
+	client *http.Client
+	meta   metadata
+
+	keysMu sync.Mutex
+	keys   *jose.JSONWebKeySet
+}
+
+// Discover loads the provider metadata from the issuer's
+// .well-known/openid-configuration document. client may be nil.
+func Discover(ctx context.Context, client *http.Client, cfg Config) (*Provider, error) {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	issuer := strings.TrimSuffix(cfg.Issuer, "/")
+	var meta metadata
+	if err := getJSON(ctx, client, issuer+"/.well-known/openid-configuration", &meta); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+	if strings.TrimSuffix(meta.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("%w: issuer %q does not match %q", ErrDiscovery, meta.Issuer, cfg.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: incomplete provider metadata", ErrDiscovery)
+	}
+	return &Provider{cfg: cfg, client: client, meta: meta}, nil
+}
+
+// NewVerifier returns a random PKCE code verifier.
+func NewVerifier() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Challenge derives the S256 PKCE code challenge for verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns the URL to send the user to. state and nonce must be
+// unguessable and remembered until the callback; verifier is the PKCE code
+// verifier from NewVerifier.
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) string {
+	scopes := p.cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = DefaultScopes
+	}
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(p.meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.meta.AuthorizationEndpoint + sep + q.Encode()
+}
+
+// Exchange redeems an authorization code and returns the claims of the
+// verified ID token, which must carry nonce.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Claims, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"client_id":     {p.cfg.ClientID},
+		"code_verifier": {verifier},
+	}
+	if p.cfg.ClientSecret != "" {
+		form.Set("client_secret", p.cfg.ClientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: token endpoint returned %d", ErrExchange, resp.StatusCode)
+	}
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("%w: no id_token in response", ErrIDToken)
+	}
+	return p.verify(ctx, tokens.IDToken, nonce)
+}
+
+func (p *Provider) verify(ctx context.Context, raw, nonce string) (*Claims, error) {
+	tok, err := jwt.ParseSigned(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIDToken, err)
+	}
+	if len(tok.Headers) != 1 || !allowedAlgorithms[tok.Headers[0].Algorithm] {
+		return nil, fmt.Errorf("%w: unsupported signature algorithm", ErrIDToken)
+	}
+	key, err := p.key(ctx, tok.Headers[0].KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	var std jwt.Claims
+	var claims Claims
+	if err := tok.Claims(key, &std, &claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIDToken, err)
+	}
+	if err := std.ValidateWithLeeway(jwt.Expected{Issuer: p.meta.Issuer, Audience: jwt.Audience{p.cfg.ClientID}, Time: time.Now()}, time.Minute); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIDToken, err)
+	}
+	if std.Expiry == nil {
+		return nil, fmt.Errorf("%w: missing exp", ErrIDToken)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing sub", ErrIDToken)
+	}
+	if nonce == "" || claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrIDToken)
+	}
+	return &claims, nil
+}
+
+// key returns the provider's signing key with the given ID. The key set is
+// refetched once when the ID is unknown so provider key rotation is picked up.
+func (p *Provider) key(ctx context.Context, kid string) (*jose.JSONWebKey, error) {
+	p.keysMu.Lock()
+	defer p.keysMu.Unlock()
+
+	for attempt := 0; attempt < 2; attempt++ {
+		if p.keys == nil || attempt > 0 {
+			var keys jose.JSONWebKeySet
+			if err := getJSON(ctx, p.client, p.meta.JWKSURI, &keys); err != nil {
+				return nil, fmt.Errorf("%w: fetching keys: %v", ErrIDToken, err)
+			}
+			p.keys = &keys
+		}
+		if kid == "" && len(p.keys.Keys) == 1 {
+			return &p.keys.Keys[0], nil
+		}
+		if found := p.keys.Key(kid); len(found) > 0 {
+			return &found[0], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: unknown signing key %q", ErrIDToken, kid)
+}
+
+func getJSON(ctx context.Context, client *http.Client, u string, dst interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", u, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(dst)
+}
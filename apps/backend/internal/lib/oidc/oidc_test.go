@@ -0,0 +1,80 @@
+package oidc_test
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/petonlabs/go-boilerplate/internal/lib/oidc"
+	"github.com/petonlabs/go-boilerplate/internal/lib/oidc/oidctest"
+)
+
+func setup(t *testing.T) (*oidctest.Provider, *oidc.Provider) {
+	t.Helper()
+	idp, err := oidctest.New("client", "secret", oidctest.User{Subject: "user-1", Email: "alice@example.com", EmailVerified: true, Name: "Alice"})
+	require.NoError(t, err)
+	t.Cleanup(idp.Close)
+
+	p, err := oidc.Discover(context.Background(), nil, oidc.Config{
+		Issuer:       idp.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "https://app.example.com/oidc/callback",
+	})
+	require.NoError(t, err)
+	return idp, p
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	idp, p := setup(t)
+
+	verifier, err := oidc.NewVerifier()
+	require.NoError(t, err)
+	authURL := p.AuthCodeURL("state-1", "nonce-1", verifier)
+
+	u, err := url.Parse(authURL)
+	require.NoError(t, err)
+	require.Equal(t, "openid email profile", u.Query().Get("scope"))
+	require.Equal(t, oidc.Challenge(verifier), u.Query().Get("code_challenge"))
+
+	code, state, err := idp.Authorize(authURL)
+	require.NoError(t, err)
+	require.Equal(t, "state-1", state)
+
+	claims, err := p.Exchange(context.Background(), code, verifier, "nonce-1")
+	require.NoError(t, err)
+	require.Equal(t, "user-1", claims.Subject)
+	require.Equal(t, "alice@example.com", claims.Email)
+	require.True(t, claims.EmailVerified)
+	require.Equal(t, "Alice", claims.Name)
+
+	// Codes are single-use.
+	_, err = p.Exchange(context.Background(), code, verifier, "nonce-1")
+	require.ErrorIs(t, err, oidc.ErrExchange)
+}
+
+func TestExchangeRejectsWrongVerifierAndNonce(t *testing.T) {
+	idp, p := setup(t)
+	verifier, err := oidc.NewVerifier()
+	require.NoError(t, err)
+
+	code, _, err := idp.Authorize(p.AuthCodeURL("s", "nonce-1", verifier))
+	require.NoError(t, err)
+	other, err := oidc.NewVerifier()
+	require.NoError(t, err)
+	_, err = p.Exchange(context.Background(), code, other, "nonce-1")
+	require.ErrorIs(t, err, oidc.ErrExchange)
+
+	code, _, err = idp.Authorize(p.AuthCodeURL("s", "nonce-1", verifier))
+	require.NoError(t, err)
+	_, err = p.Exchange(context.Background(), code, verifier, "nonce-2")
+	require.ErrorIs(t, err, oidc.ErrIDToken)
+}
+
+func TestDiscoverRejectsIssuerMismatch(t *testing.T) {
+	idp, _ := setup(t)
+	_, err := oidc.Discover(context.Background(), nil, oidc.Config{Issuer: idp.URL + "/other", ClientID: "client"})
+	require.ErrorIs(t, err, oidc.ErrDiscovery)
+}
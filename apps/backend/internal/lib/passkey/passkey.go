@@ -0,0 +1,154 @@
+// Package passkey runs WebAuthn registration and assertion ceremonies on top
+// of go-webauthn. It is storage agnostic: ceremony state is handed back to the
+// caller as opaque JSON and credentials are looked up through callbacks, so
+// AuthService decides where both live.
+package passkey
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+var (
+	// ErrNotConfigured is returned by New when no relying party ID or origin is set.
+	ErrNotConfigured = errors.New("passkey: relying party not configured")
+	// ErrSignCount is returned when an assertion's signature counter did not
+	// increase, which indicates a cloned authenticator.
+	ErrSignCount = errors.New("passkey: signature counter did not increase")
+	// ErrUnknownCredential is returned by a CredentialLookup that has no
+	// matching credential.
+	ErrUnknownCredential = errors.New("passkey: unknown credential")
+)
+
+// Config describes the relying party, i.e. this application.
+type Config struct {
+	RPID          string
+	RPDisplayName string
+	RPOrigins     []string
+}
+
+// User is the owner of a set of credentials.
+type User struct {
+	ID          []byte
+	Name        string
+	DisplayName string
+	Credentials []webauthn.Credential
+}
+
+func (u *User) WebAuthnID() []byte                         { return u.ID }
+func (u *User) WebAuthnName() string                       { return u.Name }
+func (u *User) WebAuthnDisplayName() string                { return u.DisplayName }
+func (u *User) WebAuthnIcon() string                       { return "" }
+func (u *User) WebAuthnCredentials() []webauthn.Credential { return u.Credentials }
+
+// CredentialLookup resolves the user owning the credential presented in a
+// login. userHandle is the ID the credential was registered with.
+type CredentialLookup func(credentialID, userHandle []byte) (*User, error)
+
+// RelyingParty runs ceremonies for one configured relying party.
+type RelyingParty struct {
+	w *webauthn.WebAuthn
+}
+
+// New returns a RelyingParty for cfg.
+func New(cfg Config) (*RelyingParty, error) {
+	if cfg.RPID == "" || len(cfg.RPOrigins) == 0 {
+		return nil, ErrNotConfigured
+	}
+	w, err := webauthn.New(&webauthn.Config{
+		RPID:          cfg.RPID,
+		RPDisplayName: cfg.RPDisplayName,
+		RPOrigins:     cfg.RPOrigins,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementRequired,
+			UserVerification: protocol.VerificationRequired,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &RelyingParty{w: w}, nil
+}
+
+// BeginRegistration returns the options to pass to navigator.credentials.create
+// and the ceremony state to keep until FinishRegistration. Credentials the user
+// already has are excluded so an authenticator is not registered twice.
+func (rp *RelyingParty) BeginRegistration(user *User) (*protocol.CredentialCreation, []byte, error) {
+	exclude := make([]protocol.CredentialDescriptor, 0, len(user.Credentials))
+	for _, c := range user.Credentials {
+		exclude = append(exclude, c.Descriptor())
+	}
+	options, session, err := rp.w.BeginRegistration(user, webauthn.WithExclusions(exclude))
+	if err != nil {
+		return nil, nil, err
+	}
+	state, err := json.Marshal(session)
+	if err != nil {
+		return nil, nil, err
+	}
+	return options, state, nil
+}
+
+// FinishRegistration verifies the authenticator's response against the state
+// from BeginRegistration and returns the new credential.
+func (rp *RelyingParty) FinishRegistration(user *User, state, response []byte) (*webauthn.Credential, error) {
+	var session webauthn.SessionData
+	if err := json.Unmarshal(state, &session); err != nil {
+		return nil, fmt.Errorf("passkey: invalid ceremony state: %w", err)
+	}
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(response))
+	if err != nil {
+		return nil, err
+	}
+	return rp.w.CreateCredential(user, session, parsed)
+}
+
+// BeginLogin starts a discoverable (username-less) login and returns the
+// options to pass to navigator.credentials.get with the ceremony state.
+func (rp *RelyingParty) BeginLogin() (*protocol.CredentialAssertion, []byte, error) {
+	options, session, err := rp.w.BeginDiscoverableLogin()
+	if err != nil {
+		return nil, nil, err
+	}
+	state, err := json.Marshal(session)
+	if err != nil {
+		return nil, nil, err
+	}
+	return options, state, nil
+}
+
+// FinishLogin verifies an assertion against the state from BeginLogin. The
+// returned credential carries the updated signature counter which the caller
+// must persist. ErrSignCount is returned if the counter went backwards.
+func (rp *RelyingParty) FinishLogin(state, response []byte, lookup CredentialLookup) (*User, *webauthn.Credential, error) {
+	var session webauthn.SessionData
+	if err := json.Unmarshal(state, &session); err != nil {
+		return nil, nil, fmt.Errorf("passkey: invalid ceremony state: %w", err)
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(response))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var owner *User
+	credential, err := rp.w.ValidateDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+		u, err := lookup(rawID, userHandle)
+		if err != nil {
+			return nil, err
+		}
+		owner = u
+		return u, nil
+	}, session, parsed)
+	if err != nil {
+		return nil, nil, err
+	}
+	if credential.Authenticator.CloneWarning {
+		return nil, nil, ErrSignCount
+	}
+	return owner, credential, nil
+}
@@ -0,0 +1,100 @@
+package passkey_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/stretchr/testify/require"
+
+	"github.com/petonlabs/go-boilerplate/internal/lib/passkey"
+	"github.com/petonlabs/go-boilerplate/internal/lib/passkey/passkeytest"
+)
+
+func newRelyingParty(t *testing.T) *passkey.RelyingParty {
+	t.Helper()
+	rp, err := passkey.New(passkey.Config{
+		RPID:          "localhost",
+		RPDisplayName: "Boilerplate",
+		RPOrigins:     []string{"http://localhost:3000"},
+	})
+	require.NoError(t, err)
+	return rp
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	rp := newRelyingParty(t)
+	authenticator := passkeytest.New("http://localhost:3000")
+	user := &passkey.User{ID: []byte("user-1"), Name: "bob@example.com", DisplayName: "Bob"}
+
+	options, state, err := rp.BeginRegistration(user)
+	require.NoError(t, err)
+	response, err := authenticator.Create(options)
+	require.NoError(t, err)
+	credential, err := rp.FinishRegistration(user, state, response)
+	require.NoError(t, err)
+	user.Credentials = append(user.Credentials, *credential)
+
+	lookup := func(credentialID, userHandle []byte) (*passkey.User, error) {
+		if !bytes.Equal(userHandle, user.ID) {
+			return nil, passkey.ErrUnknownCredential
+		}
+		return user, nil
+	}
+
+	assertion, state, err := rp.BeginLogin()
+	require.NoError(t, err)
+	response, err = authenticator.Get(assertion)
+	require.NoError(t, err)
+	owner, used, err := rp.FinishLogin(state, response, lookup)
+	require.NoError(t, err)
+	require.Equal(t, user.ID, owner.ID)
+	require.Equal(t, uint32(1), used.Authenticator.SignCount)
+	user.Credentials = []webauthn.Credential{*used}
+
+	// a response cannot be replayed against a new challenge
+	_, state, err = rp.BeginLogin()
+	require.NoError(t, err)
+	_, _, err = rp.FinishLogin(state, response, lookup)
+	require.Error(t, err)
+}
+
+func TestLoginRejectsCounterRegression(t *testing.T) {
+	rp := newRelyingParty(t)
+	authenticator := passkeytest.New("http://localhost:3000")
+	user := &passkey.User{ID: []byte("user-1"), Name: "bob@example.com", DisplayName: "Bob"}
+
+	options, state, err := rp.BeginRegistration(user)
+	require.NoError(t, err)
+	response, err := authenticator.Create(options)
+	require.NoError(t, err)
+	credential, err := rp.FinishRegistration(user, state, response)
+	require.NoError(t, err)
+	// the stored counter is ahead of what the authenticator will report
+	credential.Authenticator.SignCount = 10
+	user.Credentials = []webauthn.Credential{*credential}
+
+	assertion, state, err := rp.BeginLogin()
+	require.NoError(t, err)
+	response, err = authenticator.Get(assertion)
+	require.NoError(t, err)
+	_, _, err = rp.FinishLogin(state, response, func(_, _ []byte) (*passkey.User, error) { return user, nil })
+	require.ErrorIs(t, err, passkey.ErrSignCount)
+}
+
+func TestFinishRegistrationRejectsWrongOrigin(t *testing.T) {
+	rp := newRelyingParty(t)
+	user := &passkey.User{ID: []byte("user-1"), Name: "bob@example.com", DisplayName: "Bob"}
+
+	options, state, err := rp.BeginRegistration(user)
+	require.NoError(t, err)
+	response, err := passkeytest.New("https://evil.example.com").Create(options)
+	require.NoError(t, err)
+	_, err = rp.FinishRegistration(user, state, response)
+	require.Error(t, err)
+}
+
+func TestNewRequiresRelyingParty(t *testing.T) {
+	_, err := passkey.New(passkey.Config{RPDisplayName: "Boilerplate"})
+	require.ErrorIs(t, err, passkey.ErrNotConfigured)
+}
@@ -0,0 +1,177 @@
+// Package passkeytest provides a software WebAuthn authenticator so passkey
+// ceremonies can be exercised in tests without a browser or hardware key.
+package passkeytest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+)
+
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+)
+
+// Credential is a key pair held by the Authenticator.
+type Credential struct {
+	ID         []byte
+	UserHandle []byte
+	Key        *ecdsa.PrivateKey
+	// SignCount is the counter reported with the next assertion. It is
+	// incremented on every assertion; tests may rewind it to simulate a clone.
+	SignCount uint32
+}
+
+// Authenticator is a resident-key, user-verifying platform authenticator
+// producing "none" attestations with ES256 keys.
+type Authenticator struct {
+	Origin      string
+	Credentials []*Credential
+}
+
+// New returns an authenticator whose client reports origin.
+func New(origin string) *Authenticator {
+	return &Authenticator{Origin: origin}
+}
+
+// Create answers a registration ceremony and returns the JSON a browser would
+// post back from navigator.credentials.create.
+func (a *Authenticator) Create(options *protocol.CredentialCreation) ([]byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	userHandle, err := userHandle(options.Response.User.ID)
+	if err != nil {
+		return nil, err
+	}
+	cred := &Credential{ID: id, UserHandle: userHandle, Key: key}
+
+	coseKey, err := webauthncbor.Marshal(map[int]interface{}{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: padded(key.PublicKey.X.Bytes()),
+		-3: padded(key.PublicKey.Y.Bytes()),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	authData := authenticatorData(options.Response.RelyingParty.ID, flagUserPresent|flagUserVerified|flagAttestedData, 0)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(id)))
+	authData = append(authData, id...)
+	authData = append(authData, coseKey...)
+
+	attestation, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": authData,
+	})
+	if err != nil {
+		return nil, err
+	}
+	clientData, err := a.clientData(protocol.CreateCeremony, options.Response.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	a.Credentials = append(a.Credentials, cred)
+	return json.Marshal(map[string]interface{}{
+		"id":    b64(id),
+		"rawId": b64(id),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64(clientData),
+			"attestationObject": b64(attestation),
+		},
+	})
+}
+
+// Get answers a login ceremony with the most recently created credential and
+// returns the JSON a browser would post back from navigator.credentials.get.
+func (a *Authenticator) Get(options *protocol.CredentialAssertion) ([]byte, error) {
+	if len(a.Credentials) == 0 {
+		return nil, errors.New("passkeytest: no credentials")
+	}
+	cred := a.Credentials[len(a.Credentials)-1]
+	cred.SignCount++
+
+	authData := authenticatorData(options.Response.RelyingPartyID, flagUserPresent|flagUserVerified, cred.SignCount)
+	clientData, err := a.clientData(protocol.AssertCeremony, options.Response.Challenge)
+	if err != nil {
+		return nil, err
+	}
+	clientHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, cred.Key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"id":    b64(cred.ID),
+		"rawId": b64(cred.ID),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64(clientData),
+			"authenticatorData": b64(authData),
+			"signature":         b64(sig),
+			"userHandle":        b64(cred.UserHandle),
+		},
+	})
+}
+
+func (a *Authenticator) clientData(ceremony protocol.CeremonyType, challenge protocol.URLEncodedBase64) ([]byte, error) {
+	return json.Marshal(map[string]string{
+		"type":      string(ceremony),
+		"challenge": challenge.String(),
+		"origin":    a.Origin,
+	})
+}
+
+func authenticatorData(rpID string, flags byte, signCount uint32) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, flags)
+	return binary.BigEndian.AppendUint32(data, signCount)
+}
+
+// userHandle extracts the user ID from the registration options, which holds
+// either raw bytes or a string depending on the relying party's config.
+func userHandle(id interface{}) ([]byte, error) {
+	switch v := id.(type) {
+	case protocol.URLEncodedBase64:
+		return v, nil
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	}
+	return nil, errors.New("passkeytest: unsupported user id type")
+}
+
+func padded(b []byte) []byte {
+	out := make([]byte, 32)
+	copy(out[32-len(b):], b)
+	return out
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,136 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrUnknownHash is returned by Verify for a hash in an unsupported format.
+var ErrUnknownHash = errors.New("password: unknown hash format")
+
+// Hasher hashes new passwords. The algorithm and its parameters are encoded
+// in the returned string so Verify can check it without further context.
+type Hasher interface {
+	Hash(pw string) (string, error)
+	// NeedsRehash reports whether hash was produced with a different
+	// algorithm or different parameters than this Hasher would use.
+	NeedsRehash(hash string) bool
+}
+
+// Verify reports whether pw matches hash, which may have been produced by any
+// of the supported hashers.
+func Verify(hash, pw string) (bool, error) {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		p, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false, err
+		}
+		other := argon2.IDKey([]byte(pw), salt, p.Time, p.Memory, p.Threads, uint32(len(key)))
+		return subtle.ConstantTimeCompare(key, other) == 1, nil
+	case isBcrypt(hash):
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(pw))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	default:
+		return false, ErrUnknownHash
+	}
+}
+
+// Argon2id hashes passwords with argon2id and encodes them in the PHC string
+// format: $argon2id$v=19$m=<KiB>,t=<passes>,p=<threads>$<salt>$<key>.
+type Argon2id struct {
+	// Memory is the memory cost in KiB.
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+// DefaultArgon2id follows the OWASP recommendation of 19 MiB, 2 passes and
+// one degree of parallelism.
+var DefaultArgon2id = Argon2id{Memory: 19 * 1024, Time: 2, Threads: 1, SaltLen: 16, KeyLen: 32}
+
+func (h Argon2id) Hash(pw string) (string, error) {
+	salt := make([]byte, h.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(pw), salt, h.Time, h.Memory, h.Threads, h.KeyLen)
+	b64 := base64.RawStdEncoding
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Time, h.Threads, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+func (h Argon2id) NeedsRehash(hash string) bool {
+	p, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return true
+	}
+	return p.Memory != h.Memory || p.Time != h.Time || p.Threads != h.Threads ||
+		uint32(len(salt)) != h.SaltLen || uint32(len(key)) != h.KeyLen
+}
+
+func decodeArgon2id(hash string) (Argon2id, []byte, []byte, error) {
+	var p Argon2id
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return p, nil, nil, ErrUnknownHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, ErrUnknownHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads); err != nil {
+		return p, nil, nil, ErrUnknownHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, ErrUnknownHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, ErrUnknownHash
+	}
+	p.SaltLen, p.KeyLen = uint32(len(salt)), uint32(len(key))
+	return p, salt, key, nil
+}
+
+// BcryptMaxBytes is the longest input bcrypt accepts; Bcrypt.Hash fails for
+// longer passwords.
+const BcryptMaxBytes = 72
+
+// Bcrypt hashes passwords with bcrypt at the given cost.
+type Bcrypt struct {
+	Cost int
+}
+
+func (h Bcrypt) Hash(pw string) (string, error) {
+	b, err := bcrypt.GenerateFromPassword([]byte(pw), h.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (h Bcrypt) NeedsRehash(hash string) bool {
+	if !isBcrypt(hash) {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.Cost
+}
+
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
@@ -0,0 +1,73 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// cheap parameters keep the tests fast; the encoding is what matters here.
+var testArgon2id = Argon2id{Memory: 64, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32}
+
+func TestArgon2idRoundTrip(t *testing.T) {
+	hash, err := testArgon2id.Hash("Correct1Horse")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$"))
+
+	ok, err := Verify(hash, "Correct1Horse")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = Verify(hash, "correct1horse")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	other, err := testArgon2id.Hash("Correct1Horse")
+	require.NoError(t, err)
+	require.NotEqual(t, hash, other, "salt must be random")
+
+	require.False(t, testArgon2id.NeedsRehash(hash))
+	stronger := testArgon2id
+	stronger.Time = 2
+	require.True(t, stronger.NeedsRehash(hash))
+}
+
+func TestBcryptRoundTrip(t *testing.T) {
+	h := Bcrypt{Cost: bcrypt.MinCost}
+	hash, err := h.Hash("Correct1Horse")
+	require.NoError(t, err)
+
+	ok, err := Verify(hash, "Correct1Horse")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = Verify(hash, "wrong")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	require.False(t, h.NeedsRehash(hash))
+	require.True(t, Bcrypt{Cost: bcrypt.MinCost + 1}.NeedsRehash(hash))
+	require.True(t, testArgon2id.NeedsRehash(hash))
+}
+
+func TestArgon2idHashNeedsRehashUnderBcrypt(t *testing.T) {
+	hash, err := testArgon2id.Hash("Correct1Horse")
+	require.NoError(t, err)
+	require.True(t, Bcrypt{Cost: bcrypt.DefaultCost}.NeedsRehash(hash))
+}
+
+func TestVerifyRejectsUnknownFormats(t *testing.T) {
+	for _, hash := range []string{
+		"",
+		"plaintext",
+		"$argon2id$v=19$m=64,t=1,p=1$onlysalt",
+		"$argon2id$v=18$m=64,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5",
+		"$argon2i$v=19$m=64,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5",
+	} {
+		ok, err := Verify(hash, "pw")
+		require.ErrorIs(t, err, ErrUnknownHash, hash)
+		require.False(t, ok)
+	}
+}
@@ -0,0 +1,135 @@
+// Package password checks candidate passwords against a configurable policy
+// (length bounds, required character classes, banned words and a denylist of
+// known breached passwords) and hashes them with argon2id or bcrypt.
+package password
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Class is a character class a password can be required to contain.
+type Class string
+
+const (
+	Upper  Class = "upper"
+	Lower  Class = "lower"
+	Digit  Class = "digit"
+	Symbol Class = "symbol"
+)
+
+// Policy describes what an acceptable password looks like. Zero values
+// disable the respective check.
+type Policy struct {
+	// MinLength and MaxLength bound the length in characters (runes).
+	MinLength int
+	MaxLength int
+	// MaxBytes bounds the length of the UTF-8 encoding, for hashers that
+	// limit their input, such as bcrypt (BcryptMaxBytes).
+	MaxBytes int
+	// Require lists the character classes that must each appear at least once.
+	Require []Class
+	// BannedWords may not appear anywhere in the password, ignoring case.
+	BannedWords []string
+	// Denylist holds passwords that are rejected outright.
+	Denylist Denylist
+}
+
+// Check returns a human readable message for every rule pw violates, or nil
+// if pw is acceptable.
+func (p Policy) Check(pw string) []string {
+	var violations []string
+
+	n := utf8.RuneCountInString(pw)
+	if p.MinLength > 0 && n < p.MinLength {
+		violations = append(violations, "must be at least "+strconv.Itoa(p.MinLength)+" characters")
+	}
+	if p.MaxLength > 0 && n > p.MaxLength {
+		violations = append(violations, "must not exceed "+strconv.Itoa(p.MaxLength)+" characters")
+	} else if p.MaxBytes > 0 && len(pw) > p.MaxBytes {
+		violations = append(violations, "must not exceed "+strconv.Itoa(p.MaxBytes)+" bytes")
+	}
+
+	has := map[Class]bool{}
+	for _, r := range pw {
+		switch {
+		case unicode.IsUpper(r):
+			has[Upper] = true
+		case unicode.IsLower(r):
+			has[Lower] = true
+		case unicode.IsDigit(r):
+			has[Digit] = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			has[Symbol] = true
+		}
+	}
+	for _, c := range p.Require {
+		if has[c] {
+			continue
+		}
+		switch c {
+		case Upper:
+			violations = append(violations, "must include an upper case letter")
+		case Lower:
+			violations = append(violations, "must include a lower case letter")
+		case Digit:
+			violations = append(violations, "must include a digit")
+		case Symbol:
+			violations = append(violations, "must include a symbol")
+		}
+	}
+
+	lower := strings.ToLower(pw)
+	for _, w := range p.BannedWords {
+		w = strings.ToLower(strings.TrimSpace(w))
+		if w != "" && strings.Contains(lower, w) {
+			violations = append(violations, "must not contain \""+w+"\"")
+		}
+	}
+
+	if p.Denylist.Contains(pw) {
+		violations = append(violations, "appears in a list of breached passwords")
+	}
+
+	return violations
+}
+
+// Denylist is a set of rejected passwords, compared case-insensitively.
+type Denylist map[string]struct{}
+
+// LoadDenylist reads one password per line from path. Blank lines and lines
+// starting with '#' are skipped.
+func LoadDenylist(path string) (Denylist, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	d := Denylist{}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		d[strings.ToLower(line)] = struct{}{}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Contains reports whether pw is on the list.
+func (d Denylist) Contains(pw string) bool {
+	if len(d) == 0 {
+		return false
+	}
+	_, ok := d[strings.ToLower(pw)]
+	return ok
+}
@@ -0,0 +1,57 @@
+package password
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	p := Policy{
+		MinLength:   8,
+		MaxLength:   16,
+		Require:     []Class{Upper, Lower, Digit},
+		BannedWords: []string{"Acme"},
+	}
+
+	require.Empty(t, p.Check("Correct1Horse"))
+	require.Equal(t, []string{
+		"must be at least 8 characters",
+		"must include an upper case letter",
+		"must include a digit",
+	}, p.Check("short"))
+	require.Equal(t, []string{"must not exceed 16 characters"}, p.Check("Abcdefghijklmnop1"))
+	require.Equal(t, []string{`must not contain "acme"`}, p.Check("MyACME2024pw"))
+
+	// Length counts characters, not bytes.
+	require.Empty(t, Policy{MaxLength: 4}.Check("ÄÖÜß"))
+	// MaxBytes caps the encoded length for hashers such as bcrypt.
+	require.Equal(t, []string{"must not exceed 72 bytes"}, Policy{MaxLength: 128, MaxBytes: BcryptMaxBytes}.Check(strings.Repeat("Ä", 40)))
+	require.Empty(t, Policy{MaxBytes: BcryptMaxBytes}.Check(strings.Repeat("a", 72)))
+
+	require.Equal(t, []string{"must include a symbol"}, Policy{Require: []Class{Symbol}}.Check("abc123"))
+	require.Empty(t, Policy{Require: []Class{Symbol}}.Check("abc 123"))
+	require.Empty(t, Policy{}.Check(""))
+}
+
+func TestDenylist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# top passwords\nPassword1\n\n  letmein  \n"), 0o600))
+
+	d, err := LoadDenylist(path)
+	require.NoError(t, err)
+	require.Len(t, d, 2)
+	require.True(t, d.Contains("password1"))
+	require.True(t, d.Contains("LetMeIn"))
+	require.False(t, d.Contains("# top passwords"))
+
+	p := Policy{Denylist: d}
+	require.Equal(t, []string{"appears in a list of breached passwords"}, p.Check("PASSWORD1"))
+	require.Empty(t, p.Check("Password2"))
+
+	_, err = LoadDenylist(filepath.Join(t.TempDir(), "missing.txt"))
+	require.Error(t, err)
+}
@@ -0,0 +1,81 @@
+// Package rbac caches the permissions granted to a user through their roles
+// in Redis. It is shared by AuthMiddleware.RequirePermission, which resolves
+// and caches permissions, and AuthService, which drops the cache when a
+// user's roles change.
+package rbac
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/petonlabs/go-boilerplate/internal/lib/apikey"
+)
+
+const keyPrefix = "rbac:perms:"
+
+// DefaultTTL bounds how long a role change can take to reach a user whose
+// cache could not be invalidated.
+const DefaultTTL = 5 * time.Minute
+
+// Key returns the Redis key caching the permissions of the user identified by
+// userID (our user ID or a Clerk user ID).
+func Key(userID string) string {
+	return keyPrefix + userID
+}
+
+// Cached returns the cached permissions of userID. ok is false when nothing
+// is cached.
+func Cached(ctx context.Context, rdb *redis.Client, userID string) (permissions []string, ok bool, err error) {
+	if rdb == nil {
+		return nil, false, nil
+	}
+	raw, err := rdb.Get(ctx, Key(userID)).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	if raw == "" {
+		return []string{}, true, nil
+	}
+	return strings.Split(raw, ","), true, nil
+}
+
+// Store caches the permissions of userID for ttl. An empty list is cached
+// too, so users without roles do not hit the database on every request.
+func Store(ctx context.Context, rdb *redis.Client, userID string, permissions []string, ttl time.Duration) error {
+	if rdb == nil {
+		return nil
+	}
+	return rdb.Set(ctx, Key(userID), strings.Join(permissions, ","), ttl).Err()
+}
+
+// Invalidate drops the cached permissions of each of userIDs; empty IDs are
+// ignored.
+func Invalidate(ctx context.Context, rdb *redis.Client, userIDs ...string) error {
+	if rdb == nil {
+		return nil
+	}
+	keys := make([]string, 0, len(userIDs))
+	for _, id := range userIDs {
+		if id != "" {
+			keys = append(keys, Key(id))
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	return rdb.Del(ctx, keys...).Err()
+}
+
+// Allows reports whether permissions include required. Permissions use the
+// same syntax as API key scopes: "*" grants everything and "<resource>:*"
+// every action on the resource.
+func Allows(permissions []string, required string) bool {
+	return apikey.Allows(permissions, required)
+}
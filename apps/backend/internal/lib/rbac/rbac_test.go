@@ -0,0 +1,30 @@
+package rbac
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllows(t *testing.T) {
+	require.True(t, Allows([]string{"users:read", "users:delete"}, "users:delete"))
+	require.True(t, Allows([]string{"*"}, "roles:assign"))
+	require.True(t, Allows([]string{"users:*"}, "users:unlock"))
+	require.False(t, Allows([]string{"users:read"}, "users:delete"))
+	require.False(t, Allows(nil, "users:read"))
+}
+
+func TestCacheWithoutRedis(t *testing.T) {
+	ctx := context.Background()
+	require.NoError(t, Store(ctx, nil, "user-1", []string{"users:read"}, time.Minute))
+	_, ok, err := Cached(ctx, nil, "user-1")
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.NoError(t, Invalidate(ctx, nil, "user-1"))
+}
+
+func TestKey(t *testing.T) {
+	require.Equal(t, "rbac:perms:user-1", Key("user-1"))
+}
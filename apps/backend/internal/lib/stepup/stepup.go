@@ -0,0 +1,64 @@
+// Package stepup records and looks up recent re-authentications (password or
+// MFA re-confirmation) in Redis. It is shared by AuthService, which records a
+// confirmation, and AuthMiddleware.RequireRecentAuth, which checks for one.
+package stepup
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const keyPrefix = "reauth:"
+
+// Method names the factor used to re-confirm the caller's identity.
+type Method string
+
+const (
+	MethodPassword Method = "password"
+	MethodMFA      Method = "mfa"
+)
+
+// Key returns the Redis key holding the last re-confirmation of a session.
+// Confirmations are scoped to a session so that re-confirming on one device
+// does not elevate the caller's other sessions.
+func Key(userID, sessionID string) string {
+	return keyPrefix + userID + ":" + sessionID
+}
+
+// Record stores a re-confirmation for the session at time at. The record is
+// kept for ttl, which bounds the largest maxAge RequireRecentAuth can honour.
+func Record(ctx context.Context, rdb *redis.Client, userID, sessionID string, method Method, at time.Time, ttl time.Duration) error {
+	if rdb == nil {
+		return errors.New("redis not initialized")
+	}
+	key := Key(userID, sessionID)
+	pipe := rdb.TxPipeline()
+	pipe.HSet(ctx, key, "at", at.Unix(), "method", string(method))
+	pipe.Expire(ctx, key, ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// LastConfirmed returns when the session was last re-confirmed. The zero
+// time is returned if there is no record.
+func LastConfirmed(ctx context.Context, rdb *redis.Client, userID, sessionID string) (time.Time, error) {
+	if rdb == nil {
+		return time.Time{}, nil
+	}
+	raw, err := rdb.HGet(ctx, Key(userID, sessionID), "at").Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+	unix, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(unix, 0), nil
+}
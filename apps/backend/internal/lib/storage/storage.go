@@ -0,0 +1,118 @@
+// Package storage stores opaque files, such as data export archives, under
+// slash-separated keys.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/petonlabs/go-boilerplate/internal/config"
+)
+
+var (
+	ErrNotFound   = errors.New("file not found")
+	ErrInvalidKey = errors.New("invalid storage key")
+)
+
+// DefaultLocalDir is where Local keeps files when config.Storage.LocalDir is
+// unset.
+const DefaultLocalDir = "data"
+
+// Storage is a file storage backend.
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Open returns ErrNotFound when key does not exist.
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete succeeds when key does not exist.
+	Delete(ctx context.Context, key string) error
+}
+
+// New returns the backend selected by cfg.Backend.
+func New(cfg config.StorageConfig) (Storage, error) {
+	switch cfg.Backend {
+	case "", config.StorageBackendLocal:
+		dir := cfg.LocalDir
+		if dir == "" {
+			dir = DefaultLocalDir
+		}
+		return NewLocal(dir), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+}
+
+// Local stores files in a directory of the local filesystem.
+type Local struct {
+	dir string
+}
+
+func NewLocal(dir string) *Local {
+	return &Local{dir: dir}
+}
+
+func (l *Local) Put(_ context.Context, key string, r io.Reader) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	// Write to a temporary file first so that readers never see a partial
+	// file.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := io.Copy(tmp, r); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (l *Local) Open(_ context.Context, key string) (io.ReadCloser, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (l *Local) Delete(_ context.Context, key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// path maps key into the storage directory, rejecting keys that would
+// escape it.
+func (l *Local) path(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return "", ErrInvalidKey
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return "", ErrInvalidKey
+		}
+	}
+	return filepath.Join(l.dir, filepath.FromSlash(key)), nil
+}
@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocal(t *testing.T) {
+	ctx := context.Background()
+	s := NewLocal(t.TempDir())
+
+	require.NoError(t, s.Put(ctx, "exports/a.zip", strings.NewReader("archive")))
+	f, err := s.Open(ctx, "exports/a.zip")
+	require.NoError(t, err)
+	data, err := io.ReadAll(f)
+	require.NoError(t, f.Close())
+	require.NoError(t, err)
+	require.Equal(t, "archive", string(data))
+
+	require.NoError(t, s.Delete(ctx, "exports/a.zip"))
+	require.NoError(t, s.Delete(ctx, "exports/a.zip"))
+	_, err = s.Open(ctx, "exports/a.zip")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	for _, key := range []string{"", "/etc/passwd", "../a", "exports/../../a", "exports//a"} {
+		require.ErrorIs(t, s.Put(ctx, key, strings.NewReader("x")), ErrInvalidKey, key)
+	}
+}
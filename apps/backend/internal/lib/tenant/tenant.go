@@ -0,0 +1,27 @@
+// Package tenant carries the active organization of a request in its
+// context. AuthMiddleware.RequireOrganization stores it after checking the
+// caller's membership, and repositories read it to scope their queries.
+package tenant
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrNoOrganization = errors.New("no active organization")
+
+type contextKey struct{}
+
+// WithOrganization returns a copy of ctx scoped to organizationID.
+func WithOrganization(ctx context.Context, organizationID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, organizationID)
+}
+
+// OrganizationID returns the organization ctx is scoped to, or
+// ErrNoOrganization when there is none.
+func OrganizationID(ctx context.Context) (string, error) {
+	if id, ok := ctx.Value(contextKey{}).(string); ok && id != "" {
+		return id, nil
+	}
+	return "", ErrNoOrganization
+}
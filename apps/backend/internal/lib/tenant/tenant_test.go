@@ -0,0 +1,20 @@
+package tenant
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrganizationID(t *testing.T) {
+	_, err := OrganizationID(context.Background())
+	require.ErrorIs(t, err, ErrNoOrganization)
+
+	_, err = OrganizationID(WithOrganization(context.Background(), ""))
+	require.ErrorIs(t, err, ErrNoOrganization)
+
+	id, err := OrganizationID(WithOrganization(context.Background(), "org-1"))
+	require.NoError(t, err)
+	require.Equal(t, "org-1", id)
+}
@@ -0,0 +1,20 @@
+package token
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Digests returns the hex HMAC-SHA256 of raw under each secret, in key ring
+// order. Opaque tokens are stored as the digest under the active secret and
+// looked up with all of them so that rotated secrets keep matching.
+func Digests(raw string, secrets []string) []string {
+	digests := make([]string, 0, len(secrets))
+	for _, s := range secrets {
+		mac := hmac.New(sha256.New, []byte(s))
+		mac.Write([]byte(raw))
+		digests = append(digests, hex.EncodeToString(mac.Sum(nil)))
+	}
+	return digests
+}
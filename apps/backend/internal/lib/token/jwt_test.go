@@ -0,0 +1,79 @@
+package token
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignAndParse(t *testing.T) {
+	now := time.Now()
+	raw, err := Sign(Claims{
+		Subject:   "user-1",
+		SessionID: "session-1",
+		Role:      "admin",
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(time.Minute).Unix(),
+	}, "secret-new")
+	require.NoError(t, err)
+
+	claims, err := Parse(raw, []string{"secret-new"}, now)
+	require.NoError(t, err)
+	require.Equal(t, Issuer, claims.Issuer)
+	require.Equal(t, "user-1", claims.Subject)
+	require.Equal(t, "session-1", claims.SessionID)
+	require.Equal(t, "admin", claims.Role)
+
+	// a rotated key ring still accepts the token
+	_, err = Parse(raw, []string{"secret-newer", "secret-new"}, now)
+	require.NoError(t, err)
+
+	_, err = Parse(raw, []string{"other"}, now)
+	require.ErrorIs(t, err, ErrSignature)
+
+	_, err = Parse(raw, []string{"secret-new"}, now.Add(2*time.Minute))
+	require.ErrorIs(t, err, ErrExpired)
+}
+
+func TestActorClaim(t *testing.T) {
+	now := time.Now()
+	raw, err := Sign(Claims{Subject: "user-1", ExpiresAt: now.Add(time.Minute).Unix(), Actor: &Actor{Subject: "admin-1"}}, "secret")
+	require.NoError(t, err)
+	claims, err := Parse(raw, []string{"secret"}, now)
+	require.NoError(t, err)
+	require.Equal(t, &Actor{Subject: "admin-1"}, claims.Actor)
+
+	raw, err = Sign(Claims{Subject: "user-1", ExpiresAt: now.Add(time.Minute).Unix()}, "secret")
+	require.NoError(t, err)
+	claims, err = Parse(raw, []string{"secret"}, now)
+	require.NoError(t, err)
+	require.Nil(t, claims.Actor)
+}
+
+func TestParseRejectsForeignTokens(t *testing.T) {
+	now := time.Now()
+	raw, err := Sign(Claims{Issuer: "https://clerk.example.com", Subject: "user-1", ExpiresAt: now.Add(time.Minute).Unix()}, "secret")
+	require.NoError(t, err)
+
+	_, err = Parse(raw, []string{"secret"}, now)
+	require.ErrorIs(t, err, ErrIssuer)
+
+	_, err = Parse("not-a-jwt", []string{"secret"}, now)
+	require.ErrorIs(t, err, ErrMalformed)
+}
+
+func TestKeyRing(t *testing.T) {
+	require.Equal(t, []string{"a", "b", "c"}, KeyRing(" a, b|c ,", "main"))
+	require.Equal(t, []string{"main"}, KeyRing("", "main"))
+	require.Nil(t, KeyRing("", " "))
+	require.Nil(t, KeyRing(",|", "main"))
+}
+
+func TestDigests(t *testing.T) {
+	digests := Digests("opaque", []string{"new", "old"})
+	require.Len(t, digests, 2)
+	require.NotEqual(t, digests[0], digests[1])
+	require.Equal(t, digests[1], Digests("opaque", []string{"old"})[0])
+	require.Empty(t, Digests("opaque", nil))
+}
@@ -0,0 +1,62 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// RFC 6238 appendix B test vectors for SHA1, truncated to 6 digits.
+func TestCodeRFC6238Vectors(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, want := range vectors {
+		got, err := Code(secret, Step(time.Unix(unix, 0)))
+		require.NoError(t, err)
+		require.Equal(t, want, got, "time %d", unix)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+	now := time.Now()
+
+	code, err := Code(secret, Step(now))
+	require.NoError(t, err)
+	step, ok := Validate(secret, code, now)
+	require.True(t, ok)
+	require.Equal(t, Step(now), step)
+
+	// previous period is tolerated, older ones are not
+	prev, err := Code(secret, Step(now)-1)
+	require.NoError(t, err)
+	_, ok = Validate(secret, prev, now)
+	require.True(t, ok)
+
+	old, err := Code(secret, Step(now)-3)
+	require.NoError(t, err)
+	_, ok = Validate(secret, old, now)
+	require.False(t, ok)
+
+	_, ok = Validate(secret, "12345", now)
+	require.False(t, ok)
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("Boilerplate", "bob@example.com", "JBSWY3DPEHPK3PXP")
+	require.True(t, strings.HasPrefix(uri, "otpauth://totp/Boilerplate:bob@example.com?"))
+	require.Contains(t, uri, "secret=JBSWY3DPEHPK3PXP")
+	require.Contains(t, uri, "issuer=Boilerplate")
+}
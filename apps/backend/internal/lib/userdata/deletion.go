@@ -0,0 +1,137 @@
+package userdata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog"
+)
+
+// DefaultHookTimeout bounds a deletion hook that sets no Timeout.
+const DefaultHookTimeout = 10 * time.Second
+
+// DeletionHook removes or anonymizes a module's data when a user account is
+// deleted. Exactly one of Query and Run is set.
+type DeletionHook struct {
+	Name string
+	// Query is executed with the user's ID as $1.
+	Query string
+	// Run is used by hooks that need more than one statement. It must only
+	// use tx so that the deletion stays atomic.
+	Run func(ctx context.Context, tx pgx.Tx, userID string) error
+	// Timeout bounds the hook; DefaultHookTimeout when zero.
+	Timeout time.Duration
+}
+
+// RegisterDeletionHook adds h to Default.
+func RegisterDeletionHook(h DeletionHook) {
+	Default.RegisterDeletionHook(h)
+}
+
+// RegisterDeletionHook adds h to the registry. It panics on an invalid or
+// duplicate hook, like RegisterExport.
+func (r *Registry) RegisterDeletionHook(h DeletionHook) {
+	if !namePattern.MatchString(h.Name) || (h.Query == "") == (h.Run == nil) || h.Timeout < 0 {
+		panic(fmt.Sprintf("userdata: invalid deletion hook %q", h.Name))
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.hooks {
+		if existing.Name == h.Name {
+			panic(fmt.Sprintf("userdata: deletion hook %q registered twice", h.Name))
+		}
+	}
+	r.hooks = append(r.hooks, h)
+}
+
+// DeletionHooks returns the registered hooks in registration order.
+func (r *Registry) DeletionHooks() []DeletionHook {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]DeletionHook(nil), r.hooks...)
+}
+
+// RunDeletionHooks runs every hook for userID (the users.id UUID) inside tx,
+// in registration order. The first hook to fail or time out stops the run
+// and its error is returned; the caller then rolls tx back so that nothing is
+// half deleted.
+func (r *Registry) RunDeletionHooks(ctx context.Context, tx pgx.Tx, userID string, logger *zerolog.Logger) error {
+	for _, h := range r.DeletionHooks() {
+		start := time.Now()
+		err := runDeletionHook(ctx, tx, userID, h)
+		if err != nil {
+			logger.Error().Err(err).Str("hook", h.Name).Str("user_id", userID).Dur("duration", time.Since(start)).
+				Msg("deletion hook failed")
+			return fmt.Errorf("deletion hook %s: %w", h.Name, err)
+		}
+		logger.Debug().Str("hook", h.Name).Str("user_id", userID).Dur("duration", time.Since(start)).
+			Msg("deletion hook completed")
+	}
+	return nil
+}
+
+func runDeletionHook(ctx context.Context, tx pgx.Tx, userID string, h DeletionHook) error {
+	timeout := h.Timeout
+	if timeout == 0 {
+		timeout = DefaultHookTimeout
+	}
+	hctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var err error
+	if h.Run != nil {
+		err = h.Run(hctx, tx, userID)
+	} else {
+		_, err = tx.Exec(hctx, h.Query, userID)
+	}
+	// Report a timeout as such rather than as whatever the driver returned
+	// for the cancelled query.
+	if err != nil && errors.Is(hctx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+		return fmt.Errorf("timed out after %s: %w", timeout, context.DeadlineExceeded)
+	}
+	return err
+}
+
+// DeleteDueUser deletes userID if its scheduled deletion is due. In one
+// transaction it seals the escrow (unless escrow is nil), marks the row
+// deleted and runs the deletion hooks. It reports false, without error, when
+// the deletion has been cancelled, is not due yet or already happened.
+func (r *Registry) DeleteDueUser(ctx context.Context, db Beginner, userID string, escrow *Escrow, logger *zerolog.Logger) (bool, error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var id string
+	err = tx.QueryRow(ctx, `SELECT id::text FROM users
+WHERE id::text = $1 AND deleted_at IS NULL
+  AND deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= now()
+FOR UPDATE`, userID).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if escrow != nil {
+		if err := SealEscrow(ctx, tx, id, *escrow); err != nil {
+			return false, err
+		}
+	}
+	if _, err := tx.Exec(ctx, `UPDATE users SET deleted_at = now(), email = NULL, password_hash = NULL
+WHERE id::text = $1`, id); err != nil {
+		return false, err
+	}
+	if err := r.RunDeletionHooks(ctx, tx, id, logger); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
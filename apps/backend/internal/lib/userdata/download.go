@@ -0,0 +1,45 @@
+package userdata
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// DownloadSignature signs a download of export exportID that is valid until
+// expiresAt.
+func DownloadSignature(secret, exportID string, expiresAt time.Time) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "data-export:%s:%d", exportID, expiresAt.Unix())
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyDownload reports whether signature was made by DownloadSignature
+// with one of secrets and has not expired.
+func VerifyDownload(secrets []string, exportID string, expiresAt time.Time, signature string, now time.Time) bool {
+	if !now.Before(expiresAt) {
+		return false
+	}
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		want := DownloadSignature(secret, exportID, expiresAt)
+		if hmac.Equal([]byte(want), []byte(signature)) {
+			return true
+		}
+	}
+	return false
+}
+
+// DownloadURL returns the signed link to GET /api/v1/exports/:id/download.
+func DownloadURL(baseURL, secret, exportID string, expiresAt time.Time) string {
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(expiresAt.Unix(), 10))
+	q.Set("signature", DownloadSignature(secret, exportID, expiresAt))
+	return baseURL + "/api/v1/exports/" + url.PathEscape(exportID) + "/download?" + q.Encode()
+}
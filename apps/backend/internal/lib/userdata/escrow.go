@@ -0,0 +1,127 @@
+package userdata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/petonlabs/go-boilerplate/internal/lib/encrypt"
+	"github.com/petonlabs/go-boilerplate/internal/lib/token"
+)
+
+// escrowColumns are the users columns cleared on deletion that a restore
+// puts back. Sessions, tokens, passkeys, identities, roles and memberships
+// are deleted for good.
+const escrowColumns = `email, email_verified, password_hash, first_name, last_name, image_url, raw_payload,
+	clerk_id, external_id, oauth_provider, oauth_provider_id, mfa_enabled, mfa_secret, mfa_enabled_at`
+
+var (
+	// ErrNoEscrow is returned when a user has no escrow that can still be
+	// restored.
+	ErrNoEscrow = errors.New("no restorable escrow for user")
+	// ErrEscrowConflict is returned when the escrowed email or identity now
+	// belongs to another account.
+	ErrEscrowConflict = errors.New("escrowed email or identity is used by another account")
+)
+
+// Escrow configures the escrow written when a user is deleted.
+type Escrow struct {
+	// Keys is the encryption key ring; the first key seals.
+	Keys []string
+	// DigestSecret keys the email digest used to find the escrow from the
+	// owner's address. No digest is stored when empty.
+	DigestSecret string
+	// ExpiresAt is the end of the recovery window.
+	ExpiresAt time.Time
+}
+
+// EmailDigests returns the digests under which the escrow of the account
+// using email is found, one per secret.
+func EmailDigests(email string, secrets []string) []string {
+	return token.Digests(strings.ToLower(strings.TrimSpace(email)), secrets)
+}
+
+// SealEscrow encrypts the restorable columns of userID into user_escrows,
+// replacing any previous escrow. Call it in the deletion transaction before
+// the columns are cleared.
+func SealEscrow(ctx context.Context, tx pgx.Tx, userID string, e Escrow) error {
+	var profile []byte
+	var email *string
+	err := tx.QueryRow(ctx, `SELECT row_to_json(t)::text, t.email FROM (SELECT `+escrowColumns+`
+FROM users WHERE id = $1::uuid) t`, userID).Scan(&profile, &email)
+	if err != nil {
+		return fmt.Errorf("read profile to escrow: %w", err)
+	}
+	sealed, err := encrypt.Seal(e.Keys, profile)
+	if err != nil {
+		return fmt.Errorf("seal escrow: %w", err)
+	}
+	var digest *string
+	if email != nil && *email != "" && e.DigestSecret != "" {
+		digest = &EmailDigests(*email, []string{e.DigestSecret})[0]
+	}
+	_, err = tx.Exec(ctx, `INSERT INTO user_escrows (user_id, sealed, email_digest, expires_at)
+VALUES ($1::uuid, $2, $3, $4)
+ON CONFLICT (user_id) DO UPDATE SET sealed = EXCLUDED.sealed, email_digest = EXCLUDED.email_digest,
+	expires_at = EXCLUDED.expires_at, restore_token = NULL, restore_token_expires = NULL, created_at = now()`,
+		userID, sealed, digest, e.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("write escrow: %w", err)
+	}
+	return nil
+}
+
+// RestoreEscrow puts the escrowed columns of the deleted user userID back,
+// clears its deletion and removes the escrow. keys are tried in turn to open
+// it.
+func RestoreEscrow(ctx context.Context, tx pgx.Tx, userID string, keys []string) error {
+	var sealed string
+	err := tx.QueryRow(ctx, `SELECT e.sealed FROM user_escrows e JOIN users u ON u.id = e.user_id
+WHERE e.user_id::text = $1 AND e.expires_at > now() AND u.deleted_at IS NOT NULL
+FOR UPDATE OF u, e`, userID).Scan(&sealed)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNoEscrow
+	}
+	if err != nil {
+		return err
+	}
+	profile, err := encrypt.Open(keys, sealed)
+	if err != nil {
+		return fmt.Errorf("open escrow: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE users SET (`+escrowColumns+`) = (SELECT `+escrowColumns+`
+	FROM json_populate_record(NULL::users, $2::json)),
+	deleted_at = NULL, deletion_scheduled_at = NULL
+WHERE id::text = $1`, userID, string(profile))
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrEscrowConflict
+	}
+	if err != nil {
+		return fmt.Errorf("restore profile: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM user_escrows WHERE user_id::text = $1`, userID); err != nil {
+		return fmt.Errorf("delete escrow: %w", err)
+	}
+	return nil
+}
+
+// Execer is satisfied by *pgxpool.Pool and pgx.Tx.
+type Execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// DeleteExpiredEscrows removes escrows past their recovery window and returns
+// how many were removed.
+func DeleteExpiredEscrows(ctx context.Context, db Execer) (int64, error) {
+	tag, err := db.Exec(ctx, `DELETE FROM user_escrows WHERE expires_at <= now()`)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
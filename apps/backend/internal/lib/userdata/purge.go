@@ -0,0 +1,70 @@
+package userdata
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Beginner is satisfied by *pgxpool.Pool.
+type Beginner interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// PurgeResult describes one batch removed by PurgeDeletedUsers.
+type PurgeResult struct {
+	UserIDs []string
+	// FileKeys are storage keys of files owned by the purged users, such as
+	// data export archives. The caller deletes them.
+	FileKeys []string
+}
+
+// PurgeDeletedUsers removes up to limit users soft-deleted before cutoff and
+// writes a tombstone for each. Rows in tables that reference users go with
+// them through ON DELETE CASCADE. Rows locked by another purge are skipped.
+func PurgeDeletedUsers(ctx context.Context, db Beginner, cutoff time.Time, limit int) (*PurgeResult, error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	rows, err := tx.Query(ctx, `SELECT id::text FROM users
+WHERE deleted_at IS NOT NULL AND deleted_at < $1
+ORDER BY deleted_at LIMIT $2 FOR UPDATE SKIP LOCKED`, cutoff, limit)
+	if err != nil {
+		return nil, fmt.Errorf("select users to purge: %w", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("select users to purge: %w", err)
+	}
+	res := &PurgeResult{UserIDs: ids}
+	if len(ids) == 0 {
+		return res, nil
+	}
+
+	rows, err = tx.Query(ctx, `SELECT storage_key FROM data_exports
+WHERE user_id::text = ANY($1) AND storage_key IS NOT NULL`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("select purged users' files: %w", err)
+	}
+	if res.FileKeys, err = pgx.CollectRows(rows, pgx.RowTo[string]); err != nil {
+		return nil, fmt.Errorf("select purged users' files: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `INSERT INTO user_tombstones (user_id, deleted_at)
+SELECT id, deleted_at FROM users WHERE id::text = ANY($1)
+ON CONFLICT (user_id) DO NOTHING`, ids); err != nil {
+		return nil, fmt.Errorf("write tombstones: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM users WHERE id::text = ANY($1)`, ids); err != nil {
+		return nil, fmt.Errorf("delete users: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
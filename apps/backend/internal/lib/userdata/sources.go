@@ -0,0 +1,72 @@
+package userdata
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// newDefaultRegistry registers the user-owned tables created by this
+// repository's migrations. Secrets (password and token hashes, TOTP
+// secrets, passkey keys) are left out of exports. Deletion keeps the users
+// row, stripped of personal data, until it is purged; audit records of
+// impersonations and invitation redemptions hold no personal data and stay
+// until then too.
+func newDefaultRegistry() *Registry {
+	r := NewRegistry()
+	r.RegisterExport(ExportSource{Name: "profile", Query: `SELECT id, email, email_verified, first_name, last_name, image_url,
+	role, clerk_id, external_id, oauth_provider, mfa_enabled, created_at, last_login_at, deletion_scheduled_at, raw_payload
+FROM users WHERE id = $1::uuid`})
+	r.RegisterExport(ExportSource{Name: "sessions", Query: `SELECT id, user_agent, ip_address, created_at, last_used_at, expires_at, revoked_at, impersonator_id
+FROM sessions WHERE user_id = $1::uuid ORDER BY created_at`})
+	r.RegisterExport(ExportSource{Name: "login_history", Query: `SELECT created_at, success, method, failure_reason, ip_address, user_agent, new_device
+FROM login_events WHERE user_id = $1::uuid ORDER BY created_at`})
+	r.RegisterExport(ExportSource{Name: "identities", Query: `SELECT provider, provider_user_id, email, email_verified, linked_at, created_at, last_used_at
+FROM user_identities WHERE user_id = $1::uuid ORDER BY created_at`})
+	r.RegisterExport(ExportSource{Name: "passkeys", Query: `SELECT id, name, transports, backup_eligible, created_at, last_used_at
+FROM webauthn_credentials WHERE user_id = $1::uuid ORDER BY created_at`})
+	r.RegisterExport(ExportSource{Name: "personal_access_tokens", Query: `SELECT id, name, token_hint, expires_at, created_at, last_used_at, last_used_ip, revoked_at
+FROM personal_access_tokens WHERE user_id = $1::uuid ORDER BY created_at`})
+	r.RegisterExport(ExportSource{Name: "roles", Query: `SELECT r.name, ur.assigned_at
+FROM user_roles ur JOIN roles r ON r.id = ur.role_id WHERE ur.user_id = $1::uuid ORDER BY r.name`})
+	r.RegisterExport(ExportSource{Name: "organizations", Query: `SELECT o.id, o.name, o.slug, m.role, m.created_at
+FROM organization_memberships m JOIN organizations o ON o.id = m.organization_id WHERE m.user_id = $1::uuid ORDER BY o.name`})
+	r.RegisterExport(ExportSource{Name: "impersonations", Query: `SELECT created_at, action, reason
+FROM impersonation_events WHERE target_user_id = $1::uuid ORDER BY created_at`})
+	r.RegisterExport(ExportSource{Name: "data_exports", Query: `SELECT id, status, requested_at, completed_at, expires_at
+FROM data_exports WHERE user_id = $1::uuid ORDER BY requested_at`})
+
+	r.RegisterDeletionHook(DeletionHook{Name: "profile", Query: `UPDATE users SET email = NULL, email_verified = false,
+	password_hash = NULL, password_reset_token = NULL, password_reset_expires = NULL,
+	email_verification_token = NULL, email_verification_expires = NULL,
+	first_name = NULL, last_name = NULL, image_url = NULL, raw_payload = '{}'::jsonb,
+	clerk_id = NULL, external_id = NULL, oauth_provider = NULL, oauth_provider_id = NULL,
+	mfa_enabled = false, mfa_secret = NULL, mfa_last_used_step = NULL, mfa_enabled_at = NULL
+WHERE id = $1::uuid`})
+	r.RegisterDeletionHook(DeletionHook{Name: "sessions", Query: `DELETE FROM sessions WHERE user_id = $1::uuid`})
+	r.RegisterDeletionHook(DeletionHook{Name: "login_history", Query: `DELETE FROM login_events WHERE user_id = $1::uuid`})
+	r.RegisterDeletionHook(DeletionHook{Name: "identities", Query: `DELETE FROM user_identities WHERE user_id = $1::uuid`})
+	r.RegisterDeletionHook(DeletionHook{Name: "mfa", Run: deleteFrom("mfa_recovery_codes", "mfa_challenges")})
+	r.RegisterDeletionHook(DeletionHook{Name: "passkeys", Run: deleteFrom("webauthn_credentials", "webauthn_ceremonies")})
+	r.RegisterDeletionHook(DeletionHook{Name: "personal_access_tokens", Query: `DELETE FROM personal_access_tokens WHERE user_id = $1::uuid`})
+	r.RegisterDeletionHook(DeletionHook{Name: "roles", Query: `DELETE FROM user_roles WHERE user_id = $1::uuid`})
+	r.RegisterDeletionHook(DeletionHook{Name: "organizations", Query: `DELETE FROM organization_memberships WHERE user_id = $1::uuid`})
+	// Archives stay in storage, referenced by storage_key, until the purge
+	// removes them; expiring the rows stops downloads and pending builds.
+	r.RegisterDeletionHook(DeletionHook{Name: "data_exports", Query: `UPDATE data_exports SET status = 'expired'
+WHERE user_id = $1::uuid AND status IN ('pending', 'ready')`})
+	return r
+}
+
+// deleteFrom returns a hook body deleting the user's rows from each table.
+// The table names are constants, never user input.
+func deleteFrom(tables ...string) func(context.Context, pgx.Tx, string) error {
+	return func(ctx context.Context, tx pgx.Tx, userID string) error {
+		for _, table := range tables {
+			if _, err := tx.Exec(ctx, `DELETE FROM `+table+` WHERE user_id = $1::uuid`, userID); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
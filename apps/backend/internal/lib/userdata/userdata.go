@@ -0,0 +1,122 @@
+// Package userdata knows which tables hold data about a user. Modules that
+// add user-owned tables register them here so that data exports cover them
+// and account deletion removes them.
+package userdata
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ExportSource contributes one JSON file to a user's data export.
+type ExportSource struct {
+	// Name is the file name in the archive, without the .json extension.
+	Name string
+	// Query selects the rows to export; $1 is the user's ID. Leave out
+	// secrets such as password hashes and token digests.
+	Query string
+}
+
+// Querier is satisfied by *pgxpool.Pool and pgx.Tx.
+type Querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+var namePattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// Registry holds the export sources and deletion hooks.
+type Registry struct {
+	mu      sync.RWMutex
+	exports []ExportSource
+	hooks   []DeletionHook
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Default is the registry used by the data export and user deletion jobs. It
+// starts with the tables created by this repository's migrations.
+var Default = newDefaultRegistry()
+
+// RegisterExport adds s to Default.
+func RegisterExport(s ExportSource) {
+	Default.RegisterExport(s)
+}
+
+// RegisterExport adds s to the registry. Like http.Handle it panics on an
+// invalid or duplicate name, as that is a programming error.
+func (r *Registry) RegisterExport(s ExportSource) {
+	if !namePattern.MatchString(s.Name) || s.Query == "" {
+		panic(fmt.Sprintf("userdata: invalid export source %q", s.Name))
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.exports {
+		if existing.Name == s.Name {
+			panic(fmt.Sprintf("userdata: export source %q registered twice", s.Name))
+		}
+	}
+	r.exports = append(r.exports, s)
+}
+
+// Exports returns the registered export sources in registration order.
+func (r *Registry) Exports() []ExportSource {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]ExportSource(nil), r.exports...)
+}
+
+// WriteExport writes a zip archive with one JSON array per export source,
+// plus a manifest.json, for userID (the users.id UUID).
+func (r *Registry) WriteExport(ctx context.Context, q Querier, userID string, w io.Writer) error {
+	sources := r.Exports()
+	zw := zip.NewWriter(w)
+	files := make([]string, 0, len(sources))
+	for _, s := range sources {
+		var raw []byte
+		err := q.QueryRow(ctx, `SELECT COALESCE(json_agg(t), '[]'::json) FROM (`+s.Query+`) t`, userID).Scan(&raw)
+		if err != nil {
+			return fmt.Errorf("export %s: %w", s.Name, err)
+		}
+		var pretty bytes.Buffer
+		if err := json.Indent(&pretty, raw, "", "  "); err != nil {
+			return fmt.Errorf("export %s: %w", s.Name, err)
+		}
+		if err := writeFile(zw, s.Name+".json", pretty.Bytes()); err != nil {
+			return err
+		}
+		files = append(files, s.Name+".json")
+	}
+
+	manifest, err := json.MarshalIndent(map[string]any{
+		"user_id":      userID,
+		"generated_at": time.Now().UTC(),
+		"files":        files,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFile(zw, "manifest.json", manifest); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func writeFile(zw *zip.Writer, name string, data []byte) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
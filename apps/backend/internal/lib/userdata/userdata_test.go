@@ -0,0 +1,91 @@
+package userdata
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadSignature(t *testing.T) {
+	now := time.Now()
+	expires := now.Add(time.Hour)
+	sig := DownloadSignature("old", "export-1", expires)
+
+	require.True(t, VerifyDownload([]string{"new", "old"}, "export-1", expires, sig, now))
+	require.False(t, VerifyDownload([]string{"new"}, "export-1", expires, sig, now))
+	require.False(t, VerifyDownload([]string{"old"}, "export-2", expires, sig, now))
+	require.False(t, VerifyDownload([]string{"old"}, "export-1", expires.Add(time.Second), sig, now))
+	require.False(t, VerifyDownload([]string{"old"}, "export-1", expires, sig, expires))
+
+	link, err := url.Parse(DownloadURL("https://api.example.com", "old", "export-1", expires))
+	require.NoError(t, err)
+	require.Equal(t, "/api/v1/exports/export-1/download", link.Path)
+	require.Equal(t, sig, link.Query().Get("signature"))
+}
+
+func TestRegisterExport(t *testing.T) {
+	r := NewRegistry()
+	r.RegisterExport(ExportSource{Name: "notes", Query: "SELECT body FROM notes WHERE user_id = $1::uuid"})
+	require.Len(t, r.Exports(), 1)
+
+	require.Panics(t, func() { r.RegisterExport(ExportSource{Name: "notes", Query: "SELECT 1"}) })
+	require.Panics(t, func() { r.RegisterExport(ExportSource{Name: "../notes", Query: "SELECT 1"}) })
+	require.Panics(t, func() { r.RegisterExport(ExportSource{Name: "empty"}) })
+
+	for _, s := range Default.Exports() {
+		require.NotContains(t, strings.ToLower(s.Query), "password_hash", s.Name)
+	}
+}
+
+func TestRegisterDeletionHook(t *testing.T) {
+	r := NewRegistry()
+	r.RegisterDeletionHook(DeletionHook{Name: "notes", Query: "DELETE FROM notes WHERE user_id = $1::uuid"})
+	require.Len(t, r.DeletionHooks(), 1)
+
+	run := func(context.Context, pgx.Tx, string) error { return nil }
+	require.Panics(t, func() { r.RegisterDeletionHook(DeletionHook{Name: "notes", Run: run}) })
+	require.Panics(t, func() { r.RegisterDeletionHook(DeletionHook{Name: "both", Query: "SELECT 1", Run: run}) })
+	require.Panics(t, func() { r.RegisterDeletionHook(DeletionHook{Name: "neither"}) })
+	require.Panics(t, func() { r.RegisterDeletionHook(DeletionHook{Name: "Bad Name", Run: run}) })
+}
+
+func TestRunDeletionHooks(t *testing.T) {
+	logger := zerolog.Nop()
+	var ran []string
+	hook := func(name string, err error) DeletionHook {
+		return DeletionHook{Name: name, Run: func(context.Context, pgx.Tx, string) error {
+			ran = append(ran, name)
+			return err
+		}}
+	}
+
+	r := NewRegistry()
+	r.RegisterDeletionHook(hook("first", nil))
+	r.RegisterDeletionHook(hook("second", nil))
+	require.NoError(t, r.RunDeletionHooks(context.Background(), nil, "user-1", &logger))
+	require.Equal(t, []string{"first", "second"}, ran)
+
+	// A failing hook stops the run.
+	ran = nil
+	boom := errors.New("boom")
+	r = NewRegistry()
+	r.RegisterDeletionHook(hook("first", boom))
+	r.RegisterDeletionHook(hook("second", nil))
+	require.ErrorIs(t, r.RunDeletionHooks(context.Background(), nil, "user-1", &logger), boom)
+	require.Equal(t, []string{"first"}, ran)
+
+	// A hook that outlives its timeout fails with DeadlineExceeded.
+	r = NewRegistry()
+	r.RegisterDeletionHook(DeletionHook{Name: "slow", Timeout: 10 * time.Millisecond, Run: func(ctx context.Context, _ pgx.Tx, _ string) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+	require.ErrorIs(t, r.RunDeletionHooks(context.Background(), nil, "user-1", &logger), context.DeadlineExceeded)
+}
@@ -1,85 +1,113 @@
 package middleware
 
 import (
-	"encoding/json"
-	"net/http"
+	"errors"
+	"strings"
 	"time"
 
-	"github.com/clerk/clerk-sdk-go/v2"
-	clerkhttp "github.com/clerk/clerk-sdk-go/v2/http"
 	"github.com/labstack/echo/v4"
 	"github.com/petonlabs/go-boilerplate/internal/errs"
+	"github.com/petonlabs/go-boilerplate/internal/lib/stepup"
+	"github.com/petonlabs/go-boilerplate/internal/repository"
 	"github.com/petonlabs/go-boilerplate/internal/server"
 )
 
 type AuthMiddleware struct {
-	server *server.Server
+	server        *server.Server
+	authenticator Authenticator
+	organizations *repository.OrganizationRepository
 }
 
+// NewAuthMiddleware authenticates requests with the providers selected by
+// config.Auth.Providers. An invalid selection is rejected by config
+// validation, so it only falls back to the default chain here.
 func NewAuthMiddleware(s *server.Server) *AuthMiddleware {
+	authenticator, err := NewAuthenticator(s)
+	if err != nil {
+		s.Logger.Error().Err(err).Msg("invalid authentication providers, using local and clerk")
+		authenticator = Authenticators{NewLocalAuthenticator(s), NewClerkAuthenticator(s)}
+	}
+	return NewAuthMiddlewareWithAuthenticator(s, authenticator)
+}
+
+// NewAuthMiddlewareWithAuthenticator authenticates requests with a.
+func NewAuthMiddlewareWithAuthenticator(s *server.Server, a Authenticator) *AuthMiddleware {
 	return &AuthMiddleware{
-		server: s,
+		server:        s,
+		authenticator: a,
+		organizations: repository.NewOrganizationRepository(s),
 	}
 }
 
+// RequireAuth authenticates the caller with the configured Authenticator
+// and stores them in the echo context.
 func (auth *AuthMiddleware) RequireAuth(next echo.HandlerFunc) echo.HandlerFunc {
-	return echo.WrapMiddleware(
-		clerkhttp.WithHeaderAuthorization(
-			clerkhttp.AuthorizationFailureHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				start := time.Now()
-
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusUnauthorized)
-
-				response := map[string]string{
-					"code":     "UNAUTHORIZED",
-					"message":  "Unauthorized",
-					"override": "false",
-					"status":   "401",
-				}
-
-				if err := json.NewEncoder(w).Encode(response); err != nil {
-					auth.server.Logger.Error().Err(err).Str("function", "RequireAuth").Dur(
-						"duration", time.Since(start)).Msg("failed to write JSON response")
-				} else {
-					auth.server.Logger.Error().Str("function", "RequireAuth").Dur("duration", time.Since(start)).Msg(
-						"could not get session claims from context")
-				}
-			}))))(func(c echo.Context) error {
+	return func(c echo.Context) error {
 		start := time.Now()
-		claims, ok := clerk.SessionClaimsFromContext(c.Request().Context())
-
-		if !ok {
-			auth.server.Logger.Error().
+		p, err := auth.authenticator.Authenticate(c)
+		if err != nil {
+			event := auth.server.Logger.Error()
+			if errors.Is(err, ErrNoCredentials) {
+				event = auth.server.Logger.Debug()
+			}
+			event.
+				Err(err).
 				Str("function", "RequireAuth").
 				Str("request_id", GetRequestID(c)).
 				Dur("duration", time.Since(start)).
-				Msg("could not get session claims from context")
+				Msg("request not authenticated")
 			return errs.NewUnauthorizedError("Unauthorized", false)
 		}
 
-		c.Set("user_id", claims.Subject)
-
-		// Get role from public metadata
-		if customClaims, ok := claims.Custom.(map[string]interface{}); ok {
-			if metadata, ok := customClaims["metadata"].(map[string]interface{}); ok {
-				if role, ok := metadata["role"].(string); ok {
-					c.Set("user_role", role)
-				}
-			}
+		c.Set(UserIDKey, p.UserID)
+		if p.SessionID != "" {
+			c.Set(SessionIDKey, p.SessionID)
+		}
+		if p.TokenID != "" {
+			c.Set(TokenIDKey, p.TokenID)
+		}
+		if p.Role != "" {
+			c.Set(UserRoleKey, p.Role)
+		}
+		if p.Permissions != nil {
+			c.Set(PermissionsKey, p.Permissions)
+		}
+		if p.OrganizationID != "" {
+			c.Set(OrganizationClaimKey, p.OrganizationID)
+		}
+		if !p.AuthTime.IsZero() {
+			c.Set(AuthTimeKey, p.AuthTime)
+		}
+		if p.ActorID != "" {
+			c.Set(ActorIDKey, p.ActorID)
 		}
 
 		auth.server.Logger.Info().
 			Str("function", "RequireAuth").
-			Str("user_id", claims.Subject).
+			Str("user_id", p.UserID).
+			Str("method", p.Method).
+			Str("act", p.ActorID).
 			Str("request_id", GetRequestID(c)).
 			Dur("duration", time.Since(start)).
 			Msg("user authenticated successfully")
 
 		return next(c)
-	})
+	}
 }
 
+// bearerToken extracts the token from an "Authorization: Bearer <token>" header.
+func bearerToken(c echo.Context) string {
+	header := c.Request().Header.Get(echo.HeaderAuthorization)
+	if len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+// RequireRole compares the caller's role claim with role.
+//
+// Deprecated: use RequirePermission, which honours every role assigned to
+// the caller.
 func (auth *AuthMiddleware) RequireRole(role string) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
@@ -91,3 +119,60 @@ func (auth *AuthMiddleware) RequireRole(role string) echo.MiddlewareFunc {
 		}
 	}
 }
+
+// RequireRecentAuth rejects callers whose last credential check is older than
+// maxAge. A request passes when the session's auth time (the local login time
+// or Clerk's factor verification age) or a password/MFA re-confirmation
+// recorded in Redis is recent enough. Must run after RequireAuth.
+func (auth *AuthMiddleware) RequireRecentAuth(maxAge time.Duration) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			userID := GetUserID(c)
+			if userID == "" {
+				return errs.NewUnauthorizedError("Unauthorized", false)
+			}
+			// A long-lived token must not be enough to change credentials.
+			if tokenID, _ := c.Get(TokenIDKey).(string); tokenID != "" {
+				return errs.NewForbiddenError("Not allowed with a personal access token", false)
+			}
+			if GetActorID(c) != "" {
+				return errs.NewForbiddenError(impersonationForbidden, false)
+			}
+
+			now := time.Now()
+			if authTime, ok := c.Get(AuthTimeKey).(time.Time); ok && now.Sub(authTime) <= maxAge {
+				return next(c)
+			}
+
+			sessionID, _ := c.Get(SessionIDKey).(string)
+			confirmedAt, err := stepup.LastConfirmed(c.Request().Context(), auth.server.Redis, userID, sessionID)
+			if err != nil {
+				auth.server.Logger.Error().
+					Err(err).
+					Str("function", "RequireRecentAuth").
+					Str("request_id", GetRequestID(c)).
+					Msg("failed to read re-authentication record")
+			} else if !confirmedAt.IsZero() && now.Sub(confirmedAt) <= maxAge {
+				return next(c)
+			}
+
+			return errs.NewReauthenticationRequiredError("Recent authentication required", maxAge)
+		}
+	}
+}
+
+// clerkAuthTime converts Clerk's factor verification age claim (minutes since
+// the first and second factor were verified, -1 when not verified) into the
+// time of the most recent verification.
+func clerkAuthTime(fva [2]int64, now time.Time) (time.Time, bool) {
+	minutes := int64(-1)
+	for _, age := range fva {
+		if age >= 0 && (minutes < 0 || age < minutes) {
+			minutes = age
+		}
+	}
+	if minutes < 0 {
+		return time.Time{}, false
+	}
+	return now.Add(-time.Duration(minutes) * time.Minute), true
+}
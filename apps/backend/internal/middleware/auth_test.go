@@ -0,0 +1,187 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/petonlabs/go-boilerplate/internal/config"
+	"github.com/petonlabs/go-boilerplate/internal/errs"
+	"github.com/petonlabs/go-boilerplate/internal/lib/token"
+	"github.com/petonlabs/go-boilerplate/internal/server"
+)
+
+func TestRequireRecentAuth(t *testing.T) {
+	logger := zerolog.Nop()
+	auth := NewAuthMiddleware(&server.Server{Logger: &logger})
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusNoContent) }
+	guarded := auth.RequireRecentAuth(5 * time.Minute)(ok)
+
+	newContext := func(authTime time.Time) echo.Context {
+		e := echo.New()
+		c := e.NewContext(httptest.NewRequest(http.MethodPost, "/", nil), httptest.NewRecorder())
+		c.Set(UserIDKey, "user-1")
+		c.Set(SessionIDKey, "session-1")
+		c.Set(AuthTimeKey, authTime)
+		return c
+	}
+
+	require.NoError(t, guarded(newContext(time.Now().Add(-time.Minute))))
+
+	err := guarded(newContext(time.Now().Add(-time.Hour)))
+	var httpErr *errs.HTTPError
+	require.True(t, errors.As(err, &httpErr))
+	require.Equal(t, http.StatusForbidden, httpErr.Status)
+	require.NotNil(t, httpErr.Action)
+	require.Equal(t, errs.ActionTypeReauthenticate, httpErr.Action.Type)
+	require.Equal(t, "300", httpErr.Action.Value)
+
+	// Personal access tokens never count as a recent login.
+	c := newContext(time.Now())
+	c.Set(TokenIDKey, "token-1")
+	err = guarded(c)
+	require.True(t, errors.As(err, &httpErr))
+	require.Equal(t, http.StatusForbidden, httpErr.Status)
+	require.Nil(t, httpErr.Action)
+
+	// Neither do impersonation sessions.
+	c = newContext(time.Now())
+	c.Set(ActorIDKey, "admin-1")
+	err = guarded(c)
+	require.True(t, errors.As(err, &httpErr))
+	require.Equal(t, http.StatusForbidden, httpErr.Status)
+	require.Nil(t, httpErr.Action)
+}
+
+func TestDenyImpersonation(t *testing.T) {
+	logger := zerolog.Nop()
+	auth := NewAuthMiddleware(&server.Server{Logger: &logger})
+	guarded := auth.DenyImpersonation(func(c echo.Context) error { return c.NoContent(http.StatusNoContent) })
+
+	e := echo.New()
+	c := e.NewContext(httptest.NewRequest(http.MethodDelete, "/", nil), httptest.NewRecorder())
+	c.Set(UserIDKey, "user-1")
+	require.NoError(t, guarded(c))
+
+	c.Set(ActorIDKey, "admin-1")
+	err := guarded(c)
+	var httpErr *errs.HTTPError
+	require.True(t, errors.As(err, &httpErr))
+	require.Equal(t, http.StatusForbidden, httpErr.Status)
+}
+
+func TestClerkAuthTime(t *testing.T) {
+	now := time.Now()
+
+	got, ok := clerkAuthTime([2]int64{30, 2}, now)
+	require.True(t, ok)
+	require.Equal(t, now.Add(-2*time.Minute), got)
+
+	got, ok = clerkAuthTime([2]int64{10, -1}, now)
+	require.True(t, ok)
+	require.Equal(t, now.Add(-10*time.Minute), got)
+
+	_, ok = clerkAuthTime([2]int64{-1, -1}, now)
+	require.False(t, ok)
+}
+
+func TestRequireScope(t *testing.T) {
+	logger := zerolog.Nop()
+	auth := NewAuthMiddleware(&server.Server{Logger: &logger})
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusNoContent) }
+	guarded := auth.RequireScope("users:read", "billing:export")(ok)
+
+	newContext := func(scopes []string) echo.Context {
+		e := echo.New()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+		if scopes != nil {
+			c.Set(ScopesKey, scopes)
+		}
+		return c
+	}
+
+	require.NoError(t, guarded(newContext([]string{"users:*", "billing:export"})))
+	require.NoError(t, guarded(newContext([]string{"*"})))
+
+	for _, scopes := range [][]string{nil, {"users:read"}, {"billing:*"}} {
+		err := guarded(newContext(scopes))
+		var httpErr *errs.HTTPError
+		require.True(t, errors.As(err, &httpErr))
+		require.Equal(t, http.StatusForbidden, httpErr.Status)
+	}
+}
+
+type stubAuthenticator struct {
+	principal *Principal
+	err       error
+}
+
+func (s stubAuthenticator) Authenticate(echo.Context) (*Principal, error) { return s.principal, s.err }
+
+func TestAuthenticatorsChain(t *testing.T) {
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	skip := stubAuthenticator{err: ErrNoCredentials}
+	reject := stubAuthenticator{err: errors.New("bad token")}
+	accept := stubAuthenticator{principal: &Principal{UserID: "user-1"}}
+
+	p, err := Authenticators{skip, accept}.Authenticate(c)
+	require.NoError(t, err)
+	require.Equal(t, "user-1", p.UserID)
+
+	// A rejection stops the chain.
+	_, err = Authenticators{reject, accept}.Authenticate(c)
+	require.EqualError(t, err, "bad token")
+
+	_, err = Authenticators{skip}.Authenticate(c)
+	require.ErrorIs(t, err, ErrNoCredentials)
+}
+
+func TestRequireAuthLocalProvider(t *testing.T) {
+	logger := zerolog.Nop()
+	s := &server.Server{Logger: &logger}
+	s.SetConfig(&config.Config{Auth: config.AuthConfig{SecretKey: "test-secret", Providers: []string{config.AuthProviderLocal}}})
+	auth := NewAuthMiddleware(s)
+	guarded := auth.RequireAuth(func(c echo.Context) error { return c.NoContent(http.StatusNoContent) })
+
+	request := func(bearer string) (echo.Context, error) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if bearer != "" {
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+bearer)
+		}
+		c := echo.New().NewContext(req, httptest.NewRecorder())
+		return c, guarded(c)
+	}
+
+	now := time.Now()
+	raw, err := token.Sign(token.Claims{
+		Subject:   "user-1",
+		SessionID: "session-1",
+		AuthTime:  now.Unix(),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(time.Minute).Unix(),
+		Actor:     &token.Actor{Subject: "admin-1"},
+	}, "test-secret")
+	require.NoError(t, err)
+	c, err := request(raw)
+	require.NoError(t, err)
+	require.Equal(t, "user-1", GetUserID(c))
+	require.Equal(t, "admin-1", GetActorID(c))
+	require.Equal(t, "session-1", c.Get(SessionIDKey))
+
+	// Without Clerk in the chain, foreign tokens are rejected without any
+	// call to Clerk.
+	foreign, err := token.Sign(token.Claims{Subject: "user-1", ExpiresAt: now.Add(time.Minute).Unix()}, "other-secret")
+	require.NoError(t, err)
+	for _, bearer := range []string{"", foreign} {
+		_, err := request(bearer)
+		var httpErr *errs.HTTPError
+		require.True(t, errors.As(err, &httpErr))
+		require.Equal(t, http.StatusUnauthorized, httpErr.Status)
+	}
+}
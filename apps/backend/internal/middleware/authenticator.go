@@ -0,0 +1,287 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/clerk/clerk-sdk-go/v2"
+	"github.com/clerk/clerk-sdk-go/v2/jwks"
+	"github.com/clerk/clerk-sdk-go/v2/jwt"
+	"github.com/labstack/echo/v4"
+	"github.com/petonlabs/go-boilerplate/internal/config"
+	"github.com/petonlabs/go-boilerplate/internal/lib/apikey"
+	"github.com/petonlabs/go-boilerplate/internal/lib/token"
+	"github.com/petonlabs/go-boilerplate/internal/server"
+)
+
+// ErrNoCredentials is returned by an Authenticator when the request carries
+// no credentials it recognises, so that the next authenticator in a chain can
+// try.
+var ErrNoCredentials = errors.New("no credentials")
+
+// Authentication methods reported in Principal.Method.
+const (
+	AuthMethodSession             = "session"
+	AuthMethodPersonalAccessToken = "personal_access_token"
+	AuthMethodClerk               = "clerk"
+)
+
+// Principal is the caller established by an Authenticator.
+type Principal struct {
+	UserID    string
+	SessionID string
+	// TokenID is set when the caller used a personal access token.
+	TokenID string
+	Role    string
+	// Permissions are granted by the identity provider on top of the
+	// caller's roles.
+	Permissions []string
+	// OrganizationID is the organization selected in the identity provider.
+	OrganizationID string
+	// ActorID is the admin impersonating UserID, if any.
+	ActorID string
+	// AuthTime is when the caller last proved their credentials; zero when
+	// unknown.
+	AuthTime time.Time
+	Method   string
+}
+
+// Authenticator verifies the credentials carried by a request. It returns
+// ErrNoCredentials when there are none it handles, and any other error when
+// the credentials are its own but invalid.
+type Authenticator interface {
+	Authenticate(c echo.Context) (*Principal, error)
+}
+
+// Authenticators tries each authenticator in turn and returns the first
+// principal or rejection.
+type Authenticators []Authenticator
+
+func (chain Authenticators) Authenticate(c echo.Context) (*Principal, error) {
+	for _, a := range chain {
+		p, err := a.Authenticate(c)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return p, err
+	}
+	return nil, ErrNoCredentials
+}
+
+// NewAuthenticator builds the chain selected by config.Auth.Providers,
+// defaulting to local tokens first and Clerk second.
+func NewAuthenticator(s *server.Server) (Authenticator, error) {
+	providers := []string{config.AuthProviderLocal, config.AuthProviderClerk}
+	if cfg := s.GetConfig(); cfg != nil && len(cfg.Auth.Providers) > 0 {
+		providers = cfg.Auth.Providers
+	}
+	chain := make(Authenticators, 0, len(providers))
+	for _, name := range providers {
+		switch strings.TrimSpace(name) {
+		case config.AuthProviderLocal:
+			chain = append(chain, NewLocalAuthenticator(s))
+		case config.AuthProviderClerk:
+			chain = append(chain, NewClerkAuthenticator(s))
+		default:
+			return nil, fmt.Errorf("unknown authentication provider %q", name)
+		}
+	}
+	return chain, nil
+}
+
+// LocalAuthenticator accepts the access tokens issued by AuthService on login
+// and personal access tokens. It needs no external service.
+type LocalAuthenticator struct {
+	server *server.Server
+}
+
+func NewLocalAuthenticator(s *server.Server) *LocalAuthenticator {
+	return &LocalAuthenticator{server: s}
+}
+
+func (l *LocalAuthenticator) Authenticate(c echo.Context) (*Principal, error) {
+	raw := bearerToken(c)
+	if raw == "" {
+		return nil, ErrNoCredentials
+	}
+	cfg := l.server.GetConfig()
+	if cfg == nil {
+		return nil, ErrNoCredentials
+	}
+	if strings.HasPrefix(raw, apikey.PersonalAccessTokenPrefix) {
+		return l.personalAccessToken(c, cfg, raw)
+	}
+
+	claims, err := token.Parse(raw, token.KeyRing(cfg.Auth.AccessTokenSecret, cfg.Auth.SecretKey), time.Now())
+	if err != nil {
+		// Anything that is not an expired token of ours is left to the
+		// next authenticator.
+		if errors.Is(err, token.ErrExpired) {
+			return nil, err
+		}
+		return nil, ErrNoCredentials
+	}
+
+	if l.server.DB != nil && l.server.DB.Pool != nil {
+		var active bool
+		err := l.server.DB.Pool.QueryRow(c.Request().Context(),
+			`SELECT revoked_at IS NULL AND expires_at > now() FROM sessions WHERE id::text = $1`, claims.SessionID).Scan(&active)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load session: %w", err)
+		}
+		if !active {
+			return nil, errors.New("session has been revoked or has expired")
+		}
+	}
+
+	p := &Principal{
+		UserID:    claims.Subject,
+		SessionID: claims.SessionID,
+		Role:      claims.Role,
+		Method:    AuthMethodSession,
+	}
+	if claims.AuthTime > 0 {
+		p.AuthTime = time.Unix(claims.AuthTime, 0)
+	}
+	if claims.Actor != nil {
+		p.ActorID = claims.Actor.Subject
+	}
+	return p, nil
+}
+
+// personalAccessToken authenticates the owner of a personal access token and
+// records where the token was used.
+func (l *LocalAuthenticator) personalAccessToken(c echo.Context, cfg *config.Config, raw string) (*Principal, error) {
+	if l.server.DB == nil || l.server.DB.Pool == nil {
+		return nil, errors.New("database not initialized")
+	}
+	digests := token.Digests(raw, token.KeyRing(cfg.Auth.TokenHMACSecret, cfg.Auth.SecretKey))
+	if len(digests) == 0 {
+		return nil, errors.New("no token secret configured")
+	}
+
+	ctx := c.Request().Context()
+	var tokenID, userID, role string
+	err := l.server.DB.Pool.QueryRow(ctx, `SELECT t.id::text, u.id::text, COALESCE(u.role, '')
+FROM personal_access_tokens t JOIN users u ON u.id = t.user_id
+WHERE t.token_hash = ANY($1) AND t.revoked_at IS NULL AND (t.expires_at IS NULL OR t.expires_at > now()) AND u.deleted_at IS NULL`,
+		digests).Scan(&tokenID, &userID, &role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("personal access token is invalid, revoked or expired")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up personal access token: %w", err)
+	}
+
+	ip := c.RealIP()
+	if _, err := l.server.DB.Pool.Exec(ctx, `UPDATE personal_access_tokens SET last_used_at = now(), last_used_ip = $2
+WHERE id::text = $1 AND (last_used_at IS NULL OR last_used_at < now() - interval '1 minute' OR last_used_ip IS DISTINCT FROM $2)`,
+		tokenID, ip); err != nil {
+		l.server.Logger.Warn().Err(err).Str("function", "RequireAuth").Msg("failed to record personal access token use")
+	}
+
+	return &Principal{UserID: userID, TokenID: tokenID, Role: role, Method: AuthMethodPersonalAccessToken}, nil
+}
+
+// clerkJWKTTL is how long a Clerk signing key is cached.
+const clerkJWKTTL = time.Hour
+
+// ClerkAuthenticator accepts Clerk session tokens. Signing keys are fetched
+// from Clerk with config.Auth.SecretKey and cached.
+type ClerkAuthenticator struct {
+	server *server.Server
+	jwks   *jwks.Client
+
+	mu   sync.Mutex
+	keys map[string]cachedJWK
+}
+
+type cachedJWK struct {
+	key       *clerk.JSONWebKey
+	expiresAt time.Time
+}
+
+// clerkCustomClaims are the claims added by the session token template: the
+// user's public metadata.
+type clerkCustomClaims struct {
+	Metadata struct {
+		Role        string   `json:"role"`
+		Permissions []string `json:"permissions"`
+	} `json:"metadata"`
+}
+
+func NewClerkAuthenticator(s *server.Server) *ClerkAuthenticator {
+	cc := &clerk.ClientConfig{}
+	if cfg := s.GetConfig(); cfg != nil && cfg.Auth.SecretKey != "" {
+		key := cfg.Auth.SecretKey
+		cc.Key = &key
+	}
+	return &ClerkAuthenticator{server: s, jwks: jwks.NewClient(cc), keys: map[string]cachedJWK{}}
+}
+
+func (a *ClerkAuthenticator) Authenticate(c echo.Context) (*Principal, error) {
+	raw := bearerToken(c)
+	if raw == "" {
+		return nil, ErrNoCredentials
+	}
+	ctx := c.Request().Context()
+	decoded, err := jwt.Decode(ctx, &jwt.DecodeParams{Token: raw})
+	if err != nil {
+		return nil, ErrNoCredentials
+	}
+	jwk, err := a.signingKey(ctx, decoded.KeyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load clerk signing key: %w", err)
+	}
+	claims, err := jwt.Verify(ctx, &jwt.VerifyParams{
+		Token: raw,
+		JWK:   jwk,
+		CustomClaimsConstructor: func(context.Context) any {
+			return &clerkCustomClaims{}
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Principal{
+		UserID:         claims.Subject,
+		SessionID:      claims.SessionID,
+		OrganizationID: claims.ActiveOrganizationID,
+		Method:         AuthMethodClerk,
+	}
+	if authTime, ok := clerkAuthTime(claims.FactorVerificationAge, time.Now()); ok {
+		p.AuthTime = authTime
+	}
+	if custom, ok := claims.Custom.(*clerkCustomClaims); ok {
+		p.Role = custom.Metadata.Role
+		p.Permissions = custom.Metadata.Permissions
+	}
+	return p, nil
+}
+
+// signingKey returns the Clerk key with the given ID, fetching the key set
+// when it is not cached.
+func (a *ClerkAuthenticator) signingKey(ctx context.Context, kid string) (*clerk.JSONWebKey, error) {
+	now := time.Now()
+	a.mu.Lock()
+	cached, ok := a.keys[kid]
+	a.mu.Unlock()
+	if ok && now.Before(cached.expiresAt) {
+		return cached.key, nil
+	}
+
+	key, err := jwt.GetJSONWebKey(ctx, &jwt.GetJSONWebKeyParams{KeyID: kid, JWKSClient: a.jwks})
+	if err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	a.keys[kid] = cachedJWK{key: key, expiresAt: now.Add(clerkJWKTTL)}
+	a.mu.Unlock()
+	return key, nil
+}
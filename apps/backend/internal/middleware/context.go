@@ -14,8 +14,32 @@ import (
 type contextKey string
 
 const (
-	UserIDKey   = "user_id"
-	UserRoleKey = "user_role"
+	UserIDKey    = "user_id"
+	UserRoleKey  = "user_role"
+	SessionIDKey = "session_id"
+	// AuthTimeKey holds the time.Time the caller last presented credentials
+	AuthTimeKey = "auth_time"
+	// PrincipalTypeKey is PrincipalServiceAccount for callers authenticated
+	// with an API key; it is unset for users.
+	PrincipalTypeKey = "principal_type"
+	// ScopesKey holds the []string of scopes granted to the caller's key
+	ScopesKey   = "scopes"
+	APIKeyIDKey = "api_key_id"
+	// PermissionsKey holds the caller's []string permissions once resolved
+	PermissionsKey = "permissions"
+	// OrganizationIDKey and OrganizationRoleKey hold the active organization
+	// and the caller's role in it, set by RequireOrganization
+	OrganizationIDKey   = "organization_id"
+	OrganizationRoleKey = "organization_role"
+	// OrganizationClaimKey holds the active organization from the session
+	OrganizationClaimKey = "organization_claim"
+	// ActorIDKey holds the admin acting as the caller during impersonation
+	// (the token's "act" claim)
+	ActorIDKey = "actor_id"
+	// TokenIDKey holds the ID of the personal access token the caller used
+	TokenIDKey              = "token_id"
+	PrincipalServiceAccount = "service_account"
+
 	// Use custom type for context key
 	LoggerKey contextKey = "logger"
 )
@@ -52,6 +76,14 @@ func (ce *ContextEnhancer) EnhanceContext() echo.MiddlewareFunc {
 				contextLogger = contextLogger.With().Str("user_role", userRole).Logger()
 			}
 
+			// The actor is only known once RequireAuth has run, so it is added
+			// when each line is written rather than when the logger is built.
+			contextLogger = contextLogger.Hook(zerolog.HookFunc(func(e *zerolog.Event, _ zerolog.Level, _ string) {
+				if actorID := GetActorID(c); actorID != "" {
+					e.Str("act", actorID)
+				}
+			}))
+
 			// Store logger in both Echo context (string key) and standard context (typed key)
 			c.Set(string(LoggerKey), &contextLogger)
 			ctx := context.WithValue(c.Request().Context(), LoggerKey, &contextLogger)
@@ -83,6 +115,12 @@ func GetUserID(c echo.Context) string {
 	return ""
 }
 
+// GetScopes returns the scopes granted to the caller's API key.
+func GetScopes(c echo.Context) []string {
+	scopes, _ := c.Get(ScopesKey).([]string)
+	return scopes
+}
+
 func GetLogger(c echo.Context) *zerolog.Logger {
 	if logger, ok := c.Get(string(LoggerKey)).(*zerolog.Logger); ok {
 		return logger
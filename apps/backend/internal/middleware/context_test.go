@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/petonlabs/go-boilerplate/internal/server"
+)
+
+func TestEnhanceContextLogsActor(t *testing.T) {
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	ce := NewContextEnhancer(&server.Server{Logger: &logger})
+
+	e := echo.New()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	handler := ce.EnhanceContext()(func(c echo.Context) error {
+		GetLogger(c).Info().Msg("before auth")
+		// RequireAuth runs after the enhancer and sets the actor.
+		c.Set(ActorIDKey, "admin-1")
+		GetLogger(c).Info().Msg("after auth")
+		return nil
+	})
+	require.NoError(t, handler(c))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	require.NotContains(t, lines[0], `"act"`)
+	require.Contains(t, lines[1], `"act":"admin-1"`)
+}
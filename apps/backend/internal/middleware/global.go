@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -151,6 +152,7 @@ func (global *GlobalMiddlewares) GlobalErrorHandler(err error, c echo.Context) {
 	var message string
 	var fieldErrors []errs.FieldError
 	var action *errs.Action
+	var retryAfter int
 
 	switch {
 	case errors.As(err, &httpErr):
@@ -159,6 +161,7 @@ func (global *GlobalMiddlewares) GlobalErrorHandler(err error, c echo.Context) {
 		message = httpErr.Message
 		fieldErrors = httpErr.Errors
 		action = httpErr.Action
+		retryAfter = httpErr.RetryAfter
 
 	case errors.As(err, &echoErr):
 		status = echoErr.Code
@@ -187,13 +190,17 @@ func (global *GlobalMiddlewares) GlobalErrorHandler(err error, c echo.Context) {
 		Msg(message)
 
 	if !c.Response().Committed {
+		if retryAfter > 0 {
+			c.Response().Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		}
 		_ = c.JSON(status, errs.HTTPError{
-			Code:     code,
-			Message:  message,
-			Status:   status,
-			Override: httpErr != nil && httpErr.Override,
-			Errors:   fieldErrors,
-			Action:   action,
+			Code:       code,
+			Message:    message,
+			Status:     status,
+			Override:   httpErr != nil && httpErr.Override,
+			Errors:     fieldErrors,
+			Action:     action,
+			RetryAfter: retryAfter,
 		})
 	}
 }
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/petonlabs/go-boilerplate/internal/errs"
+)
+
+const impersonationForbidden = "Not allowed while impersonating"
+
+// DenyImpersonation rejects requests made with an impersonation session.
+// Use it on destructive endpoints and on anything an admin must not do in a
+// user's name. Must run after RequireAuth.
+func (auth *AuthMiddleware) DenyImpersonation(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if GetActorID(c) != "" {
+			auth.server.Logger.Warn().
+				Str("function", "DenyImpersonation").
+				Str("request_id", GetRequestID(c)).
+				Str("user_id", GetUserID(c)).
+				Str("act", GetActorID(c)).
+				Str("path", c.Path()).
+				Msg("blocked request from impersonation session")
+			return errs.NewForbiddenError(impersonationForbidden, false)
+		}
+		return next(c)
+	}
+}
+
+// GetActorID returns the admin impersonating the caller, or "" when the
+// caller is acting as themself.
+func GetActorID(c echo.Context) string {
+	actorID, _ := c.Get(ActorIDKey).(string)
+	return actorID
+}
@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/labstack/echo/v4"
+	"github.com/petonlabs/go-boilerplate/internal/errs"
+	"github.com/petonlabs/go-boilerplate/internal/lib/tenant"
+	"github.com/petonlabs/go-boilerplate/internal/repository"
+)
+
+// OrganizationHeader selects the active organization by our ID or its Clerk
+// ID. It takes precedence over the org_id claim of a Clerk session.
+const OrganizationHeader = "X-Organization-ID"
+
+// RequireOrganization resolves the active organization from the
+// X-Organization-ID header or the session's organization claim, checks that
+// the caller is a member, and scopes the request context to it (see package
+// tenant). Must run after RequireAuth.
+func (auth *AuthMiddleware) RequireOrganization(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := GetUserID(c)
+		if userID == "" {
+			return errs.NewUnauthorizedError("Unauthorized", false)
+		}
+		ref := c.Request().Header.Get(OrganizationHeader)
+		if ref == "" {
+			ref, _ = c.Get(OrganizationClaimKey).(string)
+		}
+		if ref == "" {
+			return errs.NewBadRequestError("An active organization is required", false, nil, nil, nil)
+		}
+		if auth.server.DB == nil || auth.server.DB.Pool == nil {
+			return errs.NewForbiddenError("Forbidden", false)
+		}
+
+		ctx := c.Request().Context()
+		orgID, role, err := auth.organizations.Membership(ctx, ref, userID)
+		if err != nil {
+			if !errors.Is(err, repository.ErrMemberNotFound) {
+				auth.server.Logger.Error().
+					Err(err).
+					Str("function", "RequireOrganization").
+					Str("request_id", GetRequestID(c)).
+					Msg("failed to resolve organization membership")
+			}
+			return errs.NewForbiddenError("Forbidden", false)
+		}
+
+		c.Set(OrganizationIDKey, orgID)
+		c.Set(OrganizationRoleKey, role)
+		c.SetRequest(c.Request().WithContext(tenant.WithOrganization(ctx, orgID)))
+		return next(c)
+	}
+}
+
+// RequireOrganizationRole rejects callers whose role in the active
+// organization is not one of roles. Must run after RequireOrganization.
+func (auth *AuthMiddleware) RequireOrganizationRole(roles ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			role, _ := c.Get(OrganizationRoleKey).(string)
+			if !slices.Contains(roles, role) {
+				return errs.NewForbiddenError("Forbidden", false)
+			}
+			return next(c)
+		}
+	}
+}
+
+// GetOrganizationID returns the active organization set by
+// RequireOrganization.
+func GetOrganizationID(c echo.Context) string {
+	orgID, _ := c.Get(OrganizationIDKey).(string)
+	return orgID
+}
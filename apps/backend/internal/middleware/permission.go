@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/labstack/echo/v4"
+	"github.com/petonlabs/go-boilerplate/internal/errs"
+	"github.com/petonlabs/go-boilerplate/internal/lib/rbac"
+)
+
+// RequirePermission rejects callers that were not granted permission. The
+// permissions come from the session's metadata.permissions claim when it is
+// present; otherwise they are resolved from the caller's roles in the
+// database and cached in Redis. Must run after RequireAuth.
+func (auth *AuthMiddleware) RequirePermission(permission string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			userID := GetUserID(c)
+			if userID == "" {
+				return errs.NewUnauthorizedError("Unauthorized", false)
+			}
+
+			permissions, ok := c.Get(PermissionsKey).([]string)
+			if !ok {
+				var err error
+				permissions, err = auth.userPermissions(c.Request().Context(), userID)
+				if err != nil {
+					auth.server.Logger.Error().
+						Err(err).
+						Str("function", "RequirePermission").
+						Str("request_id", GetRequestID(c)).
+						Msg("failed to resolve permissions")
+					return errs.NewForbiddenError("Forbidden", false)
+				}
+				c.Set(PermissionsKey, permissions)
+			}
+
+			if !rbac.Allows(permissions, permission) {
+				return errs.NewForbiddenError("Forbidden", false)
+			}
+			return next(c)
+		}
+	}
+}
+
+// userPermissions returns the permissions granted by the roles of the user
+// identified by userID (our user ID or a Clerk user ID), including the role
+// named by users.role.
+func (auth *AuthMiddleware) userPermissions(ctx context.Context, userID string) ([]string, error) {
+	cached, ok, err := rbac.Cached(ctx, auth.server.Redis, userID)
+	if err != nil {
+		auth.server.Logger.Warn().Err(err).Str("function", "RequirePermission").Msg("failed to read cached permissions")
+	} else if ok {
+		return cached, nil
+	}
+
+	if auth.server.DB == nil || auth.server.DB.Pool == nil {
+		return []string{}, nil
+	}
+	rows, err := auth.server.DB.Pool.Query(ctx, `SELECT DISTINCT p.name
+FROM users u
+JOIN roles r ON r.name = u.role OR r.id IN (SELECT ur.role_id FROM user_roles ur WHERE ur.user_id = u.id)
+JOIN role_permissions rp ON rp.role_id = r.id
+JOIN permissions p ON p.id = rp.permission_id
+WHERE (u.id::text = $1 OR u.clerk_id = $1) AND u.deleted_at IS NULL
+ORDER BY p.name`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := rbac.Store(ctx, auth.server.Redis, userID, permissions, rbac.DefaultTTL); err != nil {
+		auth.server.Logger.Warn().Err(err).Str("function", "RequirePermission").Msg("failed to cache permissions")
+	}
+	return permissions, nil
+}
@@ -0,0 +1,26 @@
+package model
+
+// Organization roles. Clerk's "org:admin" and "org:member" map onto these.
+const (
+	OrganizationRoleAdmin  = "admin"
+	OrganizationRoleMember = "member"
+)
+
+type Organization struct {
+	Base
+	ClerkID  *string `json:"clerkId,omitempty" db:"clerk_id"`
+	Name     string  `json:"name" db:"name"`
+	Slug     string  `json:"slug" db:"slug"`
+	ImageURL *string `json:"imageUrl,omitempty" db:"image_url"`
+	// Role is the caller's role when organizations are listed for a user.
+	Role string `json:"role,omitempty" db:"role"`
+}
+
+type OrganizationMember struct {
+	UserID    string  `json:"userId" db:"user_id"`
+	Email     *string `json:"email,omitempty" db:"email"`
+	FirstName *string `json:"firstName,omitempty" db:"first_name"`
+	LastName  *string `json:"lastName,omitempty" db:"last_name"`
+	Role      string  `json:"role" db:"role"`
+	BaseWithCreatedAt
+}
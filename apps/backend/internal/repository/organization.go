@@ -0,0 +1,275 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/petonlabs/go-boilerplate/internal/lib/tenant"
+	"github.com/petonlabs/go-boilerplate/internal/model"
+	"github.com/petonlabs/go-boilerplate/internal/server"
+)
+
+var (
+	ErrOrganizationNotFound = errors.New("organization not found")
+	ErrSlugTaken            = errors.New("organization slug already in use")
+	ErrMemberNotFound       = errors.New("organization member not found")
+	// ErrUserNotFound is returned when a membership refers to a user (or,
+	// for Clerk memberships, an organization) that does not exist or has not
+	// been synced from Clerk yet.
+	ErrUserNotFound = errors.New("user not found")
+)
+
+// OrganizationRepository stores organizations and memberships. Methods that
+// act on "the" organization are scoped to the tenant in the context (see
+// package tenant); the others look organizations up explicitly. User IDs may
+// be our user IDs or Clerk user IDs.
+type OrganizationRepository struct {
+	server *server.Server
+}
+
+func NewOrganizationRepository(s *server.Server) *OrganizationRepository {
+	return &OrganizationRepository{server: s}
+}
+
+const organizationColumns = `o.id, o.clerk_id, o.name, o.slug, o.image_url, o.created_at, o.updated_at`
+
+func scanOrganization(row pgx.Row, extra ...any) (*model.Organization, error) {
+	var org model.Organization
+	dest := append([]any{&org.ID, &org.ClerkID, &org.Name, &org.Slug, &org.ImageURL, &org.CreatedAt, &org.UpdatedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// Create inserts an organization with userID as its admin.
+func (r *OrganizationRepository) Create(ctx context.Context, name, slug, userID string) (*model.Organization, error) {
+	tx, err := r.server.DB.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	org, err := scanOrganization(tx.QueryRow(ctx, `INSERT INTO organizations AS o (name, slug) VALUES ($1, $2)
+ON CONFLICT (slug) DO NOTHING RETURNING `+organizationColumns, name, slug))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSlugTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+	ct, err := tx.Exec(ctx, `INSERT INTO organization_memberships (organization_id, user_id, role)
+SELECT $1::uuid, id, $3 FROM users WHERE (id::text = $2 OR clerk_id = $2) AND deleted_at IS NULL`, org.ID, userID, model.OrganizationRoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+	if ct.RowsAffected() == 0 {
+		return nil, ErrUserNotFound
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	org.Role = model.OrganizationRoleAdmin
+	return org, nil
+}
+
+// ListForUser returns the organizations userID belongs to with their role.
+func (r *OrganizationRepository) ListForUser(ctx context.Context, userID string) ([]model.Organization, error) {
+	rows, err := r.server.DB.Pool.Query(ctx, `SELECT `+organizationColumns+`, m.role
+FROM organizations o
+JOIN organization_memberships m ON m.organization_id = o.id
+JOIN users u ON u.id = m.user_id
+WHERE (u.id::text = $1 OR u.clerk_id = $1) AND u.deleted_at IS NULL AND o.deleted_at IS NULL
+ORDER BY o.name`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := []model.Organization{}
+	for rows.Next() {
+		var role string
+		org, err := scanOrganization(rows, &role)
+		if err != nil {
+			return nil, err
+		}
+		org.Role = role
+		orgs = append(orgs, *org)
+	}
+	return orgs, rows.Err()
+}
+
+// Membership resolves organizationRef (our organization ID or a Clerk
+// organization ID) and returns its ID and userID's role in it. Deleted users
+// are not members of anything, even before their memberships are purged.
+func (r *OrganizationRepository) Membership(ctx context.Context, organizationRef, userID string) (string, string, error) {
+	var orgID, role string
+	err := r.server.DB.Pool.QueryRow(ctx, `SELECT o.id::text, m.role
+FROM organizations o
+JOIN organization_memberships m ON m.organization_id = o.id
+JOIN users u ON u.id = m.user_id
+WHERE (o.id::text = $1 OR o.clerk_id = $1) AND o.deleted_at IS NULL
+	AND (u.id::text = $2 OR u.clerk_id = $2) AND u.deleted_at IS NULL`,
+		organizationRef, userID).Scan(&orgID, &role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", "", ErrMemberNotFound
+	}
+	return orgID, role, err
+}
+
+// Get returns the tenant organization.
+func (r *OrganizationRepository) Get(ctx context.Context) (*model.Organization, error) {
+	orgID, err := tenant.OrganizationID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	org, err := scanOrganization(r.server.DB.Pool.QueryRow(ctx, `SELECT `+organizationColumns+`
+FROM organizations o WHERE o.id::text = $1 AND o.deleted_at IS NULL`, orgID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOrganizationNotFound
+	}
+	return org, err
+}
+
+// ListMembers returns the members of the tenant organization.
+func (r *OrganizationRepository) ListMembers(ctx context.Context) ([]model.OrganizationMember, error) {
+	orgID, err := tenant.OrganizationID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.server.DB.Pool.Query(ctx, `SELECT u.id::text, u.email, u.first_name, u.last_name, m.role, m.created_at
+FROM organization_memberships m JOIN users u ON u.id = m.user_id
+WHERE m.organization_id::text = $1 AND u.deleted_at IS NULL
+ORDER BY m.created_at`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []model.OrganizationMember{}
+	for rows.Next() {
+		var m model.OrganizationMember
+		if err := rows.Scan(&m.UserID, &m.Email, &m.FirstName, &m.LastName, &m.Role, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// SetMemberRole changes the role of userID in the tenant organization. Users
+// join by accepting an invitation, so it never adds members.
+func (r *OrganizationRepository) SetMemberRole(ctx context.Context, userID, role string) error {
+	orgID, err := tenant.OrganizationID(ctx)
+	if err != nil {
+		return err
+	}
+	ct, err := r.server.DB.Pool.Exec(ctx, `UPDATE organization_memberships m SET role = $3, updated_at = now()
+FROM users u
+WHERE m.user_id = u.id AND m.organization_id::text = $1 AND (u.id::text = $2 OR u.clerk_id = $2) AND u.deleted_at IS NULL`, orgID, userID, role)
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return ErrMemberNotFound
+	}
+	return nil
+}
+
+// RemoveMember removes userID from the tenant organization.
+func (r *OrganizationRepository) RemoveMember(ctx context.Context, userID string) error {
+	orgID, err := tenant.OrganizationID(ctx)
+	if err != nil {
+		return err
+	}
+	ct, err := r.server.DB.Pool.Exec(ctx, `DELETE FROM organization_memberships m USING users u
+WHERE m.user_id = u.id AND m.organization_id::text = $1 AND (u.id::text = $2 OR u.clerk_id = $2)`, orgID, userID)
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return ErrMemberNotFound
+	}
+	return nil
+}
+
+// CountAdmins returns the number of admins of the tenant organization.
+func (r *OrganizationRepository) CountAdmins(ctx context.Context) (int, error) {
+	orgID, err := tenant.OrganizationID(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	err = r.server.DB.Pool.QueryRow(ctx, `SELECT count(*) FROM organization_memberships WHERE organization_id::text = $1 AND role = $2`,
+		orgID, model.OrganizationRoleAdmin).Scan(&n)
+	return n, err
+}
+
+// UpsertClerkOrganization creates or updates the organization synced from
+// the Clerk organization clerkID.
+func (r *OrganizationRepository) UpsertClerkOrganization(ctx context.Context, clerkID, name, slug, imageURL string, rawPayload []byte) error {
+	if slug == "" {
+		slug = clerkID
+	}
+	_, err := r.server.DB.Pool.Exec(ctx, `INSERT INTO organizations (clerk_id, name, slug, image_url, raw_payload)
+VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+ON CONFLICT (clerk_id) DO UPDATE SET name = EXCLUDED.name, slug = EXCLUDED.slug, image_url = EXCLUDED.image_url,
+	raw_payload = EXCLUDED.raw_payload, updated_at = now(), deleted_at = NULL`, clerkID, name, slug, imageURL, rawPayload)
+	if err != nil {
+		return fmt.Errorf("upsert clerk organization: %w", err)
+	}
+	return nil
+}
+
+// DeleteClerkOrganization soft-deletes the organization synced from clerkID
+// and drops its memberships.
+func (r *OrganizationRepository) DeleteClerkOrganization(ctx context.Context, clerkID string) error {
+	tx, err := r.server.DB.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var orgID string
+	err = tx.QueryRow(ctx, `UPDATE organizations SET deleted_at = COALESCE(deleted_at, now()), updated_at = now()
+WHERE clerk_id = $1 RETURNING id::text`, clerkID).Scan(&orgID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM organization_memberships WHERE organization_id::text = $1`, orgID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// UpsertClerkMembership creates or updates the membership synced from the
+// Clerk membership clerkID.
+func (r *OrganizationRepository) UpsertClerkMembership(ctx context.Context, clerkID, clerkOrganizationID, clerkUserID, role string) error {
+	ct, err := r.server.DB.Pool.Exec(ctx, `INSERT INTO organization_memberships (organization_id, user_id, role, clerk_id)
+SELECT o.id, u.id, $4, $1 FROM organizations o, users u
+WHERE o.clerk_id = $2 AND o.deleted_at IS NULL AND u.clerk_id = $3
+ON CONFLICT (organization_id, user_id) DO UPDATE SET role = EXCLUDED.role, clerk_id = EXCLUDED.clerk_id, updated_at = now()`,
+		clerkID, clerkOrganizationID, clerkUserID, role)
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// DeleteClerkMembership removes the membership synced from clerkID.
+func (r *OrganizationRepository) DeleteClerkMembership(ctx context.Context, clerkID, clerkOrganizationID, clerkUserID string) error {
+	_, err := r.server.DB.Pool.Exec(ctx, `DELETE FROM organization_memberships m USING organizations o, users u
+WHERE m.organization_id = o.id AND m.user_id = u.id
+	AND (m.clerk_id = $1 OR (o.clerk_id = $2 AND u.clerk_id = $3))`, clerkID, clerkOrganizationID, clerkUserID)
+	return err
+}
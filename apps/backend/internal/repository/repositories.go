@@ -2,8 +2,12 @@ package repository
 
 import "github.com/petonlabs/go-boilerplate/internal/server"
 
-type Repositories struct{}
+type Repositories struct {
+	Organizations *OrganizationRepository
+}
 
 func NewRepositories(s *server.Server) *Repositories {
-	return &Repositories{}
+	return &Repositories{
+		Organizations: NewOrganizationRepository(s),
+	}
 }
@@ -9,9 +9,39 @@ import (
 
 func registerAdminRoutes(g *echo.Group, h *handler.Handlers, m *middleware.Middlewares) {
 	adminGroup := g.Group("/admin")
-	adminGroup.Use(m.Auth.RequireAuth, m.Auth.RequireRole("admin"))
+	// Nothing in the admin API may be done from an impersonation session.
+	adminGroup.Use(m.Auth.RequireAuth, m.Auth.DenyImpersonation, m.Auth.RequirePermission("admin:access"))
 
 	adminGroup.GET("/health", func(c echo.Context) error {
 		return c.String(http.StatusOK, "OK")
 	})
+
+	adminGroup.POST("/users/:id/unlock", h.Admin.UnlockUser, m.Auth.RequirePermission("users:unlock"))
+	adminGroup.POST("/users/:id/deletion", h.Admin.ScheduleUserDeletion, m.Auth.RequirePermission("users:delete"))
+	adminGroup.DELETE("/users/:id/deletion", h.Admin.CancelUserDeletion, m.Auth.RequirePermission("users:delete"))
+	adminGroup.POST("/users/:id/restore", h.Admin.RestoreUser, m.Auth.RequirePermission("users:restore"))
+
+	adminGroup.GET("/roles", h.Admin.ListRoles, m.Auth.RequirePermission("roles:read"))
+	adminGroup.GET("/users/:id/roles", h.Admin.ListUserRoles, m.Auth.RequirePermission("users:read"))
+	adminGroup.GET("/logins", h.Admin.ListLoginEvents, m.Auth.RequirePermission("users:read"))
+	adminGroup.PUT("/users/:id/roles/:role", h.Admin.AssignUserRole, m.Auth.RequirePermission("roles:assign"))
+	adminGroup.DELETE("/users/:id/roles/:role", h.Admin.RemoveUserRole, m.Auth.RequirePermission("roles:assign"))
+
+	manageServiceAccounts := m.Auth.RequirePermission("service_accounts:manage")
+	adminGroup.POST("/service-accounts", h.Admin.CreateServiceAccount, manageServiceAccounts)
+	adminGroup.GET("/service-accounts", h.Admin.ListServiceAccounts, manageServiceAccounts)
+	adminGroup.DELETE("/service-accounts/:id", h.Admin.DisableServiceAccount, manageServiceAccounts)
+	adminGroup.POST("/service-accounts/:id/keys", h.Admin.CreateAPIKey, manageServiceAccounts)
+	adminGroup.GET("/service-accounts/:id/keys", h.Admin.ListAPIKeys, manageServiceAccounts)
+	adminGroup.DELETE("/service-accounts/:id/keys/:key_id", h.Admin.RevokeAPIKey, manageServiceAccounts)
+
+	manageInvitations := m.Auth.RequirePermission("invitations:manage")
+	adminGroup.POST("/invitations", h.Admin.CreateInvitation, manageInvitations)
+	adminGroup.GET("/invitations", h.Admin.ListInvitations, manageInvitations)
+	adminGroup.DELETE("/invitations/:id", h.Admin.RevokeInvitation, manageInvitations)
+
+	impersonate := m.Auth.RequirePermission("users:impersonate")
+	adminGroup.POST("/users/:id/impersonate", h.Admin.ImpersonateUser, impersonate)
+	adminGroup.GET("/impersonations", h.Admin.ListImpersonationEvents, impersonate)
+	adminGroup.DELETE("/impersonations/:session_id", h.Admin.EndImpersonation, impersonate)
 }
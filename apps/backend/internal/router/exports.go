@@ -0,0 +1,12 @@
+package router
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/petonlabs/go-boilerplate/internal/handler"
+)
+
+// registerExportRoutes registers data export downloads. They are not behind
+// RequireAuth: the signed link emailed to the user authorizes the download.
+func registerExportRoutes(g *echo.Group, h *handler.Handlers) {
+	g.GET("/exports/:id/download", h.Auth.DownloadDataExport)
+}
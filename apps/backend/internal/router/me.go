@@ -0,0 +1,56 @@
+package router
+
+import (
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/petonlabs/go-boilerplate/internal/handler"
+	"github.com/petonlabs/go-boilerplate/internal/middleware"
+)
+
+// registerMeRoutes registers endpoints that act on the authenticated caller.
+func registerMeRoutes(g *echo.Group, h *handler.Handlers, m *middleware.Middlewares) {
+	meGroup := g.Group("/me")
+	meGroup.Use(m.Auth.RequireAuth)
+
+	// Impersonation sessions cannot re-authenticate or change credentials
+	// (RequireRecentAuth rejects them as well).
+	noImpersonation := m.Auth.DenyImpersonation
+	meGroup.POST("/reauth", h.Auth.Reauthenticate, noImpersonation)
+	meGroup.DELETE("/impersonation", h.Auth.StopImpersonation)
+
+	meGroup.GET("/logins", h.Auth.ListLogins)
+
+	// Changing the second factor requires a recent login or re-confirmation so
+	// that a stolen access token alone cannot take over MFA.
+	recent := m.Auth.RequireRecentAuth(10 * time.Minute)
+	meGroup.POST("/mfa/totp", h.Auth.EnrollTOTP, recent)
+	meGroup.POST("/mfa/totp/confirm", h.Auth.ConfirmTOTP, noImpersonation)
+	meGroup.POST("/mfa/totp/disable", h.Auth.DisableTOTP, recent)
+	meGroup.POST("/mfa/recovery-codes", h.Auth.RegenerateRecoveryCodes, recent)
+
+	meGroup.GET("/passkeys", h.Auth.ListPasskeys)
+	meGroup.POST("/passkeys/register/begin", h.Auth.BeginPasskeyRegistration, recent)
+	meGroup.POST("/passkeys/register/finish", h.Auth.FinishPasskeyRegistration, noImpersonation)
+	meGroup.DELETE("/passkeys/:id", h.Auth.DeletePasskey, recent)
+
+	// Confirming a link lets another account sign in as the caller.
+	meGroup.GET("/identities", h.Auth.ListIdentities)
+	meGroup.POST("/identities/:id/confirm", h.Auth.ConfirmIdentity, recent)
+	meGroup.DELETE("/identities/:id", h.Auth.UnlinkIdentity, recent)
+
+	// Personal access tokens never count as a recent login, so a token
+	// cannot mint further tokens.
+	meGroup.GET("/tokens", h.Auth.ListPersonalAccessTokens)
+	meGroup.POST("/tokens", h.Auth.CreatePersonalAccessToken, recent)
+	meGroup.DELETE("/tokens/:id", h.Auth.RevokePersonalAccessToken, noImpersonation)
+
+	// Deleting the account requires a password or MFA re-confirmation.
+	meGroup.GET("/deletion", h.Auth.GetDeletion)
+	meGroup.POST("/deletion", h.Auth.ScheduleDeletion, recent)
+	meGroup.DELETE("/deletion", h.Auth.CancelDeletion, noImpersonation)
+
+	// The archive is emailed to the account owner, never to an impersonator.
+	meGroup.GET("/exports", h.Auth.ListDataExports)
+	meGroup.POST("/exports", h.Auth.RequestDataExport, noImpersonation)
+}
@@ -0,0 +1,31 @@
+package router
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/petonlabs/go-boilerplate/internal/handler"
+	"github.com/petonlabs/go-boilerplate/internal/middleware"
+	"github.com/petonlabs/go-boilerplate/internal/model"
+)
+
+// registerOrganizationRoutes registers organization endpoints. Routes under
+// /orgs/current act on the organization selected by RequireOrganization.
+func registerOrganizationRoutes(g *echo.Group, h *handler.Handlers, m *middleware.Middlewares) {
+	orgGroup := g.Group("/orgs")
+	orgGroup.Use(m.Auth.RequireAuth)
+
+	orgGroup.GET("", h.Organizations.ListOrganizations)
+	orgGroup.POST("", h.Organizations.CreateOrganization)
+	orgGroup.POST("/join", h.Organizations.JoinOrganization, m.Auth.DenyImpersonation)
+
+	current := orgGroup.Group("/current")
+	current.Use(m.Auth.RequireOrganization)
+
+	orgAdmin := m.Auth.RequireOrganizationRole(model.OrganizationRoleAdmin)
+	current.GET("", h.Organizations.CurrentOrganization)
+	current.GET("/members", h.Organizations.ListOrganizationMembers)
+	current.PUT("/members/:user_id", h.Organizations.SetOrganizationMember, orgAdmin, m.Auth.DenyImpersonation)
+	current.DELETE("/members/:user_id", h.Organizations.RemoveOrganizationMember, orgAdmin, m.Auth.DenyImpersonation)
+	current.GET("/invitations", h.Organizations.ListOrganizationInvitations, orgAdmin)
+	current.POST("/invitations", h.Organizations.CreateOrganizationInvitation, orgAdmin, m.Auth.DenyImpersonation)
+	current.DELETE("/invitations/:id", h.Organizations.RevokeOrganizationInvitation, orgAdmin, m.Auth.DenyImpersonation)
+}
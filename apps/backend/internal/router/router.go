@@ -56,6 +56,10 @@ func NewRouter(s *server.Server, h *handler.Handlers, services *service.Services
 	// register versioned routes
 	v1 := router.Group("/api/v1")
 	registerAdminRoutes(v1, h, middlewares)
+	registerMeRoutes(v1, h, middlewares)
+	registerOrganizationRoutes(v1, h, middlewares)
+	registerServiceAccountRoutes(v1, h, middlewares)
+	registerExportRoutes(v1, h)
 
 	return router
 }
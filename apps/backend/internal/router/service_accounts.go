@@ -0,0 +1,16 @@
+package router
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/petonlabs/go-boilerplate/internal/handler"
+	"github.com/petonlabs/go-boilerplate/internal/middleware"
+)
+
+// registerServiceAccountRoutes registers endpoints for callers authenticated
+// with a service account API key. Guard individual routes with RequireScope.
+func registerServiceAccountRoutes(g *echo.Group, h *handler.Handlers, m *middleware.Middlewares) {
+	saGroup := g.Group("/service-account")
+	saGroup.Use(m.Auth.RequireAPIKey)
+
+	saGroup.GET("", h.Auth.CurrentServiceAccount)
+}
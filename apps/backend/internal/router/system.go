@@ -19,10 +19,22 @@ func registerSystemRoutes(r *echo.Echo, h *handler.Handlers) {
 
 	r.POST("/auth/register", h.Auth.Register)
 	r.POST("/auth/login", h.Auth.Login)
+	r.POST("/auth/mfa/verify", h.Auth.CompleteMFALogin)
+	r.POST("/auth/magic-link/request", h.Auth.RequestMagicLink)
+	r.POST("/auth/magic-link/consume", h.Auth.ConsumeMagicLink)
+	r.POST("/auth/passkey/login/begin", h.Auth.BeginPasskeyLogin)
+	r.POST("/auth/passkey/login/finish", h.Auth.FinishPasskeyLogin)
+	r.GET("/auth/oidc/providers", h.Auth.ListOIDCProviders)
+	r.POST("/auth/oidc/:provider/begin", h.Auth.BeginOIDCLogin)
+	r.POST("/auth/oidc/:provider/callback", h.Auth.FinishOIDCLogin)
+	r.POST("/auth/token/refresh", h.Auth.RefreshSession)
+	r.POST("/auth/logout", h.Auth.Logout)
+	r.POST("/auth/email/verify", h.Auth.VerifyEmail)
+	r.POST("/auth/email/resend", h.Auth.ResendVerification)
 	r.POST("/auth/password/request", h.Auth.RequestPasswordReset)
 	r.POST("/auth/password/reset", h.Auth.ResetPassword)
-	r.POST("/auth/schedule_deletion", h.Auth.ScheduleDeletion)
-	r.POST("/auth/cancel_deletion", h.Auth.CancelDeletion)
+	r.POST("/auth/restore/request", h.Auth.RequestAccountRestore)
+	r.POST("/auth/restore/confirm", h.Auth.ConfirmAccountRestore)
 
 	r.POST("/admin/rotate-secrets", h.Admin.RotateSecrets)
 }
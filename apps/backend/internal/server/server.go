@@ -9,9 +9,11 @@ import (
 	"time"
 
 	"github.com/newrelic/go-agent/v3/integrations/nrredis-v9"
+	"github.com/newrelic/go-agent/v3/newrelic"
 	"github.com/petonlabs/go-boilerplate/internal/config"
 	"github.com/petonlabs/go-boilerplate/internal/database"
 	"github.com/petonlabs/go-boilerplate/internal/lib/job"
+	"github.com/petonlabs/go-boilerplate/internal/lib/storage"
 	loggerPkg "github.com/petonlabs/go-boilerplate/internal/logger"
 	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog"
@@ -27,6 +29,8 @@ type Server struct {
 	Redis         *redis.Client
 	httpServer    *http.Server
 	Job           *job.JobService
+	// Storage keeps generated files such as data export archives.
+	Storage storage.Storage
 }
 
 // deepCopyConfig returns a deep-ish copy of src suitable for storing in the
@@ -45,6 +49,41 @@ func deepCopyConfig(src *config.Config) *config.Config {
 		dst.Server.CORSAllowedOrigins = cpy
 	}
 
+	if src.Auth.WebAuthnRPOrigins != nil {
+		cpy := make([]string, len(src.Auth.WebAuthnRPOrigins))
+		copy(cpy, src.Auth.WebAuthnRPOrigins)
+		dst.Auth.WebAuthnRPOrigins = cpy
+	}
+
+	if src.Auth.PasswordPolicy.RequiredClasses != nil {
+		cpy := make([]string, len(src.Auth.PasswordPolicy.RequiredClasses))
+		copy(cpy, src.Auth.PasswordPolicy.RequiredClasses)
+		dst.Auth.PasswordPolicy.RequiredClasses = cpy
+	}
+
+	if src.Auth.PasswordPolicy.BannedWords != nil {
+		cpy := make([]string, len(src.Auth.PasswordPolicy.BannedWords))
+		copy(cpy, src.Auth.PasswordPolicy.BannedWords)
+		dst.Auth.PasswordPolicy.BannedWords = cpy
+	}
+
+	if src.Auth.Providers != nil {
+		cpy := make([]string, len(src.Auth.Providers))
+		copy(cpy, src.Auth.Providers)
+		dst.Auth.Providers = cpy
+	}
+
+	if src.Auth.OIDCProviders != nil {
+		cpy := make(map[string]config.OIDCProvider, len(src.Auth.OIDCProviders))
+		for name, p := range src.Auth.OIDCProviders {
+			if p.Scopes != nil {
+				p.Scopes = append([]string(nil), p.Scopes...)
+			}
+			cpy[name] = p
+		}
+		dst.Auth.OIDCProviders = cpy
+	}
+
 	if src.Observability != nil {
 		obs := *src.Observability
 		dst.Observability = &obs
@@ -78,12 +117,21 @@ func New(cfg *config.Config, logger *zerolog.Logger, loggerService *loggerPkg.Lo
 		// Don't fail startup if Redis is unavailable
 	}
 
+	store, err := storage.New(cfg.Storage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize storage: %w", err)
+	}
+
 	// job service (inject DB at construction so handlers have access)
 	jobService, err := job.NewJobService(logger, cfg, db)
 	if err != nil {
 		return nil, err
 	}
-	jobService.InitHandlers(cfg, logger)
+	var nrApp *newrelic.Application
+	if loggerService != nil {
+		nrApp = loggerService.GetApplication()
+	}
+	jobService.InitHandlers(cfg, logger, store, redisClient, nrApp)
 
 	if err := jobService.Start(); err != nil {
 		return nil, err
@@ -95,6 +143,7 @@ func New(cfg *config.Config, logger *zerolog.Logger, loggerService *loggerPkg.Lo
 		DB:            db,
 		Redis:         redisClient,
 		Job:           jobService,
+		Storage:       store,
 	}
 	// Store initial config atomically
 	server.SetConfig(cfg)
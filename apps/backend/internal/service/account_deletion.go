@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/petonlabs/go-boilerplate/internal/lib/job"
+)
+
+// DefaultDeletionGracePeriod is how long a scheduled account deletion can be
+// cancelled when config.Auth.DeletionDefaultTTL is unset.
+const DefaultDeletionGracePeriod = 30 * 24 * time.Hour
+
+// ErrDeletionNotScheduled is returned when cancelling a deletion that is not
+// scheduled.
+var ErrDeletionNotScheduled = errors.New("account deletion is not scheduled")
+
+// DeletionStatus reports whether an account is scheduled for deletion.
+type DeletionStatus struct {
+	ScheduledAt *time.Time `json:"scheduled_at"`
+}
+
+// DeletionGracePeriod returns config.Auth.DeletionDefaultTTL, or
+// DefaultDeletionGracePeriod when unset.
+func (a *AuthService) DeletionGracePeriod() time.Duration {
+	if cfg := a.server.GetConfig(); cfg != nil && cfg.Auth.DeletionDefaultTTL > 0 {
+		return time.Duration(cfg.Auth.DeletionDefaultTTL) * time.Second
+	}
+	return DefaultDeletionGracePeriod
+}
+
+// DeletionStatus returns when userID is due to be deleted, if at all.
+func (a *AuthService) DeletionStatus(ctx context.Context, userID string) (*DeletionStatus, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	var status DeletionStatus
+	err := a.server.DB.Pool.QueryRow(ctx, `SELECT deletion_scheduled_at FROM users
+WHERE (id::text = $1 OR clerk_id = $1) AND deleted_at IS NULL`, userID).Scan(&status.ScheduledAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// ScheduleDeletion marks userID for deletion after ttl (the grace period when
+// ttl is not positive), enqueues the deletion job and emails the user. It
+// returns when the account will be deleted.
+func (a *AuthService) ScheduleDeletion(ctx context.Context, userID string, ttl time.Duration) (time.Time, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return time.Time{}, fmt.Errorf("database not initialized")
+	}
+	if ttl <= 0 {
+		ttl = a.DeletionGracePeriod()
+	}
+	when := time.Now().Add(ttl).UTC()
+	var id string
+	var email sql.NullString
+	err := a.server.DB.Pool.QueryRow(ctx, `UPDATE users SET deletion_scheduled_at = $2
+WHERE (id::text = $1 OR clerk_id = $1) AND deleted_at IS NULL
+RETURNING id::text, email`, userID, when).Scan(&id, &email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, ErrUserNotFound
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	// The task runs when the deletion is due and replaces any earlier one. If
+	// it cannot be scheduled, the periodic sweep deletes the user instead.
+	a.scheduleDeletionTask(id, when)
+	if email.Valid && email.String != "" {
+		a.enqueueDeletionTask(func() (*asynq.Task, error) {
+			return job.NewDeletionScheduledTask(email.String, when.Unix())
+		}, "deletion scheduled email")
+	}
+	return when, nil
+}
+
+// CancelDeletion clears a scheduled deletion of userID and emails the user.
+func (a *AuthService) CancelDeletion(ctx context.Context, userID string) error {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	var id string
+	var email sql.NullString
+	err := a.server.DB.Pool.QueryRow(ctx, `UPDATE users SET deletion_scheduled_at = NULL
+WHERE (id::text = $1 OR clerk_id = $1) AND deleted_at IS NULL AND deletion_scheduled_at IS NOT NULL
+RETURNING id::text, email`, userID).Scan(&id, &email)
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, err := a.DeletionStatus(ctx, userID); err != nil {
+			return err
+		}
+		return ErrDeletionNotScheduled
+	}
+	if err != nil {
+		return err
+	}
+
+	// A task left behind is harmless: the worker skips users whose deletion
+	// is no longer scheduled.
+	if a.server.Job != nil {
+		if err := a.server.Job.CancelUserDeletion(id); err != nil && a.server.Logger != nil {
+			a.server.Logger.Warn().Err(err).Str("user_id", id).Msg("failed to cancel user deletion task")
+		}
+	}
+	if email.Valid && email.String != "" {
+		a.enqueueDeletionTask(func() (*asynq.Task, error) {
+			return job.NewDeletionCancelledTask(email.String)
+		}, "deletion cancelled email")
+	}
+	return nil
+}
+
+func (a *AuthService) scheduleDeletionTask(userID string, when time.Time) {
+	if a.server.Job == nil {
+		return
+	}
+	if err := a.server.Job.ScheduleUserDeletion(userID, when); err != nil && a.server.Logger != nil {
+		a.server.Logger.Error().Err(err).Str("user_id", userID).Msg("failed to schedule user deletion")
+	}
+}
+
+func (a *AuthService) enqueueDeletionTask(newTask func() (*asynq.Task, error), what string) {
+	if a.server.Job == nil || a.server.Job.Client == nil {
+		return
+	}
+	task, err := newTask()
+	if err == nil {
+		_, err = a.server.Job.Client.Enqueue(task)
+	}
+	if err != nil && a.server.Logger != nil {
+		a.server.Logger.Error().Err(err).Msgf("failed to enqueue %s", what)
+	}
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/petonlabs/go-boilerplate/internal/lib/job"
+	"github.com/petonlabs/go-boilerplate/internal/lib/token"
+	"github.com/petonlabs/go-boilerplate/internal/lib/userdata"
+)
+
+// DefaultRestoreTokenTTL is the lifetime of an emailed account restore link.
+const DefaultRestoreTokenTTL = time.Hour
+
+var (
+	// ErrAccountNotRestorable is returned for accounts that are not deleted,
+	// were deleted without an escrow or are past the recovery window.
+	ErrAccountNotRestorable = errors.New("account cannot be restored")
+	// ErrRestoreConflict is returned when the deleted account's email or
+	// identity has since been taken by another account.
+	ErrRestoreConflict = errors.New("account email or identity is now used by another account")
+	// ErrInvalidRestoreToken is returned for unknown, used or expired
+	// restore links.
+	ErrInvalidRestoreToken = errors.New("restore link is invalid or has expired")
+)
+
+// RestoreAccount restores the deleted account userID from its escrow: email,
+// credentials and profile come back, while sessions, tokens, passkeys,
+// linked identities, roles and memberships removed on deletion do not.
+func (a *AuthService) RestoreAccount(ctx context.Context, userID string) error {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	tx, err := a.server.DB.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	switch err := userdata.RestoreEscrow(ctx, tx, userID, a.escrowKeys()); {
+	case errors.Is(err, userdata.ErrNoEscrow):
+		return ErrAccountNotRestorable
+	case errors.Is(err, userdata.ErrEscrowConflict):
+		return ErrRestoreConflict
+	case err != nil:
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// RequestAccountRestore emails a restore link to email if it belonged to an
+// account that can still be restored, the most recently deleted one if there
+// are several. It returns sql.ErrNoRows otherwise, which callers should not
+// reveal.
+func (a *AuthService) RequestAccountRestore(ctx context.Context, email string) (string, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return "", fmt.Errorf("database not initialized")
+	}
+	digests := userdata.EmailDigests(email, a.tokenKeyRing())
+	if len(digests) == 0 {
+		return "", sql.ErrNoRows
+	}
+
+	raw, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	digest, err := a.hashToken(raw)
+	if err != nil {
+		return "", err
+	}
+
+	var expiresAt time.Time
+	err = a.server.DB.Pool.QueryRow(ctx, `UPDATE user_escrows SET restore_token = $2,
+	restore_token_expires = LEAST(now() + $3 * interval '1 second', expires_at)
+WHERE user_id = (SELECT user_id FROM user_escrows WHERE email_digest = ANY($1) AND expires_at > now()
+	ORDER BY created_at DESC LIMIT 1)
+RETURNING restore_token_expires`, digests, digest, int64(DefaultRestoreTokenTTL/time.Second)).Scan(&expiresAt)
+	if err != nil {
+		return "", err
+	}
+
+	a.enqueueDeletionTask(func() (*asynq.Task, error) {
+		return job.NewAccountRestoreTask(email, raw, expiresAt.Unix())
+	}, "account restore email")
+	return raw, nil
+}
+
+// ConsumeAccountRestore restores the account a restore link was issued for
+// and returns its ID.
+func (a *AuthService) ConsumeAccountRestore(ctx context.Context, raw string) (string, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return "", fmt.Errorf("database not initialized")
+	}
+	digests := a.tokenDigests(raw)
+	if raw == "" || len(digests) == 0 {
+		return "", ErrInvalidRestoreToken
+	}
+
+	var userID string
+	err := a.server.DB.Pool.QueryRow(ctx, `SELECT user_id::text FROM user_escrows
+WHERE restore_token = ANY($1) AND restore_token_expires > now()`, digests).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrInvalidRestoreToken
+	}
+	if err != nil {
+		return "", err
+	}
+	// The escrow, and with it the token, is gone once restored, so a link
+	// cannot be used twice.
+	if err := a.RestoreAccount(ctx, userID); err != nil {
+		if errors.Is(err, ErrAccountNotRestorable) {
+			return "", ErrInvalidRestoreToken
+		}
+		return "", err
+	}
+	return userID, nil
+}
+
+// escrowKeys returns the key ring that seals the escrow of deleted accounts.
+func (a *AuthService) escrowKeys() []string {
+	if a.server == nil {
+		return nil
+	}
+	cfg := a.server.GetConfig()
+	if cfg == nil {
+		return nil
+	}
+	return token.KeyRing(cfg.Auth.EscrowEncryptionKey, cfg.Auth.SecretKey)
+}
@@ -2,9 +2,7 @@ package service
 
 import (
 	"context"
-	"crypto/hmac"
 	"crypto/rand"
-	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
 	"errors"
@@ -12,16 +10,10 @@ import (
 	"strings"
 	"sync"
 	"time"
-	"unicode"
 
-	"github.com/rs/zerolog"
-
-	"golang.org/x/crypto/bcrypt"
-
-	"github.com/petonlabs/go-boilerplate/internal/lib/job"
+	"github.com/petonlabs/go-boilerplate/internal/lib/password"
+	"github.com/petonlabs/go-boilerplate/internal/lib/token"
 	"github.com/petonlabs/go-boilerplate/internal/server"
-
-	"github.com/clerk/clerk-sdk-go/v2"
 )
 
 type AuthService struct {
@@ -30,6 +22,13 @@ type AuthService struct {
 	// Access must be done under secretsMu.
 	secretsMu    sync.RWMutex
 	tokenSecrets []string
+	// denylist caches the breached-password list read from denylistPath.
+	denylistMu   sync.Mutex
+	denylistPath string
+	denylist     password.Denylist
+	// oidcCache holds discovered identity providers by name.
+	oidcMu    sync.Mutex
+	oidcCache map[string]cachedOIDCProvider
 }
 
 // ErrInvalidCredentials is returned when login fails due to invalid email/password
@@ -38,16 +37,13 @@ var (
 	ErrInvalidPasswordResetToken = errors.New("invalid password reset token")
 	ErrExpiredPasswordResetToken = errors.New("password reset token expired")
 	ErrUserNotFound              = errors.New("user not found or already deleted")
-	ErrPasswordValidation        = errors.New("password validation failed")
+	// ErrPasswordValidation matches every password rejected by the policy;
+	// see PasswordPolicyError for the individual violations.
+	ErrPasswordValidation = errors.New("password validation failed")
 )
 
 func NewAuthService(s *server.Server) *AuthService {
 	a := &AuthService{server: s}
-	if s != nil {
-		if cfg := s.GetConfig(); cfg != nil {
-			clerk.SetKey(cfg.Auth.SecretKey)
-		}
-	}
 	// Initialize token secrets from config so reads can use the in-memory slice.
 	if s != nil {
 		if cfg := s.GetConfig(); cfg != nil {
@@ -67,105 +63,118 @@ func NewAuthService(s *server.Server) *AuthService {
 	return a
 }
 
-// SyncUser upserts a user record from Clerk webhook data
-// email parameter should be provided from the webhook payload when available.
-func (a *AuthService) SyncUser(ctx context.Context, clerkID, externalID, email, firstName, lastName, imageURL, role string, rawPayload []byte) error {
+// RegisterUser registers a new user with email and password and enqueues an
+// email asking the user to verify the address. Depending on
+// Auth.RegistrationMode an invitation code is required; a code that is given
+// is consumed in the same transaction as the user insert, so a failed
+// registration does not use it up.
+func (a *AuthService) RegisterUser(ctx context.Context, email, password, invitationCode string) (string, error) {
 	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
-		return fmt.Errorf("database not initialized")
+		return "", fmt.Errorf("database not initialized")
 	}
 
-	// If both identifiers are missing, nothing to do.
-	if externalID == "" && clerkID == "" {
-		return nil
+	if err := a.checkRegistrationAllowed(invitationCode); err != nil {
+		return "", err
 	}
 
-	// Upsert user: some databases in tests or older deployments may not have
-	// the composite constraint the original implementation expected. To be
-	// resilient we perform an insert that does nothing on conflict and then
-	// an update by matching either external_id or clerk_id (case-insensitive
-	// where appropriate). This avoids relying on a specific constraint
-	// name existing in the database schema.
-
-	// Try insert; ON CONFLICT DO NOTHING prevents unique-violation errors
-	// from bubbling up if one of the single-column unique indexes exists.
-	insertQuery := `INSERT INTO users (email, clerk_id, external_id, first_name, last_name, image_url, role, raw_payload, created_at)
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8, now()) ON CONFLICT DO NOTHING;`
-	if _, err := a.server.DB.Pool.Exec(ctx, insertQuery, email, clerkID, externalID, firstName, lastName, imageURL, role, rawPayload); err != nil {
-		return err
+	if err := a.validatePassword(password); err != nil {
+		return "", err
 	}
 
-	// Update any existing row that matches by external_id or clerk_id. Use
-	// lower(...) comparisons to match the behavior of the unique indexes
-	// created by migrations which use lower(...).
-	updateQuery := `UPDATE users SET
-		email = $1,
-		clerk_id = COALESCE(NULLIF($2, ''), clerk_id),
-		external_id = COALESCE(NULLIF($3, ''), external_id),
-		first_name = $4,
-		last_name = $5,
-		image_url = $6,
-		role = $7,
-		raw_payload = $8
-	  WHERE (external_id IS NOT NULL AND external_id <> '' AND lower(external_id) = lower($3))
-		 OR (clerk_id IS NOT NULL AND clerk_id <> '' AND lower(clerk_id) = lower($2));`
-
-	if _, err := a.server.DB.Pool.Exec(ctx, updateQuery, email, clerkID, externalID, firstName, lastName, imageURL, role, rawPayload); err != nil {
-		return err
+	hashed, err := a.hashPassword(password)
+	if err != nil {
+		return "", err
 	}
 
-	return nil
-}
-
-// RegisterUser registers a new user with email and password
-func (a *AuthService) RegisterUser(ctx context.Context, email, password string) (string, error) {
-	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
-		return "", fmt.Errorf("database not initialized")
+	verifyToken, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	verifyDigest, err := a.hashToken(verifyToken)
+	if err != nil {
+		return "", err
 	}
+	verifyExpires := time.Now().Add(a.emailVerificationTTL())
 
-	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	tx, err := a.server.DB.Pool.Begin(ctx)
 	if err != nil {
 		return "", err
 	}
+	defer func() { _ = tx.Rollback(ctx) }()
 
 	var id string
-	query := `INSERT INTO users (email, password_hash, created_at) VALUES ($1, $2, now()) RETURNING id::text`
-	err = a.server.DB.Pool.QueryRow(ctx, query, email, string(hashed)).Scan(&id)
+	query := `INSERT INTO users (email, password_hash, email_verification_token, email_verification_expires, created_at)
+VALUES ($1, $2, $3, $4, now()) RETURNING id::text`
+	err = tx.QueryRow(ctx, query, email, hashed, verifyDigest, verifyExpires).Scan(&id)
 	if err != nil {
 		return "", err
 	}
+	if invitationCode != "" {
+		if err := a.redeemInvitation(ctx, tx, invitationCode, email, id); err != nil {
+			return "", err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return "", err
+	}
+
+	a.enqueueEmailVerification(email, verifyToken, verifyExpires)
 	return id, nil
 }
 
-// Login verifies email and password and updates last_login_at
-func (a *AuthService) Login(ctx context.Context, email, password string) (string, error) {
+// Login verifies email and password, updates last_login_at and issues a new session
+func (a *AuthService) Login(ctx context.Context, email, password string, meta SessionMeta) (*Session, error) {
 	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
-		return "", fmt.Errorf("database not initialized")
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	if err := a.checkLoginThrottle(ctx, email, meta); err != nil {
+		a.recordLoginFailed(ctx, "", email, LoginMethodPassword, LoginFailureThrottled, meta)
+		return nil, err
 	}
 
 	var id string
 	var hash string
-	err := a.server.DB.Pool.QueryRow(ctx, `SELECT id::text, password_hash FROM users WHERE email=$1 AND deleted_at IS NULL`, email).Scan(&id, &hash)
+	var verified sql.NullBool
+	var mfaEnabled bool
+	err := a.server.DB.Pool.QueryRow(ctx, `SELECT id::text, password_hash, email_verified, mfa_enabled FROM users WHERE email=$1 AND deleted_at IS NULL`, email).Scan(&id, &hash, &verified, &mfaEnabled)
 	if err != nil {
-		// avoid revealing whether the user exists
-		return "", ErrInvalidCredentials
-	}
-
-	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
-		return "", ErrInvalidCredentials
-	}
-
-	// update last_login_at
-	if _, err := a.server.DB.Pool.Exec(ctx, `UPDATE users SET last_login_at = now() WHERE id = $1`, id); err != nil {
-		// Log the error but don't fail login to avoid impacting UX
-		if a.server != nil && a.server.Logger != nil {
-			a.server.Logger.Error().Err(err).Str("user_id", id).Msg("failed to update last_login_at")
-		} else {
-			// Fallback: create a temporary logger and log structured message
-			tmp := zerolog.New(zerolog.NewConsoleWriter()).With().Timestamp().Logger()
-			tmp.Error().Err(err).Str("user_id", id).Msg("failed to update last_login_at")
+		// avoid revealing whether the user exists; unknown addresses are
+		// throttled like known ones for the same reason
+		a.recordLoginFailure(ctx, email, meta)
+		a.recordLoginFailed(ctx, "", email, LoginMethodPassword, LoginFailureInvalidCredentials, meta)
+		return nil, ErrInvalidCredentials
+	}
+
+	if !a.checkPassword(hash, password) {
+		a.recordLoginFailure(ctx, email, meta)
+		a.recordLoginFailed(ctx, id, email, LoginMethodPassword, LoginFailureInvalidCredentials, meta)
+		return nil, ErrInvalidCredentials
+	}
+	a.rehashPassword(ctx, id, hash, password)
+
+	// Checked only after the password so the answer does not leak whether an
+	// address is registered.
+	if !verified.Bool && a.requireEmailVerification() {
+		a.recordLoginFailed(ctx, id, email, LoginMethodPassword, LoginFailureEmailNotVerified, meta)
+		return nil, ErrEmailNotVerified
+	}
+
+	// With MFA enabled the password alone does not yield a session; the
+	// caller has to complete the challenge with CompleteMFALogin. Failures
+	// are kept until then, or else knowing the password would buy unlimited
+	// challenges to guess codes on.
+	if mfaEnabled {
+		challenge, err := a.newMFAChallenge(ctx, id)
+		if err != nil {
+			return nil, err
 		}
+		return nil, &MFARequiredError{Challenge: challenge}
 	}
-	return id, nil
+
+	a.resetLoginFailures(ctx, email)
+	a.recordLogin(ctx, id, LoginMethodPassword, meta)
+	return a.IssueSession(ctx, id, meta)
 }
 
 // RequestPasswordReset creates a reset token and sets expiry
@@ -181,29 +190,10 @@ func (a *AuthService) RequestPasswordReset(ctx context.Context, email string, tt
 	}
 
 	// Compute HMAC-SHA256 of the token using the current configured secret to avoid storing raw tokens.
-	// Load the current secrets under a read lock; fall back to config parsing if not initialized.
-	var currentSecret string
-	a.secretsMu.RLock()
-	if len(a.tokenSecrets) > 0 {
-		currentSecret = a.tokenSecrets[0]
-	}
-	a.secretsMu.RUnlock()
-	if currentSecret == "" {
-		// fallback: parse from config (should be rare)
-		if cfg := a.server.GetConfig(); cfg != nil {
-			parsed := parseTokenSecrets(cfg.Auth.TokenHMACSecret, cfg.Auth.SecretKey)
-			if len(parsed) == 0 {
-				return "", fmt.Errorf("no token HMAC secret configured")
-			}
-			currentSecret = parsed[0]
-		} else {
-			return "", fmt.Errorf("no token HMAC secret configured")
-		}
-
+	hashedToken, err := a.hashToken(token)
+	if err != nil {
+		return "", err
 	}
-	mac := hmac.New(sha256.New, []byte(currentSecret))
-	mac.Write([]byte(token))
-	hashedToken := hex.EncodeToString(mac.Sum(nil))
 
 	ct, err := a.server.DB.Pool.Exec(ctx, `UPDATE users SET password_reset_token=$1, password_reset_expires=$2 WHERE email=$3`, hashedToken, expiry, email)
 	if err != nil {
@@ -231,25 +221,9 @@ func (a *AuthService) ResetPassword(ctx context.Context, token, newPassword stri
 	var id string
 	var exp sql.NullTime
 	// Compute HMAC-SHA256 digests for the provided token using all configured secrets (supports rotation).
-	a.secretsMu.RLock()
-	localSecrets := make([]string, len(a.tokenSecrets))
-	copy(localSecrets, a.tokenSecrets)
-	a.secretsMu.RUnlock()
-	digests := computeTokenDigests(token, localSecrets)
-	// If no secrets were loaded from the in-memory store (unlikely), fallback to parsing from config.
+	digests := a.tokenDigests(token)
 	if len(digests) == 0 {
-		if a.server == nil {
-			return ErrInvalidPasswordResetToken
-		}
-		if cfg := a.server.GetConfig(); cfg != nil {
-			secrets := parseTokenSecrets(cfg.Auth.TokenHMACSecret, cfg.Auth.SecretKey)
-			if len(secrets) == 0 {
-				return ErrInvalidPasswordResetToken
-			}
-			digests = computeTokenDigests(token, secrets)
-		} else {
-			return ErrInvalidPasswordResetToken
-		}
+		return ErrInvalidPasswordResetToken
 	}
 
 	// Build a parameterized IN clause to find the user by any of the digests
@@ -275,17 +249,16 @@ func (a *AuthService) ResetPassword(ctx context.Context, token, newPassword stri
 		return ErrExpiredPasswordResetToken
 	}
 
-	// Validate password with shared helper (min/max length and character classes)
-	if err := validatePassword(newPassword); err != nil {
+	if err := a.validatePassword(newPassword); err != nil {
 		return err
 	}
 
-	hashed, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	hashed, err := a.hashPassword(newPassword)
 	if err != nil {
 		return err
 	}
 	// Ensure we only update non-deleted users and return an error if nothing updated
-	ct, err := a.server.DB.Pool.Exec(ctx, `UPDATE users SET password_hash=$1, password_reset_token=NULL, password_reset_expires=NULL WHERE id=$2 AND deleted_at IS NULL`, string(hashed), id)
+	ct, err := a.server.DB.Pool.Exec(ctx, `UPDATE users SET password_hash=$1, password_reset_token=NULL, password_reset_expires=NULL WHERE id=$2 AND deleted_at IS NULL`, hashed, id)
 	if err != nil {
 		return err
 	}
@@ -295,100 +268,92 @@ func (a *AuthService) ResetPassword(ctx context.Context, token, newPassword stri
 	return nil
 }
 
-// ScheduleDeletion marks a user for deletion at now + ttl and enqueues a deletion job
-func (a *AuthService) ScheduleDeletion(ctx context.Context, userID string, ttl time.Duration) error {
-	when := time.Now().Add(ttl)
-	_, err := a.server.DB.Pool.Exec(ctx, `UPDATE users SET deletion_scheduled_at=$1 WHERE id::text=$2`, when, userID)
-	if err != nil {
-		return err
-	}
-	// Enqueue job to delete (the job worker should check deletion_scheduled_at)
-	if a.server.Job != nil && a.server.Job.Client != nil {
-		task, err := job.NewUserDeleteTask(userID)
-		if err == nil {
-			_, _ = a.server.Job.Client.Enqueue(task)
-		}
+// localUserID resolves userID, which may be our user ID or the Clerk user ID
+// of a Clerk session, to our user ID. It returns ErrUserNotFound for unknown
+// and deleted users.
+func (a *AuthService) localUserID(ctx context.Context, userID string) (string, error) {
+	var id string
+	err := a.server.DB.Pool.QueryRow(ctx, `SELECT id::text FROM users WHERE (id::text = $1 OR clerk_id = $1) AND deleted_at IS NULL`, userID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrUserNotFound
 	}
-	return nil
+	return id, err
 }
 
-// CancelDeletion clears deletion_scheduled_at for a user, interrupting a scheduled deletion
-func (a *AuthService) CancelDeletion(ctx context.Context, userID string) error {
-	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
-		return fmt.Errorf("database not initialized")
-	}
-	_, err := a.server.DB.Pool.Exec(ctx, `UPDATE users SET deletion_scheduled_at = NULL WHERE id::text = $1`, userID)
-	return err
+// computeTokenDigests computes HMAC-SHA256 hex-encoded digests for the provided token
+// using the provided secrets slice. Returns an empty slice if secrets is empty.
+func computeTokenDigests(raw string, secrets []string) []string {
+	return token.Digests(raw, secrets)
 }
 
-// validatePassword enforces min/max length and character class requirements.
-func validatePassword(pw string) error {
-	if len(pw) < 8 {
-		return fmt.Errorf("password must be at least 8 characters")
+// activeTokenSecret returns the secret used to HMAC newly created tokens.
+// It reads the in-memory key ring and falls back to parsing the config.
+func (a *AuthService) activeTokenSecret() (string, error) {
+	a.secretsMu.RLock()
+	var current string
+	if len(a.tokenSecrets) > 0 {
+		current = a.tokenSecrets[0]
 	}
-	if len(pw) > 128 {
-		return fmt.Errorf("password must not exceed 128 characters")
+	a.secretsMu.RUnlock()
+	if current != "" {
+		return current, nil
 	}
-	var hasUpper, hasLower, hasDigit bool
-	for _, r := range pw {
-		if unicode.IsUpper(r) {
-			hasUpper = true
-		}
-		if unicode.IsLower(r) {
-			hasLower = true
-		}
-		if unicode.IsDigit(r) {
-			hasDigit = true
+	if a.server != nil {
+		if cfg := a.server.GetConfig(); cfg != nil {
+			if parsed := parseTokenSecrets(cfg.Auth.TokenHMACSecret, cfg.Auth.SecretKey); len(parsed) > 0 {
+				return parsed[0], nil
+			}
 		}
 	}
-	if !hasUpper || !hasLower || !hasDigit {
-		return fmt.Errorf("password must include upper and lower case letters and a digit")
+	return "", fmt.Errorf("no token HMAC secret configured")
+}
+
+// hashToken returns the HMAC digest of token under the active secret, which
+// is the form in which single-use tokens are persisted.
+func (a *AuthService) hashToken(token string) (string, error) {
+	secret, err := a.activeTokenSecret()
+	if err != nil {
+		return "", err
 	}
-	return nil
+	return computeTokenDigests(token, []string{secret})[0], nil
 }
 
-// computeTokenDigests computes HMAC-SHA256 hex-encoded digests for the provided token
-// using the provided secrets slice. Returns an empty slice if secrets is empty.
-func computeTokenDigests(token string, secrets []string) []string {
-	if len(secrets) == 0 {
-		return []string{}
+// tokenDigests returns the digests of token under every configured secret so
+// that tokens created before a rotation still match. It returns an empty
+// slice when no secret is configured.
+func (a *AuthService) tokenDigests(token string) []string {
+	return computeTokenDigests(token, a.tokenKeyRing())
+}
+
+// tokenKeyRing returns the in-memory token secrets, falling back to the
+// config when none are loaded.
+func (a *AuthService) tokenKeyRing() []string {
+	a.secretsMu.RLock()
+	localSecrets := make([]string, len(a.tokenSecrets))
+	copy(localSecrets, a.tokenSecrets)
+	a.secretsMu.RUnlock()
+	if len(localSecrets) == 0 && a.server != nil {
+		if cfg := a.server.GetConfig(); cfg != nil {
+			localSecrets = parseTokenSecrets(cfg.Auth.TokenHMACSecret, cfg.Auth.SecretKey)
+		}
 	}
-	digests := make([]string, 0, len(secrets))
-	for _, s := range secrets {
-		mac := hmac.New(sha256.New, []byte(s))
-		mac.Write([]byte(token))
-		digests = append(digests, hex.EncodeToString(mac.Sum(nil)))
+	return localSecrets
+}
+
+// randomToken returns n bytes from crypto/rand, hex encoded.
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
 	}
-	return digests
+	return hex.EncodeToString(b), nil
 }
 
 // parseTokenSecrets returns a slice of secrets to try for HMAC. Accepts an explicit
 // tokenHMACSecret string which may include multiple secrets separated by ',' or '|'.
 // If tokenHMACSecret is empty, fall back to the mainSecret as the single value.
 func parseTokenSecrets(tokenHMACSecret, mainSecret string) []string {
-	// If no explicit tokenHMACSecret is provided, fall back to mainSecret only if it is non-empty.
-	if strings.TrimSpace(tokenHMACSecret) == "" {
-		if strings.TrimSpace(mainSecret) == "" {
-			return nil
-		}
-		return []string{mainSecret}
-	}
-	normalized := strings.ReplaceAll(tokenHMACSecret, "|", ",")
-	parts := strings.Split(normalized, ",")
-	out := make([]string, 0, len(parts))
-	for _, p := range parts {
-		p = strings.TrimSpace(p)
-		if p == "" {
-			continue
-		}
-		out = append(out, p)
-	}
-	// If after filtering there are no non-empty parts, don't silently fall back to mainSecret;
-	// return nil to indicate configuration is effectively empty.
-	if len(out) == 0 {
-		return nil
-	}
-	return out
+	return token.KeyRing(tokenHMACSecret, mainSecret)
 }
 
 // RotateTokenHMACSecrets atomically replaces the configured token HMAC secrets.
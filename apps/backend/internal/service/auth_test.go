@@ -4,16 +4,43 @@
 package service_test
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/hibiken/asynq"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/require"
 
+	"github.com/petonlabs/go-boilerplate/internal/config"
+	"github.com/petonlabs/go-boilerplate/internal/errs"
+	"github.com/petonlabs/go-boilerplate/internal/lib/apikey"
+	"github.com/petonlabs/go-boilerplate/internal/lib/job"
+	"github.com/petonlabs/go-boilerplate/internal/lib/oidc/oidctest"
+	"github.com/petonlabs/go-boilerplate/internal/lib/passkey/passkeytest"
+	"github.com/petonlabs/go-boilerplate/internal/lib/rbac"
+	"github.com/petonlabs/go-boilerplate/internal/lib/storage"
+	"github.com/petonlabs/go-boilerplate/internal/lib/tenant"
+	"github.com/petonlabs/go-boilerplate/internal/lib/totp"
+	"github.com/petonlabs/go-boilerplate/internal/lib/userdata"
+	"github.com/petonlabs/go-boilerplate/internal/middleware"
+	"github.com/petonlabs/go-boilerplate/internal/repository"
 	svc "github.com/petonlabs/go-boilerplate/internal/service"
 	testhelpers "github.com/petonlabs/go-boilerplate/internal/testhelpers"
+	"github.com/petonlabs/go-boilerplate/internal/testhelpers/mocks"
 )
 
 func TestMain(m *testing.M) {
@@ -40,16 +67,18 @@ func TestRegisterLoginResetAndScheduleDeletion(t *testing.T) {
 
 	ctx := context.Background()
 	email := "bob@example.com"
-	password := "s3cret"
+	password := "S3cretPass"
 
-	id, err := authSvc.RegisterUser(ctx, email, password)
+	id, err := authSvc.RegisterUser(ctx, email, password, "")
 	require.NoError(t, err)
 	require.NotEmpty(t, id)
 
-	// Login should succeed
-	gotID, err := authSvc.Login(ctx, email, password)
+	// Login should succeed and issue a session
+	session, err := authSvc.Login(ctx, email, password, svc.SessionMeta{})
 	require.NoError(t, err)
-	require.Equal(t, id, gotID)
+	require.Equal(t, id, session.UserID)
+	require.NotEmpty(t, session.AccessToken)
+	require.NotEmpty(t, session.RefreshToken)
 
 	// Request password reset
 	token, err := authSvc.RequestPasswordReset(ctx, email, 1*time.Hour)
@@ -62,12 +91,12 @@ func TestRegisterLoginResetAndScheduleDeletion(t *testing.T) {
 	require.NoError(t, err)
 
 	// Login with new password
-	gotID2, err := authSvc.Login(ctx, email, newPass)
+	session2, err := authSvc.Login(ctx, email, newPass, svc.SessionMeta{})
 	require.NoError(t, err)
-	require.Equal(t, id, gotID2)
+	require.Equal(t, id, session2.UserID)
 
 	// Schedule deletion in 1 second and wait
-	err = authSvc.ScheduleDeletion(ctx, id, 2*time.Second)
+	_, err = authSvc.ScheduleDeletion(ctx, id, 2*time.Second)
 	require.NoError(t, err)
 
 	// Cancel deletion before it executes
@@ -100,13 +129,1411 @@ func TestLoginInvalidCredentialsWhenUserMissing(t *testing.T) {
 	authSvc := svc.NewAuthService(testServer)
 
 	ctx := context.Background()
-	_, err := authSvc.Login(ctx, "missing@example.com", "irrelevant")
+	_, err := authSvc.Login(ctx, "missing@example.com", "irrelevant", svc.SessionMeta{})
 	require.ErrorIs(t, err, svc.ErrInvalidCredentials)
 }
 
+func TestConfirmPasswordWithClerkSessions(t *testing.T) {
+	testDB, testServer, cleanup := testhelpers.SetupTest(t)
+	defer cleanup()
+
+	authSvc := svc.NewAuthService(testServer)
+	ctx := context.Background()
+
+	id, err := authSvc.RegisterUser(ctx, "reauth@example.com", "Correct1Horse", "")
+	require.NoError(t, err)
+	_, err = testDB.Pool.Exec(ctx, `UPDATE users SET clerk_id = 'user_reauth' WHERE id::text = $1`, id)
+	require.NoError(t, err)
+	require.ErrorIs(t, authSvc.ConfirmPassword(ctx, "user_reauth", "", "Wrong1Horse", svc.SessionMeta{}), svc.ErrInvalidCredentials)
+
+	// Clerk users without a local password, or not synced at all, get a
+	// clean error rather than a failed lookup.
+	_, err = testDB.Pool.Exec(ctx, `INSERT INTO users (email, clerk_id) VALUES ('clerk-only@example.com', 'user_clerk_only')`)
+	require.NoError(t, err)
+	require.ErrorIs(t, authSvc.ConfirmPassword(ctx, "user_clerk_only", "", "Correct1Horse", svc.SessionMeta{}), svc.ErrNoLocalPassword)
+	require.ErrorIs(t, authSvc.ConfirmPassword(ctx, "user_unsynced", "", "Correct1Horse", svc.SessionMeta{}), svc.ErrNoLocalPassword)
+}
+
+func TestUnlockAccountWithoutEmail(t *testing.T) {
+	testDB, testServer, cleanup := testhelpers.SetupTest(t)
+	defer cleanup()
+
+	authSvc := svc.NewAuthService(testServer)
+	ctx := context.Background()
+
+	// Clerk, OIDC and passkey-only users may have no email; their failures
+	// are keyed by their ID.
+	var userID string
+	require.NoError(t, testDB.Pool.QueryRow(ctx, `INSERT INTO users (clerk_id) VALUES ('user_no_email') RETURNING id::text`).Scan(&userID))
+	require.NoError(t, authSvc.UnlockAccount(ctx, userID))
+	require.ErrorIs(t, authSvc.UnlockAccount(ctx, "00000000-0000-0000-0000-000000000000"), sql.ErrNoRows)
+}
+
+func TestRefreshSessionRotatesAndRevokes(t *testing.T) {
+	testDB, testServer, cleanup := testhelpers.SetupTest(t)
+	defer cleanup()
+
+	authSvc := svc.NewAuthService(testServer)
+
+	ctx := context.Background()
+	_, err := authSvc.RegisterUser(ctx, "refresh@example.com", "Password1", "")
+	require.NoError(t, err)
+
+	session, err := authSvc.Login(ctx, "refresh@example.com", "Password1", svc.SessionMeta{UserAgent: "test", IPAddress: "127.0.0.1"})
+	require.NoError(t, err)
+
+	// the raw refresh token must never be stored
+	var stored string
+	err = testDB.Pool.QueryRow(ctx, `SELECT refresh_token_hash FROM sessions WHERE user_id::text = $1`, session.UserID).Scan(&stored)
+	require.NoError(t, err)
+	require.NotEqual(t, session.RefreshToken, stored)
+
+	refreshed, err := authSvc.RefreshSession(ctx, session.RefreshToken, svc.SessionMeta{})
+	require.NoError(t, err)
+	require.NotEqual(t, session.RefreshToken, refreshed.RefreshToken)
+
+	// the old refresh token was rotated out
+	_, err = authSvc.RefreshSession(ctx, session.RefreshToken, svc.SessionMeta{})
+	require.ErrorIs(t, err, svc.ErrInvalidRefreshToken)
+
+	require.NoError(t, authSvc.RevokeSession(ctx, refreshed.RefreshToken))
+	_, err = authSvc.RefreshSession(ctx, refreshed.RefreshToken, svc.SessionMeta{})
+	require.ErrorIs(t, err, svc.ErrInvalidRefreshToken)
+}
+
+func TestEmailVerificationGatesLogin(t *testing.T) {
+	testDB, testServer, cleanup := testhelpers.SetupTest(t)
+	defer cleanup()
+
+	cfg := testServer.GetConfig()
+	cfg.Auth.RequireEmailVerification = true
+	testServer.SetConfig(cfg)
+
+	authSvc := svc.NewAuthService(testServer)
+
+	ctx := context.Background()
+	email := "verify@example.com"
+	_, err := authSvc.RegisterUser(ctx, email, "Password1", "")
+	require.NoError(t, err)
+
+	_, err = authSvc.Login(ctx, email, "Password1", svc.SessionMeta{})
+	require.ErrorIs(t, err, svc.ErrEmailNotVerified)
+
+	// the password is still checked first
+	_, err = authSvc.Login(ctx, email, "wrong", svc.SessionMeta{})
+	require.ErrorIs(t, err, svc.ErrInvalidCredentials)
+
+	token, err := authSvc.RequestEmailVerification(ctx, email)
+	require.NoError(t, err)
+
+	var stored string
+	err = testDB.Pool.QueryRow(ctx, `SELECT email_verification_token FROM users WHERE email=$1`, email).Scan(&stored)
+	require.NoError(t, err)
+	require.NotEqual(t, token, stored)
+
+	require.ErrorIs(t, authSvc.VerifyEmail(ctx, "wrongtoken"), svc.ErrInvalidEmailVerificationToken)
+	require.NoError(t, authSvc.VerifyEmail(ctx, token))
+	// tokens are single-use
+	require.ErrorIs(t, authSvc.VerifyEmail(ctx, token), svc.ErrInvalidEmailVerificationToken)
+
+	_, err = authSvc.Login(ctx, email, "Password1", svc.SessionMeta{})
+	require.NoError(t, err)
+
+	// verified accounts cannot request another token
+	_, err = authSvc.RequestEmailVerification(ctx, email)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestTOTPEnrollmentAndMFALogin(t *testing.T) {
+	testDB, testServer, cleanup := testhelpers.SetupTest(t)
+	defer cleanup()
+
+	authSvc := svc.NewAuthService(testServer)
+
+	ctx := context.Background()
+	email := "mfa@example.com"
+	id, err := authSvc.RegisterUser(ctx, email, "Password1", "")
+	require.NoError(t, err)
+
+	enrollment, err := authSvc.BeginTOTPEnrollment(ctx, id)
+	require.NoError(t, err)
+	require.NotEmpty(t, enrollment.Secret)
+
+	// the secret is encrypted at rest
+	var stored string
+	err = testDB.Pool.QueryRow(ctx, `SELECT mfa_secret FROM users WHERE id::text = $1`, id).Scan(&stored)
+	require.NoError(t, err)
+	require.NotContains(t, stored, enrollment.Secret)
+
+	// enrollment is not active until confirmed
+	_, err = authSvc.Login(ctx, email, "Password1", svc.SessionMeta{})
+	require.NoError(t, err)
+
+	code, err := totp.Code(enrollment.Secret, totp.Step(time.Now()))
+	require.NoError(t, err)
+	recovery, err := authSvc.ConfirmTOTPEnrollment(ctx, id, code)
+	require.NoError(t, err)
+	require.Len(t, recovery, svc.RecoveryCodeCount)
+
+	_, err = authSvc.Login(ctx, email, "Password1", svc.SessionMeta{})
+	var mfaErr *svc.MFARequiredError
+	require.ErrorAs(t, err, &mfaErr)
+	require.NotEmpty(t, mfaErr.Challenge.Token)
+
+	// the code used for confirmation cannot be replayed
+	_, err = authSvc.CompleteMFALogin(ctx, mfaErr.Challenge.Token, code, svc.SessionMeta{})
+	require.ErrorIs(t, err, svc.ErrInvalidMFACode)
+
+	session, err := authSvc.CompleteMFALogin(ctx, mfaErr.Challenge.Token, recovery[0], svc.SessionMeta{})
+	require.NoError(t, err)
+	require.Equal(t, id, session.UserID)
+
+	// challenges and recovery codes are single-use
+	_, err = authSvc.CompleteMFALogin(ctx, mfaErr.Challenge.Token, recovery[1], svc.SessionMeta{})
+	require.ErrorIs(t, err, svc.ErrInvalidMFAChallenge)
+
+	_, err = authSvc.Login(ctx, email, "Password1", svc.SessionMeta{})
+	require.ErrorAs(t, err, &mfaErr)
+	_, err = authSvc.CompleteMFALogin(ctx, mfaErr.Challenge.Token, recovery[0], svc.SessionMeta{})
+	require.ErrorIs(t, err, svc.ErrInvalidMFACode)
+
+	// Clerk sessions identify the user by their Clerk ID.
+	_, err = testDB.Pool.Exec(ctx, `UPDATE users SET clerk_id = 'user_mfa' WHERE id::text = $1`, id)
+	require.NoError(t, err)
+	recovery, err = authSvc.RegenerateRecoveryCodes(ctx, "user_mfa")
+	require.NoError(t, err)
+	_, err = authSvc.RegenerateRecoveryCodes(ctx, "user_unknown")
+	require.ErrorIs(t, err, svc.ErrUserNotFound)
+
+	require.NoError(t, authSvc.DisableTOTP(ctx, "user_mfa", recovery[1]))
+	_, err = authSvc.Login(ctx, email, "Password1", svc.SessionMeta{})
+	require.NoError(t, err)
+	_, err = authSvc.BeginTOTPEnrollment(ctx, "user_mfa")
+	require.NoError(t, err)
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	testDB, testServer, cleanup := testhelpers.SetupTest(t)
+	defer cleanup()
+
+	cfg := testServer.GetConfig()
+	cfg.Auth.WebAuthnRPID = "localhost"
+	cfg.Auth.WebAuthnRPOrigins = []string{"http://localhost:3000"}
+	testServer.SetConfig(cfg)
+
+	authSvc := svc.NewAuthService(testServer)
+
+	ctx := context.Background()
+	id, err := authSvc.RegisterUser(ctx, "passkey@example.com", "Password1", "")
+	require.NoError(t, err)
+
+	authenticator := passkeytest.New("http://localhost:3000")
+
+	ceremony, err := authSvc.BeginPasskeyRegistration(ctx, id)
+	require.NoError(t, err)
+	response, err := authenticator.Create(ceremony.Options.(*protocol.CredentialCreation))
+	require.NoError(t, err)
+	pk, err := authSvc.FinishPasskeyRegistration(ctx, id, ceremony.ID, "Laptop", response)
+	require.NoError(t, err)
+	require.Equal(t, "Laptop", pk.Name)
+
+	// ceremonies are single-use
+	_, err = authSvc.FinishPasskeyRegistration(ctx, id, ceremony.ID, "Laptop", response)
+	require.ErrorIs(t, err, svc.ErrInvalidPasskeyCeremony)
+
+	login, err := authSvc.BeginPasskeyLogin(ctx)
+	require.NoError(t, err)
+	assertion, err := authenticator.Get(login.Options.(*protocol.CredentialAssertion))
+	require.NoError(t, err)
+	session, err := authSvc.FinishPasskeyLogin(ctx, login.ID, assertion, svc.SessionMeta{})
+	require.NoError(t, err)
+	require.Equal(t, id, session.UserID)
+
+	// a cloned authenticator reporting an old counter is rejected
+	authenticator.Credentials[0].SignCount = 0
+	login, err = authSvc.BeginPasskeyLogin(ctx)
+	require.NoError(t, err)
+	assertion, err = authenticator.Get(login.Options.(*protocol.CredentialAssertion))
+	require.NoError(t, err)
+	_, err = authSvc.FinishPasskeyLogin(ctx, login.ID, assertion, svc.SessionMeta{})
+	require.ErrorIs(t, err, svc.ErrPasskeyRejected)
+
+	passkeys, err := authSvc.ListPasskeys(ctx, id)
+	require.NoError(t, err)
+	require.Len(t, passkeys, 1)
+
+	// Clerk sessions identify the user by their Clerk ID, and a passkey-only
+	// user cannot delete their last passkey.
+	_, err = testDB.Pool.Exec(ctx, `UPDATE users SET clerk_id = 'user_passkey', password_hash = NULL WHERE id::text = $1`, id)
+	require.NoError(t, err)
+	passkeys, err = authSvc.ListPasskeys(ctx, "user_passkey")
+	require.NoError(t, err)
+	require.Len(t, passkeys, 1)
+	require.ErrorIs(t, authSvc.DeletePasskey(ctx, "user_passkey", pk.ID), svc.ErrLastLoginMethod)
+	_, err = testDB.Pool.Exec(ctx, `UPDATE users SET password_hash = 'x' WHERE id::text = $1`, id)
+	require.NoError(t, err)
+
+	require.NoError(t, authSvc.DeletePasskey(ctx, "user_passkey", pk.ID))
+	require.ErrorIs(t, authSvc.DeletePasskey(ctx, id, pk.ID), svc.ErrPasskeyNotFound)
+}
+
+func TestPasswordPolicyEnforcedOnRegisterAndReset(t *testing.T) {
+	_, testServer, cleanup := testhelpers.SetupTest(t)
+	defer cleanup()
+
+	denylist := filepath.Join(t.TempDir(), "breached.txt")
+	require.NoError(t, os.WriteFile(denylist, []byte("Summer2024\n"), 0o600))
+
+	cfg := testServer.GetConfig()
+	cfg.Auth.PasswordPolicy.MinLength = 10
+	cfg.Auth.PasswordPolicy.BannedWords = []string{"acme"}
+	cfg.Auth.PasswordPolicy.DenylistFile = denylist
+	testServer.SetConfig(cfg)
+
+	authSvc := svc.NewAuthService(testServer)
+	ctx := context.Background()
+	email := "policy@example.com"
+
+	_, err := authSvc.RegisterUser(ctx, email, "", "")
+	require.ErrorIs(t, err, svc.ErrWeakPassword)
+	require.ErrorIs(t, err, svc.ErrPasswordValidation)
+
+	_, err = authSvc.RegisterUser(ctx, email, "Summer2024", "")
+	var policyErr *svc.PasswordPolicyError
+	require.ErrorAs(t, err, &policyErr)
+	require.Equal(t, []string{"appears in a list of breached passwords"}, policyErr.Violations)
+
+	_, err = authSvc.RegisterUser(ctx, email, "MyAcmePass1", "")
+	require.ErrorAs(t, err, &policyErr)
+	require.Equal(t, "password", policyErr.FieldErrors("password")[0].Field)
+
+	_, err = authSvc.RegisterUser(ctx, email, "Correct1Horse", "")
+	require.NoError(t, err)
+
+	token, err := authSvc.RequestPasswordReset(ctx, email, time.Hour)
+	require.NoError(t, err)
+	require.ErrorIs(t, authSvc.ResetPassword(ctx, token, "short1A"), svc.ErrWeakPassword)
+	require.NoError(t, authSvc.ResetPassword(ctx, token, "Battery9Staple"))
+
+	// A broken policy fails service construction instead of each request.
+	cfg.Auth.PasswordPolicy.DenylistFile = filepath.Join(t.TempDir(), "missing.txt")
+	testServer.SetConfig(cfg)
+	_, err = svc.NewServices(testServer, nil)
+	require.Error(t, err)
+	cfg.Auth.PasswordPolicy.DenylistFile = denylist
+	cfg.Auth.PasswordPolicy.RequiredClasses = []string{"uppercase"}
+	testServer.SetConfig(cfg)
+	_, err = svc.NewServices(testServer, nil)
+	require.Error(t, err)
+}
+
+func TestLoginRehashesOutdatedPasswordHash(t *testing.T) {
+	testDB, testServer, cleanup := testhelpers.SetupTest(t)
+	defer cleanup()
+
+	cfg := testServer.GetConfig()
+	cfg.Auth.PasswordHash.Algorithm = "bcrypt"
+	cfg.Auth.PasswordHash.BcryptCost = 4
+	testServer.SetConfig(cfg)
+
+	authSvc := svc.NewAuthService(testServer)
+	ctx := context.Background()
+	email := "rehash@example.com"
+
+	id, err := authSvc.RegisterUser(ctx, email, "Correct1Horse", "")
+	require.NoError(t, err)
+
+	storedHash := func() string {
+		var hash string
+		require.NoError(t, testDB.Pool.QueryRow(ctx, `SELECT password_hash FROM users WHERE id::text = $1`, id).Scan(&hash))
+		return hash
+	}
+	require.True(t, strings.HasPrefix(storedHash(), "$2a$04$"))
+
+	// Passwords bcrypt would reject are refused by the policy, not the hasher.
+	_, err = authSvc.RegisterUser(ctx, "long@example.com", "Correct1Horse"+strings.Repeat("x", 60), "")
+	require.ErrorIs(t, err, svc.ErrWeakPassword)
+
+	// A higher bcrypt cost upgrades the hash on the next login.
+	cfg.Auth.PasswordHash.BcryptCost = 5
+	testServer.SetConfig(cfg)
+	_, err = authSvc.Login(ctx, email, "Correct1Horse", svc.SessionMeta{})
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(storedHash(), "$2a$05$"))
+
+	// Switching algorithms migrates to argon2id, and the new hash still logs in.
+	cfg.Auth.PasswordHash.Algorithm = "argon2id"
+	testServer.SetConfig(cfg)
+	_, err = authSvc.Login(ctx, email, "Correct1Horse", svc.SessionMeta{})
+	require.NoError(t, err)
+	upgraded := storedHash()
+	require.True(t, strings.HasPrefix(upgraded, "$argon2id$v=19$"))
+
+	_, err = authSvc.Login(ctx, email, "Correct1Horse", svc.SessionMeta{})
+	require.NoError(t, err)
+	require.Equal(t, upgraded, storedHash(), "current hashes are not rewritten")
+
+	_, err = authSvc.Login(ctx, email, "wrong", svc.SessionMeta{})
+	require.ErrorIs(t, err, svc.ErrInvalidCredentials)
+}
+
+func TestOIDCLoginCreatesAndLinksUsers(t *testing.T) {
+	testDB, testServer, cleanup := testhelpers.SetupTest(t)
+	defer cleanup()
+
+	idp, err := oidctest.New("boilerplate", "client-secret", oidctest.User{
+		Subject: "idp-user-1", Email: "new@example.com", EmailVerified: true, Name: "Ada Lovelace",
+	})
+	require.NoError(t, err)
+	defer idp.Close()
+
+	cfg := testServer.GetConfig()
+	cfg.Auth.OIDCProviders = map[string]config.OIDCProvider{
+		"stand-in": {Issuer: idp.URL, ClientID: "boilerplate", ClientSecret: "client-secret", RedirectURL: "https://app.example.com/oidc/callback"},
+	}
+	testServer.SetConfig(cfg)
+
+	authSvc := svc.NewAuthService(testServer)
+	ctx := context.Background()
+	require.Equal(t, []string{"stand-in"}, authSvc.OIDCProviders())
+
+	login := func() (*svc.Session, error) {
+		auth, err := authSvc.BeginOIDCLogin(ctx, "stand-in")
+		require.NoError(t, err)
+		code, state, err := idp.Authorize(auth.URL)
+		require.NoError(t, err)
+		require.Equal(t, auth.State, state)
+		return authSvc.FinishOIDCLogin(ctx, "stand-in", state, code, svc.SessionMeta{})
+	}
+
+	// First login creates the user.
+	session, err := login()
+	require.NoError(t, err)
+	var email, firstName string
+	var verified bool
+	require.NoError(t, testDB.Pool.QueryRow(ctx, `SELECT email, email_verified, first_name FROM users WHERE id::text = $1 AND oauth_provider = 'stand-in' AND oauth_provider_id = 'idp-user-1'`,
+		session.UserID).Scan(&email, &verified, &firstName))
+	require.Equal(t, "new@example.com", email)
+	require.True(t, verified)
+	require.Equal(t, "Ada", firstName)
+
+	// Subsequent logins find the same user.
+	again, err := login()
+	require.NoError(t, err)
+	require.Equal(t, session.UserID, again.UserID)
+
+	// A verified email links an existing local account.
+	localID, err := authSvc.RegisterUser(ctx, "local@example.com", "Correct1Horse", "")
+	require.NoError(t, err)
+	_, err = testDB.Pool.Exec(ctx, `UPDATE users SET email_verified = TRUE WHERE id::text = $1`, localID)
+	require.NoError(t, err)
+	idp.SetUser(oidctest.User{Subject: "idp-user-2", Email: "local@example.com", EmailVerified: true})
+	linked, err := login()
+	require.NoError(t, err)
+	require.Equal(t, localID, linked.UserID)
+
+	// An unverified email must not take over an existing account.
+	_, err = authSvc.RegisterUser(ctx, "victim@example.com", "Correct1Horse", "")
+	require.NoError(t, err)
+	idp.SetUser(oidctest.User{Subject: "idp-user-3", Email: "victim@example.com", EmailVerified: false})
+	_, err = login()
+	require.ErrorIs(t, err, svc.ErrOIDCAccountConflict)
+
+	// Nor may a verified email take over a local account that never verified
+	// it; the link waits for the account owner and the row stays unverified.
+	squatterID, err := authSvc.RegisterUser(ctx, "owner@example.com", "Correct1Horse", "")
+	require.NoError(t, err)
+	idp.SetUser(oidctest.User{Subject: "idp-user-4", Email: "owner@example.com", EmailVerified: true})
+	_, err = login()
+	require.ErrorIs(t, err, svc.ErrOIDCAccountConflict)
+	identities, err := authSvc.ListIdentities(ctx, squatterID)
+	require.NoError(t, err)
+	require.Len(t, identities, 1)
+	require.True(t, identities[0].Pending)
+	require.NoError(t, testDB.Pool.QueryRow(ctx, `SELECT email_verified FROM users WHERE id::text = $1`, squatterID).Scan(&verified))
+	require.False(t, verified)
+
+	// Closed registration stops new accounts but not existing users.
+	cfg.Auth.RegistrationMode = config.RegistrationClosed
+	testServer.SetConfig(cfg)
+	idp.SetUser(oidctest.User{Subject: "idp-user-5", Email: "latecomer@example.com", EmailVerified: true})
+	_, err = login()
+	require.ErrorIs(t, err, svc.ErrRegistrationClosed)
+	var n int
+	require.NoError(t, testDB.Pool.QueryRow(ctx, `SELECT count(*) FROM users WHERE email = 'latecomer@example.com'`).Scan(&n))
+	require.Zero(t, n)
+	idp.SetUser(oidctest.User{Subject: "idp-user-1", Email: "new@example.com", EmailVerified: true})
+	again, err = login()
+	require.NoError(t, err)
+	require.Equal(t, session.UserID, again.UserID)
+
+	// State is single-use and bound to the provider.
+	auth, err := authSvc.BeginOIDCLogin(ctx, "stand-in")
+	require.NoError(t, err)
+	code, state, err := idp.Authorize(auth.URL)
+	require.NoError(t, err)
+	_, err = authSvc.FinishOIDCLogin(ctx, "other", state, code, svc.SessionMeta{})
+	require.ErrorIs(t, err, svc.ErrOIDCProviderNotFound)
+	_, err = authSvc.FinishOIDCLogin(ctx, "stand-in", "forged", code, svc.SessionMeta{})
+	require.ErrorIs(t, err, svc.ErrInvalidOIDCState)
+}
+
+func TestMagicLinkLoginIsSingleUse(t *testing.T) {
+	testDB, testServer, cleanup := testhelpers.SetupTest(t)
+	defer cleanup()
+
+	authSvc := svc.NewAuthService(testServer)
+	ctx := context.Background()
+	email := "staff@example.com"
+
+	id, err := authSvc.RegisterUser(ctx, email, "Correct1Horse", "")
+	require.NoError(t, err)
+
+	_, err = authSvc.RequestMagicLink(ctx, "nobody@example.com")
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	// Requesting a new link invalidates the previous one.
+	first, err := authSvc.RequestMagicLink(ctx, email)
+	require.NoError(t, err)
+	token, err := authSvc.RequestMagicLink(ctx, email)
+	require.NoError(t, err)
+	_, err = authSvc.ConsumeMagicLink(ctx, first, svc.SessionMeta{})
+	require.ErrorIs(t, err, svc.ErrInvalidMagicLink)
+
+	session, err := authSvc.ConsumeMagicLink(ctx, token, svc.SessionMeta{})
+	require.NoError(t, err)
+	require.Equal(t, id, session.UserID)
+
+	var verified bool
+	require.NoError(t, testDB.Pool.QueryRow(ctx, `SELECT email_verified FROM users WHERE id::text = $1`, id).Scan(&verified))
+	require.True(t, verified)
+
+	_, err = authSvc.ConsumeMagicLink(ctx, token, svc.SessionMeta{})
+	require.ErrorIs(t, err, svc.ErrInvalidMagicLink)
+
+	// Expired links are rejected.
+	token, err = authSvc.RequestMagicLink(ctx, email)
+	require.NoError(t, err)
+	_, err = testDB.Pool.Exec(ctx, `UPDATE users SET magic_link_expires = now() - interval '1 second' WHERE id::text = $1`, id)
+	require.NoError(t, err)
+	_, err = authSvc.ConsumeMagicLink(ctx, token, svc.SessionMeta{})
+	require.ErrorIs(t, err, svc.ErrInvalidMagicLink)
+}
+
+func TestClerkSyncLinksIdentitiesExplicitly(t *testing.T) {
+	testDB, testServer, cleanup := testhelpers.SetupTest(t)
+	defer cleanup()
+
+	authSvc := svc.NewAuthService(testServer)
+	ctx := context.Background()
+	countUsers := func(email string) int {
+		var n int
+		require.NoError(t, testDB.Pool.QueryRow(ctx, `SELECT count(*) FROM users WHERE email = $1`, email).Scan(&n))
+		return n
+	}
+
+	// An address the local account never verified is not linked, even when
+	// Clerk verified it: whoever registered it may not own it.
+	squatterID, err := authSvc.RegisterUser(ctx, "sam@example.com", "Correct1Horse", "")
+	require.NoError(t, err)
+	require.NoError(t, authSvc.SyncClerkUser(ctx, svc.ClerkUser{ID: "user_sam", Email: "sam@example.com", EmailVerified: true}))
+	require.NoError(t, authSvc.SyncClerkUser(ctx, svc.ClerkUser{ID: "user_sam", Email: "sam@example.com", EmailVerified: true}))
+	identities, err := authSvc.ListIdentities(ctx, squatterID)
+	require.NoError(t, err)
+	require.Len(t, identities, 1)
+	require.True(t, identities[0].Pending)
+
+	// A verified email links the Clerk account to the local user.
+	localID, err := authSvc.RegisterUser(ctx, "linda@example.com", "Correct1Horse", "")
+	require.NoError(t, err)
+	_, err = testDB.Pool.Exec(ctx, `UPDATE users SET email_verified = TRUE WHERE id::text = $1`, localID)
+	require.NoError(t, err)
+	require.NoError(t, authSvc.SyncClerkUser(ctx, svc.ClerkUser{ID: "user_linda", Email: "linda@example.com", EmailVerified: true, FirstName: "Linda"}))
+	require.Equal(t, 1, countUsers("linda@example.com"))
+	identities, err = authSvc.ListIdentities(ctx, localID)
+	require.NoError(t, err)
+	require.Len(t, identities, 1)
+	require.Equal(t, svc.IdentityProviderClerk, identities[0].Provider)
+	require.False(t, identities[0].Pending)
+
+	// An unverified email only records a pending link the owner must confirm.
+	patID, err := authSvc.RegisterUser(ctx, "pat@example.com", "Correct1Horse", "")
+	require.NoError(t, err)
+	require.NoError(t, authSvc.SyncUser(ctx, "user_pat", "", "pat@example.com", "Pat", "", "", "", nil))
+	require.Equal(t, 1, countUsers("pat@example.com"))
+	identities, err = authSvc.ListIdentities(ctx, patID)
+	require.NoError(t, err)
+	require.Len(t, identities, 1)
+	require.True(t, identities[0].Pending)
+	var clerkID sql.NullString
+	require.NoError(t, testDB.Pool.QueryRow(ctx, `SELECT clerk_id FROM users WHERE id::text = $1`, patID).Scan(&clerkID))
+	require.False(t, clerkID.Valid)
+
+	require.ErrorIs(t, authSvc.ConfirmIdentity(ctx, localID, identities[0].ID), svc.ErrIdentityNotFound)
+	require.NoError(t, authSvc.ConfirmIdentity(ctx, patID, identities[0].ID))
+	require.NoError(t, testDB.Pool.QueryRow(ctx, `SELECT clerk_id FROM users WHERE id::text = $1`, patID).Scan(&clerkID))
+	require.Equal(t, "user_pat", clerkID.String)
+
+	// Clerk-only users without an external ID no longer collide.
+	require.NoError(t, authSvc.SyncUser(ctx, "user_one", "", "one@example.com", "", "", "", "", nil))
+	require.NoError(t, authSvc.SyncUser(ctx, "user_two", "", "two@example.com", "", "", "", "", nil))
+	require.Equal(t, 1, countUsers("two@example.com"))
+
+	// The last way to sign in cannot be unlinked; a password keeps it optional.
+	var oneID string
+	require.NoError(t, testDB.Pool.QueryRow(ctx, `SELECT id::text FROM users WHERE clerk_id = 'user_one'`).Scan(&oneID))
+	identities, err = authSvc.ListIdentities(ctx, oneID)
+	require.NoError(t, err)
+	require.Len(t, identities, 1)
+	require.ErrorIs(t, authSvc.UnlinkIdentity(ctx, oneID, identities[0].ID), svc.ErrLastLoginMethod)
+
+	// Clerk sessions identify the user by the Clerk user ID.
+	byClerkID, err := authSvc.ListIdentities(ctx, "user_one")
+	require.NoError(t, err)
+	require.Equal(t, identities, byClerkID)
+	require.ErrorIs(t, authSvc.UnlinkIdentity(ctx, "user_one", identities[0].ID), svc.ErrLastLoginMethod)
+
+	identities, err = authSvc.ListIdentities(ctx, localID)
+	require.NoError(t, err)
+	require.NoError(t, authSvc.UnlinkIdentity(ctx, localID, identities[0].ID))
+	require.NoError(t, testDB.Pool.QueryRow(ctx, `SELECT clerk_id FROM users WHERE id::text = $1`, localID).Scan(&clerkID))
+	require.False(t, clerkID.Valid)
+	identities, err = authSvc.ListIdentities(ctx, localID)
+	require.NoError(t, err)
+	require.Empty(t, identities)
+}
+
+func TestServiceAccountAPIKeys(t *testing.T) {
+	_, testServer, cleanup := testhelpers.SetupTest(t)
+	defer cleanup()
+
+	authSvc := svc.NewAuthService(testServer)
+	ctx := context.Background()
+
+	sa, err := authSvc.CreateServiceAccount(ctx, "billing-sync", "nightly export", "admin-1")
+	require.NoError(t, err)
+	_, err = authSvc.CreateServiceAccount(ctx, "billing-sync", "", "admin-1")
+	require.ErrorIs(t, err, svc.ErrServiceAccountExists)
+
+	_, err = authSvc.CreateAPIKey(ctx, sa.ID, "bad", []string{"Users"}, nil)
+	require.ErrorIs(t, err, svc.ErrInvalidScope)
+	key, err := authSvc.CreateAPIKey(ctx, sa.ID, "primary", []string{"invoices:*"}, nil)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(key.Key, apikey.ServiceAccountPrefix))
+	require.True(t, strings.HasPrefix(key.Key, key.Hint))
+
+	auth := middleware.NewAuthMiddleware(testServer)
+	call := func(raw string, scope string) (int, echo.Context) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-API-Key", raw)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		h := auth.RequireAPIKey(auth.RequireScope(scope)(func(c echo.Context) error { return c.NoContent(http.StatusNoContent) }))
+		if err := h(c); err != nil {
+			var httpErr *errs.HTTPError
+			require.True(t, errors.As(err, &httpErr))
+			return httpErr.Status, c
+		}
+		return rec.Code, c
+	}
+
+	code, c := call(key.Key, "invoices:export")
+	require.Equal(t, http.StatusNoContent, code)
+	require.Equal(t, sa.ID, middleware.GetUserID(c))
+	require.Equal(t, middleware.PrincipalServiceAccount, c.Get(middleware.PrincipalTypeKey))
+	code, _ = call(key.Key, "users:read")
+	require.Equal(t, http.StatusForbidden, code)
+	code, _ = call(key.Key+"0", "invoices:export")
+	require.Equal(t, http.StatusUnauthorized, code)
+
+	keys, err := authSvc.ListAPIKeys(ctx, sa.ID)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	require.NotNil(t, keys[0].LastUsedAt)
+
+	// Expired and revoked keys, and keys of disabled accounts, are rejected.
+	past := time.Now().Add(-time.Minute)
+	expired, err := authSvc.CreateAPIKey(ctx, sa.ID, "expired", []string{"*"}, &past)
+	require.NoError(t, err)
+	code, _ = call(expired.Key, "invoices:export")
+	require.Equal(t, http.StatusUnauthorized, code)
+
+	require.NoError(t, authSvc.RevokeAPIKey(ctx, sa.ID, key.ID))
+	code, _ = call(key.Key, "invoices:export")
+	require.Equal(t, http.StatusUnauthorized, code)
+
+	other, err := authSvc.CreateAPIKey(ctx, sa.ID, "secondary", []string{"*"}, nil)
+	require.NoError(t, err)
+	require.NoError(t, authSvc.DisableServiceAccount(ctx, sa.ID))
+	code, _ = call(other.Key, "invoices:export")
+	require.Equal(t, http.StatusUnauthorized, code)
+	_, err = authSvc.CreateAPIKey(ctx, sa.ID, "late", nil, nil)
+	require.ErrorIs(t, err, svc.ErrServiceAccountNotFound)
+}
+
+func TestPersonalAccessTokens(t *testing.T) {
+	_, testServer, cleanup := testhelpers.SetupTest(t)
+	defer cleanup()
+
+	authSvc := svc.NewAuthService(testServer)
+	ctx := context.Background()
+	userID, err := authSvc.RegisterUser(ctx, "cli@example.com", "Correct1Horse", "")
+	require.NoError(t, err)
+
+	pat, err := authSvc.CreatePersonalAccessToken(ctx, userID, "laptop", nil)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(pat.Token, apikey.PersonalAccessTokenPrefix))
+
+	auth := middleware.NewAuthMiddleware(testServer)
+	call := func(raw string) (int, echo.Context) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+raw)
+		req.Header.Set(echo.HeaderXRealIP, "203.0.113.7")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		if err := auth.RequireAuth(func(c echo.Context) error { return c.NoContent(http.StatusNoContent) })(c); err != nil {
+			var httpErr *errs.HTTPError
+			require.True(t, errors.As(err, &httpErr))
+			return httpErr.Status, c
+		}
+		return rec.Code, c
+	}
+
+	code, c := call(pat.Token)
+	require.Equal(t, http.StatusNoContent, code)
+	require.Equal(t, userID, middleware.GetUserID(c))
+	require.Equal(t, pat.ID, c.Get(middleware.TokenIDKey))
+
+	tokens, err := authSvc.ListPersonalAccessTokens(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	require.NotNil(t, tokens[0].LastUsedAt)
+	require.Equal(t, "203.0.113.7", tokens[0].LastUsedIP)
+
+	// Expired and revoked tokens are rejected and no longer listed.
+	past := time.Now().Add(-time.Minute)
+	expired, err := authSvc.CreatePersonalAccessToken(ctx, userID, "old", &past)
+	require.NoError(t, err)
+	code, _ = call(expired.Token)
+	require.Equal(t, http.StatusUnauthorized, code)
+
+	other, err := authSvc.RegisterUser(ctx, "other@example.com", "Correct1Horse", "")
+	require.NoError(t, err)
+	require.ErrorIs(t, authSvc.RevokePersonalAccessToken(ctx, other, pat.ID), svc.ErrPersonalAccessTokenNotFound)
+	require.NoError(t, authSvc.RevokePersonalAccessToken(ctx, userID, pat.ID))
+	code, _ = call(pat.Token)
+	require.Equal(t, http.StatusUnauthorized, code)
+	tokens, err = authSvc.ListPersonalAccessTokens(ctx, userID)
+	require.NoError(t, err)
+	require.Empty(t, tokens)
+}
+
+func TestRolesGrantPermissions(t *testing.T) {
+	testDB, testServer, cleanup := testhelpers.SetupTest(t)
+	defer cleanup()
+
+	authSvc := svc.NewAuthService(testServer)
+	ctx := context.Background()
+	userID, err := authSvc.RegisterUser(ctx, "agent@example.com", "Correct1Horse", "")
+	require.NoError(t, err)
+
+	auth := middleware.NewAuthMiddleware(testServer)
+	allowed := func(permission string, claims []string) bool {
+		e := echo.New()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+		c.Set(middleware.UserIDKey, userID)
+		if claims != nil {
+			c.Set(middleware.PermissionsKey, claims)
+		}
+		err := auth.RequirePermission(permission)(func(c echo.Context) error { return nil })(c)
+		return err == nil
+	}
+
+	require.False(t, allowed("users:unlock", nil))
+	require.ErrorIs(t, authSvc.AssignRole(ctx, userID, "janitor", "admin-1"), svc.ErrRoleNotFound)
+
+	require.NoError(t, authSvc.AssignRole(ctx, userID, "support", "admin-1"))
+	require.True(t, allowed("users:unlock", nil))
+	require.False(t, allowed("users:delete", nil))
+	roles, err := authSvc.UserRoles(ctx, userID)
+	require.NoError(t, err)
+	require.Equal(t, []string{"support"}, roles)
+
+	// A permissions claim on the session takes precedence over the database.
+	require.False(t, allowed("users:unlock", []string{"users:read"}))
+
+	require.NoError(t, authSvc.RemoveRole(ctx, userID, "support"))
+	require.False(t, allowed("users:unlock", nil))
+	require.ErrorIs(t, authSvc.RemoveRole(ctx, userID, "support"), svc.ErrRoleNotFound)
+
+	// The free-text users.role column still counts as a role.
+	_, err = testDB.Pool.Exec(ctx, `UPDATE users SET role = 'admin' WHERE id::text = $1`, userID)
+	require.NoError(t, err)
+	require.NoError(t, rbac.Invalidate(ctx, testServer.Redis, userID))
+	require.True(t, allowed("users:delete", nil))
+	require.NoError(t, authSvc.RemoveRole(ctx, userID, "admin"))
+	require.False(t, allowed("users:delete", nil))
+
+	// A role removed locally is not restored by a Clerk sync of the same
+	// metadata, only by a change to it.
+	clerkUser := svc.ClerkUser{ID: "user_agent", Email: "clerk-agent@example.com", EmailVerified: true, Role: "admin"}
+	require.NoError(t, authSvc.SyncClerkUser(ctx, clerkUser))
+	var clerkUserID string
+	require.NoError(t, testDB.Pool.QueryRow(ctx, `SELECT id::text FROM users WHERE clerk_id = 'user_agent'`).Scan(&clerkUserID))
+	require.NoError(t, authSvc.RemoveRole(ctx, clerkUserID, "admin"))
+	require.NoError(t, authSvc.SyncClerkUser(ctx, clerkUser))
+	roles, err = authSvc.UserRoles(ctx, clerkUserID)
+	require.NoError(t, err)
+	require.Empty(t, roles)
+	clerkUser.Role = "support"
+	require.NoError(t, authSvc.SyncClerkUser(ctx, clerkUser))
+	roles, err = authSvc.UserRoles(ctx, clerkUserID)
+	require.NoError(t, err)
+	require.Equal(t, []string{"support"}, roles)
+
+	roleList, err := authSvc.ListRoles(ctx)
+	require.NoError(t, err)
+	require.NotEmpty(t, roleList)
+}
+
 // This integration-style test runs against the test DB created by testhelpers
 // and asserts that RequestPasswordReset stores an HMAC digest in the DB and
 // ResetPassword succeeds only when given the original raw token.
+func TestOrganizationsAreTenantScoped(t *testing.T) {
+	testDB, testServer, cleanup := testhelpers.SetupTest(t)
+	defer cleanup()
+
+	authSvc := svc.NewAuthService(testServer)
+	orgSvc := svc.NewOrganizationService(testServer, repository.NewOrganizationRepository(testServer))
+	ctx := context.Background()
+	owner, err := authSvc.RegisterUser(ctx, "owner@example.com", "Correct1Horse", "")
+	require.NoError(t, err)
+	member, err := authSvc.RegisterUser(ctx, "member@example.com", "Correct1Horse", "")
+	require.NoError(t, err)
+
+	acme, err := orgSvc.Create(ctx, owner, "Acme Corp", "")
+	require.NoError(t, err)
+	require.Equal(t, "acme-corp", acme.Slug)
+	_, err = orgSvc.Create(ctx, member, "Acme", "acme-corp")
+	require.ErrorIs(t, err, repository.ErrSlugTaken)
+	globex, err := orgSvc.Create(ctx, member, "Globex", "")
+	require.NoError(t, err)
+
+	// Tenant-scoped calls refuse to run without an organization.
+	_, err = orgSvc.Members(ctx)
+	require.ErrorIs(t, err, tenant.ErrNoOrganization)
+
+	// Users join by redeeming an invitation; admins cannot add them directly.
+	acmeCtx := tenant.WithOrganization(ctx, acme.ID.String())
+	require.ErrorIs(t, orgSvc.SetMember(acmeCtx, member, "member"), repository.ErrMemberNotFound)
+	_, err = authSvc.CreateOrganizationInvitation(acmeCtx, svc.OrganizationInvitationParams{Role: "owner"})
+	require.ErrorIs(t, err, svc.ErrInvalidOrganizationRole)
+	bound, err := authSvc.CreateOrganizationInvitation(acmeCtx, svc.OrganizationInvitationParams{Email: "someone-else@example.com", Role: "member"})
+	require.NoError(t, err)
+	_, err = authSvc.AcceptOrganizationInvitation(ctx, member, bound.Code)
+	require.ErrorIs(t, err, svc.ErrInvalidInvitation)
+	inv, err := authSvc.CreateOrganizationInvitation(acmeCtx, svc.OrganizationInvitationParams{Role: "member", CreatedBy: owner})
+	require.NoError(t, err)
+	_, err = authSvc.RegisterUser(ctx, "gatecrasher@example.com", "Correct1Horse", inv.Code)
+	require.ErrorIs(t, err, svc.ErrInvalidInvitation)
+	_, err = authSvc.AcceptOrganizationInvitation(ctx, owner, inv.Code)
+	require.ErrorIs(t, err, svc.ErrAlreadyOrganizationMember)
+	joined, err := authSvc.AcceptOrganizationInvitation(ctx, member, inv.Code)
+	require.NoError(t, err)
+	require.Equal(t, acme.ID.String(), joined)
+	_, err = authSvc.AcceptOrganizationInvitation(ctx, member, inv.Code)
+	require.ErrorIs(t, err, svc.ErrInvalidInvitation)
+	invitations, err := authSvc.ListOrganizationInvitations(acmeCtx)
+	require.NoError(t, err)
+	require.Len(t, invitations, 2)
+	require.NoError(t, authSvc.RevokeOrganizationInvitation(acmeCtx, bound.ID))
+	require.ErrorIs(t, authSvc.RevokeOrganizationInvitation(tenant.WithOrganization(ctx, globex.ID.String()), inv.ID), svc.ErrInvitationNotFound)
+	registrationInvitations, err := authSvc.ListInvitations(ctx)
+	require.NoError(t, err)
+	require.Empty(t, registrationInvitations)
+
+	require.NoError(t, orgSvc.SetMember(acmeCtx, member, "member"))
+	require.ErrorIs(t, orgSvc.SetMember(acmeCtx, member, "owner"), svc.ErrInvalidOrganizationRole)
+	members, err := orgSvc.Members(acmeCtx)
+	require.NoError(t, err)
+	require.Len(t, members, 2)
+	globexMembers, err := orgSvc.Members(tenant.WithOrganization(ctx, globex.ID.String()))
+	require.NoError(t, err)
+	require.Len(t, globexMembers, 1)
+
+	require.ErrorIs(t, orgSvc.RemoveMember(acmeCtx, owner), svc.ErrLastOrganizationAdmin)
+	require.ErrorIs(t, orgSvc.SetMember(acmeCtx, owner, "member"), svc.ErrLastOrganizationAdmin)
+
+	orgs, err := orgSvc.ListForUser(ctx, member)
+	require.NoError(t, err)
+	require.Len(t, orgs, 2)
+
+	auth := middleware.NewAuthMiddleware(testServer)
+	call := func(userID, orgRef string, roles ...string) (int, echo.Context) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if orgRef != "" {
+			req.Header.Set(middleware.OrganizationHeader, orgRef)
+		}
+		c := e.NewContext(req, httptest.NewRecorder())
+		c.Set(middleware.UserIDKey, userID)
+		next := func(c echo.Context) error { return nil }
+		if len(roles) > 0 {
+			next = auth.RequireOrganizationRole(roles...)(next)
+		}
+		if err := auth.RequireOrganization(next)(c); err != nil {
+			var httpErr *errs.HTTPError
+			require.True(t, errors.As(err, &httpErr))
+			return httpErr.Status, c
+		}
+		return http.StatusOK, c
+	}
+
+	code, _ := call(member, "")
+	require.Equal(t, http.StatusBadRequest, code)
+	code, c := call(member, "acme-corp")
+	require.Equal(t, http.StatusForbidden, code)
+	code, c = call(member, acme.ID.String())
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, acme.ID.String(), middleware.GetOrganizationID(c))
+	orgID, err := tenant.OrganizationID(c.Request().Context())
+	require.NoError(t, err)
+	require.Equal(t, acme.ID.String(), orgID)
+	code, _ = call(member, acme.ID.String(), "admin")
+	require.Equal(t, http.StatusForbidden, code)
+	code, _ = call(owner, globex.ID.String())
+	require.Equal(t, http.StatusForbidden, code)
+
+	// Soft-deleted users lose access before their memberships are purged.
+	_, err = testDB.Pool.Exec(ctx, `UPDATE users SET deleted_at = now() WHERE id::text = $1`, member)
+	require.NoError(t, err)
+	code, _ = call(member, acme.ID.String())
+	require.Equal(t, http.StatusForbidden, code)
+	orgs, err = orgSvc.ListForUser(ctx, member)
+	require.NoError(t, err)
+	require.Empty(t, orgs)
+	_, err = testDB.Pool.Exec(ctx, `UPDATE users SET deleted_at = NULL WHERE id::text = $1`, member)
+	require.NoError(t, err)
+
+	// Memberships synced from Clerk resolve users and organizations by
+	// their Clerk IDs.
+	require.NoError(t, authSvc.SyncClerkUser(ctx, svc.ClerkUser{ID: "user_clerk_org", Email: "clerk-org@example.com"}))
+	require.NoError(t, orgSvc.SyncClerkOrganization(ctx, svc.ClerkOrganization{ID: "org_123", Name: "Initech", Slug: "initech"}))
+	m := svc.ClerkMembership{ID: "orgmem_1", OrganizationID: "org_123", UserID: "user_clerk_org", Role: "org:admin"}
+	require.NoError(t, orgSvc.SyncClerkMembership(ctx, m))
+	code, c = call("user_clerk_org", "org_123", "admin")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "admin", c.Get(middleware.OrganizationRoleKey))
+	require.ErrorIs(t, orgSvc.SyncClerkMembership(ctx, svc.ClerkMembership{ID: "orgmem_2", OrganizationID: "org_123", UserID: "user_unknown"}), repository.ErrUserNotFound)
+
+	require.NoError(t, orgSvc.DeleteClerkMembership(ctx, m))
+	code, _ = call("user_clerk_org", "org_123")
+	require.Equal(t, http.StatusForbidden, code)
+	require.NoError(t, orgSvc.SyncClerkMembership(ctx, m))
+	require.NoError(t, orgSvc.DeleteClerkOrganization(ctx, "org_123"))
+	code, _ = call("user_clerk_org", "org_123")
+	require.Equal(t, http.StatusForbidden, code)
+}
+
+func TestInviteOnlyRegistration(t *testing.T) {
+	_, testServer, cleanup := testhelpers.SetupTest(t)
+	defer cleanup()
+
+	cfg := testServer.GetConfig()
+	cfg.Auth.RegistrationMode = config.RegistrationInviteOnly
+	authSvc := svc.NewAuthService(testServer)
+	ctx := context.Background()
+
+	_, err := authSvc.RegisterUser(ctx, "nocode@example.com", "Correct1Horse", "")
+	require.ErrorIs(t, err, svc.ErrInvitationRequired)
+
+	_, err = authSvc.CreateInvitation(ctx, svc.InvitationParams{Role: "wizard"})
+	require.ErrorIs(t, err, svc.ErrRoleNotFound)
+
+	// A single-use code bound to an address that grants a role.
+	bound, err := authSvc.CreateInvitation(ctx, svc.InvitationParams{Email: "Support@Example.com", Role: "support", CreatedBy: "admin-1"})
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(bound.Code, apikey.InvitationPrefix))
+	_, err = authSvc.RegisterUser(ctx, "someone@example.com", "Correct1Horse", bound.Code)
+	require.ErrorIs(t, err, svc.ErrInvalidInvitation)
+	supportID, err := authSvc.RegisterUser(ctx, "support@example.com", "Correct1Horse", bound.Code)
+	require.NoError(t, err)
+	roles, err := authSvc.UserRoles(ctx, supportID)
+	require.NoError(t, err)
+	require.Equal(t, []string{"support"}, roles)
+	_, err = authSvc.RegisterUser(ctx, "support2@example.com", "Correct1Horse", bound.Code)
+	require.ErrorIs(t, err, svc.ErrInvalidInvitation)
+
+	// A registration that fails does not use up the code.
+	spare, err := authSvc.CreateInvitation(ctx, svc.InvitationParams{})
+	require.NoError(t, err)
+	_, err = authSvc.RegisterUser(ctx, "support@example.com", "Correct1Horse", spare.Code)
+	require.Error(t, err)
+	_, err = authSvc.RegisterUser(ctx, "spare@example.com", "Correct1Horse", spare.Code)
+	require.NoError(t, err)
+
+	// An N-use code cannot be redeemed more than N times, even concurrently.
+	multi, err := authSvc.CreateInvitation(ctx, svc.InvitationParams{MaxUses: 2})
+	require.NoError(t, err)
+	results := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		go func(i int) {
+			_, err := authSvc.RegisterUser(ctx, fmt.Sprintf("beta%d@example.com", i), "Correct1Horse", multi.Code)
+			results <- err
+		}(i)
+	}
+	var ok, rejected int
+	for i := 0; i < 4; i++ {
+		if err := <-results; err == nil {
+			ok++
+		} else {
+			require.ErrorIs(t, err, svc.ErrInvalidInvitation)
+			rejected++
+		}
+	}
+	require.Equal(t, 2, ok)
+	require.Equal(t, 2, rejected)
+
+	revoked, err := authSvc.CreateInvitation(ctx, svc.InvitationParams{})
+	require.NoError(t, err)
+	require.NoError(t, authSvc.RevokeInvitation(ctx, revoked.ID))
+	require.ErrorIs(t, authSvc.RevokeInvitation(ctx, revoked.ID), svc.ErrInvitationNotFound)
+	_, err = authSvc.RegisterUser(ctx, "late@example.com", "Correct1Horse", revoked.Code)
+	require.ErrorIs(t, err, svc.ErrInvalidInvitation)
+
+	invitations, err := authSvc.ListInvitations(ctx)
+	require.NoError(t, err)
+	require.Len(t, invitations, 4)
+
+	cfg.Auth.RegistrationMode = config.RegistrationClosed
+	_, err = authSvc.RegisterUser(ctx, "closed@example.com", "Correct1Horse", multi.Code)
+	require.ErrorIs(t, err, svc.ErrRegistrationClosed)
+}
+
+func TestImpersonationIsAudited(t *testing.T) {
+	_, testServer, cleanup := testhelpers.SetupTest(t)
+	defer cleanup()
+
+	authSvc := svc.NewAuthService(testServer)
+	ctx := context.Background()
+	adminID, err := authSvc.RegisterUser(ctx, "support-admin@example.com", "Correct1Horse", "")
+	require.NoError(t, err)
+	userID, err := authSvc.RegisterUser(ctx, "customer@example.com", "Correct1Horse", "")
+	require.NoError(t, err)
+
+	meta := svc.SessionMeta{IPAddress: "203.0.113.9", UserAgent: "support-console"}
+	_, err = authSvc.StartImpersonation(ctx, adminID, userID, " ", meta)
+	require.ErrorIs(t, err, svc.ErrImpersonationReasonRequired)
+	_, err = authSvc.StartImpersonation(ctx, adminID, adminID, "ticket 42", meta)
+	require.ErrorIs(t, err, svc.ErrCannotImpersonate)
+
+	// Support staff cannot open a session as someone with more permissions.
+	require.NoError(t, authSvc.AssignRole(ctx, adminID, "support", ""))
+	rootID, err := authSvc.RegisterUser(ctx, "root@example.com", "Correct1Horse", "")
+	require.NoError(t, err)
+	require.NoError(t, authSvc.AssignRole(ctx, rootID, "admin", ""))
+	_, err = authSvc.StartImpersonation(ctx, adminID, rootID, "ticket 42", meta)
+	require.ErrorIs(t, err, svc.ErrImpersonationNotAllowed)
+
+	session, err := authSvc.StartImpersonation(ctx, adminID, userID, "ticket 42", meta)
+	require.NoError(t, err)
+	require.Equal(t, userID, session.UserID)
+	require.Empty(t, session.RefreshToken)
+
+	auth := middleware.NewAuthMiddleware(testServer)
+	call := func(next echo.HandlerFunc) (int, echo.Context) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodDelete, "/", nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+session.AccessToken)
+		c := e.NewContext(req, httptest.NewRecorder())
+		if err := auth.RequireAuth(next)(c); err != nil {
+			var httpErr *errs.HTTPError
+			require.True(t, errors.As(err, &httpErr))
+			return httpErr.Status, c
+		}
+		return http.StatusOK, c
+	}
+
+	code, c := call(func(c echo.Context) error { return nil })
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, userID, middleware.GetUserID(c))
+	require.Equal(t, adminID, middleware.GetActorID(c))
+	code, _ = call(auth.DenyImpersonation(func(c echo.Context) error { return nil }))
+	require.Equal(t, http.StatusForbidden, code)
+
+	require.NoError(t, authSvc.StopImpersonation(ctx, session.ID, adminID, meta))
+	require.ErrorIs(t, authSvc.StopImpersonation(ctx, session.ID, adminID, meta), svc.ErrImpersonationSessionNotFound)
+	code, _ = call(func(c echo.Context) error { return nil })
+	require.Equal(t, http.StatusUnauthorized, code)
+
+	events, err := authSvc.ListImpersonationEvents(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	require.Equal(t, "stop", events[0].Action)
+	require.Equal(t, adminID, events[0].StoppedBy)
+	require.Equal(t, "start", events[1].Action)
+	require.Equal(t, "ticket 42", events[1].Reason)
+	require.Equal(t, adminID, events[1].ActorID)
+	require.Equal(t, session.ID, events[1].SessionID)
+
+	// Regular sessions cannot be stopped as impersonations.
+	regular, err := authSvc.Login(ctx, "customer@example.com", "Correct1Horse", meta)
+	require.NoError(t, err)
+	require.ErrorIs(t, authSvc.StopImpersonation(ctx, regular.ID, adminID, meta), svc.ErrImpersonationSessionNotFound)
+}
+
+func TestLoginHistoryAndNewDeviceAlert(t *testing.T) {
+	_, testServer, cleanup := testhelpers.SetupTest(t)
+	defer cleanup()
+
+	enqueuer := mocks.NewMockEnqueuer()
+	testhelpers.AttachMockEnqueuer(testServer, enqueuer)
+	authSvc := svc.NewAuthService(testServer)
+	ctx := context.Background()
+	email := "history@example.com"
+	userID, err := authSvc.RegisterUser(ctx, email, "Correct1Horse", "")
+	require.NoError(t, err)
+
+	signInAlerts := func() int {
+		n := 0
+		for _, task := range enqueuer.GetTasks() {
+			if task.Type() == job.TaskNewSignIn {
+				n++
+			}
+		}
+		return n
+	}
+
+	laptop := svc.SessionMeta{IPAddress: "203.0.113.1", UserAgent: "Firefox/128.0", RequestID: "req-1"}
+	_, err = authSvc.Login(ctx, email, "wrong-password", laptop)
+	require.ErrorIs(t, err, svc.ErrInvalidCredentials)
+	_, err = authSvc.Login(ctx, "nobody@example.com", "wrong-password", laptop)
+	require.ErrorIs(t, err, svc.ErrInvalidCredentials)
+
+	// The first login is not an alert; repeating it from the same device
+	// and address is not one either.
+	_, err = authSvc.Login(ctx, email, "Correct1Horse", laptop)
+	require.NoError(t, err)
+	_, err = authSvc.Login(ctx, email, "Correct1Horse", laptop)
+	require.NoError(t, err)
+	require.Equal(t, 0, signInAlerts())
+
+	phone := svc.SessionMeta{IPAddress: "198.51.100.2", UserAgent: "Mobile Safari/17.0", RequestID: "req-2"}
+	_, err = authSvc.Login(ctx, email, "Correct1Horse", phone)
+	require.NoError(t, err)
+	require.Equal(t, 1, signInAlerts())
+
+	events, err := authSvc.ListLoginEvents(ctx, svc.LoginEventFilter{UserID: userID})
+	require.NoError(t, err)
+	require.Len(t, events, 4)
+	require.True(t, events[0].Success)
+	require.True(t, events[0].NewDevice)
+	require.Equal(t, "req-2", events[0].RequestID)
+	require.Equal(t, svc.LoginMethodPassword, events[0].Method)
+	require.False(t, events[3].Success)
+	require.Equal(t, svc.LoginFailureInvalidCredentials, events[3].FailureReason)
+	require.Equal(t, "203.0.113.1", events[3].IPAddress)
+
+	failed := false
+	events, err = authSvc.ListLoginEvents(ctx, svc.LoginEventFilter{Email: "nobody@example.com", Success: &failed})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Empty(t, events[0].UserID)
+}
+
+func TestAccountDeletionGracePeriod(t *testing.T) {
+	_, testServer, cleanup := testhelpers.SetupTest(t)
+	defer cleanup()
+
+	enqueuer := mocks.NewMockEnqueuer()
+	testhelpers.AttachMockEnqueuer(testServer, enqueuer)
+	authSvc := svc.NewAuthService(testServer)
+	ctx := context.Background()
+	userID, err := authSvc.RegisterUser(ctx, "leaving@example.com", "Correct1Horse", "")
+	require.NoError(t, err)
+
+	countTasks := func(taskType string) int {
+		n := 0
+		for _, task := range enqueuer.GetTasks() {
+			if task.Type() == taskType {
+				n++
+			}
+		}
+		return n
+	}
+
+	status, err := authSvc.DeletionStatus(ctx, userID)
+	require.NoError(t, err)
+	require.Nil(t, status.ScheduledAt)
+	require.ErrorIs(t, authSvc.CancelDeletion(ctx, userID), svc.ErrDeletionNotScheduled)
+
+	when, err := authSvc.ScheduleDeletion(ctx, userID, 0)
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now().Add(svc.DefaultDeletionGracePeriod), when, time.Minute)
+	status, err = authSvc.DeletionStatus(ctx, userID)
+	require.NoError(t, err)
+	require.NotNil(t, status.ScheduledAt)
+	require.WithinDuration(t, when, *status.ScheduledAt, time.Second)
+	require.Equal(t, 1, countTasks(job.TaskUserDelete))
+	require.Equal(t, 1, countTasks(job.TaskDeletionScheduled))
+	deleteTask := func() *asynq.Task {
+		for _, task := range enqueuer.GetTasks() {
+			if task.Type() == job.TaskUserDelete {
+				return task
+			}
+		}
+		return nil
+	}
+	require.WithinDuration(t, when, enqueuer.ProcessAt(deleteTask()), time.Second)
+
+	// Rescheduling replaces the pending task.
+	later, err := authSvc.ScheduleDeletion(ctx, userID, 48*time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, 1, countTasks(job.TaskUserDelete))
+	require.WithinDuration(t, later, enqueuer.ProcessAt(deleteTask()), time.Second)
+
+	require.NoError(t, authSvc.CancelDeletion(ctx, userID))
+	require.Equal(t, 1, countTasks(job.TaskDeletionCancelled))
+	require.Zero(t, countTasks(job.TaskUserDelete))
+	status, err = authSvc.DeletionStatus(ctx, userID)
+	require.NoError(t, err)
+	require.Nil(t, status.ScheduledAt)
+
+	_, err = authSvc.ScheduleDeletion(ctx, "00000000-0000-0000-0000-000000000000", 0)
+	require.ErrorIs(t, err, svc.ErrUserNotFound)
+}
+
+func TestDataExport(t *testing.T) {
+	testDB, testServer, cleanup := testhelpers.SetupTest(t)
+	defer cleanup()
+
+	cfg := testServer.GetConfig()
+	require.NotNil(t, cfg)
+	cfg.Auth.TokenHMACSecret = "export-secret"
+	testServer.SetConfig(cfg)
+	testServer.Storage = storage.NewLocal(t.TempDir())
+
+	enqueuer := mocks.NewMockEnqueuer()
+	testhelpers.AttachMockEnqueuer(testServer, enqueuer)
+	authSvc := svc.NewAuthService(testServer)
+	ctx := context.Background()
+	userID, err := authSvc.RegisterUser(ctx, "export@example.com", "Correct1Horse", "")
+	require.NoError(t, err)
+
+	export, err := authSvc.RequestDataExport(ctx, userID)
+	require.NoError(t, err)
+	require.Equal(t, "pending", export.Status)
+	require.Len(t, enqueuer.GetTasks(), 1)
+	require.Equal(t, job.TaskUserExport, enqueuer.GetTasks()[0].Type())
+
+	// A second request while one is pending returns the same export.
+	again, err := authSvc.RequestDataExport(ctx, userID)
+	require.NoError(t, err)
+	require.Equal(t, export.ID, again.ID)
+	exports, err := authSvc.ListDataExports(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, exports, 1)
+
+	// The archive holds the profile without credentials.
+	var buf bytes.Buffer
+	require.NoError(t, userdata.Default.WriteExport(ctx, testDB.Pool, userID, &buf))
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		b, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+		files[f.Name] = string(b)
+	}
+	require.Contains(t, files, "manifest.json")
+	require.Contains(t, files["profile.json"], "export@example.com")
+	require.NotContains(t, files["profile.json"], "password_hash")
+
+	// Mark it ready as the user:export task would.
+	key := job.DataExportKey(export.ID)
+	require.NoError(t, testServer.Storage.Put(ctx, key, bytes.NewReader(buf.Bytes())))
+	_, err = testDB.Pool.Exec(ctx, `UPDATE data_exports SET status = 'ready', storage_key = $2, completed_at = now(),
+expires_at = now() + interval '1 day' WHERE id::text = $1`, export.ID, key)
+	require.NoError(t, err)
+
+	expiresAt := time.Now().Add(time.Hour)
+	sig := userdata.DownloadSignature("export-secret", export.ID, expiresAt)
+	archive, err := authSvc.DownloadDataExport(ctx, export.ID, expiresAt.Unix(), sig)
+	require.NoError(t, err)
+	data, err := io.ReadAll(archive)
+	require.NoError(t, err)
+	require.NoError(t, archive.Close())
+	require.Equal(t, buf.Bytes(), data)
+
+	_, err = authSvc.DownloadDataExport(ctx, export.ID, expiresAt.Unix(), userdata.DownloadSignature("other-secret", export.ID, expiresAt))
+	require.ErrorIs(t, err, svc.ErrInvalidDownloadLink)
+	past := time.Now().Add(-time.Minute)
+	_, err = authSvc.DownloadDataExport(ctx, export.ID, past.Unix(), userdata.DownloadSignature("export-secret", export.ID, past))
+	require.ErrorIs(t, err, svc.ErrInvalidDownloadLink)
+}
+
+func TestPurgeDeletedUsers(t *testing.T) {
+	testDB, testServer, cleanup := testhelpers.SetupTest(t)
+	defer cleanup()
+
+	authSvc := svc.NewAuthService(testServer)
+	ctx := context.Background()
+	oldID, err := authSvc.RegisterUser(ctx, "purged@example.com", "Correct1Horse", "")
+	require.NoError(t, err)
+	recentID, err := authSvc.RegisterUser(ctx, "recent@example.com", "Correct1Horse", "")
+	require.NoError(t, err)
+	activeID, err := authSvc.RegisterUser(ctx, "active@example.com", "Correct1Horse", "")
+	require.NoError(t, err)
+
+	_, err = testDB.Pool.Exec(ctx, `UPDATE users SET deleted_at = now() - interval '40 days', email = NULL, password_hash = NULL WHERE id::text = $1`, oldID)
+	require.NoError(t, err)
+	_, err = testDB.Pool.Exec(ctx, `UPDATE users SET deleted_at = now() - interval '1 day', email = NULL, password_hash = NULL WHERE id::text = $1`, recentID)
+	require.NoError(t, err)
+	_, err = testDB.Pool.Exec(ctx, `INSERT INTO data_exports (user_id, status, storage_key) VALUES ($1::uuid, 'ready', 'exports/old.zip')`, oldID)
+	require.NoError(t, err)
+
+	res, err := userdata.PurgeDeletedUsers(ctx, testDB.Pool, time.Now().Add(-30*24*time.Hour), 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{oldID}, res.UserIDs)
+	require.Equal(t, []string{"exports/old.zip"}, res.FileKeys)
+
+	var n int
+	require.NoError(t, testDB.Pool.QueryRow(ctx, `SELECT count(*) FROM users WHERE id::text = $1`, oldID).Scan(&n))
+	require.Equal(t, 0, n)
+	require.NoError(t, testDB.Pool.QueryRow(ctx, `SELECT count(*) FROM data_exports WHERE user_id::text = $1`, oldID).Scan(&n))
+	require.Equal(t, 0, n)
+	var deletedAt time.Time
+	require.NoError(t, testDB.Pool.QueryRow(ctx, `SELECT deleted_at FROM user_tombstones WHERE user_id::text = $1`, oldID).Scan(&deletedAt))
+	require.WithinDuration(t, time.Now().Add(-40*24*time.Hour), deletedAt, time.Minute)
+
+	// Users deleted within the retention period and active users stay.
+	require.NoError(t, testDB.Pool.QueryRow(ctx, `SELECT count(*) FROM users WHERE id::text IN ($1, $2)`, recentID, activeID).Scan(&n))
+	require.Equal(t, 2, n)
+
+	res, err = userdata.PurgeDeletedUsers(ctx, testDB.Pool, time.Now().Add(-30*24*time.Hour), 10)
+	require.NoError(t, err)
+	require.Empty(t, res.UserIDs)
+}
+
+func TestDefaultDeletionHooks(t *testing.T) {
+	testDB, testServer, cleanup := testhelpers.SetupTest(t)
+	defer cleanup()
+
+	authSvc := svc.NewAuthService(testServer)
+	ctx := context.Background()
+	userID, err := authSvc.RegisterUser(ctx, "hooks@example.com", "Correct1Horse", "")
+	require.NoError(t, err)
+	_, err = authSvc.Login(ctx, "hooks@example.com", "Correct1Horse", svc.SessionMeta{UserAgent: "test", IPAddress: "127.0.0.1"})
+	require.NoError(t, err)
+	_, err = testDB.Pool.Exec(ctx, `UPDATE users SET first_name = 'Ada', raw_payload = '{"name": "Ada"}' WHERE id::text = $1`, userID)
+	require.NoError(t, err)
+
+	logger := zerolog.Nop()
+	tx, err := testDB.Pool.Begin(ctx)
+	require.NoError(t, err)
+	require.NoError(t, userdata.Default.RunDeletionHooks(ctx, tx, userID, &logger))
+	require.NoError(t, tx.Commit(ctx))
+
+	var email, firstName *string
+	var payload string
+	require.NoError(t, testDB.Pool.QueryRow(ctx, `SELECT email, first_name, raw_payload::text FROM users WHERE id::text = $1`, userID).
+		Scan(&email, &firstName, &payload))
+	require.Nil(t, email)
+	require.Nil(t, firstName)
+	require.Equal(t, "{}", payload)
+	for _, table := range []string{"sessions", "login_events"} {
+		var n int
+		require.NoError(t, testDB.Pool.QueryRow(ctx, `SELECT count(*) FROM `+table+` WHERE user_id::text = $1`, userID).Scan(&n))
+		require.Zero(t, n, table)
+	}
+}
+
+func TestRestoreDeletedAccount(t *testing.T) {
+	testDB, testServer, cleanup := testhelpers.SetupTest(t)
+	defer cleanup()
+
+	cfg := testServer.GetConfig()
+	require.NotNil(t, cfg)
+	cfg.Auth.TokenHMACSecret = "restore-secret"
+	cfg.Auth.EscrowEncryptionKey = "escrow-key"
+	testServer.SetConfig(cfg)
+
+	enqueuer := mocks.NewMockEnqueuer()
+	testhelpers.AttachMockEnqueuer(testServer, enqueuer)
+	authSvc := svc.NewAuthService(testServer)
+	ctx := context.Background()
+	logger := zerolog.Nop()
+	escrow := &userdata.Escrow{Keys: []string{"escrow-key"}, DigestSecret: "restore-secret", ExpiresAt: time.Now().Add(time.Hour)}
+	deleteNow := func(userID string) {
+		t.Helper()
+		_, err := testDB.Pool.Exec(ctx, `UPDATE users SET deletion_scheduled_at = now() - interval '1 minute' WHERE id::text = $1`, userID)
+		require.NoError(t, err)
+		deleted, err := userdata.Default.DeleteDueUser(ctx, testDB.Pool, userID, escrow, &logger)
+		require.NoError(t, err)
+		require.True(t, deleted)
+	}
+
+	userID, err := authSvc.RegisterUser(ctx, "restore@example.com", "Correct1Horse", "")
+	require.NoError(t, err)
+	_, err = testDB.Pool.Exec(ctx, `UPDATE users SET first_name = 'Ada' WHERE id::text = $1`, userID)
+	require.NoError(t, err)
+	require.ErrorIs(t, authSvc.RestoreAccount(ctx, userID), svc.ErrAccountNotRestorable)
+
+	deleteNow(userID)
+	_, err = authSvc.Login(ctx, "restore@example.com", "Correct1Horse", svc.SessionMeta{})
+	require.Error(t, err)
+
+	// Self-service: the link is only sent for an address with an escrow.
+	_, err = authSvc.RequestAccountRestore(ctx, "unknown@example.com")
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	raw, err := authSvc.RequestAccountRestore(ctx, "Restore@Example.com")
+	require.NoError(t, err)
+	tasks := enqueuer.GetTasks()
+	require.Equal(t, job.TaskAccountRestore, tasks[len(tasks)-1].Type())
+
+	restoredID, err := authSvc.ConsumeAccountRestore(ctx, raw)
+	require.NoError(t, err)
+	require.Equal(t, userID, restoredID)
+	_, err = authSvc.ConsumeAccountRestore(ctx, raw)
+	require.ErrorIs(t, err, svc.ErrInvalidRestoreToken)
+
+	_, err = authSvc.Login(ctx, "restore@example.com", "Correct1Horse", svc.SessionMeta{})
+	require.NoError(t, err)
+	var firstName string
+	require.NoError(t, testDB.Pool.QueryRow(ctx, `SELECT first_name FROM users WHERE id::text = $1`, userID).Scan(&firstName))
+	require.Equal(t, "Ada", firstName)
+
+	// An address taken over since the deletion blocks the restore.
+	deleteNow(userID)
+	secondID, err := authSvc.RegisterUser(ctx, "restore@example.com", "Correct1Horse", "")
+	require.NoError(t, err)
+	require.ErrorIs(t, authSvc.RestoreAccount(ctx, userID), svc.ErrRestoreConflict)
+
+	// With two escrows for the address, the link restores the newest.
+	_, err = testDB.Pool.Exec(ctx, `UPDATE user_escrows SET created_at = now() - interval '1 hour' WHERE user_id::text = $1`, userID)
+	require.NoError(t, err)
+	deleteNow(secondID)
+	raw, err = authSvc.RequestAccountRestore(ctx, "restore@example.com")
+	require.NoError(t, err)
+	restoredID, err = authSvc.ConsumeAccountRestore(ctx, raw)
+	require.NoError(t, err)
+	require.Equal(t, secondID, restoredID)
+	require.ErrorIs(t, authSvc.RestoreAccount(ctx, userID), svc.ErrRestoreConflict)
+
+	// Past the recovery window the escrow is gone.
+	_, err = testDB.Pool.Exec(ctx, `UPDATE user_escrows SET expires_at = now() - interval '1 second' WHERE user_id::text = $1`, userID)
+	require.NoError(t, err)
+	require.ErrorIs(t, authSvc.RestoreAccount(ctx, userID), svc.ErrAccountNotRestorable)
+	n, err := userdata.DeleteExpiredEscrows(ctx, testDB.Pool)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, n)
+}
+
 func TestRequestPasswordReset_StoresHMACAndResetSucceeds(t *testing.T) {
 	testDB, testServer, cleanup := testhelpers.SetupTest(t)
 	defer cleanup()
@@ -124,7 +1551,7 @@ func TestRequestPasswordReset_StoresHMACAndResetSucceeds(t *testing.T) {
 	ctx := context.Background()
 	// create a user
 	email := "hmac-test@example.com"
-	id, err := authSvc.RegisterUser(ctx, email, "Password1")
+	id, err := authSvc.RegisterUser(ctx, email, "Password1", "")
 	require.NoError(t, err)
 	require.NotEmpty(t, id)
 
@@ -166,7 +1593,7 @@ func TestRotateTokenHMACSecrets(t *testing.T) {
 
 	ctx := context.Background()
 	email := "rotate-test@example.com"
-	_, err := authSvc.RegisterUser(ctx, email, "Password1")
+	_, err := authSvc.RegisterUser(ctx, email, "Password1", "")
 	require.NoError(t, err)
 
 	// create token with old secret
@@ -253,7 +1680,7 @@ func TestSyncUserUpserts_ClerkIDOnly(t *testing.T) {
 	var gotLastName string
 	var gotImage string
 
-	row := testDB.Pool.QueryRow(ctx, `SELECT clerk_id, external_id, first_name, last_name, image_url FROM users WHERE clerk_id=$1`, clerkID)
+	row := testDB.Pool.QueryRow(ctx, `SELECT clerk_id, COALESCE(external_id, ''), first_name, last_name, image_url FROM users WHERE clerk_id=$1`, clerkID)
 	err = row.Scan(&gotClerkID, &gotExternalID, &gotFirstName, &gotLastName, &gotImage)
 	require.NoError(t, err)
 	require.Equal(t, clerkID, gotClerkID)
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/petonlabs/go-boilerplate/internal/lib/job"
+	"github.com/petonlabs/go-boilerplate/internal/lib/storage"
+	"github.com/petonlabs/go-boilerplate/internal/lib/userdata"
+)
+
+// ErrInvalidDownloadLink is returned for download links with a bad
+// signature, that have expired, or whose archive is gone.
+var ErrInvalidDownloadLink = errors.New("download link is invalid or has expired")
+
+// DataExport is a "download my data" request. The archive is built by the
+// user:export task and emailed as a signed link.
+type DataExport struct {
+	ID          string     `json:"id"`
+	Status      string     `json:"status"`
+	SizeBytes   *int64     `json:"size_bytes,omitempty"`
+	RequestedAt time.Time  `json:"requested_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+const dataExportColumns = `id::text, status, size_bytes, requested_at, completed_at, expires_at`
+
+func scanDataExport(row interface{ Scan(...any) error }) (*DataExport, error) {
+	var e DataExport
+	if err := row.Scan(&e.ID, &e.Status, &e.SizeBytes, &e.RequestedAt, &e.CompletedAt, &e.ExpiresAt); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// RequestDataExport queues an export of everything held about userID. While
+// an export is in progress it is returned instead of queuing another.
+func (a *AuthService) RequestDataExport(ctx context.Context, userID string) (*DataExport, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	if a.server.Job == nil || a.server.Job.Client == nil {
+		return nil, fmt.Errorf("job queue not initialized")
+	}
+
+	var id string
+	err := a.server.DB.Pool.QueryRow(ctx, `SELECT id::text FROM users WHERE (id::text = $1 OR clerk_id = $1) AND deleted_at IS NULL`,
+		userID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	export, err := scanDataExport(a.server.DB.Pool.QueryRow(ctx, `INSERT INTO data_exports (user_id) VALUES ($1::uuid)
+ON CONFLICT (user_id) WHERE status = 'pending' DO NOTHING
+RETURNING `+dataExportColumns, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return scanDataExport(a.server.DB.Pool.QueryRow(ctx, `SELECT `+dataExportColumns+`
+FROM data_exports WHERE user_id = $1::uuid AND status = 'pending'`, id))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	task, err := job.NewUserExportTask(export.ID, id)
+	if err == nil {
+		_, err = a.server.Job.Client.Enqueue(task)
+	}
+	if err != nil {
+		// Let the user try again rather than wait for a task that never runs.
+		_, _ = a.server.DB.Pool.Exec(ctx, `DELETE FROM data_exports WHERE id::text = $1`, export.ID)
+		return nil, fmt.Errorf("enqueue data export: %w", err)
+	}
+	return export, nil
+}
+
+// ListDataExports returns userID's export requests, newest first.
+func (a *AuthService) ListDataExports(ctx context.Context, userID string) ([]DataExport, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	rows, err := a.server.DB.Pool.Query(ctx, `SELECT e.id::text, e.status, e.size_bytes, e.requested_at, e.completed_at, e.expires_at
+FROM data_exports e JOIN users u ON u.id = e.user_id
+WHERE (u.id::text = $1 OR u.clerk_id = $1)
+ORDER BY e.requested_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exports := []DataExport{}
+	for rows.Next() {
+		e, err := scanDataExport(rows)
+		if err != nil {
+			return nil, err
+		}
+		exports = append(exports, *e)
+	}
+	return exports, rows.Err()
+}
+
+// DownloadDataExport checks a signed download link (see
+// userdata.DownloadURL) and opens the archive. The caller streams it and
+// must close it.
+func (a *AuthService) DownloadDataExport(ctx context.Context, exportID string, expires int64, signature string) (io.ReadCloser, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	if a.server.Storage == nil {
+		return nil, fmt.Errorf("storage not initialized")
+	}
+	if !userdata.VerifyDownload(a.tokenKeyRing(), exportID, time.Unix(expires, 0), signature, time.Now()) {
+		return nil, ErrInvalidDownloadLink
+	}
+
+	var key string
+	err := a.server.DB.Pool.QueryRow(ctx, `SELECT storage_key FROM data_exports
+WHERE id::text = $1 AND status = 'ready' AND storage_key IS NOT NULL AND expires_at > now()`, exportID).Scan(&key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidDownloadLink
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := a.server.Storage.Open(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrInvalidDownloadLink
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
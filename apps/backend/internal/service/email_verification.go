@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/petonlabs/go-boilerplate/internal/lib/job"
+)
+
+// DefaultEmailVerificationTTL is used when Auth.EmailVerificationTTL is not configured.
+const DefaultEmailVerificationTTL = 24 * time.Hour
+
+var (
+	ErrInvalidEmailVerificationToken = errors.New("invalid email verification token")
+	ErrExpiredEmailVerificationToken = errors.New("email verification token expired")
+	// ErrEmailNotVerified is returned by Login when Auth.RequireEmailVerification
+	// is set and the account has not confirmed its email address.
+	ErrEmailNotVerified = errors.New("email address not verified")
+)
+
+// RequestEmailVerification issues a new verification token for an unverified
+// account and enqueues the verification email. Any previously issued token
+// stops working. sql.ErrNoRows is returned when there is no unverified
+// account for email so callers can respond without revealing which it was.
+func (a *AuthService) RequestEmailVerification(ctx context.Context, email string) (string, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return "", fmt.Errorf("database not initialized")
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	digest, err := a.hashToken(token)
+	if err != nil {
+		return "", err
+	}
+	expiresAt := time.Now().Add(a.emailVerificationTTL())
+
+	ct, err := a.server.DB.Pool.Exec(ctx, `UPDATE users SET email_verification_token = $1, email_verification_expires = $2
+WHERE email = $3 AND deleted_at IS NULL AND email_verified IS NOT TRUE`, digest, expiresAt, email)
+	if err != nil {
+		return "", fmt.Errorf("failed to set email verification token: %w", err)
+	}
+	if ct.RowsAffected() == 0 {
+		return "", sql.ErrNoRows
+	}
+
+	a.enqueueEmailVerification(email, token, expiresAt)
+	return token, nil
+}
+
+// VerifyEmail consumes a verification token and marks the owning account's
+// email address as verified.
+func (a *AuthService) VerifyEmail(ctx context.Context, token string) error {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	if token == "" {
+		return ErrInvalidEmailVerificationToken
+	}
+	digests := a.tokenDigests(token)
+	if len(digests) == 0 {
+		return ErrInvalidEmailVerificationToken
+	}
+
+	var id string
+	var exp sql.NullTime
+	err := a.server.DB.Pool.QueryRow(ctx, `SELECT id::text, email_verification_expires FROM users
+WHERE email_verification_token = ANY($1) AND deleted_at IS NULL`, digests).Scan(&id, &exp)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidEmailVerificationToken
+		}
+		return err
+	}
+	if !exp.Valid {
+		return ErrInvalidEmailVerificationToken
+	}
+	if time.Now().After(exp.Time) {
+		return ErrExpiredEmailVerificationToken
+	}
+
+	// Clearing the token in the same statement makes it single-use even if
+	// two requests race on it.
+	ct, err := a.server.DB.Pool.Exec(ctx, `UPDATE users SET email_verified = TRUE, email_verification_token = NULL, email_verification_expires = NULL
+WHERE id::text = $1 AND email_verification_token = ANY($2)`, id, digests)
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return ErrInvalidEmailVerificationToken
+	}
+	return nil
+}
+
+// enqueueEmailVerification hands the raw token to the job queue. Failures are
+// logged only: the user can always ask for the email to be sent again.
+func (a *AuthService) enqueueEmailVerification(email, token string, expiresAt time.Time) {
+	if a.server.Job == nil || a.server.Job.Client == nil {
+		return
+	}
+	task, err := job.NewEmailVerificationTask(email, token, expiresAt.Unix())
+	if err == nil {
+		_, err = a.server.Job.Client.Enqueue(task)
+	}
+	if err != nil && a.server.Logger != nil {
+		a.server.Logger.Error().Err(err).Msg("failed to enqueue email verification")
+	}
+}
+
+func (a *AuthService) emailVerificationTTL() time.Duration {
+	if a.server != nil {
+		if cfg := a.server.GetConfig(); cfg != nil && cfg.Auth.EmailVerificationTTL > 0 {
+			return time.Duration(cfg.Auth.EmailVerificationTTL) * time.Second
+		}
+	}
+	return DefaultEmailVerificationTTL
+}
+
+func (a *AuthService) requireEmailVerification() bool {
+	if a.server == nil {
+		return false
+	}
+	cfg := a.server.GetConfig()
+	return cfg != nil && cfg.Auth.RequireEmailVerification
+}
@@ -0,0 +1,321 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// IdentityProviderClerk is the provider name of identities synced from Clerk.
+// OIDC identities use the name of the configured provider.
+const IdentityProviderClerk = "clerk"
+
+var (
+	ErrIdentityNotFound = errors.New("identity not found")
+	// ErrLastLoginMethod is returned when unlinking an identity or deleting a
+	// passkey would leave the user without a password, passkey or linked
+	// identity.
+	ErrLastLoginMethod = errors.New("last remaining login method")
+)
+
+// Identity is an external identity attached to a user. Pending identities
+// matched the user's email without the provider verifying it and are not used
+// until the user confirms them.
+type Identity struct {
+	ID            string     `json:"id"`
+	Provider      string     `json:"provider"`
+	Email         string     `json:"email,omitempty"`
+	EmailVerified bool       `json:"email_verified"`
+	Pending       bool       `json:"pending"`
+	CreatedAt     time.Time  `json:"created_at"`
+	LinkedAt      *time.Time `json:"linked_at,omitempty"`
+	LastUsedAt    *time.Time `json:"last_used_at,omitempty"`
+}
+
+// ClerkUser is the part of a Clerk user object that is mirrored locally.
+type ClerkUser struct {
+	ID            string
+	ExternalID    string
+	Email         string
+	EmailVerified bool
+	FirstName     string
+	LastName      string
+	ImageURL      string
+	Role          string
+	RawPayload    []byte
+}
+
+// SyncClerkUser mirrors a Clerk user into the users table. A user already
+// linked to the Clerk account (or matching its clerk_id or external_id) is
+// updated. Otherwise a local user with the same email is linked when both
+// Clerk and the local account have verified the address; when either has
+// not, a pending identity is recorded for the local user to confirm and no
+// second account is created. Users with no match at all are created.
+func (a *AuthService) SyncClerkUser(ctx context.Context, u ClerkUser) error {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	if u.ID == "" && u.ExternalID == "" {
+		return nil
+	}
+
+	tx, err := a.server.DB.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	userID, linked, err := clerkUserID(ctx, tx, u)
+	if errors.Is(err, sql.ErrNoRows) {
+		userID, linked, err = linkOrCreateClerkUser(ctx, tx, u)
+	}
+	if err != nil {
+		return err
+	}
+	if !linked {
+		return tx.Commit(ctx)
+	}
+
+	// The email is only taken over when no other account uses it, so a
+	// change in Clerk cannot collide with a local user. The role is only
+	// taken over when it changed in Clerk, so that roles removed locally
+	// stay removed.
+	if _, err := tx.Exec(ctx, `UPDATE users SET
+		email = CASE WHEN $2 = '' OR EXISTS (SELECT 1 FROM users o WHERE o.email = $2 AND o.id <> users.id) THEN users.email ELSE $2 END,
+		clerk_id = COALESCE(clerk_id, NULLIF($3, '')),
+		external_id = COALESCE(external_id, NULLIF($4, '')),
+		first_name = COALESCE(NULLIF($5, ''), first_name),
+		last_name = COALESCE(NULLIF($6, ''), last_name),
+		image_url = COALESCE(NULLIF($7, ''), image_url),
+		role = CASE WHEN $8 <> '' AND clerk_role IS DISTINCT FROM $8 THEN $8 ELSE role END,
+		clerk_role = NULLIF($8, ''),
+		raw_payload = $9
+	WHERE id::text = $1`, userID, u.Email, u.ID, u.ExternalID, u.FirstName, u.LastName, u.ImageURL, u.Role, u.RawPayload); err != nil {
+		return err
+	}
+	if u.ID != "" {
+		if err := upsertIdentity(ctx, tx, userID, IdentityProviderClerk, u.ID, u.Email, u.EmailVerified, true); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	if u.Role != "" {
+		a.invalidatePermissions(ctx, userID, u.ID)
+	}
+	return nil
+}
+
+// SyncUser upserts a user record from Clerk webhook data without knowing
+// whether Clerk verified the email, so it never links by email alone.
+func (a *AuthService) SyncUser(ctx context.Context, clerkID, externalID, email, firstName, lastName, imageURL, role string, rawPayload []byte) error {
+	return a.SyncClerkUser(ctx, ClerkUser{
+		ID:         clerkID,
+		ExternalID: externalID,
+		Email:      email,
+		FirstName:  firstName,
+		LastName:   lastName,
+		ImageURL:   imageURL,
+		Role:       role,
+		RawPayload: rawPayload,
+	})
+}
+
+// clerkUserID finds the user already associated with the Clerk account and
+// reports whether the association is confirmed. A pending identity is
+// promoted once Clerk reports the matching email as verified, provided the
+// local account has verified it too.
+func clerkUserID(ctx context.Context, tx pgx.Tx, u ClerkUser) (string, bool, error) {
+	var userID, userEmail string
+	var linked, userVerified bool
+	err := tx.QueryRow(ctx, `SELECT i.user_id::text, COALESCE(u.email, ''), COALESCE(u.email_verified, FALSE), i.linked_at IS NOT NULL
+FROM user_identities i JOIN users u ON u.id = i.user_id WHERE i.provider = $1 AND i.provider_user_id = $2`,
+		IdentityProviderClerk, u.ID).Scan(&userID, &userEmail, &userVerified, &linked)
+	switch {
+	case err == nil:
+		if !linked {
+			linked = u.EmailVerified && userVerified && u.Email != "" && strings.EqualFold(u.Email, userEmail)
+			if err := upsertIdentity(ctx, tx, userID, IdentityProviderClerk, u.ID, u.Email, u.EmailVerified, linked); err != nil {
+				return "", false, err
+			}
+		}
+		return userID, linked, nil
+	case !errors.Is(err, sql.ErrNoRows):
+		return "", false, err
+	}
+
+	// Users synced before identities were tracked are matched on the
+	// identifiers stored on the row itself.
+	err = tx.QueryRow(ctx, `SELECT id::text FROM users
+WHERE ($1 <> '' AND lower(clerk_id) = lower($1)) OR ($2 <> '' AND lower(external_id) = lower($2)) LIMIT 1`,
+		u.ID, u.ExternalID).Scan(&userID)
+	if err != nil {
+		return "", false, err
+	}
+	return userID, true, nil
+}
+
+// linkOrCreateClerkUser handles a Clerk account seen for the first time. It
+// reports false when the account could only be recorded as a pending link.
+// Anyone can register an unverified local account for an address, so the
+// local row must have verified the email too: otherwise whoever registered
+// it would keep a password on the Clerk user's account.
+func linkOrCreateClerkUser(ctx context.Context, tx pgx.Tx, u ClerkUser) (string, bool, error) {
+	var userID string
+	var hasClerkID, userVerified bool
+	if u.Email != "" {
+		err := tx.QueryRow(ctx, `SELECT id::text, clerk_id IS NOT NULL, COALESCE(email_verified, FALSE) FROM users WHERE email = $1`, u.Email).Scan(&userID, &hasClerkID, &userVerified)
+		switch {
+		case err == nil:
+			if u.ID == "" {
+				// without a Clerk ID there is nothing to link
+				return userID, false, nil
+			}
+			linked := u.EmailVerified && userVerified && !hasClerkID
+			if err := upsertIdentity(ctx, tx, userID, IdentityProviderClerk, u.ID, u.Email, u.EmailVerified, linked); err != nil {
+				return "", false, err
+			}
+			return userID, linked, nil
+		case !errors.Is(err, sql.ErrNoRows):
+			return "", false, err
+		}
+	}
+
+	err := tx.QueryRow(ctx, `INSERT INTO users (email, email_verified, clerk_id, external_id, created_at)
+VALUES (NULLIF($1, ''), $2, NULLIF($3, ''), NULLIF($4, ''), now()) RETURNING id::text`,
+		u.Email, u.EmailVerified, u.ID, u.ExternalID).Scan(&userID)
+	if err != nil {
+		return "", false, err
+	}
+	return userID, true, nil
+}
+
+// upsertIdentity records provider's identity for userID. An identity that
+// already belongs to another user is left untouched, and a confirmed link is
+// never demoted back to pending.
+func upsertIdentity(ctx context.Context, tx pgx.Tx, userID, provider, subject, email string, emailVerified, linked bool) error {
+	_, err := tx.Exec(ctx, `INSERT INTO user_identities (user_id, provider, provider_user_id, email, email_verified, linked_at)
+VALUES ($1::uuid, $2, $3, NULLIF($4, ''), $5, CASE WHEN $6 THEN now() END)
+ON CONFLICT (provider, provider_user_id) DO UPDATE SET
+	email = EXCLUDED.email,
+	email_verified = EXCLUDED.email_verified,
+	linked_at = COALESCE(user_identities.linked_at, EXCLUDED.linked_at)
+WHERE user_identities.user_id = EXCLUDED.user_id`, userID, provider, subject, email, emailVerified, linked)
+	return err
+}
+
+// ListIdentities returns the identities attached to userID, including links
+// waiting for confirmation. Like the other identity methods it accepts our
+// user ID or, for Clerk sessions, the Clerk user ID.
+func (a *AuthService) ListIdentities(ctx context.Context, userID string) ([]Identity, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	rows, err := a.server.DB.Pool.Query(ctx, `SELECT id::text, provider, COALESCE(email, ''), email_verified, created_at, linked_at, last_used_at
+FROM user_identities WHERE user_id = (SELECT id FROM users WHERE (id::text = $1 OR clerk_id = $1) AND deleted_at IS NULL)
+ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []Identity{}
+	for rows.Next() {
+		var id Identity
+		if err := rows.Scan(&id.ID, &id.Provider, &id.Email, &id.EmailVerified, &id.CreatedAt, &id.LinkedAt, &id.LastUsedAt); err != nil {
+			return nil, err
+		}
+		id.Pending = id.LinkedAt == nil
+		identities = append(identities, id)
+	}
+	return identities, rows.Err()
+}
+
+// ConfirmIdentity links one of userID's pending identities. Callers must
+// have re-authenticated, since confirming lets the external account sign in.
+func (a *AuthService) ConfirmIdentity(ctx context.Context, userID, identityID string) error {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	tx, err := a.server.DB.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var provider, subject string
+	err = tx.QueryRow(ctx, `UPDATE user_identities SET linked_at = now()
+WHERE id::text = $1 AND linked_at IS NULL
+	AND user_id = (SELECT id FROM users WHERE (id::text = $2 OR clerk_id = $2) AND deleted_at IS NULL)
+RETURNING user_id::text, provider, provider_user_id`, identityID, userID).Scan(&userID, &provider, &subject)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrIdentityNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if provider == IdentityProviderClerk {
+		_, err = tx.Exec(ctx, `UPDATE users SET clerk_id = $2 WHERE id::text = $1 AND clerk_id IS NULL`, userID, subject)
+	} else {
+		_, err = tx.Exec(ctx, `UPDATE users SET oauth_provider = $2, oauth_provider_id = $3 WHERE id::text = $1 AND oauth_provider IS NULL`, userID, provider, subject)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// UnlinkIdentity detaches an identity from userID, or rejects it if the link
+// is still pending. A linked identity cannot be removed when it is the only
+// way left to sign in.
+func (a *AuthService) UnlinkIdentity(ctx context.Context, userID, identityID string) error {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	tx, err := a.server.DB.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	// Lock the user row so two concurrent unlinks cannot each see the other
+	// identity as the remaining login method.
+	var provider, subject string
+	var linked, hasOther bool
+	err = tx.QueryRow(ctx, `SELECT u.id::text, i.provider, i.provider_user_id, i.linked_at IS NOT NULL,
+	u.password_hash IS NOT NULL
+	OR EXISTS (SELECT 1 FROM webauthn_credentials w WHERE w.user_id = u.id)
+	OR EXISTS (SELECT 1 FROM user_identities o WHERE o.user_id = u.id AND o.id <> i.id AND o.linked_at IS NOT NULL)
+FROM user_identities i JOIN users u ON u.id = i.user_id
+WHERE i.id::text = $1 AND (u.id::text = $2 OR u.clerk_id = $2) AND u.deleted_at IS NULL
+FOR UPDATE OF u`, identityID, userID).Scan(&userID, &provider, &subject, &linked, &hasOther)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrIdentityNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if linked && !hasOther {
+		return ErrLastLoginMethod
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM user_identities WHERE id::text = $1`, identityID); err != nil {
+		return err
+	}
+	if provider == IdentityProviderClerk {
+		_, err = tx.Exec(ctx, `UPDATE users SET clerk_id = NULL, external_id = NULL WHERE id::text = $1 AND lower(clerk_id) = lower($2)`, userID, subject)
+	} else {
+		_, err = tx.Exec(ctx, `UPDATE users SET oauth_provider = NULL, oauth_provider_id = NULL
+WHERE id::text = $1 AND oauth_provider = $2 AND oauth_provider_id = $3`, userID, provider, subject)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
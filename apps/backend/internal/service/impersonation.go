@@ -0,0 +1,232 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/petonlabs/go-boilerplate/internal/lib/rbac"
+	"github.com/petonlabs/go-boilerplate/internal/lib/token"
+)
+
+// DefaultImpersonationTTL is used when Auth.ImpersonationTTL is not configured.
+const DefaultImpersonationTTL = 15 * time.Minute
+
+var (
+	ErrCannotImpersonate            = errors.New("cannot impersonate this user")
+	ErrImpersonationReasonRequired  = errors.New("a reason is required to impersonate a user")
+	ErrImpersonationSessionNotFound = errors.New("impersonation session not found")
+	// ErrImpersonationNotAllowed is returned when the target holds a
+	// permission the actor lacks, so support staff cannot act as an admin.
+	ErrImpersonationNotAllowed = errors.New("target has permissions the actor lacks")
+)
+
+// ImpersonationEvent is an entry of the impersonation audit trail.
+type ImpersonationEvent struct {
+	ID           string    `json:"id"`
+	SessionID    string    `json:"session_id"`
+	ActorID      string    `json:"actor_id"`
+	TargetUserID string    `json:"target_user_id"`
+	Action       string    `json:"action"`
+	Reason       string    `json:"reason,omitempty"`
+	StoppedBy    string    `json:"stopped_by,omitempty"`
+	IPAddress    string    `json:"ip_address,omitempty"`
+	UserAgent    string    `json:"user_agent,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// StartImpersonation opens a session as targetUserID on behalf of actorID.
+// The access token carries actorID in its "act" claim and lasts for
+// Auth.ImpersonationTTL; no refresh token is issued, so the session cannot
+// be extended. The start is recorded in the audit trail. Users holding a
+// permission actorID lacks cannot be impersonated.
+func (a *AuthService) StartImpersonation(ctx context.Context, actorID, targetUserID, reason string, meta SessionMeta) (*Session, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ErrImpersonationReasonRequired
+	}
+
+	tx, err := a.server.DB.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var userID string
+	var clerkID, role sql.NullString
+	err = tx.QueryRow(ctx, `SELECT id::text, clerk_id, role FROM users WHERE id::text = $1 AND deleted_at IS NULL`, targetUserID).
+		Scan(&userID, &clerkID, &role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if actorID == "" || actorID == userID || actorID == clerkID.String {
+		return nil, ErrCannotImpersonate
+	}
+	actorPermissions, err := userPermissions(ctx, tx, actorID)
+	if err != nil {
+		return nil, err
+	}
+	targetPermissions, err := userPermissions(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range targetPermissions {
+		if !rbac.Allows(actorPermissions, p) {
+			return nil, ErrImpersonationNotAllowed
+		}
+	}
+
+	// The session needs a refresh token digest, but the token is never
+	// handed out and RefreshSession skips impersonation sessions.
+	unused, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := a.hashToken(unused)
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(a.impersonationTTL())
+	var sessionID string
+	err = tx.QueryRow(ctx, `INSERT INTO sessions (user_id, refresh_token_hash, user_agent, ip_address, expires_at, impersonator_id)
+VALUES ($1::uuid, $2, $3, $4, $5, $6) RETURNING id::text`, userID, digest, meta.UserAgent, meta.IPAddress, expiresAt, actorID).Scan(&sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO impersonation_events (session_id, actor_id, target_user_id, action, reason, ip_address, user_agent)
+VALUES ($1::uuid, $2, $3::uuid, 'start', $4, $5, $6)`, sessionID, actorID, userID, reason, meta.IPAddress, meta.UserAgent); err != nil {
+		return nil, err
+	}
+
+	secrets := a.accessTokenSecrets()
+	if len(secrets) == 0 {
+		return nil, fmt.Errorf("no access token secret configured")
+	}
+	now := time.Now()
+	// AuthTime is left unset: an impersonation session never counts as a
+	// recent login.
+	access, err := token.Sign(token.Claims{
+		Subject:   userID,
+		SessionID: sessionID,
+		Role:      role.String,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+		Actor:     &token.Actor{Subject: actorID},
+	}, secrets[0])
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return &Session{
+		ID:               sessionID,
+		UserID:           userID,
+		AccessToken:      access,
+		TokenType:        "Bearer",
+		ExpiresIn:        int64(expiresAt.Sub(now).Seconds()),
+		RefreshExpiresAt: expiresAt,
+	}, nil
+}
+
+// StopImpersonation ends the impersonation session sessionID and records who
+// stopped it.
+func (a *AuthService) StopImpersonation(ctx context.Context, sessionID, stoppedBy string, meta SessionMeta) error {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	tx, err := a.server.DB.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var actorID, userID string
+	err = tx.QueryRow(ctx, `UPDATE sessions SET revoked_at = now()
+WHERE id::text = $1 AND impersonator_id IS NOT NULL AND revoked_at IS NULL AND expires_at > now()
+RETURNING impersonator_id, user_id::text`, sessionID).Scan(&actorID, &userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrImpersonationSessionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO impersonation_events (session_id, actor_id, target_user_id, action, stopped_by, ip_address, user_agent)
+VALUES ($1::uuid, $2, $3::uuid, 'stop', $4, $5, $6)`, sessionID, actorID, userID, stoppedBy, meta.IPAddress, meta.UserAgent); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// ListImpersonationEvents returns the audit trail, newest first, optionally
+// limited to the sessions opened as targetUserID.
+func (a *AuthService) ListImpersonationEvents(ctx context.Context, targetUserID string) ([]ImpersonationEvent, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	rows, err := a.server.DB.Pool.Query(ctx, `SELECT id::text, session_id::text, actor_id, target_user_id::text, action, COALESCE(reason, ''),
+	COALESCE(stopped_by, ''), COALESCE(ip_address, ''), COALESCE(user_agent, ''), created_at
+FROM impersonation_events
+WHERE $1 = '' OR target_user_id::text = $1
+ORDER BY created_at DESC`, targetUserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []ImpersonationEvent{}
+	for rows.Next() {
+		var e ImpersonationEvent
+		if err := rows.Scan(&e.ID, &e.SessionID, &e.ActorID, &e.TargetUserID, &e.Action, &e.Reason,
+			&e.StoppedBy, &e.IPAddress, &e.UserAgent, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func (a *AuthService) impersonationTTL() time.Duration {
+	if a.server != nil {
+		if cfg := a.server.GetConfig(); cfg != nil && cfg.Auth.ImpersonationTTL > 0 {
+			return time.Duration(cfg.Auth.ImpersonationTTL) * time.Second
+		}
+	}
+	return DefaultImpersonationTTL
+}
+
+// userPermissions returns the permissions granted by the roles of the user
+// identified by userID (our user ID or a Clerk user ID), including the role
+// named by users.role. Unlike RequirePermission it bypasses the cache.
+func userPermissions(ctx context.Context, tx pgx.Tx, userID string) ([]string, error) {
+	rows, err := tx.Query(ctx, `SELECT DISTINCT p.name
+FROM users u
+JOIN roles r ON r.name = u.role OR r.id IN (SELECT ur.role_id FROM user_roles ur WHERE ur.user_id = u.id)
+JOIN role_permissions rp ON rp.role_id = r.id
+JOIN permissions p ON p.id = rp.permission_id
+WHERE (u.id::text = $1 OR u.clerk_id = $1) AND u.deleted_at IS NULL`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, name)
+	}
+	return permissions, rows.Err()
+}
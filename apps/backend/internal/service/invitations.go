@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/petonlabs/go-boilerplate/internal/config"
+	"github.com/petonlabs/go-boilerplate/internal/lib/apikey"
+)
+
+var (
+	ErrRegistrationClosed = errors.New("registration is closed")
+	ErrInvitationRequired = errors.New("an invitation code is required to register")
+	// ErrInvalidInvitation is returned for unknown, revoked, expired or used
+	// up codes, and for codes bound to another email address.
+	ErrInvalidInvitation     = errors.New("invalid invitation code")
+	ErrInvitationNotFound    = errors.New("invitation not found")
+	ErrInvalidInvitationUses = errors.New("invitation max uses must be positive")
+)
+
+// Invitation describes a registration invitation. The code itself is only
+// returned once, by CreateInvitation.
+type Invitation struct {
+	ID        string     `json:"id"`
+	Hint      string     `json:"hint"`
+	Email     string     `json:"email,omitempty"`
+	Role      string     `json:"role,omitempty"`
+	MaxUses   int        `json:"max_uses"`
+	Uses      int        `json:"uses"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	CreatedBy string     `json:"created_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// IssuedInvitation is a newly created invitation together with its code.
+type IssuedInvitation struct {
+	Invitation
+	Code string `json:"code"`
+}
+
+// InvitationParams configures a new invitation. Email binds the code to one
+// address, Role is granted to users who register with it, and MaxUses
+// defaults to 1.
+type InvitationParams struct {
+	Email     string
+	Role      string
+	MaxUses   int
+	ExpiresAt *time.Time
+	CreatedBy string
+}
+
+// CreateInvitation mints an invitation code.
+func (a *AuthService) CreateInvitation(ctx context.Context, p InvitationParams) (*IssuedInvitation, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	if p.MaxUses == 0 {
+		p.MaxUses = 1
+	}
+	if p.MaxUses < 0 {
+		return nil, ErrInvalidInvitationUses
+	}
+	p.Email = strings.TrimSpace(p.Email)
+
+	var roleID *string
+	if p.Role != "" {
+		var id string
+		err := a.server.DB.Pool.QueryRow(ctx, `SELECT id::text FROM roles WHERE name = $1`, p.Role).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRoleNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		roleID = &id
+	}
+
+	raw, err := apikey.Generate(apikey.InvitationPrefix)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := a.hashToken(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	issued := IssuedInvitation{
+		Invitation: Invitation{
+			Hint:      apikey.Hint(apikey.InvitationPrefix, raw),
+			Email:     p.Email,
+			Role:      p.Role,
+			MaxUses:   p.MaxUses,
+			ExpiresAt: p.ExpiresAt,
+			CreatedBy: p.CreatedBy,
+		},
+		Code: raw,
+	}
+	err = a.server.DB.Pool.QueryRow(ctx, `INSERT INTO invitations (code_hash, code_hint, email, role_id, max_uses, expires_at, created_by)
+VALUES ($1, $2, NULLIF($3, ''), $4::uuid, $5, $6, NULLIF($7, '')) RETURNING id::text, created_at`,
+		digest, issued.Hint, p.Email, roleID, p.MaxUses, p.ExpiresAt, p.CreatedBy).Scan(&issued.ID, &issued.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &issued, nil
+}
+
+// ListInvitations returns all registration invitations, newest first.
+func (a *AuthService) ListInvitations(ctx context.Context) ([]Invitation, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	rows, err := a.server.DB.Pool.Query(ctx, `SELECT i.id::text, i.code_hint, COALESCE(i.email, ''), COALESCE(r.name, ''), i.max_uses, i.uses,
+	i.expires_at, COALESCE(i.created_by, ''), i.created_at, i.revoked_at
+FROM invitations i LEFT JOIN roles r ON r.id = i.role_id
+WHERE i.organization_id IS NULL
+ORDER BY i.created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []Invitation{}
+	for rows.Next() {
+		var i Invitation
+		if err := rows.Scan(&i.ID, &i.Hint, &i.Email, &i.Role, &i.MaxUses, &i.Uses, &i.ExpiresAt, &i.CreatedBy, &i.CreatedAt, &i.RevokedAt); err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, i)
+	}
+	return invitations, rows.Err()
+}
+
+// RevokeInvitation stops an invitation from being redeemed.
+func (a *AuthService) RevokeInvitation(ctx context.Context, id string) error {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	ct, err := a.server.DB.Pool.Exec(ctx, `UPDATE invitations SET revoked_at = now()
+WHERE id::text = $1 AND organization_id IS NULL AND revoked_at IS NULL`, id)
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return ErrInvitationNotFound
+	}
+	return nil
+}
+
+// checkRegistrationAllowed applies Auth.RegistrationMode to a registration
+// with the given invitation code.
+func (a *AuthService) checkRegistrationAllowed(invitationCode string) error {
+	switch a.registrationMode() {
+	case config.RegistrationClosed:
+		return ErrRegistrationClosed
+	case config.RegistrationInviteOnly:
+		if invitationCode == "" {
+			return ErrInvitationRequired
+		}
+	}
+	return nil
+}
+
+func (a *AuthService) registrationMode() string {
+	if a.server != nil {
+		if cfg := a.server.GetConfig(); cfg != nil && cfg.Auth.RegistrationMode != "" {
+			return cfg.Auth.RegistrationMode
+		}
+	}
+	return config.RegistrationOpen
+}
+
+// redeemInvitation consumes one use of code for userID within tx and grants
+// the invitation's role. The use is taken with a conditional UPDATE, so
+// concurrent registrations cannot exceed max_uses.
+func (a *AuthService) redeemInvitation(ctx context.Context, tx pgx.Tx, code, email, userID string) error {
+	var invitationID string
+	var roleID sql.NullString
+	err := tx.QueryRow(ctx, `UPDATE invitations SET uses = uses + 1
+WHERE code_hash = ANY($1) AND organization_id IS NULL AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > now())
+	AND uses < max_uses AND (email IS NULL OR lower(email) = lower($2))
+RETURNING id::text, role_id::text`, a.tokenDigests(code), email).Scan(&invitationID, &roleID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrInvalidInvitation
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO invitation_redemptions (invitation_id, user_id) VALUES ($1::uuid, $2::uuid)`, invitationID, userID); err != nil {
+		return err
+	}
+	if roleID.Valid {
+		if _, err := tx.Exec(ctx, `INSERT INTO user_roles (user_id, role_id, assigned_by)
+VALUES ($1::uuid, $2::uuid, 'invitation') ON CONFLICT DO NOTHING`, userID, roleID.String); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/petonlabs/go-boilerplate/internal/lib/lockout"
+)
+
+// Defaults for login throttling, see config.LockoutConfig.
+const (
+	DefaultLockoutWindow              = 15 * time.Minute
+	DefaultLockoutBackoffAfter        = 3
+	DefaultLockoutBackoffBase         = time.Second
+	DefaultLockoutBackoffMax          = 30 * time.Second
+	DefaultLockoutMaxFailuresPerEmail = 10
+	DefaultLockoutMaxFailuresPerIP    = 100
+	DefaultLockoutDuration            = 15 * time.Minute
+)
+
+// ErrLoginThrottled is returned (wrapped in a LoginThrottledError) when too
+// many failed logins were recorded for an email address or client IP.
+var ErrLoginThrottled = errors.New("too many failed login attempts")
+
+// LoginThrottledError tells the caller how long to wait before the next
+// login attempt is accepted.
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string { return ErrLoginThrottled.Error() }
+func (e *LoginThrottledError) Unwrap() error { return ErrLoginThrottled }
+
+// loginGuards returns the per-email and per-IP failure counters. Only the
+// email guard backs off; an IP may be shared by many users behind a NAT, so
+// it is only locked out once its much higher limit is reached.
+func (a *AuthService) loginGuards() (email, ip *lockout.Guard) {
+	if a.server == nil || a.server.Redis == nil {
+		return nil, nil
+	}
+	cfg := a.server.GetConfig()
+	if cfg == nil || cfg.Auth.Lockout.Disabled {
+		return nil, nil
+	}
+	c := cfg.Auth.Lockout
+
+	window := secondsOr(c.Window, DefaultLockoutWindow)
+	duration := secondsOr(c.Duration, DefaultLockoutDuration)
+	backoffAfter := c.BackoffAfter
+	if backoffAfter <= 0 {
+		backoffAfter = DefaultLockoutBackoffAfter
+	}
+	maxEmail := c.MaxFailuresPerEmail
+	if maxEmail <= 0 {
+		maxEmail = DefaultLockoutMaxFailuresPerEmail
+	}
+	maxIP := c.MaxFailuresPerIP
+	if maxIP <= 0 {
+		maxIP = DefaultLockoutMaxFailuresPerIP
+	}
+
+	email = lockout.New(a.server.Redis, "login:email", lockout.Policy{
+		Window:          window,
+		BackoffAfter:    backoffAfter,
+		BackoffBase:     secondsOr(c.BackoffBase, DefaultLockoutBackoffBase),
+		BackoffMax:      secondsOr(c.BackoffMax, DefaultLockoutBackoffMax),
+		LockoutAfter:    maxEmail,
+		LockoutDuration: duration,
+	})
+	ip = lockout.New(a.server.Redis, "login:ip", lockout.Policy{
+		Window:          window,
+		LockoutAfter:    maxIP,
+		LockoutDuration: duration,
+	})
+	return email, ip
+}
+
+func secondsOr(seconds int, def time.Duration) time.Duration {
+	if seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return def
+}
+
+func lockoutEmailKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// checkLoginThrottle returns a LoginThrottledError if either the email
+// address or the client IP is currently blocked. Redis errors are logged and
+// ignored so an outage does not lock everyone out.
+func (a *AuthService) checkLoginThrottle(ctx context.Context, email string, meta SessionMeta) error {
+	emailGuard, ipGuard := a.loginGuards()
+	if emailGuard == nil {
+		return nil
+	}
+	wait, err := emailGuard.Check(ctx, lockoutEmailKey(email))
+	if err != nil {
+		a.logLockoutError(err)
+		return nil
+	}
+	if meta.IPAddress != "" {
+		ipWait, err := ipGuard.Check(ctx, meta.IPAddress)
+		if err != nil {
+			a.logLockoutError(err)
+			return nil
+		}
+		wait = max(wait, ipWait)
+	}
+	if wait > 0 {
+		return &LoginThrottledError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// recordLoginFailure counts a failed login against the email address and
+// client IP.
+func (a *AuthService) recordLoginFailure(ctx context.Context, email string, meta SessionMeta) {
+	emailGuard, ipGuard := a.loginGuards()
+	if emailGuard == nil {
+		return
+	}
+	if _, err := emailGuard.Fail(ctx, lockoutEmailKey(email)); err != nil {
+		a.logLockoutError(err)
+	}
+	if meta.IPAddress != "" {
+		if _, err := ipGuard.Fail(ctx, meta.IPAddress); err != nil {
+			a.logLockoutError(err)
+		}
+	}
+}
+
+// resetLoginFailures clears the failures of email once a login has fully
+// succeeded, including any MFA challenge. The IP counter is left alone so one
+// valid account cannot be used to launder guesses against others.
+func (a *AuthService) resetLoginFailures(ctx context.Context, email string) {
+	emailGuard, _ := a.loginGuards()
+	if emailGuard == nil {
+		return
+	}
+	if err := emailGuard.Reset(ctx, lockoutEmailKey(email)); err != nil {
+		a.logLockoutError(err)
+	}
+}
+
+// userLockoutKey returns the address that failed re-authentications and MFA
+// codes of userID count against, so they share the limits of password
+// logins. Users without an email are keyed by their ID, which cannot collide
+// with an address. userID may also be a Clerk user ID.
+func (a *AuthService) userLockoutKey(ctx context.Context, userID string) (string, error) {
+	var key string
+	err := a.server.DB.Pool.QueryRow(ctx, `SELECT COALESCE(email, id::text) FROM users
+WHERE (id::text = $1 OR clerk_id = $1) AND deleted_at IS NULL`, userID).Scan(&key)
+	return key, err
+}
+
+// UnlockAccount lifts any backoff or lockout on the user's lockout key (see
+// userLockoutKey) and forgets its recorded failures. It returns
+// sql.ErrNoRows if the user does not exist.
+func (a *AuthService) UnlockAccount(ctx context.Context, userID string) error {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	key, err := a.userLockoutKey(ctx, userID)
+	if err != nil {
+		return err
+	}
+	emailGuard, _ := a.loginGuards()
+	if emailGuard == nil {
+		return nil
+	}
+	return emailGuard.Reset(ctx, lockoutEmailKey(key))
+}
+
+func (a *AuthService) logLockoutError(err error) {
+	if a.server != nil && a.server.Logger != nil {
+		a.server.Logger.Warn().Err(err).Msg("login throttling unavailable")
+	}
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/petonlabs/go-boilerplate/internal/lib/job"
+)
+
+// Login methods recorded in the login history.
+const (
+	LoginMethodPassword  = "password"
+	LoginMethodMFA       = "mfa"
+	LoginMethodMagicLink = "magic_link"
+	LoginMethodPasskey   = "passkey"
+	LoginMethodOIDC      = "oidc"
+)
+
+// Reasons recorded for failed logins.
+const (
+	LoginFailureInvalidCredentials = "invalid_credentials"
+	LoginFailureThrottled          = "throttled"
+	LoginFailureEmailNotVerified   = "email_not_verified"
+	LoginFailureInvalidMFACode     = "invalid_mfa_code"
+)
+
+const (
+	defaultLoginEventsLimit = 50
+	maxLoginEventsLimit     = 500
+)
+
+// LoginEvent is an entry of the login history.
+type LoginEvent struct {
+	ID            string    `json:"id"`
+	UserID        string    `json:"user_id,omitempty"`
+	Email         string    `json:"email,omitempty"`
+	Success       bool      `json:"success"`
+	Method        string    `json:"method"`
+	FailureReason string    `json:"failure_reason,omitempty"`
+	IPAddress     string    `json:"ip_address,omitempty"`
+	UserAgent     string    `json:"user_agent,omitempty"`
+	DeviceID      string    `json:"device_id,omitempty"`
+	RequestID     string    `json:"request_id,omitempty"`
+	NewDevice     bool      `json:"new_device"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// LoginEventFilter narrows ListLoginEvents. Empty fields match everything;
+// UserID may be our user ID or a Clerk user ID.
+type LoginEventFilter struct {
+	UserID    string
+	Email     string
+	IPAddress string
+	Success   *bool
+	Limit     int
+}
+
+// ListLoginEvents returns matching login events, newest first.
+func (a *AuthService) ListLoginEvents(ctx context.Context, f LoginEventFilter) ([]LoginEvent, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	if f.Limit <= 0 {
+		f.Limit = defaultLoginEventsLimit
+	}
+	f.Limit = min(f.Limit, maxLoginEventsLimit)
+
+	rows, err := a.server.DB.Pool.Query(ctx, `SELECT e.id::text, COALESCE(e.user_id::text, ''), COALESCE(e.email, ''), e.success, e.method,
+	COALESCE(e.failure_reason, ''), COALESCE(e.ip_address, ''), COALESCE(e.user_agent, ''), COALESCE(e.device_id, ''),
+	COALESCE(e.request_id, ''), e.new_device, e.created_at
+FROM login_events e LEFT JOIN users u ON u.id = e.user_id
+WHERE ($1 = '' OR u.id::text = $1 OR u.clerk_id = $1)
+	AND ($2 = '' OR lower(e.email) = lower($2))
+	AND ($3 = '' OR e.ip_address = $3)
+	AND ($4::boolean IS NULL OR e.success = $4)
+ORDER BY e.created_at DESC
+LIMIT $5`, f.UserID, f.Email, f.IPAddress, f.Success, f.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []LoginEvent{}
+	for rows.Next() {
+		var e LoginEvent
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Email, &e.Success, &e.Method, &e.FailureReason, &e.IPAddress,
+			&e.UserAgent, &e.DeviceID, &e.RequestID, &e.NewDevice, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// recordLogin updates last_login_at for userID and adds a successful login
+// to the history. A login from a device or IP address the user has not
+// signed in from before enqueues a "new sign-in" email; the very first login
+// does not. Failures are logged rather than returned so that they never
+// block a login.
+func (a *AuthService) recordLogin(ctx context.Context, userID, method string, meta SessionMeta) {
+	if _, err := a.server.DB.Pool.Exec(ctx, `UPDATE users SET last_login_at = now() WHERE id::text = $1`, userID); err != nil {
+		a.logLoginEventError(err, userID, "failed to update last_login_at")
+	}
+
+	deviceID := deviceFingerprint(meta.UserAgent)
+	var email *string
+	var seenBefore, knownDevice, knownIP bool
+	err := a.server.DB.Pool.QueryRow(ctx, `SELECT u.email,
+	EXISTS (SELECT 1 FROM login_events e WHERE e.user_id = u.id AND e.success),
+	EXISTS (SELECT 1 FROM login_events e WHERE e.user_id = u.id AND e.success AND e.device_id = $2),
+	EXISTS (SELECT 1 FROM login_events e WHERE e.user_id = u.id AND e.success AND e.ip_address = $3)
+FROM users u WHERE u.id::text = $1`, userID, deviceID, meta.IPAddress).Scan(&email, &seenBefore, &knownDevice, &knownIP)
+	if err != nil {
+		a.logLoginEventError(err, userID, "failed to look up login history")
+		return
+	}
+	newDevice := seenBefore && (!knownDevice || !knownIP)
+
+	if _, err := a.server.DB.Pool.Exec(ctx, `INSERT INTO login_events (user_id, email, success, method, ip_address, user_agent, device_id, request_id, new_device)
+VALUES ($1::uuid, $2, true, $3, NULLIF($4, ''), NULLIF($5, ''), $6, NULLIF($7, ''), $8)`,
+		userID, email, method, meta.IPAddress, meta.UserAgent, deviceID, meta.RequestID, newDevice); err != nil {
+		a.logLoginEventError(err, userID, "failed to record login")
+		return
+	}
+
+	if newDevice && email != nil && *email != "" {
+		a.enqueueNewSignInEmail(*email, meta, time.Now())
+	}
+}
+
+// recordLoginFailed adds a failed login to the history. userID is empty when
+// email does not belong to an account.
+func (a *AuthService) recordLoginFailed(ctx context.Context, userID, email, method, reason string, meta SessionMeta) {
+	if _, err := a.server.DB.Pool.Exec(ctx, `INSERT INTO login_events (user_id, email, success, method, failure_reason, ip_address, user_agent, device_id, request_id)
+VALUES (NULLIF($1, '')::uuid, NULLIF($2, ''), false, $3, $4, NULLIF($5, ''), NULLIF($6, ''), $7, NULLIF($8, ''))`,
+		userID, email, method, reason, meta.IPAddress, meta.UserAgent, deviceFingerprint(meta.UserAgent), meta.RequestID); err != nil {
+		a.logLoginEventError(err, userID, "failed to record failed login")
+	}
+}
+
+func (a *AuthService) enqueueNewSignInEmail(email string, meta SessionMeta, at time.Time) {
+	if a.server.Job == nil || a.server.Job.Client == nil {
+		return
+	}
+	task, err := job.NewSignInAlertTask(email, meta.IPAddress, meta.UserAgent, at.Unix())
+	if err == nil {
+		_, err = a.server.Job.Client.Enqueue(task)
+	}
+	if err != nil && a.server.Logger != nil {
+		a.server.Logger.Error().Err(err).Msg("failed to enqueue new sign-in email")
+	}
+}
+
+func (a *AuthService) logLoginEventError(err error, userID, msg string) {
+	if a.server.Logger != nil {
+		a.server.Logger.Error().Err(err).Str("user_id", userID).Msg(msg)
+	}
+}
+
+// deviceFingerprint identifies a client by its normalized user agent.
+func deviceFingerprint(userAgent string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.Join(strings.Fields(userAgent), " "))))
+	return hex.EncodeToString(sum[:8])
+}
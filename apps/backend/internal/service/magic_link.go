@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/petonlabs/go-boilerplate/internal/lib/job"
+)
+
+// DefaultMagicLinkTTL is used when Auth.MagicLinkTTL is not configured.
+const DefaultMagicLinkTTL = 15 * time.Minute
+
+// ErrInvalidMagicLink is returned for unknown, used and expired login links.
+var ErrInvalidMagicLink = errors.New("invalid or expired login link")
+
+// RequestMagicLink issues a passwordless login link for the account with
+// email and enqueues it for delivery. Any previously issued link stops
+// working. sql.ErrNoRows is returned when there is no such account so callers
+// can respond without revealing which it was.
+func (a *AuthService) RequestMagicLink(ctx context.Context, email string) (string, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return "", fmt.Errorf("database not initialized")
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	digest, err := a.hashToken(token)
+	if err != nil {
+		return "", err
+	}
+	expiresAt := time.Now().Add(a.magicLinkTTL())
+
+	ct, err := a.server.DB.Pool.Exec(ctx, `UPDATE users SET magic_link_token = $1, magic_link_expires = $2
+WHERE email = $3 AND deleted_at IS NULL`, digest, expiresAt, email)
+	if err != nil {
+		return "", fmt.Errorf("failed to set magic link token: %w", err)
+	}
+	if ct.RowsAffected() == 0 {
+		return "", sql.ErrNoRows
+	}
+
+	a.enqueueMagicLink(email, token, expiresAt)
+	return token, nil
+}
+
+// ConsumeMagicLink redeems a login link and issues a session for its owner.
+// Following the link proves control of the inbox, so the email address is
+// marked verified. Accounts with MFA enabled get an MFARequiredError.
+func (a *AuthService) ConsumeMagicLink(ctx context.Context, token string, meta SessionMeta) (*Session, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	if token == "" {
+		return nil, ErrInvalidMagicLink
+	}
+	digests := a.tokenDigests(token)
+	if len(digests) == 0 {
+		return nil, ErrInvalidMagicLink
+	}
+
+	// Clearing the token in the same statement that checks it makes the link
+	// single-use even if two requests race on it.
+	var id string
+	var mfaEnabled bool
+	err := a.server.DB.Pool.QueryRow(ctx, `UPDATE users SET magic_link_token = NULL, magic_link_expires = NULL, email_verified = TRUE
+WHERE magic_link_token = ANY($1) AND magic_link_expires > now() AND deleted_at IS NULL
+RETURNING id::text, mfa_enabled`, digests).Scan(&id, &mfaEnabled)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidMagicLink
+		}
+		return nil, err
+	}
+
+	if mfaEnabled {
+		challenge, err := a.newMFAChallenge(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return nil, &MFARequiredError{Challenge: challenge}
+	}
+
+	a.recordLogin(ctx, id, LoginMethodMagicLink, meta)
+	return a.IssueSession(ctx, id, meta)
+}
+
+// enqueueMagicLink hands the raw token to the job queue. Failures are logged
+// only: the user can always ask for another link.
+func (a *AuthService) enqueueMagicLink(email, token string, expiresAt time.Time) {
+	if a.server.Job == nil || a.server.Job.Client == nil {
+		return
+	}
+	task, err := job.NewMagicLinkTask(email, token, expiresAt.Unix())
+	if err == nil {
+		_, err = a.server.Job.Client.Enqueue(task)
+	}
+	if err != nil && a.server.Logger != nil {
+		a.server.Logger.Error().Err(err).Msg("failed to enqueue magic link")
+	}
+}
+
+func (a *AuthService) magicLinkTTL() time.Duration {
+	if a.server != nil {
+		if cfg := a.server.GetConfig(); cfg != nil && cfg.Auth.MagicLinkTTL > 0 {
+			return time.Duration(cfg.Auth.MagicLinkTTL) * time.Second
+		}
+	}
+	return DefaultMagicLinkTTL
+}
@@ -0,0 +1,466 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/petonlabs/go-boilerplate/internal/lib/encrypt"
+	"github.com/petonlabs/go-boilerplate/internal/lib/stepup"
+	"github.com/petonlabs/go-boilerplate/internal/lib/token"
+	"github.com/petonlabs/go-boilerplate/internal/lib/totp"
+)
+
+const (
+	// MFAChallengeTTL is how long a user has to enter a code after a
+	// successful password check.
+	MFAChallengeTTL = 5 * time.Minute
+	// MaxMFAChallengeAttempts is the number of wrong codes a challenge
+	// tolerates before it has to be restarted with the password.
+	MaxMFAChallengeAttempts = 5
+	// RecoveryCodeCount is the number of recovery codes issued at a time.
+	RecoveryCodeCount = 10
+	// DefaultMFAIssuer is used when Auth.MFAIssuer is not configured.
+	DefaultMFAIssuer = "Boilerplate"
+)
+
+var (
+	ErrMFARequired             = errors.New("mfa required")
+	ErrInvalidMFACode          = errors.New("invalid mfa code")
+	ErrInvalidMFAChallenge     = errors.New("invalid or expired mfa challenge")
+	ErrMFAAlreadyEnabled       = errors.New("mfa already enabled")
+	ErrMFANotEnabled           = errors.New("mfa not enabled")
+	ErrMFAEnrollmentNotStarted = errors.New("no pending mfa enrollment")
+	ErrMFALocalOnly            = errors.New("mfa is only available for local password accounts")
+)
+
+// MFAChallenge is handed out by Login instead of a session when the account
+// has MFA enabled. Token is exchanged together with a code for a session.
+type MFAChallenge struct {
+	MFARequired bool      `json:"mfa_required"`
+	Token       string    `json:"mfa_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// MFARequiredError is returned by Login for accounts with MFA enabled. It
+// matches ErrMFARequired with errors.Is.
+type MFARequiredError struct {
+	Challenge *MFAChallenge
+}
+
+func (e *MFARequiredError) Error() string { return ErrMFARequired.Error() }
+
+func (e *MFARequiredError) Unwrap() error { return ErrMFARequired }
+
+// TOTPEnrollment carries what an authenticator app needs to be set up.
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// BeginTOTPEnrollment generates a new TOTP secret for userID and stores it
+// encrypted. MFA stays disabled until ConfirmTOTPEnrollment proves that the
+// user's authenticator produces matching codes.
+func (a *AuthService) BeginTOTPEnrollment(ctx context.Context, userID string) (*TOTPEnrollment, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	userID, err := a.localUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var email sql.NullString
+	var hasPassword, enabled bool
+	err = a.server.DB.Pool.QueryRow(ctx, `SELECT email, password_hash IS NOT NULL, mfa_enabled FROM users WHERE id::text = $1 AND deleted_at IS NULL`, userID).
+		Scan(&email, &hasPassword, &enabled)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	if !hasPassword {
+		return nil, ErrMFALocalOnly
+	}
+	if enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := encrypt.Seal(a.mfaKeys(), []byte(secret))
+	if err != nil {
+		return nil, err
+	}
+	ct, err := a.server.DB.Pool.Exec(ctx, `UPDATE users SET mfa_secret = $1, mfa_last_used_step = NULL WHERE id::text = $2 AND mfa_enabled = FALSE`, sealed, userID)
+	if err != nil {
+		return nil, err
+	}
+	if ct.RowsAffected() == 0 {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	return &TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.URI(a.mfaIssuer(), email.String, secret),
+	}, nil
+}
+
+// ConfirmTOTPEnrollment enables MFA once code matches the pending secret and
+// returns a fresh set of recovery codes. The codes are only shown this once.
+func (a *AuthService) ConfirmTOTPEnrollment(ctx context.Context, userID, code string) ([]string, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	userID, err := a.localUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var sealed sql.NullString
+	var enabled bool
+	err = a.server.DB.Pool.QueryRow(ctx, `SELECT mfa_secret, mfa_enabled FROM users WHERE id::text = $1 AND deleted_at IS NULL`, userID).Scan(&sealed, &enabled)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	if enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if !sealed.Valid {
+		return nil, ErrMFAEnrollmentNotStarted
+	}
+	secret, err := encrypt.Open(a.mfaKeys(), sealed.String)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := totp.Validate(string(secret), code, time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	tx, err := a.server.DB.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	ct, err := tx.Exec(ctx, `UPDATE users SET mfa_enabled = TRUE, mfa_enabled_at = now(), mfa_last_used_step = $1
+WHERE id::text = $2 AND mfa_enabled = FALSE AND mfa_secret = $3`, step, userID, sealed.String)
+	if err != nil {
+		return nil, err
+	}
+	if ct.RowsAffected() == 0 {
+		// the enrollment was restarted or completed concurrently
+		return nil, ErrMFAEnrollmentNotStarted
+	}
+	codes, digests, err := a.newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id::text = $1`, userID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO mfa_recovery_codes (user_id, code_hash) SELECT $1::uuid, unnest($2::text[])`, userID, digests); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableTOTP turns MFA off for userID after verifying a current TOTP or
+// recovery code, and discards the secret and all recovery codes.
+func (a *AuthService) DisableTOTP(ctx context.Context, userID, code string) error {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	userID, err := a.localUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := a.verifyMFACode(ctx, userID, code); err != nil {
+		return err
+	}
+
+	tx, err := a.server.DB.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, `UPDATE users SET mfa_enabled = FALSE, mfa_secret = NULL, mfa_last_used_step = NULL, mfa_enabled_at = NULL WHERE id::text = $1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id::text = $1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_challenges WHERE user_id::text = $1`, userID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of userID with a new set.
+func (a *AuthService) RegenerateRecoveryCodes(ctx context.Context, userID string) ([]string, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	userID, err := a.localUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, digests, err := a.newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := a.server.DB.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var enabled bool
+	err = tx.QueryRow(ctx, `SELECT mfa_enabled FROM users WHERE id::text = $1 AND deleted_at IS NULL FOR UPDATE`, userID).Scan(&enabled)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	if !enabled {
+		return nil, ErrMFANotEnabled
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id::text = $1`, userID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO mfa_recovery_codes (user_id, code_hash) SELECT $1::uuid, unnest($2::text[])`, userID, digests); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// CompleteMFALogin exchanges an MFA challenge from Login and a TOTP or
+// recovery code for a session.
+func (a *AuthService) CompleteMFALogin(ctx context.Context, challengeToken, code string, meta SessionMeta) (*Session, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	digests := a.tokenDigests(challengeToken)
+	if challengeToken == "" || len(digests) == 0 {
+		return nil, ErrInvalidMFAChallenge
+	}
+
+	var challengeID, userID string
+	err := a.server.DB.Pool.QueryRow(ctx, `SELECT id::text, user_id::text FROM mfa_challenges
+WHERE token_hash = ANY($1) AND consumed_at IS NULL AND expires_at > now() AND attempts < $2`, digests, MaxMFAChallengeAttempts).
+		Scan(&challengeID, &userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidMFAChallenge
+		}
+		return nil, err
+	}
+
+	// Wrong codes count against the same email and IP limits as wrong
+	// passwords, across all of the user's challenges.
+	key, err := a.userLockoutKey(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidMFAChallenge
+		}
+		return nil, err
+	}
+	if err := a.checkLoginThrottle(ctx, key, meta); err != nil {
+		a.recordLoginFailed(ctx, userID, "", LoginMethodMFA, LoginFailureThrottled, meta)
+		return nil, err
+	}
+
+	if err := a.verifyMFACode(ctx, userID, code); err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			a.recordLoginFailure(ctx, key, meta)
+			a.recordLoginFailed(ctx, userID, "", LoginMethodMFA, LoginFailureInvalidMFACode, meta)
+			if _, uerr := a.server.DB.Pool.Exec(ctx, `UPDATE mfa_challenges SET attempts = attempts + 1 WHERE id::text = $1`, challengeID); uerr != nil {
+				return nil, uerr
+			}
+		}
+		return nil, err
+	}
+
+	ct, err := a.server.DB.Pool.Exec(ctx, `UPDATE mfa_challenges SET consumed_at = now() WHERE id::text = $1 AND consumed_at IS NULL`, challengeID)
+	if err != nil {
+		return nil, err
+	}
+	if ct.RowsAffected() == 0 {
+		return nil, ErrInvalidMFAChallenge
+	}
+
+	a.resetLoginFailures(ctx, key)
+	a.recordLogin(ctx, userID, LoginMethodMFA, meta)
+	return a.IssueSession(ctx, userID, meta)
+}
+
+// ConfirmMFA re-verifies a TOTP or recovery code of an already authenticated
+// user and records it as a step-up for the caller's session. Wrong codes count
+// as failed logins, so the code space cannot be searched.
+func (a *AuthService) ConfirmMFA(ctx context.Context, userID, sessionID, code string, meta SessionMeta) error {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	localID, err := a.localUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	key, err := a.userLockoutKey(ctx, localID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if err := a.checkLoginThrottle(ctx, key, meta); err != nil {
+		return err
+	}
+	if err := a.verifyMFACode(ctx, localID, code); err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			a.recordLoginFailure(ctx, key, meta)
+		}
+		return err
+	}
+	a.resetLoginFailures(ctx, key)
+	return stepup.Record(ctx, a.server.Redis, userID, sessionID, stepup.MethodMFA, time.Now(), ReauthRecordTTL)
+}
+
+// newMFAChallenge stores a challenge for userID and returns it with its raw token.
+func (a *AuthService) newMFAChallenge(ctx context.Context, userID string) (*MFAChallenge, error) {
+	raw, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := a.hashToken(raw)
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(MFAChallengeTTL)
+	if _, err := a.server.DB.Pool.Exec(ctx, `INSERT INTO mfa_challenges (user_id, token_hash, expires_at) VALUES ($1::uuid, $2, $3)`, userID, digest, expiresAt); err != nil {
+		return nil, fmt.Errorf("failed to create mfa challenge: %w", err)
+	}
+	return &MFAChallenge{MFARequired: true, Token: raw, ExpiresAt: expiresAt}, nil
+}
+
+// verifyMFACode accepts either a TOTP code or an unused recovery code for
+// userID. TOTP codes are rejected if their time step was already used, and
+// recovery codes are burnt on use.
+func (a *AuthService) verifyMFACode(ctx context.Context, userID, code string) error {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	var sealed sql.NullString
+	var enabled bool
+	err := a.server.DB.Pool.QueryRow(ctx, `SELECT mfa_enabled, mfa_secret FROM users WHERE id::text = $1 AND deleted_at IS NULL`, userID).Scan(&enabled, &sealed)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	if !enabled || !sealed.Valid {
+		return ErrMFANotEnabled
+	}
+
+	secret, err := encrypt.Open(a.mfaKeys(), sealed.String)
+	if err != nil {
+		return err
+	}
+	if step, ok := totp.Validate(string(secret), code, time.Now()); ok {
+		ct, err := a.server.DB.Pool.Exec(ctx, `UPDATE users SET mfa_last_used_step = $1
+WHERE id::text = $2 AND (mfa_last_used_step IS NULL OR mfa_last_used_step < $1)`, step, userID)
+		if err != nil {
+			return err
+		}
+		if ct.RowsAffected() == 0 {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+
+	digests := a.tokenDigests(normalizeRecoveryCode(code))
+	if len(digests) == 0 {
+		return ErrInvalidMFACode
+	}
+	ct, err := a.server.DB.Pool.Exec(ctx, `UPDATE mfa_recovery_codes SET used_at = now()
+WHERE id = (SELECT id FROM mfa_recovery_codes WHERE user_id::text = $1 AND code_hash = ANY($2) AND used_at IS NULL LIMIT 1)`, userID, digests)
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newRecoveryCodes returns RecoveryCodeCount codes formatted as xxxxx-xxxxx
+// together with the digests to store.
+func (a *AuthService) newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, RecoveryCodeCount)
+	digests := make([]string, 0, RecoveryCodeCount)
+	for i := 0; i < RecoveryCodeCount; i++ {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(recoveryEncoding.EncodeToString(b))[:10]
+		digest, err := a.hashToken(raw)
+		if err != nil {
+			return nil, nil, err
+		}
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		digests = append(digests, digest)
+	}
+	return codes, digests, nil
+}
+
+// normalizeRecoveryCode strips the separators users may or may not type.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+func (a *AuthService) mfaKeys() []string {
+	if a.server == nil {
+		return nil
+	}
+	cfg := a.server.GetConfig()
+	if cfg == nil {
+		return nil
+	}
+	return token.KeyRing(cfg.Auth.MFAEncryptionKey, cfg.Auth.SecretKey)
+}
+
+func (a *AuthService) mfaIssuer() string {
+	if a.server != nil {
+		if cfg := a.server.GetConfig(); cfg != nil && cfg.Auth.MFAIssuer != "" {
+			return cfg.Auth.MFAIssuer
+		}
+	}
+	return DefaultMFAIssuer
+}
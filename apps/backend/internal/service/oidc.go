@@ -0,0 +1,276 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/petonlabs/go-boilerplate/internal/config"
+	"github.com/petonlabs/go-boilerplate/internal/lib/oidc"
+)
+
+// OIDCLoginTTL bounds how long the user may take at the identity provider.
+const OIDCLoginTTL = 10 * time.Minute
+
+var (
+	ErrOIDCProviderNotFound = errors.New("unknown identity provider")
+	ErrInvalidOIDCState     = errors.New("invalid or expired login state")
+	ErrOIDCRejected         = errors.New("identity provider login failed")
+	// ErrOIDCAccountConflict is returned when the identity's email belongs to
+	// an existing account that cannot be linked automatically, either because
+	// the provider or the account did not verify the address or the account
+	// is already linked to another identity.
+	ErrOIDCAccountConflict = errors.New("an account with this email already exists")
+)
+
+// OIDCAuthorization is returned when an OIDC login starts. The client sends
+// the user to URL and should check that the state it gets back matches.
+type OIDCAuthorization struct {
+	URL   string `json:"authorization_url"`
+	State string `json:"state"`
+}
+
+type cachedOIDCProvider struct {
+	cfg      config.OIDCProvider
+	provider *oidc.Provider
+}
+
+// OIDCProviders returns the names of the configured identity providers.
+func (a *AuthService) OIDCProviders() []string {
+	names := []string{}
+	if a.server == nil {
+		return names
+	}
+	if cfg := a.server.GetConfig(); cfg != nil {
+		for name := range cfg.Auth.OIDCProviders {
+			if name == IdentityProviderClerk {
+				continue
+			}
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// BeginOIDCLogin starts an authorization code flow with PKCE at the named
+// provider.
+func (a *AuthService) BeginOIDCLogin(ctx context.Context, providerName string) (*OIDCAuthorization, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	provider, err := a.oidcProvider(ctx, providerName)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := oidc.NewVerifier()
+	if err != nil {
+		return nil, err
+	}
+	stateHash, err := a.hashToken(state)
+	if err != nil {
+		return nil, err
+	}
+	_, err = a.server.DB.Pool.Exec(ctx, `INSERT INTO oidc_login_states (state_hash, provider, code_verifier, nonce, expires_at) VALUES ($1, $2, $3, $4, $5)`,
+		stateHash, providerName, verifier, nonce, time.Now().Add(OIDCLoginTTL))
+	if err != nil {
+		return nil, fmt.Errorf("failed to store login state: %w", err)
+	}
+	return &OIDCAuthorization{URL: provider.AuthCodeURL(state, nonce, verifier), State: state}, nil
+}
+
+// FinishOIDCLogin redeems the authorization code the provider returned
+// together with state and issues a session for the matching user. Users are
+// matched by provider identity first; otherwise an account with the same
+// provider-verified email is linked, or a new account is created. As with
+// password logins, accounts with MFA enabled get an MFARequiredError.
+func (a *AuthService) FinishOIDCLogin(ctx context.Context, providerName, state, code string, meta SessionMeta) (*Session, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	provider, err := a.oidcProvider(ctx, providerName)
+	if err != nil {
+		return nil, err
+	}
+
+	var verifier, nonce string
+	err = a.server.DB.Pool.QueryRow(ctx, `DELETE FROM oidc_login_states
+WHERE state_hash = ANY($1) AND provider = $2 AND expires_at > now()
+RETURNING code_verifier, nonce`, a.tokenDigests(state), providerName).Scan(&verifier, &nonce)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidOIDCState
+		}
+		return nil, err
+	}
+
+	claims, err := provider.Exchange(ctx, code, verifier, nonce)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCRejected, err)
+	}
+
+	userID, mfaEnabled, err := a.oidcUser(ctx, providerName, claims)
+	if err != nil {
+		return nil, err
+	}
+	if mfaEnabled {
+		challenge, err := a.newMFAChallenge(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		return nil, &MFARequiredError{Challenge: challenge}
+	}
+
+	a.recordLogin(ctx, userID, LoginMethodOIDC, meta)
+	return a.IssueSession(ctx, userID, meta)
+}
+
+// oidcUser finds, links or creates the user for an identity provider login
+// and reports whether the user has MFA enabled.
+func (a *AuthService) oidcUser(ctx context.Context, providerName string, claims *oidc.Claims) (string, bool, error) {
+	tx, err := a.server.DB.Pool.Begin(ctx)
+	if err != nil {
+		return "", false, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var id string
+	var mfaEnabled, linked bool
+	err = tx.QueryRow(ctx, `SELECT u.id::text, u.mfa_enabled, i.linked_at IS NOT NULL
+FROM user_identities i JOIN users u ON u.id = i.user_id
+WHERE i.provider = $1 AND i.provider_user_id = $2 AND u.deleted_at IS NULL`, providerName, claims.Subject).Scan(&id, &mfaEnabled, &linked)
+	switch {
+	case err == nil:
+		if !linked {
+			// waiting for the account owner to confirm the link
+			return "", false, ErrOIDCAccountConflict
+		}
+		if _, err := tx.Exec(ctx, `UPDATE user_identities SET last_used_at = now(), email = COALESCE(NULLIF($3, ''), email)
+WHERE provider = $1 AND provider_user_id = $2`, providerName, claims.Subject, claims.Email); err != nil {
+			return "", false, err
+		}
+		return id, mfaEnabled, tx.Commit(ctx)
+	case !errors.Is(err, sql.ErrNoRows):
+		return "", false, err
+	}
+
+	var email interface{}
+	if claims.Email != "" {
+		email = claims.Email
+		var hasProvider, userVerified bool
+		err := tx.QueryRow(ctx, `SELECT u.id::text, u.mfa_enabled, COALESCE(u.email_verified, FALSE),
+	EXISTS (SELECT 1 FROM user_identities i WHERE i.user_id = u.id AND i.provider = $2)
+FROM users u WHERE u.email = $1 AND u.deleted_at IS NULL`, claims.Email, providerName).Scan(&id, &mfaEnabled, &userVerified, &hasProvider)
+		switch {
+		case err == nil:
+			// A user links at most one account per provider.
+			if hasProvider {
+				return "", false, ErrOIDCAccountConflict
+			}
+			// Linking on an unverified address would let anyone who can
+			// register that address at the provider take over the account.
+			// Likewise an unverified local account may have been registered
+			// by someone else, whose password would keep working. Either way
+			// the owner has to confirm the link after signing in.
+			if !claims.EmailVerified || !userVerified {
+				if err := upsertIdentity(ctx, tx, id, providerName, claims.Subject, claims.Email, claims.EmailVerified, false); err != nil {
+					return "", false, err
+				}
+				if err := tx.Commit(ctx); err != nil {
+					return "", false, err
+				}
+				return "", false, ErrOIDCAccountConflict
+			}
+			if err := upsertIdentity(ctx, tx, id, providerName, claims.Subject, claims.Email, true, true); err != nil {
+				return "", false, err
+			}
+			if _, err := tx.Exec(ctx, `UPDATE users SET
+	oauth_provider = COALESCE(oauth_provider, $2), oauth_provider_id = COALESCE(oauth_provider_id, $3)
+WHERE id::text = $1`, id, providerName, claims.Subject); err != nil {
+				return "", false, err
+			}
+			return id, mfaEnabled, tx.Commit(ctx)
+		case !errors.Is(err, sql.ErrNoRows):
+			return "", false, err
+		}
+	}
+
+	// Signing in through a provider must not bypass Auth.RegistrationMode.
+	// There is no invitation code in an OIDC login, so invite-only
+	// registration is refused as well.
+	if err := a.checkRegistrationAllowed(""); err != nil {
+		return "", false, err
+	}
+
+	firstName, lastName := claims.GivenName, claims.FamilyName
+	if firstName == "" && lastName == "" && claims.Name != "" {
+		firstName, lastName, _ = strings.Cut(claims.Name, " ")
+	}
+	err = tx.QueryRow(ctx, `INSERT INTO users (email, email_verified, oauth_provider, oauth_provider_id, first_name, last_name, image_url, created_at)
+VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), now()) RETURNING id::text`,
+		email, claims.EmailVerified, providerName, claims.Subject, firstName, lastName, claims.Picture).Scan(&id)
+	if err != nil {
+		return "", false, err
+	}
+	if err := upsertIdentity(ctx, tx, id, providerName, claims.Subject, claims.Email, claims.EmailVerified, true); err != nil {
+		return "", false, err
+	}
+	return id, false, tx.Commit(ctx)
+}
+
+// oidcProvider returns the discovered provider for name. Discovery results
+// are cached until the provider's configuration changes.
+func (a *AuthService) oidcProvider(ctx context.Context, name string) (*oidc.Provider, error) {
+	if a.server == nil {
+		return nil, ErrOIDCProviderNotFound
+	}
+	cfg := a.server.GetConfig()
+	if cfg == nil {
+		return nil, ErrOIDCProviderNotFound
+	}
+	pc, ok := cfg.Auth.OIDCProviders[name]
+	// "clerk" names the identities synced from Clerk webhooks
+	if !ok || name == IdentityProviderClerk || pc.Issuer == "" || pc.ClientID == "" {
+		return nil, ErrOIDCProviderNotFound
+	}
+
+	a.oidcMu.Lock()
+	defer a.oidcMu.Unlock()
+	if cached, ok := a.oidcCache[name]; ok && sameOIDCProvider(cached.cfg, pc) {
+		return cached.provider, nil
+	}
+	provider, err := oidc.Discover(ctx, nil, oidc.Config{
+		Issuer:       pc.Issuer,
+		ClientID:     pc.ClientID,
+		ClientSecret: pc.ClientSecret,
+		RedirectURL:  pc.RedirectURL,
+		Scopes:       pc.Scopes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if a.oidcCache == nil {
+		a.oidcCache = map[string]cachedOIDCProvider{}
+	}
+	a.oidcCache[name] = cachedOIDCProvider{cfg: pc, provider: provider}
+	return provider, nil
+}
+
+func sameOIDCProvider(a, b config.OIDCProvider) bool {
+	return a.Issuer == b.Issuer && a.ClientID == b.ClientID && a.ClientSecret == b.ClientSecret &&
+		a.RedirectURL == b.RedirectURL && slices.Equal(a.Scopes, b.Scopes)
+}
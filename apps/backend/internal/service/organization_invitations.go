@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/petonlabs/go-boilerplate/internal/lib/apikey"
+	"github.com/petonlabs/go-boilerplate/internal/lib/tenant"
+	"github.com/petonlabs/go-boilerplate/internal/model"
+)
+
+// ErrAlreadyOrganizationMember is returned when an invitation is redeemed by
+// a member of its organization. The invitation is not used up.
+var ErrAlreadyOrganizationMember = errors.New("already a member of the organization")
+
+// OrganizationInvitationParams configures an invitation to the active
+// organization. Role is the organization role (admin or member) the invitee
+// joins with, Email optionally binds the code to one address, and MaxUses
+// defaults to 1.
+type OrganizationInvitationParams struct {
+	Email     string
+	Role      string
+	MaxUses   int
+	ExpiresAt *time.Time
+	CreatedBy string
+}
+
+// CreateOrganizationInvitation mints an invitation to the active
+// organization. Members can only be added by redeeming one, so that nobody
+// joins an organization, and has their email shown to its members, without
+// agreeing to it.
+func (a *AuthService) CreateOrganizationInvitation(ctx context.Context, p OrganizationInvitationParams) (*IssuedInvitation, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	orgID, err := tenant.OrganizationID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if p.Role != model.OrganizationRoleAdmin && p.Role != model.OrganizationRoleMember {
+		return nil, ErrInvalidOrganizationRole
+	}
+	if p.MaxUses == 0 {
+		p.MaxUses = 1
+	}
+	if p.MaxUses < 0 {
+		return nil, ErrInvalidInvitationUses
+	}
+	p.Email = strings.TrimSpace(p.Email)
+
+	raw, err := apikey.Generate(apikey.InvitationPrefix)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := a.hashToken(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	issued := IssuedInvitation{
+		Invitation: Invitation{
+			Hint:      apikey.Hint(apikey.InvitationPrefix, raw),
+			Email:     p.Email,
+			Role:      p.Role,
+			MaxUses:   p.MaxUses,
+			ExpiresAt: p.ExpiresAt,
+			CreatedBy: p.CreatedBy,
+		},
+		Code: raw,
+	}
+	err = a.server.DB.Pool.QueryRow(ctx, `INSERT INTO invitations (code_hash, code_hint, email, organization_id, organization_role, max_uses, expires_at, created_by)
+VALUES ($1, $2, NULLIF($3, ''), $4::uuid, $5, $6, $7, NULLIF($8, '')) RETURNING id::text, created_at`,
+		digest, issued.Hint, p.Email, orgID, p.Role, p.MaxUses, p.ExpiresAt, p.CreatedBy).Scan(&issued.ID, &issued.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &issued, nil
+}
+
+// ListOrganizationInvitations returns the invitations to the active
+// organization, newest first. Their Role is the organization role.
+func (a *AuthService) ListOrganizationInvitations(ctx context.Context) ([]Invitation, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	orgID, err := tenant.OrganizationID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := a.server.DB.Pool.Query(ctx, `SELECT id::text, code_hint, COALESCE(email, ''), organization_role, max_uses, uses,
+	expires_at, COALESCE(created_by, ''), created_at, revoked_at
+FROM invitations WHERE organization_id::text = $1
+ORDER BY created_at DESC`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []Invitation{}
+	for rows.Next() {
+		var i Invitation
+		if err := rows.Scan(&i.ID, &i.Hint, &i.Email, &i.Role, &i.MaxUses, &i.Uses, &i.ExpiresAt, &i.CreatedBy, &i.CreatedAt, &i.RevokedAt); err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, i)
+	}
+	return invitations, rows.Err()
+}
+
+// RevokeOrganizationInvitation stops an invitation to the active
+// organization from being redeemed.
+func (a *AuthService) RevokeOrganizationInvitation(ctx context.Context, id string) error {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	orgID, err := tenant.OrganizationID(ctx)
+	if err != nil {
+		return err
+	}
+	ct, err := a.server.DB.Pool.Exec(ctx, `UPDATE invitations SET revoked_at = now()
+WHERE id::text = $1 AND organization_id::text = $2 AND revoked_at IS NULL`, id, orgID)
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return ErrInvitationNotFound
+	}
+	return nil
+}
+
+// AcceptOrganizationInvitation adds userID to the organization code invites
+// to and returns the organization's ID. Codes bound to an email address can
+// only be redeemed by the user with that address.
+func (a *AuthService) AcceptOrganizationInvitation(ctx context.Context, userID, code string) (string, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return "", fmt.Errorf("database not initialized")
+	}
+	digests := a.tokenDigests(code)
+	if code == "" || len(digests) == 0 {
+		return "", ErrInvalidInvitation
+	}
+
+	tx, err := a.server.DB.Pool.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var id, email string
+	err = tx.QueryRow(ctx, `SELECT id::text, COALESCE(email, '') FROM users WHERE (id::text = $1 OR clerk_id = $1) AND deleted_at IS NULL`,
+		userID).Scan(&id, &email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrUserNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var invitationID, orgID, role string
+	err = tx.QueryRow(ctx, `UPDATE invitations i SET uses = i.uses + 1
+FROM organizations o
+WHERE o.id = i.organization_id AND o.deleted_at IS NULL
+	AND i.code_hash = ANY($1) AND i.revoked_at IS NULL AND (i.expires_at IS NULL OR i.expires_at > now())
+	AND i.uses < i.max_uses AND (i.email IS NULL OR lower(i.email) = lower($2))
+RETURNING i.id::text, i.organization_id::text, i.organization_role`, digests, email).Scan(&invitationID, &orgID, &role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrInvalidInvitation
+	}
+	if err != nil {
+		return "", err
+	}
+
+	ct, err := tx.Exec(ctx, `INSERT INTO organization_memberships (organization_id, user_id, role)
+VALUES ($1::uuid, $2::uuid, $3) ON CONFLICT (organization_id, user_id) DO NOTHING`, orgID, id, role)
+	if err != nil {
+		return "", err
+	}
+	if ct.RowsAffected() == 0 {
+		return "", ErrAlreadyOrganizationMember
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO invitation_redemptions (invitation_id, user_id) VALUES ($1::uuid, $2::uuid)`, invitationID, id); err != nil {
+		return "", err
+	}
+	return orgID, tx.Commit(ctx)
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/petonlabs/go-boilerplate/internal/lib/tenant"
+	"github.com/petonlabs/go-boilerplate/internal/model"
+	"github.com/petonlabs/go-boilerplate/internal/repository"
+	"github.com/petonlabs/go-boilerplate/internal/server"
+)
+
+var (
+	ErrInvalidOrganization     = errors.New("organization name or slug is invalid")
+	ErrInvalidOrganizationRole = errors.New("organization role must be admin or member")
+	// ErrLastOrganizationAdmin is returned when a change would leave an
+	// organization without an admin.
+	ErrLastOrganizationAdmin = errors.New("organization must keep at least one admin")
+)
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+
+// OrganizationService manages organizations (tenants) and their members.
+// Calls acting on the active organization expect a context scoped with
+// package tenant, as set up by AuthMiddleware.RequireOrganization.
+type OrganizationService struct {
+	server *server.Server
+	repo   *repository.OrganizationRepository
+}
+
+func NewOrganizationService(s *server.Server, repo *repository.OrganizationRepository) *OrganizationService {
+	return &OrganizationService{server: s, repo: repo}
+}
+
+// ClerkOrganization is the part of a Clerk organization that is mirrored
+// locally.
+type ClerkOrganization struct {
+	ID         string
+	Name       string
+	Slug       string
+	ImageURL   string
+	RawPayload []byte
+}
+
+// ClerkMembership is a Clerk organization membership.
+type ClerkMembership struct {
+	ID             string
+	OrganizationID string
+	UserID         string
+	Role           string
+}
+
+// Create creates an organization with userID as its admin. The slug is
+// derived from the name when empty.
+func (o *OrganizationService) Create(ctx context.Context, userID, name, slug string) (*model.Organization, error) {
+	name = strings.TrimSpace(name)
+	if slug == "" {
+		slug = slugify(name)
+	}
+	if name == "" || !slugPattern.MatchString(slug) {
+		return nil, ErrInvalidOrganization
+	}
+	return o.repo.Create(ctx, name, slug, userID)
+}
+
+// ListForUser returns the organizations userID belongs to.
+func (o *OrganizationService) ListForUser(ctx context.Context, userID string) ([]model.Organization, error) {
+	return o.repo.ListForUser(ctx, userID)
+}
+
+// Current returns the active organization.
+func (o *OrganizationService) Current(ctx context.Context) (*model.Organization, error) {
+	return o.repo.Get(ctx)
+}
+
+// Members returns the members of the active organization.
+func (o *OrganizationService) Members(ctx context.Context) ([]model.OrganizationMember, error) {
+	return o.repo.ListMembers(ctx)
+}
+
+// SetMember changes the role of a member of the active organization. Users
+// are added with AuthService.CreateOrganizationInvitation instead.
+func (o *OrganizationService) SetMember(ctx context.Context, userID, role string) error {
+	if role != model.OrganizationRoleAdmin && role != model.OrganizationRoleMember {
+		return ErrInvalidOrganizationRole
+	}
+	if role != model.OrganizationRoleAdmin {
+		if err := o.ensureOtherAdmin(ctx, userID); err != nil {
+			return err
+		}
+	}
+	return o.repo.SetMemberRole(ctx, userID, role)
+}
+
+// RemoveMember removes userID from the active organization.
+func (o *OrganizationService) RemoveMember(ctx context.Context, userID string) error {
+	if err := o.ensureOtherAdmin(ctx, userID); err != nil {
+		return err
+	}
+	return o.repo.RemoveMember(ctx, userID)
+}
+
+// ensureOtherAdmin fails if userID is the only admin of the active
+// organization.
+func (o *OrganizationService) ensureOtherAdmin(ctx context.Context, userID string) error {
+	orgID, err := tenant.OrganizationID(ctx)
+	if err != nil {
+		return err
+	}
+	_, role, err := o.repo.Membership(ctx, orgID, userID)
+	if errors.Is(err, repository.ErrMemberNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if role != model.OrganizationRoleAdmin {
+		return nil
+	}
+	admins, err := o.repo.CountAdmins(ctx)
+	if err != nil {
+		return err
+	}
+	if admins <= 1 {
+		return ErrLastOrganizationAdmin
+	}
+	return nil
+}
+
+// SyncClerkOrganization mirrors an organization.created or
+// organization.updated event.
+func (o *OrganizationService) SyncClerkOrganization(ctx context.Context, org ClerkOrganization) error {
+	if org.ID == "" {
+		return nil
+	}
+	return o.repo.UpsertClerkOrganization(ctx, org.ID, org.Name, org.Slug, org.ImageURL, org.RawPayload)
+}
+
+// DeleteClerkOrganization handles an organization.deleted event.
+func (o *OrganizationService) DeleteClerkOrganization(ctx context.Context, clerkID string) error {
+	if clerkID == "" {
+		return nil
+	}
+	return o.repo.DeleteClerkOrganization(ctx, clerkID)
+}
+
+// SyncClerkMembership mirrors an organizationMembership.created or
+// organizationMembership.updated event. It returns repository.ErrUserNotFound
+// when the user or organization has not been synced yet, so the event is
+// retried.
+func (o *OrganizationService) SyncClerkMembership(ctx context.Context, m ClerkMembership) error {
+	if m.OrganizationID == "" || m.UserID == "" {
+		return nil
+	}
+	return o.repo.UpsertClerkMembership(ctx, m.ID, m.OrganizationID, m.UserID, clerkOrganizationRole(m.Role))
+}
+
+// DeleteClerkMembership handles an organizationMembership.deleted event.
+func (o *OrganizationService) DeleteClerkMembership(ctx context.Context, m ClerkMembership) error {
+	return o.repo.DeleteClerkMembership(ctx, m.ID, m.OrganizationID, m.UserID)
+}
+
+// clerkOrganizationRole maps Clerk's "org:admin"/"org:member" roles; custom
+// Clerk roles become members.
+func clerkOrganizationRole(role string) string {
+	if strings.TrimPrefix(role, "org:") == model.OrganizationRoleAdmin {
+		return model.OrganizationRoleAdmin
+	}
+	return model.OrganizationRoleMember
+}
+
+// slugify lower-cases name and joins its letters and digits with dashes.
+func slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9'):
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		default:
+			dash = true
+		}
+	}
+	return b.String()
+}
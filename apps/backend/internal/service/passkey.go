@@ -0,0 +1,354 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+
+	"github.com/petonlabs/go-boilerplate/internal/lib/passkey"
+)
+
+// PasskeyCeremonyTTL bounds how long a started registration or login
+// ceremony can be completed.
+const PasskeyCeremonyTTL = 5 * time.Minute
+
+var (
+	ErrPasskeysDisabled       = errors.New("passkeys are not configured")
+	ErrInvalidPasskeyCeremony = errors.New("invalid or expired passkey ceremony")
+	ErrPasskeyRejected        = errors.New("passkey verification failed")
+	ErrPasskeyNotFound        = errors.New("passkey not found")
+)
+
+// PasskeyCeremony is returned when a registration or login starts. Options
+// is passed to navigator.credentials.create/get as-is and ID is echoed back
+// together with the authenticator's response.
+type PasskeyCeremony struct {
+	ID      string      `json:"ceremony_id"`
+	Options interface{} `json:"options"`
+}
+
+// Passkey describes a registered WebAuthn credential.
+type Passkey struct {
+	ID             string     `json:"id"`
+	Name           string     `json:"name"`
+	BackupEligible bool       `json:"backup_eligible"`
+	CreatedAt      time.Time  `json:"created_at"`
+	LastUsedAt     *time.Time `json:"last_used_at,omitempty"`
+}
+
+// BeginPasskeyRegistration starts registering a new passkey for userID.
+func (a *AuthService) BeginPasskeyRegistration(ctx context.Context, userID string) (*PasskeyCeremony, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	rp, err := a.relyingParty()
+	if err != nil {
+		return nil, err
+	}
+	userID, err = a.localUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	user, err := a.passkeyUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	options, state, err := rp.BeginRegistration(user)
+	if err != nil {
+		return nil, err
+	}
+	id, err := a.storePasskeyCeremony(ctx, userID, "registration", state)
+	if err != nil {
+		return nil, err
+	}
+	return &PasskeyCeremony{ID: id, Options: options}, nil
+}
+
+// FinishPasskeyRegistration verifies the authenticator's response to a
+// registration ceremony and stores the new credential under name.
+func (a *AuthService) FinishPasskeyRegistration(ctx context.Context, userID, ceremonyID, name string, response []byte) (*Passkey, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	rp, err := a.relyingParty()
+	if err != nil {
+		return nil, err
+	}
+	userID, err = a.localUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	state, err := a.consumePasskeyCeremony(ctx, ceremonyID, "registration", userID)
+	if err != nil {
+		return nil, err
+	}
+	user, err := a.passkeyUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	credential, err := rp.FinishRegistration(user, state, response)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPasskeyRejected, err)
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "Passkey"
+	}
+	transports := make([]string, 0, len(credential.Transport))
+	for _, t := range credential.Transport {
+		transports = append(transports, string(t))
+	}
+
+	pk := Passkey{Name: name, BackupEligible: credential.Flags.BackupEligible}
+	err = a.server.DB.Pool.QueryRow(ctx, `INSERT INTO webauthn_credentials
+(user_id, credential_id, public_key, attestation_type, aaguid, sign_count, transports, backup_eligible, backup_state, name)
+VALUES ($1::uuid, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+ON CONFLICT (credential_id) DO NOTHING
+RETURNING id::text, created_at`,
+		userID, credential.ID, credential.PublicKey, credential.AttestationType, credential.Authenticator.AAGUID,
+		int64(credential.Authenticator.SignCount), transports, credential.Flags.BackupEligible, credential.Flags.BackupState, name).
+		Scan(&pk.ID, &pk.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: credential already registered", ErrPasskeyRejected)
+		}
+		return nil, err
+	}
+	return &pk, nil
+}
+
+// BeginPasskeyLogin starts a username-less passkey login.
+func (a *AuthService) BeginPasskeyLogin(ctx context.Context) (*PasskeyCeremony, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	rp, err := a.relyingParty()
+	if err != nil {
+		return nil, err
+	}
+	options, state, err := rp.BeginLogin()
+	if err != nil {
+		return nil, err
+	}
+	id, err := a.storePasskeyCeremony(ctx, "", "login", state)
+	if err != nil {
+		return nil, err
+	}
+	return &PasskeyCeremony{ID: id, Options: options}, nil
+}
+
+// FinishPasskeyLogin verifies an assertion for a login ceremony and issues a
+// session for the credential's owner. A passkey with user verification is
+// already multi-factor, so no MFA challenge follows.
+func (a *AuthService) FinishPasskeyLogin(ctx context.Context, ceremonyID string, response []byte, meta SessionMeta) (*Session, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	rp, err := a.relyingParty()
+	if err != nil {
+		return nil, err
+	}
+	state, err := a.consumePasskeyCeremony(ctx, ceremonyID, "login", "")
+	if err != nil {
+		return nil, err
+	}
+
+	user, credential, err := rp.FinishLogin(state, response, func(credentialID, userHandle []byte) (*passkey.User, error) {
+		var ownerID string
+		err := a.server.DB.Pool.QueryRow(ctx, `SELECT c.user_id::text FROM webauthn_credentials c JOIN users u ON u.id = c.user_id
+WHERE c.credential_id = $1 AND u.deleted_at IS NULL`, credentialID).Scan(&ownerID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, passkey.ErrUnknownCredential
+			}
+			return nil, err
+		}
+		if !bytes.Equal([]byte(ownerID), userHandle) {
+			return nil, passkey.ErrUnknownCredential
+		}
+		return a.passkeyUser(ctx, ownerID)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPasskeyRejected, err)
+	}
+
+	// Persist the counter only if it still moves forward, so two concurrent
+	// logins with a cloned key cannot both pass. Authenticators that do not
+	// implement a counter always report zero.
+	newCount := int64(credential.Authenticator.SignCount)
+	ct, err := a.server.DB.Pool.Exec(ctx, `UPDATE webauthn_credentials SET sign_count = $1, backup_state = $2, last_used_at = now()
+WHERE credential_id = $3 AND (sign_count < $1 OR ($1 = 0 AND sign_count = 0))`, newCount, credential.Flags.BackupState, credential.ID)
+	if err != nil {
+		return nil, err
+	}
+	if ct.RowsAffected() == 0 {
+		return nil, fmt.Errorf("%w: %v", ErrPasskeyRejected, passkey.ErrSignCount)
+	}
+
+	userID := string(user.ID)
+	a.recordLogin(ctx, userID, LoginMethodPasskey, meta)
+	return a.IssueSession(ctx, userID, meta)
+}
+
+// ListPasskeys returns the passkeys registered by userID.
+func (a *AuthService) ListPasskeys(ctx context.Context, userID string) ([]Passkey, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	rows, err := a.server.DB.Pool.Query(ctx, `SELECT id::text, COALESCE(name, ''), backup_eligible, created_at, last_used_at
+FROM webauthn_credentials
+WHERE user_id = (SELECT id FROM users WHERE (id::text = $1 OR clerk_id = $1) AND deleted_at IS NULL)
+ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	passkeys := []Passkey{}
+	for rows.Next() {
+		var pk Passkey
+		if err := rows.Scan(&pk.ID, &pk.Name, &pk.BackupEligible, &pk.CreatedAt, &pk.LastUsedAt); err != nil {
+			return nil, err
+		}
+		passkeys = append(passkeys, pk)
+	}
+	return passkeys, rows.Err()
+}
+
+// DeletePasskey removes one of userID's passkeys. The last remaining login
+// method cannot be removed, see UnlinkIdentity.
+func (a *AuthService) DeletePasskey(ctx context.Context, userID, passkeyID string) error {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	tx, err := a.server.DB.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	// Lock the user row like UnlinkIdentity, so that concurrent removals
+	// cannot each leave the other as the remaining login method.
+	var hasOther bool
+	err = tx.QueryRow(ctx, `SELECT u.password_hash IS NOT NULL
+	OR EXISTS (SELECT 1 FROM webauthn_credentials o WHERE o.user_id = u.id AND o.id <> w.id)
+	OR EXISTS (SELECT 1 FROM user_identities i WHERE i.user_id = u.id AND i.linked_at IS NOT NULL)
+FROM webauthn_credentials w JOIN users u ON u.id = w.user_id
+WHERE w.id::text = $1 AND (u.id::text = $2 OR u.clerk_id = $2) AND u.deleted_at IS NULL
+FOR UPDATE OF u`, passkeyID, userID).Scan(&hasOther)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrPasskeyNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if !hasOther {
+		return ErrLastLoginMethod
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM webauthn_credentials WHERE id::text = $1`, passkeyID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// passkeyUser loads userID together with its registered credentials. The
+// user's UUID doubles as the WebAuthn user handle.
+func (a *AuthService) passkeyUser(ctx context.Context, userID string) (*passkey.User, error) {
+	var email, firstName, lastName sql.NullString
+	err := a.server.DB.Pool.QueryRow(ctx, `SELECT email, first_name, last_name FROM users WHERE id::text = $1 AND deleted_at IS NULL`, userID).
+		Scan(&email, &firstName, &lastName)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	displayName := strings.TrimSpace(firstName.String + " " + lastName.String)
+	if displayName == "" {
+		displayName = email.String
+	}
+	user := &passkey.User{ID: []byte(userID), Name: email.String, DisplayName: displayName}
+
+	rows, err := a.server.DB.Pool.Query(ctx, `SELECT credential_id, public_key, COALESCE(attestation_type, ''), aaguid, sign_count, transports, backup_eligible, backup_state
+FROM webauthn_credentials WHERE user_id::text = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c webauthn.Credential
+		var signCount int64
+		var transports []string
+		if err := rows.Scan(&c.ID, &c.PublicKey, &c.AttestationType, &c.Authenticator.AAGUID, &signCount, &transports,
+			&c.Flags.BackupEligible, &c.Flags.BackupState); err != nil {
+			return nil, err
+		}
+		c.Authenticator.SignCount = uint32(signCount)
+		for _, t := range transports {
+			c.Transport = append(c.Transport, protocol.AuthenticatorTransport(t))
+		}
+		user.Credentials = append(user.Credentials, c)
+	}
+	return user, rows.Err()
+}
+
+func (a *AuthService) storePasskeyCeremony(ctx context.Context, userID, kind string, state []byte) (string, error) {
+	var owner interface{}
+	if userID != "" {
+		owner = userID
+	}
+	var id string
+	err := a.server.DB.Pool.QueryRow(ctx, `INSERT INTO webauthn_ceremonies (user_id, kind, state, expires_at) VALUES ($1::uuid, $2, $3, $4) RETURNING id::text`,
+		owner, kind, state, time.Now().Add(PasskeyCeremonyTTL)).Scan(&id)
+	if err != nil {
+		return "", fmt.Errorf("failed to store passkey ceremony: %w", err)
+	}
+	return id, nil
+}
+
+// consumePasskeyCeremony deletes and returns the state of an unexpired
+// ceremony, so that every ceremony can be completed at most once.
+func (a *AuthService) consumePasskeyCeremony(ctx context.Context, ceremonyID, kind, userID string) ([]byte, error) {
+	var state []byte
+	err := a.server.DB.Pool.QueryRow(ctx, `DELETE FROM webauthn_ceremonies
+WHERE id::text = $1 AND kind = $2 AND COALESCE(user_id::text, '') = $3 AND expires_at > now()
+RETURNING state`, ceremonyID, kind, userID).Scan(&state)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidPasskeyCeremony
+		}
+		return nil, err
+	}
+	return state, nil
+}
+
+func (a *AuthService) relyingParty() (*passkey.RelyingParty, error) {
+	if a.server == nil {
+		return nil, ErrPasskeysDisabled
+	}
+	cfg := a.server.GetConfig()
+	if cfg == nil || cfg.Auth.WebAuthnRPID == "" {
+		return nil, ErrPasskeysDisabled
+	}
+	displayName := cfg.Auth.WebAuthnRPDisplayName
+	if displayName == "" {
+		displayName = a.mfaIssuer()
+	}
+	rp, err := passkey.New(passkey.Config{
+		RPID:          cfg.Auth.WebAuthnRPID,
+		RPDisplayName: displayName,
+		RPOrigins:     cfg.Auth.WebAuthnRPOrigins,
+	})
+	if errors.Is(err, passkey.ErrNotConfigured) {
+		return nil, ErrPasskeysDisabled
+	}
+	return rp, err
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/petonlabs/go-boilerplate/internal/config"
+	"github.com/petonlabs/go-boilerplate/internal/lib/password"
+)
+
+// passwordHasher returns the hasher for new passwords as configured in
+// config.Auth.PasswordHash.
+func (a *AuthService) passwordHasher() (password.Hasher, error) {
+	var c config.PasswordHashConfig
+	if a.server != nil {
+		if cfg := a.server.GetConfig(); cfg != nil {
+			c = cfg.Auth.PasswordHash
+		}
+	}
+
+	switch strings.ToLower(c.Algorithm) {
+	case "", "argon2id":
+		h := password.DefaultArgon2id
+		if c.Argon2Memory > 0 {
+			h.Memory = uint32(c.Argon2Memory)
+		}
+		if c.Argon2Time > 0 {
+			h.Time = uint32(c.Argon2Time)
+		}
+		if c.Argon2Threads > 0 && c.Argon2Threads <= 255 {
+			h.Threads = uint8(c.Argon2Threads)
+		}
+		return h, nil
+	case "bcrypt":
+		h := password.Bcrypt{Cost: bcrypt.DefaultCost}
+		if c.BcryptCost > 0 {
+			h.Cost = c.BcryptCost
+		}
+		return h, nil
+	default:
+		return nil, fmt.Errorf("unknown password hash algorithm %q", c.Algorithm)
+	}
+}
+
+// hashPassword hashes pw with the configured hasher.
+func (a *AuthService) hashPassword(pw string) (string, error) {
+	h, err := a.passwordHasher()
+	if err != nil {
+		return "", err
+	}
+	return h.Hash(pw)
+}
+
+// checkPassword reports whether pw matches the stored hash. Unknown or
+// corrupt hashes never match.
+func (a *AuthService) checkPassword(hash, pw string) bool {
+	ok, err := password.Verify(hash, pw)
+	return err == nil && ok
+}
+
+// rehashPassword replaces userID's password hash if it was produced with an
+// outdated algorithm or parameters. pw must already have been verified
+// against oldHash. Failures are logged and otherwise ignored; the old hash
+// keeps working.
+func (a *AuthService) rehashPassword(ctx context.Context, userID, oldHash, pw string) {
+	h, err := a.passwordHasher()
+	if err != nil {
+		if a.server.Logger != nil {
+			a.server.Logger.Error().Err(err).Msg("password hashes cannot be upgraded")
+		}
+		return
+	}
+	if !h.NeedsRehash(oldHash) {
+		return
+	}
+	newHash, err := h.Hash(pw)
+	if err == nil {
+		// Compare-and-swap so a password changed concurrently is not overwritten.
+		_, err = a.server.DB.Pool.Exec(ctx, `UPDATE users SET password_hash = $1 WHERE id::text = $2 AND password_hash = $3`, newHash, userID, oldHash)
+	}
+	if err != nil && a.server.Logger != nil {
+		a.server.Logger.Error().Err(err).Str("user_id", userID).Msg("failed to upgrade password hash")
+	}
+}
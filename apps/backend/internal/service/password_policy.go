@@ -0,0 +1,128 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/petonlabs/go-boilerplate/internal/errs"
+	"github.com/petonlabs/go-boilerplate/internal/lib/password"
+)
+
+// Defaults for the password policy, see config.PasswordPolicy.
+const (
+	DefaultPasswordMinLength = 8
+	DefaultPasswordMaxLength = 128
+)
+
+// DefaultPasswordClasses are required when no classes are configured.
+var DefaultPasswordClasses = []password.Class{password.Upper, password.Lower, password.Digit}
+
+// ErrWeakPassword is returned (wrapped in a PasswordPolicyError, which also
+// matches ErrPasswordValidation) when a password does not satisfy the
+// configured policy.
+var ErrWeakPassword = errors.New("password does not meet policy")
+
+// PasswordPolicyError lists every rule a rejected password violates.
+type PasswordPolicyError struct {
+	Violations []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "password " + strings.Join(e.Violations, ", ")
+}
+
+func (e *PasswordPolicyError) Unwrap() []error {
+	return []error{ErrWeakPassword, ErrPasswordValidation}
+}
+
+// FieldErrors returns the violations as field errors for the request field
+// that carried the password.
+func (e *PasswordPolicyError) FieldErrors(field string) []errs.FieldError {
+	out := make([]errs.FieldError, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		out = append(out, errs.FieldError{Field: field, Error: v})
+	}
+	return out
+}
+
+// validatePassword checks pw against the configured password policy and
+// returns a PasswordPolicyError describing all violations.
+func (a *AuthService) validatePassword(pw string) error {
+	policy, err := a.passwordPolicy()
+	if err != nil {
+		return err
+	}
+	if violations := policy.Check(pw); len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// passwordPolicy builds the policy from the current config. The denylist
+// file is read once and cached until its configured path changes.
+func (a *AuthService) passwordPolicy() (password.Policy, error) {
+	policy := password.Policy{
+		MinLength: DefaultPasswordMinLength,
+		MaxLength: DefaultPasswordMaxLength,
+		Require:   DefaultPasswordClasses,
+	}
+	if a.server == nil {
+		return policy, nil
+	}
+	cfg := a.server.GetConfig()
+	if cfg == nil {
+		return policy, nil
+	}
+	c := cfg.Auth.PasswordPolicy
+
+	if c.MinLength > 0 {
+		policy.MinLength = c.MinLength
+	}
+	if c.MaxLength > 0 {
+		policy.MaxLength = c.MaxLength
+	}
+	// bcrypt rejects longer input, so such passwords fail the policy
+	// instead of the hasher.
+	if strings.EqualFold(cfg.Auth.PasswordHash.Algorithm, "bcrypt") {
+		policy.MaxBytes = password.BcryptMaxBytes
+	}
+	if len(c.RequiredClasses) > 0 {
+		policy.Require = nil
+		for _, name := range c.RequiredClasses {
+			class := password.Class(strings.ToLower(strings.TrimSpace(name)))
+			switch class {
+			case password.Upper, password.Lower, password.Digit, password.Symbol:
+				policy.Require = append(policy.Require, class)
+			case "none", "":
+			default:
+				return policy, fmt.Errorf("unknown password character class %q", name)
+			}
+		}
+	}
+	policy.BannedWords = c.BannedWords
+
+	if c.DenylistFile != "" {
+		denylist, err := a.passwordDenylist(c.DenylistFile)
+		if err != nil {
+			return policy, err
+		}
+		policy.Denylist = denylist
+	}
+	return policy, nil
+}
+
+func (a *AuthService) passwordDenylist(path string) (password.Denylist, error) {
+	a.denylistMu.Lock()
+	defer a.denylistMu.Unlock()
+	if a.denylist != nil && a.denylistPath == path {
+		return a.denylist, nil
+	}
+	denylist, err := password.LoadDenylist(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load password denylist: %w", err)
+	}
+	a.denylist = denylist
+	a.denylistPath = path
+	return denylist, nil
+}
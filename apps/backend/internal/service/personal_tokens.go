@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/petonlabs/go-boilerplate/internal/lib/apikey"
+)
+
+var ErrPersonalAccessTokenNotFound = errors.New("personal access token not found")
+
+// PersonalAccessToken describes a token minted by a user. The token itself
+// is only returned once, by CreatePersonalAccessToken.
+type PersonalAccessToken struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Hint       string     `json:"hint"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+}
+
+// IssuedPersonalAccessToken is a newly created token together with its
+// secret value.
+type IssuedPersonalAccessToken struct {
+	PersonalAccessToken
+	Token string `json:"token"`
+}
+
+// CreatePersonalAccessToken mints a token that authenticates as userID. The
+// caller may be identified by our user ID or, for Clerk sessions, by the
+// Clerk user ID. A nil expiresAt creates a token that does not expire.
+func (a *AuthService) CreatePersonalAccessToken(ctx context.Context, userID, name string, expiresAt *time.Time) (*IssuedPersonalAccessToken, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	raw, err := apikey.Generate(apikey.PersonalAccessTokenPrefix)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := a.hashToken(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	issued := IssuedPersonalAccessToken{
+		PersonalAccessToken: PersonalAccessToken{Name: name, Hint: apikey.Hint(apikey.PersonalAccessTokenPrefix, raw), ExpiresAt: expiresAt},
+		Token:               raw,
+	}
+	err = a.server.DB.Pool.QueryRow(ctx, `INSERT INTO personal_access_tokens (user_id, name, token_hash, token_hint, expires_at)
+SELECT id, $2, $3, $4, $5 FROM users WHERE (id::text = $1 OR clerk_id = $1) AND deleted_at IS NULL
+RETURNING id::text, created_at`, userID, name, digest, issued.Hint, expiresAt).Scan(&issued.ID, &issued.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &issued, nil
+}
+
+// ListPersonalAccessTokens returns userID's active tokens, newest first.
+func (a *AuthService) ListPersonalAccessTokens(ctx context.Context, userID string) ([]PersonalAccessToken, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	rows, err := a.server.DB.Pool.Query(ctx, `SELECT t.id::text, t.name, t.token_hint, t.expires_at, t.created_at, t.last_used_at, COALESCE(t.last_used_ip, '')
+FROM personal_access_tokens t JOIN users u ON u.id = t.user_id
+WHERE (u.id::text = $1 OR u.clerk_id = $1) AND t.revoked_at IS NULL AND (t.expires_at IS NULL OR t.expires_at > now())
+ORDER BY t.created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []PersonalAccessToken{}
+	for rows.Next() {
+		var t PersonalAccessToken
+		if err := rows.Scan(&t.ID, &t.Name, &t.Hint, &t.ExpiresAt, &t.CreatedAt, &t.LastUsedAt, &t.LastUsedIP); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// RevokePersonalAccessToken revokes one of userID's tokens.
+func (a *AuthService) RevokePersonalAccessToken(ctx context.Context, userID, tokenID string) error {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	var id string
+	err := a.server.DB.Pool.QueryRow(ctx, `UPDATE personal_access_tokens t SET revoked_at = now()
+FROM users u WHERE u.id = t.user_id AND t.id::text = $1 AND (u.id::text = $2 OR u.clerk_id = $2) AND t.revoked_at IS NULL
+RETURNING t.id::text`, tokenID, userID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrPersonalAccessTokenNotFound
+	}
+	return err
+}
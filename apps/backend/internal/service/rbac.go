@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/petonlabs/go-boilerplate/internal/lib/rbac"
+)
+
+var ErrRoleNotFound = errors.New("role not found")
+
+// Role is a named set of permissions.
+type Role struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Permissions []string `json:"permissions"`
+}
+
+// ListRoles returns every role with its permissions.
+func (a *AuthService) ListRoles(ctx context.Context) ([]Role, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	rows, err := a.server.DB.Pool.Query(ctx, `SELECT r.name, COALESCE(r.description, ''),
+	COALESCE(array_agg(p.name ORDER BY p.name) FILTER (WHERE p.name IS NOT NULL), '{}')
+FROM roles r
+LEFT JOIN role_permissions rp ON rp.role_id = r.id
+LEFT JOIN permissions p ON p.id = rp.permission_id
+GROUP BY r.id ORDER BY r.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []Role{}
+	for rows.Next() {
+		var r Role
+		if err := rows.Scan(&r.Name, &r.Description, &r.Permissions); err != nil {
+			return nil, err
+		}
+		roles = append(roles, r)
+	}
+	return roles, rows.Err()
+}
+
+// UserRoles returns the names of the roles assigned to userID, including the
+// role stored in users.role. It returns sql.ErrNoRows for unknown users.
+func (a *AuthService) UserRoles(ctx context.Context, userID string) ([]string, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	var roles []string
+	err := a.server.DB.Pool.QueryRow(ctx, `SELECT COALESCE(array_agg(DISTINCT r.name ORDER BY r.name) FILTER (WHERE r.name IS NOT NULL), '{}')
+FROM users u
+LEFT JOIN roles r ON r.name = u.role OR r.id IN (SELECT ur.role_id FROM user_roles ur WHERE ur.user_id = u.id)
+WHERE u.id::text = $1
+GROUP BY u.id`, userID).Scan(&roles)
+	if err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// AssignRole grants role to userID. Assigning a role the user already has is
+// not an error.
+func (a *AuthService) AssignRole(ctx context.Context, userID, role, assignedBy string) error {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	var roleID string
+	err := a.server.DB.Pool.QueryRow(ctx, `SELECT id::text FROM roles WHERE name = $1`, role).Scan(&roleID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrRoleNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	var clerkID sql.NullString
+	if err := a.server.DB.Pool.QueryRow(ctx, `SELECT clerk_id FROM users WHERE id::text = $1`, userID).Scan(&clerkID); err != nil {
+		return err
+	}
+	if _, err := a.server.DB.Pool.Exec(ctx, `INSERT INTO user_roles (user_id, role_id, assigned_by)
+VALUES ($1::uuid, $2::uuid, NULLIF($3, '')) ON CONFLICT DO NOTHING`, userID, roleID, assignedBy); err != nil {
+		return err
+	}
+	a.invalidatePermissions(ctx, userID, clerkID.String)
+	return nil
+}
+
+// RemoveRole takes role away from userID, including when it is the role
+// stored in users.role. A role synced from Clerk stays removed until its
+// public_metadata.role changes.
+func (a *AuthService) RemoveRole(ctx context.Context, userID, role string) error {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	var clerkID sql.NullString
+	if err := a.server.DB.Pool.QueryRow(ctx, `SELECT clerk_id FROM users WHERE id::text = $1`, userID).Scan(&clerkID); err != nil {
+		return err
+	}
+
+	tx, err := a.server.DB.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	assigned, err := tx.Exec(ctx, `DELETE FROM user_roles ur USING roles r
+WHERE ur.role_id = r.id AND ur.user_id::text = $1 AND r.name = $2`, userID, role)
+	if err != nil {
+		return err
+	}
+	legacy, err := tx.Exec(ctx, `UPDATE users SET role = NULL WHERE id::text = $1 AND role = $2`, userID, role)
+	if err != nil {
+		return err
+	}
+	if assigned.RowsAffected() == 0 && legacy.RowsAffected() == 0 {
+		return ErrRoleNotFound
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	a.invalidatePermissions(ctx, userID, clerkID.String)
+	return nil
+}
+
+// invalidatePermissions drops the permissions RequirePermission cached for a
+// user under each of the IDs it may be authenticated with.
+func (a *AuthService) invalidatePermissions(ctx context.Context, userIDs ...string) {
+	if err := rbac.Invalidate(ctx, a.server.Redis, userIDs...); err != nil && a.server.Logger != nil {
+		a.server.Logger.Warn().Err(err).Msg("failed to invalidate cached permissions")
+	}
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/petonlabs/go-boilerplate/internal/lib/stepup"
+)
+
+// ReauthRecordTTL bounds how long a re-confirmation is remembered in Redis and
+// therefore the largest maxAge RequireRecentAuth can be satisfied with.
+const ReauthRecordTTL = time.Hour
+
+// ErrNoLocalPassword is returned by ConfirmPassword for users without a local
+// password, such as users who only sign in through Clerk, OIDC or passkeys.
+var ErrNoLocalPassword = errors.New("account has no local password")
+
+// ConfirmPassword re-verifies the password of an already authenticated user and
+// records the confirmation for the caller's session, so that endpoints guarded
+// by RequireRecentAuth accept the session for a while. Wrong passwords are
+// throttled like failed logins, so a stolen access token cannot be used to
+// guess the password.
+func (a *AuthService) ConfirmPassword(ctx context.Context, userID, sessionID, password string, meta SessionMeta) error {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	key, err := a.userLockoutKey(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNoLocalPassword
+	}
+	if err != nil {
+		return err
+	}
+	if err := a.checkLoginThrottle(ctx, key, meta); err != nil {
+		return err
+	}
+
+	var hash string
+	err = a.server.DB.Pool.QueryRow(ctx, `SELECT password_hash FROM users
+WHERE (id::text = $1 OR clerk_id = $1) AND deleted_at IS NULL AND password_hash IS NOT NULL`, userID).Scan(&hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNoLocalPassword
+	}
+	if err != nil {
+		return err
+	}
+	if !a.checkPassword(hash, password) {
+		a.recordLoginFailure(ctx, key, meta)
+		return ErrInvalidCredentials
+	}
+	a.resetLoginFailures(ctx, key)
+
+	return stepup.Record(ctx, a.server.Redis, userID, sessionID, stepup.MethodPassword, time.Now(), ReauthRecordTTL)
+}
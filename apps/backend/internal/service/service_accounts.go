@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/petonlabs/go-boilerplate/internal/lib/apikey"
+)
+
+var (
+	ErrServiceAccountNotFound = errors.New("service account not found")
+	ErrServiceAccountExists   = errors.New("service account name already in use")
+	ErrAPIKeyNotFound         = errors.New("api key not found")
+	// ErrInvalidScope is returned for scopes that are not "*",
+	// "<resource>:*" or "<resource>:<action>".
+	ErrInvalidScope = apikey.ErrInvalidScope
+)
+
+// ServiceAccount is a non-human principal that authenticates with API keys.
+type ServiceAccount struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	CreatedBy   string     `json:"created_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	DisabledAt  *time.Time `json:"disabled_at,omitempty"`
+}
+
+// APIKey describes an issued key. The key itself is only returned once, by
+// CreateAPIKey.
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Hint       string     `json:"hint"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// IssuedAPIKey is a newly created key together with its secret value.
+type IssuedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// CreateServiceAccount registers a service account. createdBy records the
+// admin who created it.
+func (a *AuthService) CreateServiceAccount(ctx context.Context, name, description, createdBy string) (*ServiceAccount, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("service account name is required")
+	}
+
+	sa := ServiceAccount{Name: name, Description: description, CreatedBy: createdBy}
+	err := a.server.DB.Pool.QueryRow(ctx, `INSERT INTO service_accounts (name, description, created_by)
+VALUES ($1, NULLIF($2, ''), NULLIF($3, '')) ON CONFLICT (name) DO NOTHING RETURNING id::text, created_at`,
+		name, description, createdBy).Scan(&sa.ID, &sa.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrServiceAccountExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sa, nil
+}
+
+// ListServiceAccounts returns all service accounts, including disabled ones.
+func (a *AuthService) ListServiceAccounts(ctx context.Context) ([]ServiceAccount, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	rows, err := a.server.DB.Pool.Query(ctx, `SELECT id::text, name, COALESCE(description, ''), COALESCE(created_by, ''), created_at, disabled_at
+FROM service_accounts ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := []ServiceAccount{}
+	for rows.Next() {
+		var sa ServiceAccount
+		if err := rows.Scan(&sa.ID, &sa.Name, &sa.Description, &sa.CreatedBy, &sa.CreatedAt, &sa.DisabledAt); err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, sa)
+	}
+	return accounts, rows.Err()
+}
+
+// DisableServiceAccount stops all keys of the account from authenticating.
+// The account and its keys are kept for auditing.
+func (a *AuthService) DisableServiceAccount(ctx context.Context, accountID string) error {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	ct, err := a.server.DB.Pool.Exec(ctx, `UPDATE service_accounts SET disabled_at = COALESCE(disabled_at, now()) WHERE id::text = $1`, accountID)
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return ErrServiceAccountNotFound
+	}
+	return nil
+}
+
+// CreateAPIKey issues a key for an enabled service account. A nil expiresAt
+// creates a key that does not expire.
+func (a *AuthService) CreateAPIKey(ctx context.Context, accountID, name string, scopes []string, expiresAt *time.Time) (*IssuedAPIKey, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	if err := apikey.ValidateScopes(scopes); err != nil {
+		return nil, err
+	}
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	key, err := apikey.Generate(apikey.ServiceAccountPrefix)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := a.hashToken(key)
+	if err != nil {
+		return nil, err
+	}
+
+	issued := IssuedAPIKey{
+		APIKey: APIKey{Name: name, Hint: apikey.Hint(apikey.ServiceAccountPrefix, key), Scopes: scopes, ExpiresAt: expiresAt},
+		Key:    key,
+	}
+	err = a.server.DB.Pool.QueryRow(ctx, `INSERT INTO api_keys (service_account_id, name, key_hash, key_hint, scopes, expires_at)
+SELECT id, $2, $3, $4, $5, $6 FROM service_accounts WHERE id::text = $1 AND disabled_at IS NULL
+RETURNING id::text, created_at`, accountID, name, digest, issued.Hint, scopes, expiresAt).Scan(&issued.ID, &issued.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrServiceAccountNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &issued, nil
+}
+
+// ListAPIKeys returns the keys issued to a service account, newest first.
+func (a *AuthService) ListAPIKeys(ctx context.Context, accountID string) ([]APIKey, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	rows, err := a.server.DB.Pool.Query(ctx, `SELECT id::text, name, key_hint, scopes, expires_at, created_at, last_used_at, revoked_at
+FROM api_keys WHERE service_account_id::text = $1 ORDER BY created_at DESC`, accountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var k APIKey
+		if err := rows.Scan(&k.ID, &k.Name, &k.Hint, &k.Scopes, &k.ExpiresAt, &k.CreatedAt, &k.LastUsedAt, &k.RevokedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey revokes one of the service account's keys.
+func (a *AuthService) RevokeAPIKey(ctx context.Context, accountID, keyID string) error {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	ct, err := a.server.DB.Pool.Exec(ctx, `UPDATE api_keys SET revoked_at = COALESCE(revoked_at, now())
+WHERE id::text = $1 AND service_account_id::text = $2`, keyID, accountID)
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
@@ -1,21 +1,33 @@
 package service
 
 import (
+	"fmt"
+
 	"github.com/petonlabs/go-boilerplate/internal/lib/job"
 	"github.com/petonlabs/go-boilerplate/internal/repository"
 	"github.com/petonlabs/go-boilerplate/internal/server"
 )
 
 type Services struct {
-	Auth *AuthService
-	Job  *job.JobService
+	Auth          *AuthService
+	Organizations *OrganizationService
+	Job           *job.JobService
 }
 
 func NewServices(s *server.Server, repos *repository.Repositories) (*Services, error) {
 	authService := NewAuthService(s)
+	// Build the password policy once so a bad denylist or character class
+	// fails startup instead of every registration.
+	if _, err := authService.passwordPolicy(); err != nil {
+		return nil, fmt.Errorf("invalid password policy: %w", err)
+	}
+	if repos == nil {
+		repos = repository.NewRepositories(s)
+	}
 
 	return &Services{
-		Job:  s.Job,
-		Auth: authService,
+		Job:           s.Job,
+		Auth:          authService,
+		Organizations: NewOrganizationService(s, repos.Organizations),
 	}, nil
 }
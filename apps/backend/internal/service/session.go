@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/petonlabs/go-boilerplate/internal/lib/token"
+)
+
+const (
+	// DefaultAccessTokenTTL is used when Auth.AccessTokenTTL is not configured.
+	DefaultAccessTokenTTL = 15 * time.Minute
+	// DefaultRefreshTokenTTL is used when Auth.RefreshTokenTTL is not configured.
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// ErrInvalidRefreshToken is returned when a refresh token is unknown, revoked or expired.
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// Session is the credential pair handed to a client after a successful login.
+type Session struct {
+	ID               string    `json:"-"`
+	UserID           string    `json:"user_id"`
+	AccessToken      string    `json:"access_token"`
+	RefreshToken     string    `json:"refresh_token"`
+	TokenType        string    `json:"token_type"`
+	ExpiresIn        int64     `json:"expires_in"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// SessionMeta describes the client a session is issued to.
+type SessionMeta struct {
+	UserAgent string
+	IPAddress string
+	// RequestID ties login history entries to the request logs.
+	RequestID string
+}
+
+// IssueSession creates a new session row for userID and returns a signed
+// access token together with a refresh token. Only the HMAC digest of the
+// refresh token is stored.
+func (a *AuthService) IssueSession(ctx context.Context, userID string, meta SessionMeta) (*Session, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	var role sql.NullString
+	err := a.server.DB.Pool.QueryRow(ctx, `SELECT role FROM users WHERE id::text = $1 AND deleted_at IS NULL`, userID).Scan(&role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	refresh, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := a.hashToken(refresh)
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(a.refreshTokenTTL())
+	var sessionID string
+	var createdAt time.Time
+	err = a.server.DB.Pool.QueryRow(ctx, `INSERT INTO sessions (user_id, refresh_token_hash, user_agent, ip_address, expires_at)
+VALUES ($1::uuid, $2, $3, $4, $5) RETURNING id::text, created_at`, userID, digest, meta.UserAgent, meta.IPAddress, expiresAt).Scan(&sessionID, &createdAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return a.buildSession(sessionID, userID, role.String, refresh, createdAt, expiresAt)
+}
+
+// RefreshSession exchanges a valid refresh token for a new access token. The
+// refresh token is rotated: the one presented stops working once this returns.
+func (a *AuthService) RefreshSession(ctx context.Context, refreshToken string, meta SessionMeta) (*Session, error) {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	if refreshToken == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+	digests := a.tokenDigests(refreshToken)
+	if len(digests) == 0 {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	var sessionID, userID, currentDigest string
+	var role sql.NullString
+	var createdAt, expiresAt time.Time
+	err := a.server.DB.Pool.QueryRow(ctx, `SELECT s.id::text, s.user_id::text, s.refresh_token_hash, s.created_at, s.expires_at, u.role
+FROM sessions s JOIN users u ON u.id = s.user_id
+WHERE s.refresh_token_hash = ANY($1) AND s.revoked_at IS NULL AND s.expires_at > now() AND s.impersonator_id IS NULL
+	AND u.deleted_at IS NULL`, digests).
+		Scan(&sessionID, &userID, &currentDigest, &createdAt, &expiresAt, &role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	next, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	nextDigest, err := a.hashToken(next)
+	if err != nil {
+		return nil, err
+	}
+
+	// Compare-and-swap on the stored digest so two concurrent refreshes with the
+	// same token cannot both succeed.
+	ct, err := a.server.DB.Pool.Exec(ctx, `UPDATE sessions SET refresh_token_hash = $1, last_used_at = now(), user_agent = $2, ip_address = $3
+WHERE id::text = $4 AND refresh_token_hash = $5 AND revoked_at IS NULL`, nextDigest, meta.UserAgent, meta.IPAddress, sessionID, currentDigest)
+	if err != nil {
+		return nil, err
+	}
+	if ct.RowsAffected() == 0 {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// A refresh does not re-verify credentials, so the session keeps the auth
+	// time of the original login.
+	return a.buildSession(sessionID, userID, role.String, next, createdAt, expiresAt)
+}
+
+// RevokeSession ends the session identified by refreshToken. Revoking an
+// unknown or already revoked token is not an error.
+func (a *AuthService) RevokeSession(ctx context.Context, refreshToken string) error {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	digests := a.tokenDigests(refreshToken)
+	if refreshToken == "" || len(digests) == 0 {
+		return nil
+	}
+	_, err := a.server.DB.Pool.Exec(ctx, `UPDATE sessions SET revoked_at = now() WHERE refresh_token_hash = ANY($1) AND revoked_at IS NULL`, digests)
+	return err
+}
+
+// RevokeAllSessions ends every active session of userID.
+func (a *AuthService) RevokeAllSessions(ctx context.Context, userID string) error {
+	if a.server == nil || a.server.DB == nil || a.server.DB.Pool == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	_, err := a.server.DB.Pool.Exec(ctx, `UPDATE sessions SET revoked_at = now() WHERE user_id::text = $1 AND revoked_at IS NULL`, userID)
+	return err
+}
+
+func (a *AuthService) buildSession(sessionID, userID, role, refresh string, authTime, refreshExpiresAt time.Time) (*Session, error) {
+	secrets := a.accessTokenSecrets()
+	if len(secrets) == 0 {
+		return nil, fmt.Errorf("no access token secret configured")
+	}
+	now := time.Now()
+	ttl := a.accessTokenTTL()
+	access, err := token.Sign(token.Claims{
+		Subject:   userID,
+		SessionID: sessionID,
+		Role:      role,
+		AuthTime:  authTime.Unix(),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	}, secrets[0])
+	if err != nil {
+		return nil, err
+	}
+	return &Session{
+		ID:               sessionID,
+		UserID:           userID,
+		AccessToken:      access,
+		RefreshToken:     refresh,
+		TokenType:        "Bearer",
+		ExpiresIn:        int64(ttl.Seconds()),
+		RefreshExpiresAt: refreshExpiresAt,
+	}, nil
+}
+
+func (a *AuthService) accessTokenSecrets() []string {
+	if a.server == nil {
+		return nil
+	}
+	cfg := a.server.GetConfig()
+	if cfg == nil {
+		return nil
+	}
+	return token.KeyRing(cfg.Auth.AccessTokenSecret, cfg.Auth.SecretKey)
+}
+
+func (a *AuthService) accessTokenTTL() time.Duration {
+	if a.server != nil {
+		if cfg := a.server.GetConfig(); cfg != nil && cfg.Auth.AccessTokenTTL > 0 {
+			return time.Duration(cfg.Auth.AccessTokenTTL) * time.Second
+		}
+	}
+	return DefaultAccessTokenTTL
+}
+
+func (a *AuthService) refreshTokenTTL() time.Duration {
+	if a.server != nil {
+		if cfg := a.server.GetConfig(); cfg != nil && cfg.Auth.RefreshTokenTTL > 0 {
+			return time.Duration(cfg.Auth.RefreshTokenTTL) * time.Second
+		}
+	}
+	return DefaultRefreshTokenTTL
+}
@@ -41,7 +41,7 @@ func AttachMockEnqueuer(s *server.Server, m *mocks.MockEnqueuer) {
 	}
 	// Create a minimal JobService with the mock as its Client so handlers
 	// that check s.Job.Client can call Enqueue without touching Redis.
-	s.Job = &job.JobService{Client: m}
+	s.Job = &job.JobService{Client: m, Inspector: m}
 }
 
 // MustMarshalJSON marshals an object to JSON or fails the test
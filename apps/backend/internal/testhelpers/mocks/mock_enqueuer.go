@@ -1,24 +1,105 @@
 package mocks
 
 import (
+	"errors"
 	"sync"
+	"time"
 
 	"github.com/hibiken/asynq"
 )
 
-// MockEnqueuer records enqueued tasks for assertions in tests.
+// MockEnqueuer records enqueued tasks for assertions in tests. Like asynq it
+// rejects a second pending task with the same asynq.TaskID, and it implements
+// job.TaskDeleter so that pending tasks can be deleted by ID. Tasks marked
+// with SetActive behave like running tasks and cannot be deleted.
 type MockEnqueuer struct {
-	mu    sync.Mutex
-	tasks []*asynq.Task
+	mu        sync.Mutex
+	tasks     []*asynq.Task
+	ids       map[*asynq.Task]string
+	processAt map[*asynq.Task]time.Time
+	active    map[string]bool
 }
 
-func NewMockEnqueuer() *MockEnqueuer { return &MockEnqueuer{} }
+func NewMockEnqueuer() *MockEnqueuer {
+	return &MockEnqueuer{
+		ids:       make(map[*asynq.Task]string),
+		processAt: make(map[*asynq.Task]time.Time),
+		active:    make(map[string]bool),
+	}
+}
 
-func (m *MockEnqueuer) Enqueue(t *asynq.Task, _ ...asynq.Option) (*asynq.TaskInfo, error) {
+func (m *MockEnqueuer) Enqueue(t *asynq.Task, opts ...asynq.Option) (*asynq.TaskInfo, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	var id string
+	var at time.Time
+	for _, opt := range opts {
+		switch opt.Type() {
+		case asynq.TaskIDOpt:
+			id, _ = opt.Value().(string)
+		case asynq.ProcessAtOpt:
+			at, _ = opt.Value().(time.Time)
+		}
+	}
+	if id != "" {
+		for _, existing := range m.tasks {
+			if m.ids[existing] == id {
+				return nil, asynq.ErrTaskIDConflict
+			}
+		}
+		m.ids[t] = id
+	}
+	if !at.IsZero() {
+		m.processAt[t] = at
+	}
 	m.tasks = append(m.tasks, t)
-	return &asynq.TaskInfo{Type: t.Type()}, nil
+	return &asynq.TaskInfo{ID: id, Type: t.Type(), NextProcessAt: at}, nil
+}
+
+// DeleteTask removes the pending task with the given ID. Like asynq it
+// refuses to delete an active task.
+func (m *MockEnqueuer) DeleteTask(_ string, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, t := range m.tasks {
+		if m.ids[t] == id {
+			if m.active[id] {
+				return errors.New("cannot delete task in active state")
+			}
+			m.tasks = append(m.tasks[:i], m.tasks[i+1:]...)
+			delete(m.ids, t)
+			delete(m.processAt, t)
+			return nil
+		}
+	}
+	return asynq.ErrTaskNotFound
+}
+
+// GetTaskInfo returns the task with the given ID, whose State is
+// asynq.TaskStateActive once SetActive has been called for it.
+func (m *MockEnqueuer) GetTaskInfo(queue, id string) (*asynq.TaskInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, t := range m.tasks {
+		if m.ids[t] != id {
+			continue
+		}
+		state := asynq.TaskStatePending
+		if m.active[id] {
+			state = asynq.TaskStateActive
+		} else if !m.processAt[t].IsZero() {
+			state = asynq.TaskStateScheduled
+		}
+		return &asynq.TaskInfo{ID: id, Queue: queue, Type: t.Type(), State: state, NextProcessAt: m.processAt[t]}, nil
+	}
+	return nil, asynq.ErrTaskNotFound
+}
+
+// SetActive marks the task with the given ID as running.
+func (m *MockEnqueuer) SetActive(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.active[id] = true
 }
 
 // GetTasks returns a copy of the enqueued tasks. The returned slice is a shallow
@@ -31,4 +112,12 @@ func (m *MockEnqueuer) GetTasks() []*asynq.Task {
 	return out
 }
 
+// ProcessAt returns the time t was scheduled to run at, or the zero time if
+// it was enqueued to run immediately.
+func (m *MockEnqueuer) ProcessAt(t *asynq.Task) time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.processAt[t]
+}
+
 func (m *MockEnqueuer) Close() error { return nil }
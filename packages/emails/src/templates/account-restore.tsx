@@ -0,0 +1,81 @@
+import {
+  Body,
+  Button,
+  Container,
+  Head,
+  Heading,
+  Hr,
+  Html,
+  Preview,
+  Section,
+  Text,
+  Tailwind,
+} from "@react-email/components";
+
+interface AccountRestoreProps {
+  restoreUrl: string;
+  expiresIn: string;
+}
+
+export const AccountRestore = ({
+  restoreUrl = "{{.RestoreURL}}",
+  expiresIn = "{{.ExpiresIn}}",
+}: AccountRestoreProps) => {
+  return (
+    <Html>
+      <Head />
+      <Preview>Restore your account</Preview>
+      <Tailwind>
+        <Body className="bg-gray-100 font-sans">
+          <Container className="bg-white p-8 rounded-lg shadow-sm my-10 mx-auto max-w-[600px]">
+            <Heading className="text-2xl font-bold text-gray-800 mt-4">
+              Restore your account
+            </Heading>
+
+            <Section>
+              <Text className="text-gray-700 text-base">
+                Your account was deleted recently. Use the button below to restore it with your previous email address and password. The link can be used once.
+              </Text>
+              <Text className="text-gray-700 text-base">
+                This link expires in {expiresIn}.
+              </Text>
+            </Section>
+
+            <Section className="my-8 text-center">
+              <Button
+                className="bg-orange-600 hover:bg-orange-700 text-white font-medium rounded-md px-6 py-3"
+                href={restoreUrl}
+              >
+                Restore account
+              </Button>
+            </Section>
+
+            <Hr className="border-gray-200 my-6" />
+
+            <Section>
+              <Text className="text-gray-600 text-sm">
+                If you did not request this link, you can safely ignore this email and your account stays deleted.
+              </Text>
+            </Section>
+
+            <Section className="mt-8 text-center">
+              <Text className="text-gray-500 text-xs">
+                © {new Date().getFullYear()} Alfred. All rights reserved.
+              </Text>
+              <Text className="text-gray-500 text-xs">
+                123 Project Street, Suite 100, San Francisco, CA 94103
+              </Text>
+            </Section>
+          </Container>
+        </Body>
+      </Tailwind>
+    </Html>
+  );
+};
+
+AccountRestore.PreviewProps = {
+  restoreUrl: "https://example.com/restore-account?token=abc123",
+  expiresIn: "1 hour",
+};
+
+export default AccountRestore;
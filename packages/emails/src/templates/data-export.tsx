@@ -0,0 +1,81 @@
+import {
+  Body,
+  Button,
+  Container,
+  Head,
+  Heading,
+  Hr,
+  Html,
+  Preview,
+  Section,
+  Text,
+  Tailwind,
+} from "@react-email/components";
+
+interface DataExportProps {
+  downloadUrl: string;
+  expiresIn: string;
+}
+
+export const DataExport = ({
+  downloadUrl = "{{.DownloadURL}}",
+  expiresIn = "{{.ExpiresIn}}",
+}: DataExportProps) => {
+  return (
+    <Html>
+      <Head />
+      <Preview>Your data export is ready</Preview>
+      <Tailwind>
+        <Body className="bg-gray-100 font-sans">
+          <Container className="bg-white p-8 rounded-lg shadow-sm my-10 mx-auto max-w-[600px]">
+            <Heading className="text-2xl font-bold text-gray-800 mt-4">
+              Your data export is ready
+            </Heading>
+
+            <Section>
+              <Text className="text-gray-700 text-base">
+                The archive with the data we hold about your account is ready. It contains one JSON file per kind of data.
+              </Text>
+              <Text className="text-gray-700 text-base">
+                This link expires in {expiresIn}.
+              </Text>
+            </Section>
+
+            <Section className="my-8 text-center">
+              <Button
+                className="bg-orange-600 hover:bg-orange-700 text-white font-medium rounded-md px-6 py-3"
+                href={downloadUrl}
+              >
+                Download your data
+              </Button>
+            </Section>
+
+            <Hr className="border-gray-200 my-6" />
+
+            <Section>
+              <Text className="text-gray-600 text-sm">
+                Anyone with this link can download the archive until it expires, so do not forward this email. If you did not request an export, change your password.
+              </Text>
+            </Section>
+
+            <Section className="mt-8 text-center">
+              <Text className="text-gray-500 text-xs">
+                © {new Date().getFullYear()} Alfred. All rights reserved.
+              </Text>
+              <Text className="text-gray-500 text-xs">
+                123 Project Street, Suite 100, San Francisco, CA 94103
+              </Text>
+            </Section>
+          </Container>
+        </Body>
+      </Tailwind>
+    </Html>
+  );
+};
+
+DataExport.PreviewProps = {
+  downloadUrl: "https://api.example.com/api/v1/exports/0b6f0d5e/download?expires=1735830240&signature=abc123",
+  expiresIn: "7 days",
+};
+
+export default DataExport;
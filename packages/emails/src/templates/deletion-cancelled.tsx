@@ -0,0 +1,55 @@
+import {
+  Body,
+  Container,
+  Head,
+  Heading,
+  Hr,
+  Html,
+  Preview,
+  Section,
+  Text,
+  Tailwind,
+} from "@react-email/components";
+
+export const DeletionCancelled = () => {
+  return (
+    <Html>
+      <Head />
+      <Preview>Your account deletion was cancelled</Preview>
+      <Tailwind>
+        <Body className="bg-gray-100 font-sans">
+          <Container className="bg-white p-8 rounded-lg shadow-sm my-10 mx-auto max-w-[600px]">
+            <Heading className="text-2xl font-bold text-gray-800 mt-4">
+              Your account deletion was cancelled
+            </Heading>
+
+            <Section>
+              <Text className="text-gray-700 text-base">
+                The scheduled deletion of your account has been cancelled. Your account and its data will be kept.
+              </Text>
+            </Section>
+
+            <Hr className="border-gray-200 my-6" />
+
+            <Section>
+              <Text className="text-gray-600 text-sm">
+                If you did not cancel the deletion yourself, an administrator may have done so on your behalf. Contact support if you still want your account deleted.
+              </Text>
+            </Section>
+
+            <Section className="mt-8 text-center">
+              <Text className="text-gray-500 text-xs">
+                © {new Date().getFullYear()} Alfred. All rights reserved.
+              </Text>
+              <Text className="text-gray-500 text-xs">
+                123 Project Street, Suite 100, San Francisco, CA 94103
+              </Text>
+            </Section>
+          </Container>
+        </Body>
+      </Tailwind>
+    </Html>
+  );
+};
+
+export default DeletionCancelled;
@@ -0,0 +1,68 @@
+import {
+  Body,
+  Container,
+  Head,
+  Heading,
+  Hr,
+  Html,
+  Preview,
+  Section,
+  Text,
+  Tailwind,
+} from "@react-email/components";
+
+interface DeletionScheduledProps {
+  deleteAt: string;
+}
+
+export const DeletionScheduled = ({
+  deleteAt = "{{.DeleteAt}}",
+}: DeletionScheduledProps) => {
+  return (
+    <Html>
+      <Head />
+      <Preview>Your account is scheduled for deletion</Preview>
+      <Tailwind>
+        <Body className="bg-gray-100 font-sans">
+          <Container className="bg-white p-8 rounded-lg shadow-sm my-10 mx-auto max-w-[600px]">
+            <Heading className="text-2xl font-bold text-gray-800 mt-4">
+              Your account is scheduled for deletion
+            </Heading>
+
+            <Section>
+              <Text className="text-gray-700 text-base">
+                We received a request to delete your account. It will be permanently deleted on {deleteAt}.
+              </Text>
+              <Text className="text-gray-700 text-base">
+                Until then you can cancel the deletion by signing in and cancelling it from your account settings.
+              </Text>
+            </Section>
+
+            <Hr className="border-gray-200 my-6" />
+
+            <Section>
+              <Text className="text-gray-600 text-sm">
+                If you did not request this, sign in, cancel the deletion and change your password right away.
+              </Text>
+            </Section>
+
+            <Section className="mt-8 text-center">
+              <Text className="text-gray-500 text-xs">
+                © {new Date().getFullYear()} Alfred. All rights reserved.
+              </Text>
+              <Text className="text-gray-500 text-xs">
+                123 Project Street, Suite 100, San Francisco, CA 94103
+              </Text>
+            </Section>
+          </Container>
+        </Body>
+      </Tailwind>
+    </Html>
+  );
+};
+
+DeletionScheduled.PreviewProps = {
+  deleteAt: "February 1, 2025 at 15:04 UTC",
+};
+
+export default DeletionScheduled;
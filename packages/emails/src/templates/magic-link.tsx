@@ -0,0 +1,81 @@
+import {
+  Body,
+  Button,
+  Container,
+  Head,
+  Heading,
+  Hr,
+  Html,
+  Preview,
+  Section,
+  Text,
+  Tailwind,
+} from "@react-email/components";
+
+interface MagicLinkProps {
+  loginUrl: string;
+  expiresIn: string;
+}
+
+export const MagicLink = ({
+  loginUrl = "{{.LoginURL}}",
+  expiresIn = "{{.ExpiresIn}}",
+}: MagicLinkProps) => {
+  return (
+    <Html>
+      <Head />
+      <Preview>Your sign-in link</Preview>
+      <Tailwind>
+        <Body className="bg-gray-100 font-sans">
+          <Container className="bg-white p-8 rounded-lg shadow-sm my-10 mx-auto max-w-[600px]">
+            <Heading className="text-2xl font-bold text-gray-800 mt-4">
+              Your sign-in link
+            </Heading>
+
+            <Section>
+              <Text className="text-gray-700 text-base">
+                Use the button below to sign in. The link can be used once.
+              </Text>
+              <Text className="text-gray-700 text-base">
+                This link expires in {expiresIn}.
+              </Text>
+            </Section>
+
+            <Section className="my-8 text-center">
+              <Button
+                className="bg-orange-600 hover:bg-orange-700 text-white font-medium rounded-md px-6 py-3"
+                href={loginUrl}
+              >
+                Sign in
+              </Button>
+            </Section>
+
+            <Hr className="border-gray-200 my-6" />
+
+            <Section>
+              <Text className="text-gray-600 text-sm">
+                If you did not request this link, you can safely ignore this email. Nobody can sign in without it.
+              </Text>
+            </Section>
+
+            <Section className="mt-8 text-center">
+              <Text className="text-gray-500 text-xs">
+                © {new Date().getFullYear()} Alfred. All rights reserved.
+              </Text>
+              <Text className="text-gray-500 text-xs">
+                123 Project Street, Suite 100, San Francisco, CA 94103
+              </Text>
+            </Section>
+          </Container>
+        </Body>
+      </Tailwind>
+    </Html>
+  );
+};
+
+MagicLink.PreviewProps = {
+  loginUrl: "https://example.com/magic-link?token=abc123",
+  expiresIn: "15 minutes",
+};
+
+export default MagicLink;
@@ -0,0 +1,78 @@
+import {
+  Body,
+  Container,
+  Head,
+  Heading,
+  Hr,
+  Html,
+  Preview,
+  Section,
+  Text,
+  Tailwind,
+} from "@react-email/components";
+
+interface NewSignInProps {
+  signedInAt: string;
+  ipAddress: string;
+  userAgent: string;
+}
+
+export const NewSignIn = ({
+  signedInAt = "{{.SignedInAt}}",
+  ipAddress = "{{.IPAddress}}",
+  userAgent = "{{.UserAgent}}",
+}: NewSignInProps) => {
+  return (
+    <Html>
+      <Head />
+      <Preview>New sign-in to your account</Preview>
+      <Tailwind>
+        <Body className="bg-gray-100 font-sans">
+          <Container className="bg-white p-8 rounded-lg shadow-sm my-10 mx-auto max-w-[600px]">
+            <Heading className="text-2xl font-bold text-gray-800 mt-4">
+              New sign-in to your account
+            </Heading>
+
+            <Section>
+              <Text className="text-gray-700 text-base">
+                Your account was just signed in to from a device or location we have not seen before.
+              </Text>
+              <Text className="text-gray-700 text-base">
+                Time: {signedInAt}
+                <br />
+                IP address: {ipAddress}
+                <br />
+                Device: {userAgent}
+              </Text>
+            </Section>
+
+            <Hr className="border-gray-200 my-6" />
+
+            <Section>
+              <Text className="text-gray-600 text-sm">
+                If this was you, you can ignore this email. If not, reset your password right away and review your active sessions.
+              </Text>
+            </Section>
+
+            <Section className="mt-8 text-center">
+              <Text className="text-gray-500 text-xs">
+                © {new Date().getFullYear()} Alfred. All rights reserved.
+              </Text>
+              <Text className="text-gray-500 text-xs">
+                123 Project Street, Suite 100, San Francisco, CA 94103
+              </Text>
+            </Section>
+          </Container>
+        </Body>
+      </Tailwind>
+    </Html>
+  );
+};
+
+NewSignIn.PreviewProps = {
+  signedInAt: "January 2, 2025 at 15:04 UTC",
+  ipAddress: "203.0.113.7",
+  userAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_0) Safari/605.1.15",
+};
+
+export default NewSignIn;
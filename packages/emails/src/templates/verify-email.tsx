@@ -0,0 +1,81 @@
+import {
+  Body,
+  Button,
+  Container,
+  Head,
+  Heading,
+  Hr,
+  Html,
+  Preview,
+  Section,
+  Text,
+  Tailwind,
+} from "@react-email/components";
+
+interface VerifyEmailProps {
+  verifyUrl: string;
+  expiresIn: string;
+}
+
+export const VerifyEmail = ({
+  verifyUrl = "{{.VerifyURL}}",
+  expiresIn = "{{.ExpiresIn}}",
+}: VerifyEmailProps) => {
+  return (
+    <Html>
+      <Head />
+      <Preview>Confirm your email address</Preview>
+      <Tailwind>
+        <Body className="bg-gray-100 font-sans">
+          <Container className="bg-white p-8 rounded-lg shadow-sm my-10 mx-auto max-w-[600px]">
+            <Heading className="text-2xl font-bold text-gray-800 mt-4">
+              Confirm your email address
+            </Heading>
+
+            <Section>
+              <Text className="text-gray-700 text-base">
+                Please confirm that this is your email address so we can finish setting up your account.
+              </Text>
+              <Text className="text-gray-700 text-base">
+                This link expires in {expiresIn}.
+              </Text>
+            </Section>
+
+            <Section className="my-8 text-center">
+              <Button
+                className="bg-orange-600 hover:bg-orange-700 text-white font-medium rounded-md px-6 py-3"
+                href={verifyUrl}
+              >
+                Verify email
+              </Button>
+            </Section>
+
+            <Hr className="border-gray-200 my-6" />
+
+            <Section>
+              <Text className="text-gray-600 text-sm">
+                If you did not create an account, you can safely ignore this email.
+              </Text>
+            </Section>
+
+            <Section className="mt-8 text-center">
+              <Text className="text-gray-500 text-xs">
+                © {new Date().getFullYear()} Alfred. All rights reserved.
+              </Text>
+              <Text className="text-gray-500 text-xs">
+                123 Project Street, Suite 100, San Francisco, CA 94103
+              </Text>
+            </Section>
+          </Container>
+        </Body>
+      </Tailwind>
+    </Html>
+  );
+};
+
+VerifyEmail.PreviewProps = {
+  verifyUrl: "https://example.com/verify-email?token=abc123",
+  expiresIn: "24 hours",
+};
+
+export default VerifyEmail;